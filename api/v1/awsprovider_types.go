@@ -31,6 +31,90 @@ type AWSProviderSpec struct {
 	Region         string `json:"region,omitempty"`
 	IdentityPoolID string `json:"identityPoolID,omitempty"`
 	RoleARN        string `json:"roleARN,omitempty"`
+	// CredentialsRef references static access keys of the operator
+	// (accessKeyID, secretAccessKey and optionally sessionToken keys) or a
+	// service account whose tokens assume RoleARN. The tokens of the operator
+	// service account are used when not set.
+	// +optional
+	CredentialsRef *CredentialsRef `json:"credentialsRef,omitempty"`
+	// AssumeRole is a role assumed with sts:AssumeRole from the credentials
+	// of the operator, the static access keys or RoleARN, to chain roles
+	// across accounts
+	// +optional
+	AssumeRole *AWSAssumeRoleConfig `json:"assumeRole,omitempty"`
+	// Endpoint overrides the endpoint of the STS, IAM and Cognito APIs, for
+	// instance with a local stand-in of AWS
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// Mode selects how the identities are created on AWS: Cognito creates an
+	// identity in the IdentityPoolID pool, sharing the permissions of its
+	// role; IAMRole creates an IAM role per identity.
+	// +kubebuilder:validation:Enum=Cognito;IAMRole
+	// +kubebuilder:default=Cognito
+	// +optional
+	Mode AWSProviderMode `json:"mode,omitempty"`
+	// IAMRole configures the IAM roles of the identities in IAMRole mode
+	// +optional
+	IAMRole *AWSIAMRoleConfig `json:"iamRole,omitempty"`
+	// OIDCProvider registers the service account issuer of the cluster as an
+	// IAM OpenID Connect provider kept in sync by the operator and, in Cognito
+	// mode, attaches it to the identity pool. The OpenID Connect provider is
+	// managed manually when not set.
+	// +optional
+	OIDCProvider *AWSOIDCProviderConfig `json:"oidcProvider,omitempty"`
+}
+
+// AWSOIDCProviderConfig configures the IAM OpenID Connect provider of the cluster issuer
+type AWSOIDCProviderConfig struct {
+	// ClientIDs are the audiences accepted by the OpenID Connect provider
+	// +kubebuilder:default={sts.amazonaws.com}
+	// +optional
+	ClientIDs []string `json:"clientIDs,omitempty"`
+	// Thumbprints are the SHA-1 thumbprints of the certificate authority of
+	// the issuer. Computed from the certificate chain served by the JWKS
+	// endpoint of the issuer when not set.
+	// +optional
+	Thumbprints []string `json:"thumbprints,omitempty"`
+}
+
+// AWSAssumeRoleConfig configures a role assumed by the operator
+type AWSAssumeRoleConfig struct {
+	// RoleARN is the ARN of the assumed role
+	RoleARN string `json:"roleARN"`
+	// ExternalID is the external id required by the trust policy of the role
+	// +optional
+	ExternalID string `json:"externalID,omitempty"`
+	// SessionName is the name of the role session
+	// +kubebuilder:default=aegis-operator
+	// +optional
+	SessionName string `json:"sessionName,omitempty"`
+}
+
+// AWSProviderMode is the mode of an AWS provider
+type AWSProviderMode string
+
+const (
+	// AWSProviderModeCognito creates the identities in a Cognito identity pool
+	AWSProviderModeCognito AWSProviderMode = "Cognito"
+	// AWSProviderModeIAMRole creates an IAM role per identity
+	AWSProviderModeIAMRole AWSProviderMode = "IAMRole"
+)
+
+// AWSIAMRoleConfig configures the IAM roles created for the identities
+type AWSIAMRoleConfig struct {
+	// OIDCProviderARN is the ARN of the IAM OIDC identity provider of the
+	// cluster issuer trusted by the roles. Defaults to the provider of the
+	// issuer in the account of the operator.
+	// +optional
+	OIDCProviderARN string `json:"oidcProviderARN,omitempty"`
+	// Path of the roles
+	// +kubebuilder:default=/aegis/
+	// +optional
+	Path string `json:"path,omitempty"`
+	// PermissionsBoundary is the ARN of the managed policy set as the
+	// permissions boundary of the roles
+	// +optional
+	PermissionsBoundary string `json:"permissionsBoundary,omitempty"`
 }
 
 // AWSProviderStatus defines the observed state of AWSProvider
@@ -38,6 +122,19 @@ type AWSProviderStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	ReconcileStatus       `json:",inline"`
+	ProviderHealthStatus  `json:",inline"`
+	AWSOIDCProviderStatus `json:",inline"`
+}
+
+// AWSOIDCProviderStatus reports the resources registering the cluster issuer on AWS
+type AWSOIDCProviderStatus struct {
+	// OIDCProviderARN is the ARN of the IAM OpenID Connect provider of the cluster issuer
+	OIDCProviderARN string `json:"oidcProviderARN,omitempty"`
+	// IdentityPoolARN is the ARN of the Cognito identity pool the OpenID
+	// Connect provider is attached to
+	IdentityPoolARN string `json:"identityPoolARN,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -61,6 +158,26 @@ type AWSProviderList struct {
 	Items           []AWSProvider `json:"items"`
 }
 
+// GetConditions returns the status conditions of the provider
+func (p *AWSProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *AWSProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *AWSProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
+// GetHealthStatus returns the result of the last health check of the provider
+func (p *AWSProvider) GetHealthStatus() *ProviderHealthStatus {
+	return &p.Status.ProviderHealthStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSProvider{}, &AWSProviderList{})
 }
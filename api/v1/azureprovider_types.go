@@ -31,6 +31,37 @@ type AzureProviderSpec struct {
 	Name     string `json:"name,omitempty"`
 	TenantID string `json:"tenantID,omitempty"`
 	ClientID string `json:"clientID,omitempty"`
+	// CredentialsRef references a client secret of the operator application
+	// (clientSecret key) or a service account whose tokens are used as client
+	// assertions. The tokens of the operator service account are used when not set.
+	// +optional
+	CredentialsRef *CredentialsRef `json:"credentialsRef,omitempty"`
+	// ClaimsMapping makes the operator manage a claims mapping policy adding
+	// the namespace and the name of the calling identity to the tokens issued
+	// for the identities of the provider. Disabled when not set.
+	// +optional
+	ClaimsMapping *AzureClaimsMapping `json:"claimsMapping,omitempty"`
+	// PermanentDeletion permanently deletes the applications of the deleted
+	// identities instead of leaving them in the deleted items of the
+	// directory, where they can be restored for 30 days
+	// +optional
+	PermanentDeletion bool `json:"permanentDeletion,omitempty"`
+}
+
+// AzureClaimsMapping configures the claims mapping policy managed by the operator
+type AzureClaimsMapping struct {
+	// PolicyName is the display name of the claims mapping policy
+	// +kubebuilder:default=aegis_id
+	// +optional
+	PolicyName string `json:"policyName,omitempty"`
+	// NamespaceClaim is the claim with the namespace of the calling identity
+	// +kubebuilder:default=aegis_namespace
+	// +optional
+	NamespaceClaim string `json:"namespaceClaim,omitempty"`
+	// IdentityClaim is the claim with the name of the calling identity
+	// +kubebuilder:default=aegis_identity
+	// +optional
+	IdentityClaim string `json:"identityClaim,omitempty"`
 }
 
 // AzureProviderStatus defines the observed state of AzureProvider
@@ -38,6 +69,9 @@ type AzureProviderStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	ReconcileStatus      `json:",inline"`
+	ProviderHealthStatus `json:",inline"`
 }
 
 //+kubebuilder:object:root=true
@@ -61,6 +95,26 @@ type AzureProviderList struct {
 	Items           []AzureProvider `json:"items"`
 }
 
+// GetConditions returns the status conditions of the provider
+func (p *AzureProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *AzureProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *AzureProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
+// GetHealthStatus returns the result of the last health check of the provider
+func (p *AzureProvider) GetHealthStatus() *ProviderHealthStatus {
+	return &p.Status.ProviderHealthStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AzureProvider{}, &AzureProviderList{})
 }
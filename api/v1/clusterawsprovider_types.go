@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterAWSProviderSpec defines the desired state of ClusterAWSProvider
+type ClusterAWSProviderSpec struct {
+	AWSProviderSpec `json:",inline"`
+
+	// AllowedNamespaces selects the namespaces whose identities can use the provider.
+	// All namespaces are allowed when not set.
+	AllowedNamespaces *metav1.LabelSelector `json:"allowedNamespaces,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterAWSProvider is the Schema for the clusterawsproviders API
+type ClusterAWSProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterAWSProviderSpec `json:"spec,omitempty"`
+	Status AWSProviderStatus      `json:"status,omitempty"`
+}
+
+// GetAllowedNamespaces returns the selector of the namespaces allowed to use the provider
+func (p *ClusterAWSProvider) GetAllowedNamespaces() *metav1.LabelSelector {
+	return p.Spec.AllowedNamespaces
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterAWSProviderList contains a list of ClusterAWSProvider
+type ClusterAWSProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterAWSProvider `json:"items"`
+}
+
+// GetConditions returns the status conditions of the provider
+func (p *ClusterAWSProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *ClusterAWSProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *ClusterAWSProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
+// GetHealthStatus returns the result of the last health check of the provider
+func (p *ClusterAWSProvider) GetHealthStatus() *ProviderHealthStatus {
+	return &p.Status.ProviderHealthStatus
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterAWSProvider{}, &ClusterAWSProviderList{})
+}
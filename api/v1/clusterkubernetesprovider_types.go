@@ -0,0 +1,76 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterKubernetesProviderSpec defines the desired state of ClusterKubernetesProvider
+type ClusterKubernetesProviderSpec struct {
+	KubernetesProviderSpec `json:",inline"`
+
+	// AllowedNamespaces selects the namespaces whose identities can use the provider.
+	// All namespaces are allowed when not set.
+	AllowedNamespaces *metav1.LabelSelector `json:"allowedNamespaces,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterKubernetesProvider is the Schema for the clusterkubernetesproviders API
+type ClusterKubernetesProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterKubernetesProviderSpec `json:"spec,omitempty"`
+	Status KubernetesProviderStatus      `json:"status,omitempty"`
+}
+
+// GetAllowedNamespaces returns the selector of the namespaces allowed to use the provider
+func (p *ClusterKubernetesProvider) GetAllowedNamespaces() *metav1.LabelSelector {
+	return p.Spec.AllowedNamespaces
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterKubernetesProviderList contains a list of ClusterKubernetesProvider
+type ClusterKubernetesProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterKubernetesProvider `json:"items"`
+}
+
+// GetConditions returns the status conditions of the provider
+func (p *ClusterKubernetesProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *ClusterKubernetesProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *ClusterKubernetesProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterKubernetesProvider{}, &ClusterKubernetesProviderList{})
+}
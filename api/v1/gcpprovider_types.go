@@ -0,0 +1,110 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GCPProviderSpec defines the desired state of GCPProvider
+type GCPProviderSpec struct {
+	Name string `json:"name,omitempty"`
+	// ProjectID is the id of the project hosting the service accounts of the identities
+	ProjectID string `json:"projectID"`
+	// ProjectNumber is the number of the project hosting the workload identity pool
+	ProjectNumber string `json:"projectNumber"`
+	// PoolID is the id of the workload identity pool. It is created when missing.
+	PoolID string `json:"poolID"`
+	// ProviderID is the id of the workload identity pool provider federating
+	// the cluster issuer. It is created when missing and defaults to aegis.
+	// +optional
+	ProviderID string `json:"providerID,omitempty"`
+	// AllowedAudiences are the audiences accepted by the workload identity
+	// pool provider, the first one is the default audience of the identities.
+	// When the operator exchanges its token with the same provider, the
+	// audience of the operator token (gcp) is appended.
+	// +optional
+	AllowedAudiences []string `json:"allowedAudiences,omitempty"`
+	// OperatorAudience is the full resource name of the workload identity pool
+	// provider the operator exchanges its service account token with. It
+	// defaults to the provider of the identities, which must then already exist.
+	// +optional
+	OperatorAudience string `json:"operatorAudience,omitempty"`
+	// OperatorServiceAccount is the email of the service account impersonated
+	// by the operator. The federated token is used directly when not set.
+	// +optional
+	OperatorServiceAccount string `json:"operatorServiceAccount,omitempty"`
+	// CredentialsRef references a service account whose tokens the operator
+	// exchanges on STS instead of the tokens of the operator service account.
+	// Secrets are not supported.
+	// +kubebuilder:validation:XValidation:rule="!has(self.secretName)",message="GCP providers only support service account credentials"
+	// +optional
+	CredentialsRef *CredentialsRef `json:"credentialsRef,omitempty"`
+}
+
+// GCPProviderStatus defines the observed state of GCPProvider
+type GCPProviderStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	ReconcileStatus      `json:",inline"`
+	ProviderHealthStatus `json:",inline"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// GCPProvider is the Schema for the gcpproviders API
+type GCPProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GCPProviderSpec   `json:"spec,omitempty"`
+	Status GCPProviderStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// GCPProviderList contains a list of GCPProvider
+type GCPProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GCPProvider `json:"items"`
+}
+
+// GetConditions returns the status conditions of the provider
+func (p *GCPProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *GCPProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *GCPProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
+// GetHealthStatus returns the result of the last health check of the provider
+func (p *GCPProvider) GetHealthStatus() *ProviderHealthStatus {
+	return &p.Status.ProviderHealthStatus
+}
+
+func init() {
+	SchemeBuilder.Register(&GCPProvider{}, &GCPProviderList{})
+}
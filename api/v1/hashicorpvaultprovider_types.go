@@ -36,6 +36,34 @@ type HashicorpVaultProviderSpec struct {
 
 	Name         string `json:"name,omitempty"`
 	VaultAddress string `json:"vaultAddress,omitempty"`
+
+	// VaultNamespace is the Vault Enterprise namespace of the identities
+	VaultNamespace string `json:"vaultNamespace,omitempty"`
+	// CABundleRef references the PEM encoded CA bundle used to verify the Vault server certificate
+	CABundleRef *SecretKeyRef `json:"caBundleRef,omitempty"`
+	// AuthMount is the path of the jwt auth method. Defaults to jwt.
+	AuthMount string `json:"authMount,omitempty"`
+	// OperatorRole is the jwt role the operator logs in with. Defaults to aegis.
+	OperatorRole string `json:"operatorRole,omitempty"`
+	// Policies are the policies of the jwt roles of the identities. Defaults to default and jwt_issuer.
+	Policies []string `json:"policies,omitempty"`
+	// Audience is the audience bound to the jwt roles of the identities. Defaults to vault.
+	Audience string `json:"audience,omitempty"`
+	// OIDCKey is the named key signing the identity tokens. Defaults to aegis-key.
+	OIDCKey string `json:"oidcKey,omitempty"`
+	// TokenTTL is the TTL of the identity tokens. Defaults to 1h.
+	TokenTTL string `json:"tokenTTL,omitempty"`
+	// TokenTemplate is the default template of the identity tokens. Identities can override it.
+	TokenTemplate *TokenTemplate `json:"tokenTemplate,omitempty"`
+	// CredentialsRef references an AppRole of the operator (roleID and secretID
+	// keys) or a service account whose tokens log in with OperatorRole. The
+	// tokens of the operator service account are used when not set.
+	// +optional
+	CredentialsRef *CredentialsRef `json:"credentialsRef,omitempty"`
+	// AppRoleMount is the path of the approle auth method used with AppRole
+	// credentials. Defaults to approle.
+	// +optional
+	AppRoleMount string `json:"appRoleMount,omitempty"`
 }
 
 // HashicorpVaultProviderStatus defines the observed state of HashicorpVaultProvider
@@ -43,6 +71,9 @@ type HashicorpVaultProviderStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	ReconcileStatus      `json:",inline"`
+	ProviderHealthStatus `json:",inline"`
 }
 
 //+kubebuilder:object:root=true
@@ -66,6 +97,26 @@ type HashicorpVaultProviderList struct {
 	Items           []HashicorpVaultProvider `json:"items"`
 }
 
+// GetConditions returns the status conditions of the provider
+func (p *HashicorpVaultProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *HashicorpVaultProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *HashicorpVaultProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
+// GetHealthStatus returns the result of the last health check of the provider
+func (p *HashicorpVaultProvider) GetHealthStatus() *ProviderHealthStatus {
+	return &p.Status.ProviderHealthStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&HashicorpVaultProvider{}, &HashicorpVaultProviderList{})
 }
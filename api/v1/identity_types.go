@@ -28,8 +28,71 @@ type IdentitySpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	Name     string `json:"name,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Provider is the name of the identity provider, looked up across all the
+	// provider kinds in the namespace of the identity.
+	// Deprecated: use ProviderRef, which is not ambiguous.
 	Provider string `json:"provider,omitempty"`
+	// ProviderRef references the identity provider by kind and name.
+	// When set it takes precedence over Provider.
+	ProviderRef *ProviderRef `json:"providerRef,omitempty"`
+	// TokenTTL is the lifetime of the tokens of the identity, bounded by the provider.
+	// Defaults to the provider default.
+	TokenTTL *metav1.Duration `json:"tokenTTL,omitempty"`
+	// Audiences are the audiences of the tokens of the identity. The first one is the
+	// audience of the service account token of the proxy. Defaults to the provider audience.
+	Audiences []string `json:"audiences,omitempty"`
+	// TokenTemplate is the template of the tokens issued for the identity.
+	// Only used by the Hashicorp Vault provider; overrides the template of the provider.
+	TokenTemplate *TokenTemplate `json:"tokenTemplate,omitempty"`
+	// EntityMetadata is added to the metadata of the Vault entity of the identity, where
+	// token templates can reference it as {{identity.entity.metadata.<key>}}.
+	// Keys starting with aegis_ are reserved.
+	EntityMetadata map[string]string `json:"entityMetadata,omitempty"`
+	// PolicyARNs are the ARNs of the managed policies attached to the IAM role of the identity.
+	// Only used by the AWS provider in IAMRole mode.
+	PolicyARNs []string `json:"policyARNs,omitempty"`
+	// DeletionPolicy is what happens to the identity on the identity provider
+	// when the Identity is deleted: Delete removes it, Retain keeps it, Orphan
+	// keeps it together with the service account of the identity.
+	// +kubebuilder:validation:Enum=Delete;Retain;Orphan
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// DeletionPolicy is the deletion policy of an Identity
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the identity from the identity provider
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the identity on the identity provider
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyOrphan keeps the identity on the identity provider and the
+	// service account of the identity, so that running workloads keep it
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// TokenTemplate is a Vault identity token template, set inline or read from a ConfigMap
+type TokenTemplate struct {
+	// Inline is the JSON template
+	Inline string `json:"inline,omitempty"`
+	// ConfigMapRef references the config map key holding the JSON template
+	ConfigMapRef *ConfigMapKeyRef `json:"configMapRef,omitempty"`
+}
+
+// ProviderRef references an identity provider
+type ProviderRef struct {
+	// Kind of the provider (e.g. HashicorpVaultProvider, AzureProvider)
+	//+kubebuilder:validation:MinLength=1
+	Kind string `json:"kind"`
+	// Name of the provider
+	//+kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Namespace of the provider. Namespaced providers can only be referenced
+	// from their own namespace, so when set it must be the namespace of the identity.
+	Namespace string `json:"namespace,omitempty"`
 }
 
 type IdentityRef struct {
@@ -44,6 +107,8 @@ type IdentityStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 	Provider   string             `json:"provider,omitempty"`
 	Metadata   map[string]string  `json:"metadata,omitempty"`
+
+	ReconcileStatus `json:",inline"`
 }
 
 //+kubebuilder:object:root=true
@@ -35,6 +35,14 @@ type IngressPolicySpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Rules []Rule `json:"rules,omitempty"`
+
+	// Identity is the name of the Identity, in the namespace of the policy,
+	// of the workloads protected by the policy. When its provider supports it
+	// (e.g. Azure), the identities of the rules are granted access to it on the
+	// identity provider, which then refuses to issue tokens for it to any other
+	// caller.
+	// +optional
+	Identity string `json:"identity,omitempty"`
 }
 
 // IngressPolicyStatus defines the observed state of IngressPolicy
@@ -42,6 +50,13 @@ type IngressPolicyStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Identity is the identity whose access was last granted on the identity
+	// provider, so that the access is revoked when spec.identity changes
+	// +optional
+	Identity string `json:"identity,omitempty"`
+
+	ReconcileStatus `json:",inline"`
 }
 
 //+kubebuilder:object:root=true
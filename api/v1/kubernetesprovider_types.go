@@ -28,6 +28,35 @@ type KubernetesProviderSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Name string `json:"name,omitempty"`
+	// Remote describes a remote cluster whose service account tokens the
+	// proxies accept. The tokens of the local cluster are accepted when not set.
+	// +optional
+	Remote *KubernetesRemoteCluster `json:"remote,omitempty"`
+}
+
+// KubernetesRemoteCluster describes the issuer of the service account tokens of a remote cluster
+// +kubebuilder:validation:XValidation:rule="has(self.issuer) || has(self.kubeconfigSecretRef)",message="issuer or kubeconfigSecretRef must be set"
+// +kubebuilder:validation:XValidation:rule="!(has(self.jwks) && has(self.jwksURI))",message="jwks and jwksURI are mutually exclusive"
+type KubernetesRemoteCluster struct {
+	// Issuer is the service account issuer of the remote cluster. Read from
+	// the discovery document of its API server when not set.
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+	// JWKSURI is the URI of the JSON web key set of the issuer. Read from the
+	// discovery document of the issuer when not set.
+	// +optional
+	JWKSURI string `json:"jwksURI,omitempty"`
+	// JWKS is the JSON web key set of the issuer, used instead of fetching it
+	// +optional
+	JWKS string `json:"jwks,omitempty"`
+	// KubeconfigSecretRef references a kubeconfig of the remote cluster. The
+	// issuer and its key set are then read from its API server.
+	// +optional
+	KubeconfigSecretRef *SecretKeyRef `json:"kubeconfigSecretRef,omitempty"`
+	// RefreshInterval is the delay between two fetches of the key set
+	// +kubebuilder:default="1h"
+	// +optional
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
 }
 
 // KubernetesProviderStatus defines the observed state of KubernetesProvider
@@ -36,6 +65,19 @@ type KubernetesProviderStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 	Issuer     string             `json:"issuer,omitempty"`
+	// JWKS is the JSON web key set of the issuer of the remote cluster
+	JWKS string `json:"jwks,omitempty"`
+	// KeyIDs are the ids of the keys of the key set of the issuer
+	KeyIDs []string `json:"keyIDs,omitempty"`
+	// JWKSHash is the SHA-256 hash of the key set of the issuer
+	JWKSHash string `json:"jwksHash,omitempty"`
+	// JWKSConfigMap is the ConfigMap the key set is mirrored into, mounted
+	// into the proxies validating the tokens of the issuer
+	JWKSConfigMap string `json:"jwksConfigMap,omitempty"`
+	// KeySetUpdateTime is the last time the key set changed
+	KeySetUpdateTime *metav1.Time `json:"keySetUpdateTime,omitempty"`
+
+	ReconcileStatus `json:",inline"`
 }
 
 //+kubebuilder:object:root=true
@@ -59,6 +101,21 @@ type KubernetesProviderList struct {
 	Items           []KubernetesProvider `json:"items"`
 }
 
+// GetConditions returns the status conditions of the provider
+func (p *KubernetesProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *KubernetesProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *KubernetesProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&KubernetesProvider{}, &KubernetesProviderList{})
 }
@@ -0,0 +1,108 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OIDCProviderSpec defines the desired state of OIDCProvider
+type OIDCProviderSpec struct {
+	Name string `json:"name,omitempty"`
+	// IssuerURL is the issuer of the IdP (e.g. https://keycloak.example.com/realms/aegis)
+	//+kubebuilder:validation:MinLength=1
+	IssuerURL string `json:"issuerURL"`
+	// AdminAPI is the type of the admin API of the IdP
+	//+kubebuilder:validation:Enum=keycloak
+	//+kubebuilder:default=keycloak
+	AdminAPI string `json:"adminAPI,omitempty"`
+	// AdminURL is the base URL of the admin API. It is derived from the issuer when not set.
+	// +optional
+	AdminURL string `json:"adminURL,omitempty"`
+	// ClientID is the id of the client the operator authenticates with
+	//+kubebuilder:validation:MinLength=1
+	ClientID string `json:"clientID"`
+	// ClientSecretRef references the secret of the client the operator authenticates with
+	ClientSecretRef SecretKeyRef `json:"clientSecretRef"`
+	// CABundleRef references a secret key holding the PEM encoded CA bundle
+	// verifying the IdP certificate
+	// +optional
+	CABundleRef *SecretKeyRef `json:"caBundleRef,omitempty"`
+	// TrustAlias is the alias of the cluster issuer on the IdP. Defaults to kubernetes.
+	// +optional
+	TrustAlias string `json:"trustAlias,omitempty"`
+	// ClusterJWKSURL is the URL the IdP fetches the keys of the cluster issuer
+	// from. Defaults to the keys endpoint of the issuer.
+	// +optional
+	ClusterJWKSURL string `json:"clusterJWKSURL,omitempty"`
+	// Audience is the audience of the service account tokens exchanged on the IdP. Defaults to aegis.
+	// +optional
+	Audience string `json:"audience,omitempty"`
+}
+
+// OIDCProviderStatus defines the observed state of OIDCProvider
+type OIDCProviderStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	ReconcileStatus      `json:",inline"`
+	ProviderHealthStatus `json:",inline"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// OIDCProvider is the Schema for the oidcproviders API
+type OIDCProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OIDCProviderSpec   `json:"spec,omitempty"`
+	Status OIDCProviderStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// OIDCProviderList contains a list of OIDCProvider
+type OIDCProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OIDCProvider `json:"items"`
+}
+
+// GetConditions returns the status conditions of the provider
+func (p *OIDCProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *OIDCProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *OIDCProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
+// GetHealthStatus returns the result of the last health check of the provider
+func (p *OIDCProvider) GetHealthStatus() *ProviderHealthStatus {
+	return &p.Status.ProviderHealthStatus
+}
+
+func init() {
+	SchemeBuilder.Register(&OIDCProvider{}, &OIDCProviderList{})
+}
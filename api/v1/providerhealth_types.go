@@ -0,0 +1,29 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProviderHealthStatus is the result of the last connectivity check of an identity provider
+type ProviderHealthStatus struct {
+	// LastSuccessfulCheckTime is the time of the last successful connectivity check
+	LastSuccessfulCheckTime *metav1.Time `json:"lastSuccessfulCheckTime,omitempty"`
+	// BackendVersion is the version reported by the backend, when available
+	BackendVersion string `json:"backendVersion,omitempty"`
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReconcileStatus tracks the failed reconciliation attempts of an object,
+// used to back off before retrying.
+type ReconcileStatus struct {
+	// LastAttemptTime is the time of the last failed reconciliation attempt
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+	// LastAttemptGeneration is the generation of the object at the last failed
+	// reconciliation attempt. A newer generation is reconciled without backoff.
+	LastAttemptGeneration int64 `json:"lastAttemptGeneration,omitempty"`
+	// ConsecutiveFailures is the number of failed reconciliation attempts since the last success
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+}
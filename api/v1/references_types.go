@@ -0,0 +1,61 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// SecretKeyRef references a key of a Secret
+type SecretKeyRef struct {
+	// Name of the secret
+	//+kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Namespace of the secret. Defaults to the namespace of the provider, the
+	// only one namespaced providers can reference; required for cluster scoped providers.
+	Namespace string `json:"namespace,omitempty"`
+	// Key of the secret data
+	//+kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
+// ConfigMapKeyRef references a key of a ConfigMap
+type ConfigMapKeyRef struct {
+	// Name of the config map
+	//+kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Namespace of the config map. Defaults to the namespace of the referencing object,
+	// the only one namespaced objects can reference; required for cluster scoped providers.
+	Namespace string `json:"namespace,omitempty"`
+	// Key of the config map data
+	//+kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
+// CredentialsRef references the credentials the operator authenticates to the
+// IdP with, instead of the tokens of the operator service account.
+// Exactly one of secretName and serviceAccountName must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.secretName) != has(self.serviceAccountName)",message="exactly one of secretName and serviceAccountName must be set"
+type CredentialsRef struct {
+	// SecretName is the name of a secret with static credentials. Its keys
+	// depend on the provider: clientSecret for Azure, roleID and secretID for a
+	// Vault AppRole, accessKeyID, secretAccessKey and optionally sessionToken for AWS.
+	SecretName string `json:"secretName,omitempty"`
+	// ServiceAccountName is the name of a service account whose tokens, issued
+	// with the TokenRequest API for the audience of the provider, authenticate the operator
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// Namespace of the secret or the service account. Defaults to the namespace
+	// of the provider, the only one namespaced providers can reference; required
+	// for cluster scoped providers.
+	Namespace string `json:"namespace,omitempty"`
+}
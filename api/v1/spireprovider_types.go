@@ -0,0 +1,102 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SPIREProviderSpec defines the desired state of SPIREProvider
+type SPIREProviderSpec struct {
+	Name string `json:"name,omitempty"`
+	// TrustDomain is the SPIFFE trust domain of the SPIRE server
+	//+kubebuilder:validation:MinLength=1
+	TrustDomain string `json:"trustDomain"`
+	// ParentID is the SPIFFE ID of the agents the registration entries of the
+	// identities are bound to (e.g. spiffe://example.org/spire/agent/k8s_psat/cluster)
+	//+kubebuilder:validation:MinLength=1
+	ParentID string `json:"parentID"`
+	// ServerSocketPath is the path of the admin API socket of the SPIRE
+	// server, mounted into the operator. Defaults to /tmp/spire-server/private/api.sock.
+	// +optional
+	ServerSocketPath string `json:"serverSocketPath,omitempty"`
+	// AgentSocketPath is the host path of the Workload API socket of the
+	// SPIRE agents. Defaults to /run/spire/agent-sockets/spire-agent.sock.
+	// +optional
+	AgentSocketPath string `json:"agentSocketPath,omitempty"`
+	// CSIDriver is the name of the SPIFFE CSI driver (e.g. csi.spiffe.io)
+	// mounting the Workload API socket. The socket directory is mounted from
+	// the host when not set.
+	// +optional
+	CSIDriver string `json:"csiDriver,omitempty"`
+	// Audience is the default audience of the JWT-SVIDs. Defaults to aegis.
+	// +optional
+	Audience string `json:"audience,omitempty"`
+}
+
+// SPIREProviderStatus defines the observed state of SPIREProvider
+type SPIREProviderStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	ReconcileStatus      `json:",inline"`
+	ProviderHealthStatus `json:",inline"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// SPIREProvider is the Schema for the spireproviders API
+type SPIREProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SPIREProviderSpec   `json:"spec,omitempty"`
+	Status SPIREProviderStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SPIREProviderList contains a list of SPIREProvider
+type SPIREProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SPIREProvider `json:"items"`
+}
+
+// GetConditions returns the status conditions of the provider
+func (p *SPIREProvider) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+// StatusConditions returns a pointer to the status conditions of the provider, for updates
+func (p *SPIREProvider) StatusConditions() *[]metav1.Condition {
+	return &p.Status.Conditions
+}
+
+// GetReconcileStatus returns the failed reconciliation attempts of the provider
+func (p *SPIREProvider) GetReconcileStatus() *ReconcileStatus {
+	return &p.Status.ReconcileStatus
+}
+
+// GetHealthStatus returns the result of the last health check of the provider
+func (p *SPIREProvider) GetHealthStatus() *ProviderHealthStatus {
+	return &p.Status.ProviderHealthStatus
+}
+
+func init() {
+	SchemeBuilder.Register(&SPIREProvider{}, &SPIREProviderList{})
+}
@@ -25,12 +25,82 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWSAssumeRoleConfig) DeepCopyInto(out *AWSAssumeRoleConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSAssumeRoleConfig.
+func (in *AWSAssumeRoleConfig) DeepCopy() *AWSAssumeRoleConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AWSAssumeRoleConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWSIAMRoleConfig) DeepCopyInto(out *AWSIAMRoleConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSIAMRoleConfig.
+func (in *AWSIAMRoleConfig) DeepCopy() *AWSIAMRoleConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AWSIAMRoleConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWSOIDCProviderConfig) DeepCopyInto(out *AWSOIDCProviderConfig) {
+	*out = *in
+	if in.ClientIDs != nil {
+		in, out := &in.ClientIDs, &out.ClientIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Thumbprints != nil {
+		in, out := &in.Thumbprints, &out.Thumbprints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSOIDCProviderConfig.
+func (in *AWSOIDCProviderConfig) DeepCopy() *AWSOIDCProviderConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AWSOIDCProviderConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWSOIDCProviderStatus) DeepCopyInto(out *AWSOIDCProviderStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSOIDCProviderStatus.
+func (in *AWSOIDCProviderStatus) DeepCopy() *AWSOIDCProviderStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AWSOIDCProviderStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AWSProvider) DeepCopyInto(out *AWSProvider) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -87,6 +157,26 @@ func (in *AWSProviderList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AWSProviderSpec) DeepCopyInto(out *AWSProviderSpec) {
 	*out = *in
+	if in.CredentialsRef != nil {
+		in, out := &in.CredentialsRef, &out.CredentialsRef
+		*out = new(CredentialsRef)
+		**out = **in
+	}
+	if in.AssumeRole != nil {
+		in, out := &in.AssumeRole, &out.AssumeRole
+		*out = new(AWSAssumeRoleConfig)
+		**out = **in
+	}
+	if in.IAMRole != nil {
+		in, out := &in.IAMRole, &out.IAMRole
+		*out = new(AWSIAMRoleConfig)
+		**out = **in
+	}
+	if in.OIDCProvider != nil {
+		in, out := &in.OIDCProvider, &out.OIDCProvider
+		*out = new(AWSOIDCProviderConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSProviderSpec.
@@ -109,6 +199,9 @@ func (in *AWSProviderStatus) DeepCopyInto(out *AWSProviderStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+	in.ProviderHealthStatus.DeepCopyInto(&out.ProviderHealthStatus)
+	out.AWSOIDCProviderStatus = in.AWSOIDCProviderStatus
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSProviderStatus.
@@ -121,12 +214,27 @@ func (in *AWSProviderStatus) DeepCopy() *AWSProviderStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureClaimsMapping) DeepCopyInto(out *AzureClaimsMapping) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureClaimsMapping.
+func (in *AzureClaimsMapping) DeepCopy() *AzureClaimsMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureClaimsMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AzureProvider) DeepCopyInto(out *AzureProvider) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -183,6 +291,16 @@ func (in *AzureProviderList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AzureProviderSpec) DeepCopyInto(out *AzureProviderSpec) {
 	*out = *in
+	if in.CredentialsRef != nil {
+		in, out := &in.CredentialsRef, &out.CredentialsRef
+		*out = new(CredentialsRef)
+		**out = **in
+	}
+	if in.ClaimsMapping != nil {
+		in, out := &in.ClaimsMapping, &out.ClaimsMapping
+		*out = new(AzureClaimsMapping)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureProviderSpec.
@@ -205,6 +323,8 @@ func (in *AzureProviderStatus) DeepCopyInto(out *AzureProviderStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+	in.ProviderHealthStatus.DeepCopyInto(&out.ProviderHealthStatus)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureProviderStatus.
@@ -218,26 +338,26 @@ func (in *AzureProviderStatus) DeepCopy() *AzureProviderStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *HashicorpVaultProvider) DeepCopyInto(out *HashicorpVaultProvider) {
+func (in *ClusterAWSProvider) DeepCopyInto(out *ClusterAWSProvider) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashicorpVaultProvider.
-func (in *HashicorpVaultProvider) DeepCopy() *HashicorpVaultProvider {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAWSProvider.
+func (in *ClusterAWSProvider) DeepCopy() *ClusterAWSProvider {
 	if in == nil {
 		return nil
 	}
-	out := new(HashicorpVaultProvider)
+	out := new(ClusterAWSProvider)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *HashicorpVaultProvider) DeepCopyObject() runtime.Object {
+func (in *ClusterAWSProvider) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -245,31 +365,31 @@ func (in *HashicorpVaultProvider) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *HashicorpVaultProviderList) DeepCopyInto(out *HashicorpVaultProviderList) {
+func (in *ClusterAWSProviderList) DeepCopyInto(out *ClusterAWSProviderList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]HashicorpVaultProvider, len(*in))
+		*out = make([]ClusterAWSProvider, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashicorpVaultProviderList.
-func (in *HashicorpVaultProviderList) DeepCopy() *HashicorpVaultProviderList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAWSProviderList.
+func (in *ClusterAWSProviderList) DeepCopy() *ClusterAWSProviderList {
 	if in == nil {
 		return nil
 	}
-	out := new(HashicorpVaultProviderList)
+	out := new(ClusterAWSProviderList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *HashicorpVaultProviderList) DeepCopyObject() runtime.Object {
+func (in *ClusterAWSProviderList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -277,63 +397,47 @@ func (in *HashicorpVaultProviderList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *HashicorpVaultProviderSpec) DeepCopyInto(out *HashicorpVaultProviderSpec) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashicorpVaultProviderSpec.
-func (in *HashicorpVaultProviderSpec) DeepCopy() *HashicorpVaultProviderSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(HashicorpVaultProviderSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *HashicorpVaultProviderStatus) DeepCopyInto(out *HashicorpVaultProviderStatus) {
+func (in *ClusterAWSProviderSpec) DeepCopyInto(out *ClusterAWSProviderSpec) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]metav1.Condition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	in.AWSProviderSpec.DeepCopyInto(&out.AWSProviderSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashicorpVaultProviderStatus.
-func (in *HashicorpVaultProviderStatus) DeepCopy() *HashicorpVaultProviderStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAWSProviderSpec.
+func (in *ClusterAWSProviderSpec) DeepCopy() *ClusterAWSProviderSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(HashicorpVaultProviderStatus)
+	out := new(ClusterAWSProviderSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Identity) DeepCopyInto(out *Identity) {
+func (in *ClusterAzureProvider) DeepCopyInto(out *ClusterAzureProvider) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Identity.
-func (in *Identity) DeepCopy() *Identity {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAzureProvider.
+func (in *ClusterAzureProvider) DeepCopy() *ClusterAzureProvider {
 	if in == nil {
 		return nil
 	}
-	out := new(Identity)
+	out := new(ClusterAzureProvider)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *Identity) DeepCopyObject() runtime.Object {
+func (in *ClusterAzureProvider) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -341,31 +445,31 @@ func (in *Identity) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IdentityList) DeepCopyInto(out *IdentityList) {
+func (in *ClusterAzureProviderList) DeepCopyInto(out *ClusterAzureProviderList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]Identity, len(*in))
+		*out = make([]ClusterAzureProvider, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityList.
-func (in *IdentityList) DeepCopy() *IdentityList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAzureProviderList.
+func (in *ClusterAzureProviderList) DeepCopy() *ClusterAzureProviderList {
 	if in == nil {
 		return nil
 	}
-	out := new(IdentityList)
+	out := new(ClusterAzureProviderList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *IdentityList) DeepCopyObject() runtime.Object {
+func (in *ClusterAzureProviderList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -373,66 +477,108 @@ func (in *IdentityList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IdentityRef) DeepCopyInto(out *IdentityRef) {
+func (in *ClusterAzureProviderSpec) DeepCopyInto(out *ClusterAzureProviderSpec) {
 	*out = *in
+	in.AzureProviderSpec.DeepCopyInto(&out.AzureProviderSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityRef.
-func (in *IdentityRef) DeepCopy() *IdentityRef {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAzureProviderSpec.
+func (in *ClusterAzureProviderSpec) DeepCopy() *ClusterAzureProviderSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(IdentityRef)
+	out := new(ClusterAzureProviderSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IdentitySpec) DeepCopyInto(out *IdentitySpec) {
+func (in *ClusterGCPProvider) DeepCopyInto(out *ClusterGCPProvider) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentitySpec.
-func (in *IdentitySpec) DeepCopy() *IdentitySpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGCPProvider.
+func (in *ClusterGCPProvider) DeepCopy() *ClusterGCPProvider {
 	if in == nil {
 		return nil
 	}
-	out := new(IdentitySpec)
+	out := new(ClusterGCPProvider)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterGCPProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IdentityStatus) DeepCopyInto(out *IdentityStatus) {
+func (in *ClusterGCPProviderList) DeepCopyInto(out *ClusterGCPProviderList) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]metav1.Condition, len(*in))
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterGCPProvider, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
-	if in.Metadata != nil {
-		in, out := &in.Metadata, &out.Metadata
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGCPProviderList.
+func (in *ClusterGCPProviderList) DeepCopy() *ClusterGCPProviderList {
+	if in == nil {
+		return nil
 	}
+	out := new(ClusterGCPProviderList)
+	in.DeepCopyInto(out)
+	return out
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityStatus.
-func (in *IdentityStatus) DeepCopy() *IdentityStatus {
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterGCPProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGCPProviderSpec) DeepCopyInto(out *ClusterGCPProviderSpec) {
+	*out = *in
+	in.GCPProviderSpec.DeepCopyInto(&out.GCPProviderSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGCPProviderSpec.
+func (in *ClusterGCPProviderSpec) DeepCopy() *ClusterGCPProviderSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(IdentityStatus)
+	out := new(ClusterGCPProviderSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IngressPolicy) DeepCopyInto(out *IngressPolicy) {
+func (in *ClusterHashicorpVaultProvider) DeepCopyInto(out *ClusterHashicorpVaultProvider) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
@@ -440,18 +586,18 @@ func (in *IngressPolicy) DeepCopyInto(out *IngressPolicy) {
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicy.
-func (in *IngressPolicy) DeepCopy() *IngressPolicy {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterHashicorpVaultProvider.
+func (in *ClusterHashicorpVaultProvider) DeepCopy() *ClusterHashicorpVaultProvider {
 	if in == nil {
 		return nil
 	}
-	out := new(IngressPolicy)
+	out := new(ClusterHashicorpVaultProvider)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *IngressPolicy) DeepCopyObject() runtime.Object {
+func (in *ClusterHashicorpVaultProvider) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -459,31 +605,31 @@ func (in *IngressPolicy) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IngressPolicyList) DeepCopyInto(out *IngressPolicyList) {
+func (in *ClusterHashicorpVaultProviderList) DeepCopyInto(out *ClusterHashicorpVaultProviderList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]IngressPolicy, len(*in))
+		*out = make([]ClusterHashicorpVaultProvider, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicyList.
-func (in *IngressPolicyList) DeepCopy() *IngressPolicyList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterHashicorpVaultProviderList.
+func (in *ClusterHashicorpVaultProviderList) DeepCopy() *ClusterHashicorpVaultProviderList {
 	if in == nil {
 		return nil
 	}
-	out := new(IngressPolicyList)
+	out := new(ClusterHashicorpVaultProviderList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *IngressPolicyList) DeepCopyObject() runtime.Object {
+func (in *ClusterHashicorpVaultProviderList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -491,70 +637,47 @@ func (in *IngressPolicyList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IngressPolicySpec) DeepCopyInto(out *IngressPolicySpec) {
-	*out = *in
-	if in.Rules != nil {
-		in, out := &in.Rules, &out.Rules
-		*out = make([]Rule, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicySpec.
-func (in *IngressPolicySpec) DeepCopy() *IngressPolicySpec {
-	if in == nil {
-		return nil
-	}
-	out := new(IngressPolicySpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IngressPolicyStatus) DeepCopyInto(out *IngressPolicyStatus) {
+func (in *ClusterHashicorpVaultProviderSpec) DeepCopyInto(out *ClusterHashicorpVaultProviderSpec) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]metav1.Condition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	in.HashicorpVaultProviderSpec.DeepCopyInto(&out.HashicorpVaultProviderSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicyStatus.
-func (in *IngressPolicyStatus) DeepCopy() *IngressPolicyStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterHashicorpVaultProviderSpec.
+func (in *ClusterHashicorpVaultProviderSpec) DeepCopy() *ClusterHashicorpVaultProviderSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(IngressPolicyStatus)
+	out := new(ClusterHashicorpVaultProviderSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KubernetesProvider) DeepCopyInto(out *KubernetesProvider) {
+func (in *ClusterKubernetesProvider) DeepCopyInto(out *ClusterKubernetesProvider) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesProvider.
-func (in *KubernetesProvider) DeepCopy() *KubernetesProvider {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterKubernetesProvider.
+func (in *ClusterKubernetesProvider) DeepCopy() *ClusterKubernetesProvider {
 	if in == nil {
 		return nil
 	}
-	out := new(KubernetesProvider)
+	out := new(ClusterKubernetesProvider)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *KubernetesProvider) DeepCopyObject() runtime.Object {
+func (in *ClusterKubernetesProvider) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -562,31 +685,31 @@ func (in *KubernetesProvider) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KubernetesProviderList) DeepCopyInto(out *KubernetesProviderList) {
+func (in *ClusterKubernetesProviderList) DeepCopyInto(out *ClusterKubernetesProviderList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]KubernetesProvider, len(*in))
+		*out = make([]ClusterKubernetesProvider, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesProviderList.
-func (in *KubernetesProviderList) DeepCopy() *KubernetesProviderList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterKubernetesProviderList.
+func (in *ClusterKubernetesProviderList) DeepCopy() *ClusterKubernetesProviderList {
 	if in == nil {
 		return nil
 	}
-	out := new(KubernetesProviderList)
+	out := new(ClusterKubernetesProviderList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *KubernetesProviderList) DeepCopyObject() runtime.Object {
+func (in *ClusterKubernetesProviderList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -594,45 +717,993 @@ func (in *KubernetesProviderList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KubernetesProviderSpec) DeepCopyInto(out *KubernetesProviderSpec) {
+func (in *ClusterKubernetesProviderSpec) DeepCopyInto(out *ClusterKubernetesProviderSpec) {
 	*out = *in
+	in.KubernetesProviderSpec.DeepCopyInto(&out.KubernetesProviderSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesProviderSpec.
-func (in *KubernetesProviderSpec) DeepCopy() *KubernetesProviderSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterKubernetesProviderSpec.
+func (in *ClusterKubernetesProviderSpec) DeepCopy() *ClusterKubernetesProviderSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(KubernetesProviderSpec)
+	out := new(ClusterKubernetesProviderSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KubernetesProviderStatus) DeepCopyInto(out *KubernetesProviderStatus) {
+func (in *ClusterOIDCProvider) DeepCopyInto(out *ClusterOIDCProvider) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]metav1.Condition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesProviderStatus.
-func (in *KubernetesProviderStatus) DeepCopy() *KubernetesProviderStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOIDCProvider.
+func (in *ClusterOIDCProvider) DeepCopy() *ClusterOIDCProvider {
 	if in == nil {
 		return nil
 	}
-	out := new(KubernetesProviderStatus)
+	out := new(ClusterOIDCProvider)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Rule) DeepCopyInto(out *Rule) {
-	*out = *in
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterOIDCProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOIDCProviderList) DeepCopyInto(out *ClusterOIDCProviderList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterOIDCProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOIDCProviderList.
+func (in *ClusterOIDCProviderList) DeepCopy() *ClusterOIDCProviderList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOIDCProviderList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterOIDCProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOIDCProviderSpec) DeepCopyInto(out *ClusterOIDCProviderSpec) {
+	*out = *in
+	in.OIDCProviderSpec.DeepCopyInto(&out.OIDCProviderSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOIDCProviderSpec.
+func (in *ClusterOIDCProviderSpec) DeepCopy() *ClusterOIDCProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOIDCProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSPIREProvider) DeepCopyInto(out *ClusterSPIREProvider) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIREProvider.
+func (in *ClusterSPIREProvider) DeepCopy() *ClusterSPIREProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSPIREProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterSPIREProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSPIREProviderList) DeepCopyInto(out *ClusterSPIREProviderList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterSPIREProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIREProviderList.
+func (in *ClusterSPIREProviderList) DeepCopy() *ClusterSPIREProviderList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSPIREProviderList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterSPIREProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSPIREProviderSpec) DeepCopyInto(out *ClusterSPIREProviderSpec) {
+	*out = *in
+	out.SPIREProviderSpec = in.SPIREProviderSpec
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSPIREProviderSpec.
+func (in *ClusterSPIREProviderSpec) DeepCopy() *ClusterSPIREProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSPIREProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapKeyRef) DeepCopyInto(out *ConfigMapKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapKeyRef.
+func (in *ConfigMapKeyRef) DeepCopy() *ConfigMapKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsRef) DeepCopyInto(out *CredentialsRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsRef.
+func (in *CredentialsRef) DeepCopy() *CredentialsRef {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPProvider) DeepCopyInto(out *GCPProvider) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPProvider.
+func (in *GCPProvider) DeepCopy() *GCPProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GCPProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPProviderList) DeepCopyInto(out *GCPProviderList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]GCPProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPProviderList.
+func (in *GCPProviderList) DeepCopy() *GCPProviderList {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPProviderList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *GCPProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPProviderSpec) DeepCopyInto(out *GCPProviderSpec) {
+	*out = *in
+	if in.AllowedAudiences != nil {
+		in, out := &in.AllowedAudiences, &out.AllowedAudiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CredentialsRef != nil {
+		in, out := &in.CredentialsRef, &out.CredentialsRef
+		*out = new(CredentialsRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPProviderSpec.
+func (in *GCPProviderSpec) DeepCopy() *GCPProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPProviderStatus) DeepCopyInto(out *GCPProviderStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+	in.ProviderHealthStatus.DeepCopyInto(&out.ProviderHealthStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPProviderStatus.
+func (in *GCPProviderStatus) DeepCopy() *GCPProviderStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPProviderStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashicorpVaultProvider) DeepCopyInto(out *HashicorpVaultProvider) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashicorpVaultProvider.
+func (in *HashicorpVaultProvider) DeepCopy() *HashicorpVaultProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(HashicorpVaultProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *HashicorpVaultProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashicorpVaultProviderList) DeepCopyInto(out *HashicorpVaultProviderList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]HashicorpVaultProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashicorpVaultProviderList.
+func (in *HashicorpVaultProviderList) DeepCopy() *HashicorpVaultProviderList {
+	if in == nil {
+		return nil
+	}
+	out := new(HashicorpVaultProviderList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *HashicorpVaultProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashicorpVaultProviderSpec) DeepCopyInto(out *HashicorpVaultProviderSpec) {
+	*out = *in
+	if in.CABundleRef != nil {
+		in, out := &in.CABundleRef, &out.CABundleRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TokenTemplate != nil {
+		in, out := &in.TokenTemplate, &out.TokenTemplate
+		*out = new(TokenTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialsRef != nil {
+		in, out := &in.CredentialsRef, &out.CredentialsRef
+		*out = new(CredentialsRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashicorpVaultProviderSpec.
+func (in *HashicorpVaultProviderSpec) DeepCopy() *HashicorpVaultProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HashicorpVaultProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashicorpVaultProviderStatus) DeepCopyInto(out *HashicorpVaultProviderStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+	in.ProviderHealthStatus.DeepCopyInto(&out.ProviderHealthStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashicorpVaultProviderStatus.
+func (in *HashicorpVaultProviderStatus) DeepCopy() *HashicorpVaultProviderStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HashicorpVaultProviderStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Identity) DeepCopyInto(out *Identity) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Identity.
+func (in *Identity) DeepCopy() *Identity {
+	if in == nil {
+		return nil
+	}
+	out := new(Identity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Identity) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentityList) DeepCopyInto(out *IdentityList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Identity, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityList.
+func (in *IdentityList) DeepCopy() *IdentityList {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentityList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IdentityList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentityRef) DeepCopyInto(out *IdentityRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityRef.
+func (in *IdentityRef) DeepCopy() *IdentityRef {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentityRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentitySpec) DeepCopyInto(out *IdentitySpec) {
+	*out = *in
+	if in.ProviderRef != nil {
+		in, out := &in.ProviderRef, &out.ProviderRef
+		*out = new(ProviderRef)
+		**out = **in
+	}
+	if in.TokenTTL != nil {
+		in, out := &in.TokenTTL, &out.TokenTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TokenTemplate != nil {
+		in, out := &in.TokenTemplate, &out.TokenTemplate
+		*out = new(TokenTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EntityMetadata != nil {
+		in, out := &in.EntityMetadata, &out.EntityMetadata
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PolicyARNs != nil {
+		in, out := &in.PolicyARNs, &out.PolicyARNs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentitySpec.
+func (in *IdentitySpec) DeepCopy() *IdentitySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentitySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentityStatus) DeepCopyInto(out *IdentityStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityStatus.
+func (in *IdentityStatus) DeepCopy() *IdentityStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentityStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressPolicy) DeepCopyInto(out *IngressPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicy.
+func (in *IngressPolicy) DeepCopy() *IngressPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IngressPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressPolicyList) DeepCopyInto(out *IngressPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IngressPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicyList.
+func (in *IngressPolicyList) DeepCopy() *IngressPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IngressPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressPolicySpec) DeepCopyInto(out *IngressPolicySpec) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]Rule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicySpec.
+func (in *IngressPolicySpec) DeepCopy() *IngressPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressPolicyStatus) DeepCopyInto(out *IngressPolicyStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicyStatus.
+func (in *IngressPolicyStatus) DeepCopy() *IngressPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressPolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesProvider) DeepCopyInto(out *KubernetesProvider) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesProvider.
+func (in *KubernetesProvider) DeepCopy() *KubernetesProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubernetesProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesProviderList) DeepCopyInto(out *KubernetesProviderList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KubernetesProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesProviderList.
+func (in *KubernetesProviderList) DeepCopy() *KubernetesProviderList {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesProviderList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubernetesProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesProviderSpec) DeepCopyInto(out *KubernetesProviderSpec) {
+	*out = *in
+	if in.Remote != nil {
+		in, out := &in.Remote, &out.Remote
+		*out = new(KubernetesRemoteCluster)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesProviderSpec.
+func (in *KubernetesProviderSpec) DeepCopy() *KubernetesProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesProviderStatus) DeepCopyInto(out *KubernetesProviderStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.KeyIDs != nil {
+		in, out := &in.KeyIDs, &out.KeyIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KeySetUpdateTime != nil {
+		in, out := &in.KeySetUpdateTime, &out.KeySetUpdateTime
+		*out = (*in).DeepCopy()
+	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesProviderStatus.
+func (in *KubernetesProviderStatus) DeepCopy() *KubernetesProviderStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesProviderStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesRemoteCluster) DeepCopyInto(out *KubernetesRemoteCluster) {
+	*out = *in
+	if in.KubeconfigSecretRef != nil {
+		in, out := &in.KubeconfigSecretRef, &out.KubeconfigSecretRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.RefreshInterval != nil {
+		in, out := &in.RefreshInterval, &out.RefreshInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesRemoteCluster.
+func (in *KubernetesRemoteCluster) DeepCopy() *KubernetesRemoteCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesRemoteCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCProvider) DeepCopyInto(out *OIDCProvider) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCProvider.
+func (in *OIDCProvider) DeepCopy() *OIDCProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OIDCProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCProviderList) DeepCopyInto(out *OIDCProviderList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]OIDCProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCProviderList.
+func (in *OIDCProviderList) DeepCopy() *OIDCProviderList {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCProviderList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OIDCProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCProviderSpec) DeepCopyInto(out *OIDCProviderSpec) {
+	*out = *in
+	out.ClientSecretRef = in.ClientSecretRef
+	if in.CABundleRef != nil {
+		in, out := &in.CABundleRef, &out.CABundleRef
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCProviderSpec.
+func (in *OIDCProviderSpec) DeepCopy() *OIDCProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCProviderStatus) DeepCopyInto(out *OIDCProviderStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+	in.ProviderHealthStatus.DeepCopyInto(&out.ProviderHealthStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCProviderStatus.
+func (in *OIDCProviderStatus) DeepCopy() *OIDCProviderStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCProviderStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderHealthStatus) DeepCopyInto(out *ProviderHealthStatus) {
+	*out = *in
+	if in.LastSuccessfulCheckTime != nil {
+		in, out := &in.LastSuccessfulCheckTime, &out.LastSuccessfulCheckTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderHealthStatus.
+func (in *ProviderHealthStatus) DeepCopy() *ProviderHealthStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderHealthStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderRef) DeepCopyInto(out *ProviderRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderRef.
+func (in *ProviderRef) DeepCopy() *ProviderRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcileStatus) DeepCopyInto(out *ReconcileStatus) {
+	*out = *in
+	if in.LastAttemptTime != nil {
+		in, out := &in.LastAttemptTime, &out.LastAttemptTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcileStatus.
+func (in *ReconcileStatus) DeepCopy() *ReconcileStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcileStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Rule) DeepCopyInto(out *Rule) {
+	*out = *in
 	if in.Paths != nil {
 		in, out := &in.Paths, &out.Paths
 		*out = make([]string, len(*in))
@@ -659,3 +1730,136 @@ func (in *Rule) DeepCopy() *Rule {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIREProvider) DeepCopyInto(out *SPIREProvider) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIREProvider.
+func (in *SPIREProvider) DeepCopy() *SPIREProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIREProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIREProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIREProviderList) DeepCopyInto(out *SPIREProviderList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SPIREProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIREProviderList.
+func (in *SPIREProviderList) DeepCopy() *SPIREProviderList {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIREProviderList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIREProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIREProviderSpec) DeepCopyInto(out *SPIREProviderSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIREProviderSpec.
+func (in *SPIREProviderSpec) DeepCopy() *SPIREProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIREProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIREProviderStatus) DeepCopyInto(out *SPIREProviderStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.ReconcileStatus.DeepCopyInto(&out.ReconcileStatus)
+	in.ProviderHealthStatus.DeepCopyInto(&out.ProviderHealthStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIREProviderStatus.
+func (in *SPIREProviderStatus) DeepCopy() *SPIREProviderStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIREProviderStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyRef) DeepCopyInto(out *SecretKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyRef.
+func (in *SecretKeyRef) DeepCopy() *SecretKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenTemplate) DeepCopyInto(out *TokenTemplate) {
+	*out = *in
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(ConfigMapKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenTemplate.
+func (in *TokenTemplate) DeepCopy() *TokenTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -20,6 +20,7 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -36,6 +37,9 @@ import (
 
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
 	"github.com/vmarchese/aegis-operator/internal/controller"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"github.com/vmarchese/aegis-operator/internal/identity/k8stoken"
+	"github.com/vmarchese/aegis-operator/internal/logging"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -57,6 +61,17 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var identityResyncInterval time.Duration
+	var providerResyncInterval time.Duration
+	var ingressPolicyResyncInterval time.Duration
+	var baseBackoff time.Duration
+	var maxBackoff time.Duration
+	var maxConcurrentReconciles int
+	var rateLimiterQPS float64
+	var rateLimiterBurst int
+	var operatorNamespace string
+	var operatorServiceAccount string
+	var logProviderCalls bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -66,13 +81,37 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.DurationVar(&identityResyncInterval, "identity-resync-interval", controller.DefaultIdentityResyncInterval,
+		"How often identities are reconciled and checked for drift on the identity provider. 0 disables the resync.")
+	flag.DurationVar(&providerResyncInterval, "provider-resync-interval", controller.DefaultProviderResyncInterval,
+		"How often identity providers are reconciled. 0 disables the resync.")
+	flag.DurationVar(&ingressPolicyResyncInterval, "ingresspolicy-resync-interval", controller.DefaultIngressPolicyResyncInterval,
+		"How often ingress policies are reconciled. 0 disables the resync.")
+	flag.DurationVar(&baseBackoff, "reconcile-base-backoff", controller.DefaultBaseBackoff,
+		"The delay before retrying a failed reconciliation, doubled on each consecutive failure.")
+	flag.DurationVar(&maxBackoff, "reconcile-max-backoff", controller.DefaultMaxBackoff,
+		"The maximum delay before retrying a failed reconciliation.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The maximum number of concurrent reconciles per controller.")
+	flag.Float64Var(&rateLimiterQPS, "rate-limiter-qps", 0,
+		"The overall rate of reconciles per controller. 0 uses the controller-runtime default rate limiter.")
+	flag.IntVar(&rateLimiterBurst, "rate-limiter-burst", 100,
+		"The burst of the controller rate limiter. Only used if rate-limiter-qps is set.")
+	flag.StringVar(&operatorNamespace, "operator-namespace", os.Getenv("OPERATOR_NAMESPACE"),
+		"The namespace of the operator service account, whose tokens authenticate the providers without credentials.")
+	flag.StringVar(&operatorServiceAccount, "operator-service-account", os.Getenv("OPERATOR_SERVICE_ACCOUNT"),
+		"The name of the operator service account, whose tokens authenticate the providers without credentials.")
+	flag.BoolVar(&logProviderCalls, "log-provider-calls", false,
+		"If set, the requests to the identity provider APIs and their responses are logged, with the secrets redacted.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	// the secrets are redacted from the logs of the manager and of all the loggers derived from it
+	ctrl.SetLogger(logging.NewRedactingLogger(zap.New(zap.UseFlagOptions(&opts))))
+	logging.SetProviderCallLogging(logProviderCalls)
 
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
@@ -122,34 +161,51 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.IdentityReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Identity")
+	if err := k8stoken.Setup(mgr.GetConfig(), mgr.GetClient(), operatorNamespace, operatorServiceAccount); err != nil {
+		setupLog.Error(err, "unable to set up the operator tokens")
 		os.Exit(1)
 	}
-	if err = (&controller.AzureProviderReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "AzureProvider")
-		os.Exit(1)
+	// secrets are read from the API server, not watched
+	idp.SetSecretReader(mgr.GetAPIReader())
+	if operatorNamespace == "" || operatorServiceAccount == "" {
+		setupLog.Info("operator service account not set, providers without credentials use the tokens mounted into the operator")
 	}
-	if err = (&controller.AWSProviderReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "AWSProvider")
-		os.Exit(1)
+
+	reconcileOptions := func(resyncInterval time.Duration) controller.ReconcileOptions {
+		return controller.ReconcileOptions{
+			ResyncInterval:          resyncInterval,
+			BaseBackoff:             baseBackoff,
+			MaxBackoff:              maxBackoff,
+			MaxConcurrentReconciles: maxConcurrentReconciles,
+			RateLimiterQPS:          rateLimiterQPS,
+			RateLimiterBurst:        rateLimiterBurst,
+		}
 	}
-	if err = (&controller.HashicorpVaultProviderReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+
+	if err = (&controller.IdentityReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Options: reconcileOptions(identityResyncInterval),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "HashicorpVaultProvider")
+		setupLog.Error(err, "unable to create controller", "controller", "Identity")
 		os.Exit(1)
 	}
+	for _, provider := range idp.Providers() {
+		for _, kind := range []string{provider.Kind, provider.ClusterKind} {
+			if kind == "" {
+				continue
+			}
+			if err = (&controller.ProviderReconciler{
+				Client:  mgr.GetClient(),
+				Scheme:  mgr.GetScheme(),
+				Options: reconcileOptions(providerResyncInterval),
+				Kind:    kind,
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", kind)
+				os.Exit(1)
+			}
+		}
+	}
 	if err = (&controller.PodWebhook{
 		Scheme: mgr.GetScheme(),
 	}).SetupWebhookWithManager(mgr); err != nil {
@@ -157,19 +213,13 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controller.IngressPolicyReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Options: reconcileOptions(ingressPolicyResyncInterval),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "IngressPolicy")
 		os.Exit(1)
 	}
-	if err = (&controller.KubernetesProviderReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "KubernetesProvider")
-		os.Exit(1)
-	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
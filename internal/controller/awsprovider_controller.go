@@ -18,152 +18,94 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
 )
 
 const (
-	awsProviderFinalizerName = "idprovider.aegis.aegisproxy.io"
-	typeAvailableAWSProvider = "Available"
+	// typeOIDCProviderReadyAWSProvider reports whether the OpenID Connect provider of the cluster issuer is in sync
+	typeOIDCProviderReadyAWSProvider = "OIDCProviderReady"
 )
 
-// AWSProviderReconciler reconciles a AWSProvider object
-type AWSProviderReconciler struct {
-	client.Client
-	Scheme *runtime.Scheme
-}
-
-//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=awsproviders,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=awsproviders/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=awsproviders/finalizers,verbs=update
-
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the AWSProvider object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.3/pkg/reconcile
-func (r *AWSProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-
-	log := log.FromContext(ctx)
-
-	// Log the request details
-	log.Info("Reconciling AWSProvider", "name", req.Name, "namespace", req.Namespace)
-	// Fetch the Identity object
-	awsIAM := &aegisv1.AWSProvider{}
-	err := r.Get(ctx, req.NamespacedName, awsIAM)
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			log.Info("AWSProvider resource not found. Ignoring since object must be deleted")
-			return ctrl.Result{}, nil
+// awsProviderExtension registers the cluster issuer on AWS
+var awsProviderExtension = providerExtension{
+	sync: func(ctx context.Context, r *ProviderReconciler, kind string, obj providerObject) (ctrl.Result, error) {
+		var spec *aegisv1.AWSProviderSpec
+		var status *aegisv1.AWSProviderStatus
+		switch p := obj.(type) {
+		case *aegisv1.AWSProvider:
+			spec, status = &p.Spec, &p.Status
+		case *aegisv1.ClusterAWSProvider:
+			spec, status = &p.Spec.AWSProviderSpec, &p.Status
+		default:
+			return ctrl.Result{}, fmt.Errorf("unexpected %s object %T", kind, obj)
 		}
-		log.Error(err, "unable to fetch AWSProvider")
-		return ctrl.Result{}, err
-	}
-
-	if !awsIAM.ObjectMeta.DeletionTimestamp.IsZero() {
-		log.Info("AWSProvider is being deleted")
-		// delete all identities
-		// List all identities with matching provider label
-		identityList := &aegisv1.IdentityList{}
-		if err := r.List(ctx, identityList, client.MatchingLabels{
-			"aegis.aegisproxy.io/identity.provider": awsIAM.Name,
-		}); err != nil {
-			log.Error(err, "Failed to list identities")
+		if err := bootstrapAWSOIDCProvider(ctx, r.Client, kind, obj, spec, status); err != nil {
+			log.FromContext(ctx).Error(err, kind+" OpenID Connect provider bootstrap failed")
 			return ctrl.Result{}, err
 		}
-
-		// Delete each identity
-		for _, identity := range identityList.Items {
-			log.Info("Deleting identity", "identity", identity.Name)
-			if err := r.Delete(ctx, &identity); err != nil {
-				log.Error(err, "Failed to delete identity", "identity", identity.Name)
-				return ctrl.Result{}, err
-			}
-		}
-		// check for deletion
-		for _, identity := range identityList.Items {
-			idObj := &aegisv1.Identity{}
-			if err := r.Get(ctx, types.NamespacedName{Name: identity.Name, Namespace: identity.Namespace}, idObj); err == nil {
-				log.Error(err, "identity not deleted", "identity", identity.Name)
-				return ctrl.Result{Requeue: true}, nil
-			}
-		}
-
-		// now delete the vault provider finalizer
-		if controllerutil.ContainsFinalizer(awsIAM, awsProviderFinalizerName) {
-			log.Info("Deleting AWSProvider finalizer")
-			updated := controllerutil.RemoveFinalizer(awsIAM, awsProviderFinalizerName)
-			if !updated {
-				return ctrl.Result{}, err
-			}
-			if err := r.Update(ctx, awsIAM); err != nil {
-				log.Error(err, "Failed to update AWSProvider to remove finalizer")
-				return ctrl.Result{}, err
-			}
-		}
 		return ctrl.Result{}, nil
-	}
+	},
+}
 
-	if len(awsIAM.Status.Conditions) == 0 {
-		meta.SetStatusCondition(&awsIAM.Status.Conditions,
-			metav1.Condition{Type: typeAvailableAWSProvider,
-				Status:  metav1.ConditionUnknown,
-				Reason:  "Reconciling",
-				Message: "Starting reconciliation"})
-		if err = r.Status().Update(ctx, awsIAM); err != nil {
-			log.Error(err, "Failed to update AWSProvider status to Reconciling")
-			return ctrl.Result{}, err
-		}
+// oidcProviderBootstrapper is implemented by the AWS identity helpers
+type oidcProviderBootstrapper interface {
+	BootstrapOIDCProvider(ctx context.Context) (aegisv1.AWSOIDCProviderStatus, error)
+}
 
-		if err := r.Get(ctx, req.NamespacedName, awsIAM); err != nil {
-			log.Error(err, "Failed to re-fetch AWSProvider")
-			return ctrl.Result{}, err
-		}
+// bootstrapAWSOIDCProvider creates or updates the IAM OpenID Connect provider
+// of the cluster issuer when spec manages it and records the result in the
+// OIDCProviderReady condition and the ARNs of status. The error is returned so
+// that failed bootstraps are retried with backoff.
+func bootstrapAWSOIDCProvider(ctx context.Context, c client.Client, kind string, obj client.Object, spec *aegisv1.AWSProviderSpec, status *aegisv1.AWSProviderStatus) error {
+	log := log.FromContext(ctx)
+
+	if spec.OIDCProvider == nil {
+		meta.RemoveStatusCondition(&status.Conditions, typeOIDCProviderReadyAWSProvider)
+		status.AWSOIDCProviderStatus = aegisv1.AWSOIDCProviderStatus{}
+		return nil
 	}
 
-	// appending finalizer
-	if !controllerutil.ContainsFinalizer(awsIAM, awsProviderFinalizerName) {
-		updated := controllerutil.AddFinalizer(awsIAM, awsProviderFinalizerName)
-		if !updated {
-			log.Error(err, "Failed to update AWSProvider with finalizer")
-			return ctrl.Result{}, err
+	result, err := func() (aegisv1.AWSOIDCProviderStatus, error) {
+		provider, ok := idp.Lookup(kind)
+		if !ok {
+			return aegisv1.AWSOIDCProviderStatus{}, fmt.Errorf("unknown identity provider kind %s", kind)
 		}
-		if err := r.Update(ctx, awsIAM); err != nil {
-			log.Error(err, "Failed to update AWSProvider to add finalizer")
-			return ctrl.Result{}, err
+		idHelper, err := provider.New(ctx, c, obj)
+		if err != nil {
+			return aegisv1.AWSOIDCProviderStatus{}, err
 		}
-		return ctrl.Result{Requeue: true}, nil
-	}
-	meta.SetStatusCondition(&awsIAM.Status.Conditions,
-		metav1.Condition{Type: typeAvailableAWSProvider,
-			Status:  metav1.ConditionTrue,
-			Reason:  "Reconciled",
-			Message: "AWSProvider reconciled"})
-	if err := r.Status().Update(ctx, awsIAM); err != nil {
-		log.Error(err, "Failed to update AWSProvider status to Reconciled")
-		return ctrl.Result{}, err
+		bootstrapper, ok := idHelper.(oidcProviderBootstrapper)
+		if !ok {
+			return aegisv1.AWSOIDCProviderStatus{}, fmt.Errorf("%s %s cannot manage an OpenID Connect provider", kind, obj.GetName())
+		}
+		log.Info("Bootstrapping OpenID Connect provider", "kind", kind, "provider", obj.GetName())
+		return bootstrapper.BootstrapOIDCProvider(ctx)
+	}()
+	if err != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    typeOIDCProviderReadyAWSProvider,
+			Status:  metav1.ConditionFalse,
+			Reason:  "BootstrapFailed",
+			Message: err.Error(),
+		})
+		return err
 	}
 
-	return ctrl.Result{}, nil
-}
-
-// SetupWithManager sets up the controller with the Manager.
-func (r *AWSProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&aegisv1.AWSProvider{}).
-		Complete(r)
+	status.AWSOIDCProviderStatus = result
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    typeOIDCProviderReadyAWSProvider,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Bootstrapped",
+		Message: fmt.Sprintf("OpenID Connect provider %s in sync", result.OIDCProviderARN),
+	})
+	return nil
 }
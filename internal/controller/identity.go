@@ -2,13 +2,191 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	// identity backends register themselves in the provider registry
+	_ "github.com/vmarchese/aegis-operator/internal/identity/aws"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/azure"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/gcp"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/hashicorpvault"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/kubernetes"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/oidc"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/spire"
+)
+
+const (
+	labelIdentityProvider     = "aegis.aegisproxy.io/identity.provider"
+	labelIdentityProviderKind = "aegis.aegisproxy.io/identity.provider.kind"
 )
 
-type IdentityHelper interface {
-	CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (map[string]string, error)
-	GetIdentity(ctx context.Context, identity *aegisv1.Identity) (bool, error)
-	DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) error
-	GetName() string
+// IdentityHelper is implemented by the identity backends registered in the
+// provider registry.
+type IdentityHelper = idp.IdentityHelper
+
+// providerMatch is a provider object together with its registry entry
+type providerMatch struct {
+	provider idp.Provider
+	object   client.Object
+}
+
+// kind returns the kind of the provider object, namespaced or cluster scoped
+func (m providerMatch) kind() string {
+	if m.object.GetNamespace() == "" && m.provider.ClusterKind != "" {
+		return m.provider.ClusterKind
+	}
+	return m.provider.Kind
+}
+
+// clusterProvider is implemented by the cluster scoped provider CRDs
+type clusterProvider interface {
+	GetAllowedNamespaces() *metav1.LabelSelector
+}
+
+// findProvidersByName looks up providerName across all the registered provider
+// kinds and returns every match, in the precedence order of the registry.
+// Namespaced providers in namespace are looked up first; cluster scoped
+// providers are only considered when no namespaced provider matches, and only
+// if they allow namespace.
+func findProvidersByName(ctx context.Context, c client.Client, namespace, providerName string) ([]providerMatch, error) {
+	matches := []providerMatch{}
+	for _, provider := range idp.Providers() {
+		obj := provider.NewObject()
+		err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: providerName}, obj)
+		if err == nil {
+			matches = append(matches, providerMatch{provider: provider, object: obj})
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	if len(matches) > 0 {
+		return matches, nil
+	}
+
+	var notAllowed error
+	for _, provider := range idp.Providers() {
+		if provider.ClusterKind == "" {
+			continue
+		}
+		obj := provider.NewClusterObject()
+		err := c.Get(ctx, client.ObjectKey{Name: providerName}, obj)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := checkNamespaceAllowed(ctx, c, provider.ClusterKind, obj, namespace); err != nil {
+			notAllowed = err
+			continue
+		}
+		matches = append(matches, providerMatch{provider: provider, object: obj})
+	}
+	if len(matches) == 0 {
+		if notAllowed != nil {
+			return nil, notAllowed
+		}
+		return nil, &providerNotFoundError{name: providerName, namespace: namespace}
+	}
+	return matches, nil
+}
+
+// providerNotFoundError reports that no provider named name is usable from namespace
+type providerNotFoundError struct {
+	name      string
+	namespace string
+}
+
+func (e *providerNotFoundError) Error() string {
+	return fmt.Sprintf("identity provider %s not found in namespace %s", e.name, e.namespace)
+}
+
+// isProviderNotFound reports whether err is returned by findIdentityProvider
+// for a provider that does not exist
+func isProviderNotFound(err error) bool {
+	var notFound *providerNotFoundError
+	return errors.As(err, &notFound) || apierrors.IsNotFound(err)
+}
+
+// getProviderByRef fetches the provider referenced by ref from namespace.
+// Namespaced providers can only be referenced from their own namespace; only
+// cluster scoped providers, gated by their allowed namespaces, are shared.
+func getProviderByRef(ctx context.Context, c client.Client, ref *aegisv1.ProviderRef, namespace string) (providerMatch, error) {
+	provider, ok := idp.Lookup(ref.Kind)
+	if !ok {
+		return providerMatch{}, fmt.Errorf("unknown identity provider kind %s", ref.Kind)
+	}
+	obj := provider.NewObjectForKind(ref.Kind)
+
+	if provider.IsClusterKind(ref.Kind) {
+		if err := c.Get(ctx, client.ObjectKey{Name: ref.Name}, obj); err != nil {
+			return providerMatch{}, fmt.Errorf("failed to get %s %s: %w", ref.Kind, ref.Name, err)
+		}
+		if err := checkNamespaceAllowed(ctx, c, ref.Kind, obj, namespace); err != nil {
+			return providerMatch{}, err
+		}
+		return providerMatch{provider: provider, object: obj}, nil
+	}
+
+	if ref.Namespace != "" && ref.Namespace != namespace {
+		return providerMatch{}, fmt.Errorf("%s %s/%s cannot be referenced from namespace %s", ref.Kind, ref.Namespace, ref.Name, namespace)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, obj); err != nil {
+		return providerMatch{}, fmt.Errorf("failed to get %s %s/%s: %w", ref.Kind, namespace, ref.Name, err)
+	}
+	return providerMatch{provider: provider, object: obj}, nil
+}
+
+// checkNamespaceAllowed verifies that the cluster scoped provider obj can be used from namespace
+func checkNamespaceAllowed(ctx context.Context, c client.Client, kind string, obj client.Object, namespace string) error {
+	cp, ok := obj.(clusterProvider)
+	if !ok || cp.GetAllowedNamespaces() == nil {
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(cp.GetAllowedNamespaces())
+	if err != nil {
+		return fmt.Errorf("invalid allowedNamespaces on %s %s: %w", kind, obj.GetName(), err)
+	}
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return err
+	}
+	if !selector.Matches(labels.Set(ns.Labels)) {
+		return fmt.Errorf("%s %s does not allow namespace %s", kind, obj.GetName(), namespace)
+	}
+	return nil
+}
+
+// findIdentityProvider resolves the provider of an identity. The typed
+// providerRef wins; the deprecated provider name is looked up across all
+// kinds and the first match is used. All the kinds matching the name are
+// returned so that callers can report ambiguous names.
+func findIdentityProvider(ctx context.Context, c client.Client, identity *aegisv1.Identity) (providerMatch, []string, error) {
+	if identity.Spec.ProviderRef != nil {
+		match, err := getProviderByRef(ctx, c, identity.Spec.ProviderRef, identity.Namespace)
+		return match, nil, err
+	}
+	if identity.Spec.Provider == "" {
+		return providerMatch{}, nil, fmt.Errorf("identity %s has no provider", identity.Name)
+	}
+
+	matches, err := findProvidersByName(ctx, c, identity.Namespace, identity.Spec.Provider)
+	if err != nil {
+		return providerMatch{}, nil, err
+	}
+	kinds := make([]string, 0, len(matches))
+	for _, match := range matches {
+		kinds = append(kinds, match.kind())
+	}
+	return matches[0], kinds, nil
 }
@@ -19,6 +19,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -26,30 +27,28 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
-	"github.com/vmarchese/aegis-operator/internal/identity/aws"
-	"github.com/vmarchese/aegis-operator/internal/identity/azure"
-	"github.com/vmarchese/aegis-operator/internal/identity/hashicorpvault"
-	kubeidp "github.com/vmarchese/aegis-operator/internal/identity/kubernetes"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
 )
 
 const (
-	typeAvailableIdentity = "Available"
-	identityFinalizerName = "identity.aegis.aegisproxy.io"
-	roleName              = "ingresspolicy-viewer-role"
+	typeAvailableIdentity         = "Available"
+	typeProviderAmbiguousIdentity = "ProviderAmbiguous"
+	typeSyncedIdentity            = "Synced"
+	identityFinalizerName         = "identity.aegis.aegisproxy.io"
+	roleName                      = "ingresspolicy-viewer-role"
 )
 
 // IdentityReconciler reconciles a Identity object
 type IdentityReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme  *runtime.Scheme
+	Options ReconcileOptions
 }
 
 //+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=identities,verbs=get;list;watch;create;update;patch;delete
@@ -71,12 +70,18 @@ type IdentityReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.3/pkg/reconcile
 func (r *IdentityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	identity := &aegisv1.Identity{}
+	return r.Options.reconcile(ctx, r.Client, req, identity, &identity.Status.ReconcileStatus, func() (ctrl.Result, error) {
+		return r.reconcile(ctx, req, identity)
+	})
+}
+
+func (r *IdentityReconciler) reconcile(ctx context.Context, req ctrl.Request, identity *aegisv1.Identity) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
 	// Log the request details
 	log.Info("Reconciling Identity", "name", req.Name, "namespace", req.Namespace, "request", req)
 	// Fetch the Identity object
-	identity := &aegisv1.Identity{}
 	if err := r.Get(ctx, req.NamespacedName, identity); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Info("identity resource not found. Ignoring since object must be deleted")
@@ -86,36 +91,21 @@ func (r *IdentityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	idProvider, err := r.findProvider(ctx, req, identity.Spec.Provider)
+	// check deletion timestamp
+	if !identity.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.deleteIdentity(ctx, identity)
+	}
+
+	providerMatch, providerKinds, err := findIdentityProvider(ctx, r.Client, identity)
 	if err != nil {
 		log.Error(err, "Failed to find provider")
 		return ctrl.Result{}, err
 	}
-
-	// check deletion timestamp
-	if !identity.ObjectMeta.DeletionTimestamp.IsZero() {
-		log.Info("identity is being deleted", "identity", identity.Name, "idProvider", idProvider.GetName())
-		err = idProvider.DeleteIdentity(ctx, identity)
-		if err != nil {
-			log.Error(err, "Failed to delete identity on identity provider")
-			return ctrl.Result{}, err
-		}
-
-		if controllerutil.ContainsFinalizer(identity, identityFinalizerName) {
-			updated := controllerutil.RemoveFinalizer(identity, identityFinalizerName)
-			if !updated {
-				log.Error(err, "Failed to update Identity to remove finalizer")
-				return ctrl.Result{}, err
-			}
-			if err := r.Update(ctx, identity); err != nil {
-				log.Error(err, "Failed to update Identity to remove finalizer")
-				return ctrl.Result{}, err
-			}
-		}
-
-		log.Info("identity deleted", "identity", identity.Name)
-
-		return ctrl.Result{}, nil
+	log.Info("provider found", "kind", providerMatch.kind(), "provider", providerMatch.object.GetName())
+	idProvider, err := providerMatch.provider.New(ctx, r.Client, providerMatch.object)
+	if err != nil {
+		log.Error(err, "Failed to create identity helper")
+		return ctrl.Result{}, err
 	}
 
 	// set status to reconciling if not set
@@ -148,6 +138,14 @@ func (r *IdentityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 	meta.SetStatusCondition(&identity.Status.Conditions,
 		metav1.Condition{Type: typeAvailableIdentity, Status: metav1.ConditionTrue, Reason: "Reconciled", Message: "Identity reconciled"})
+	if len(providerKinds) > 1 {
+		meta.SetStatusCondition(&identity.Status.Conditions,
+			metav1.Condition{Type: typeProviderAmbiguousIdentity, Status: metav1.ConditionTrue, Reason: "AmbiguousProviderName",
+				Message: fmt.Sprintf("provider %s matches kinds %s, using %s: set spec.providerRef to select one",
+					identity.Spec.Provider, strings.Join(providerKinds, ", "), providerMatch.kind())})
+	} else {
+		meta.RemoveStatusCondition(&identity.Status.Conditions, typeProviderAmbiguousIdentity)
+	}
 	identity.Status.Provider = idProvider.GetName()
 	if err := r.Status().Update(ctx, identity); err != nil {
 		log.Error(err, "Failed to update Identity status")
@@ -180,21 +178,41 @@ func (r *IdentityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	idmeta, err := idProvider.CreateIdentity(ctx, identity)
+	// token lifetime and audiences must be within the bounds of the provider
+	if _, err := idp.GetTokenOptions(idProvider, identity); err != nil {
+		log.Error(err, "Invalid token options")
+		meta.SetStatusCondition(&identity.Status.Conditions,
+			metav1.Condition{Type: typeSyncedIdentity, Status: metav1.ConditionFalse, Reason: "InvalidTokenOptions", Message: err.Error()})
+		if err := r.Status().Update(ctx, identity); err != nil {
+			log.Error(err, "Failed to update Identity status")
+		}
+		return ctrl.Result{}, err
+	}
+
+	idmeta, syncReason, err := r.syncIdentity(ctx, idProvider, identity)
 	if err != nil {
-		log.Error(err, "Failed to create identity on identity provider")
+		log.Error(err, "Failed to sync identity on identity provider")
+		meta.SetStatusCondition(&identity.Status.Conditions,
+			metav1.Condition{Type: typeSyncedIdentity, Status: metav1.ConditionFalse, Reason: "SyncFailed", Message: err.Error()})
+		if err := r.Status().Update(ctx, identity); err != nil {
+			log.Error(err, "Failed to update Identity status")
+		}
 		return ctrl.Result{}, err
 	}
 
 	// add labels
-	identity.ObjectMeta.Labels = map[string]string{
-		"aegis.aegisproxy.io/identity.provider": identity.Spec.Provider,
+	if identity.ObjectMeta.Labels == nil {
+		identity.ObjectMeta.Labels = map[string]string{}
 	}
+	identity.ObjectMeta.Labels[labelIdentityProvider] = providerMatch.object.GetName()
+	identity.ObjectMeta.Labels[labelIdentityProviderKind] = providerMatch.kind()
 	if err := r.Update(ctx, identity); err != nil {
 		log.Error(err, "Failed to update Identity labels")
 		return ctrl.Result{}, err
 	}
 	identity.Status.Metadata = idmeta
+	meta.SetStatusCondition(&identity.Status.Conditions,
+		metav1.Condition{Type: typeSyncedIdentity, Status: metav1.ConditionTrue, Reason: syncReason, Message: syncMessages[syncReason]})
 	if err := r.Status().Update(ctx, identity); err != nil {
 		log.Error(err, "Failed to update Identity status")
 		return ctrl.Result{}, err
@@ -204,6 +222,107 @@ func (r *IdentityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	return ctrl.Result{}, nil
 }
 
+// deleteIdentity deletes the identity from its provider unless its deletion
+// policy retains it, then removes the finalizer. The Orphan policy also keeps
+// the service account of the identity.
+func (r *IdentityReconciler) deleteIdentity(ctx context.Context, identity *aegisv1.Identity) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(identity, identityFinalizerName) {
+		return ctrl.Result{}, nil
+	}
+
+	switch identity.Spec.DeletionPolicy {
+	case aegisv1.DeletionPolicyRetain, aegisv1.DeletionPolicyOrphan:
+		// the provider is not needed, it can be deleted already
+		log.Info("identity is being deleted, retaining it on identity provider", "identity", identity.Name, "deletionPolicy", identity.Spec.DeletionPolicy)
+	default:
+		providerMatch, _, err := findIdentityProvider(ctx, r.Client, identity)
+		if err != nil {
+			log.Error(err, "Failed to find provider")
+			return ctrl.Result{}, err
+		}
+		idProvider, err := providerMatch.provider.New(ctx, r.Client, providerMatch.object)
+		if err != nil {
+			log.Error(err, "Failed to create identity helper")
+			return ctrl.Result{}, err
+		}
+		log.Info("identity is being deleted", "identity", identity.Name, "idProvider", idProvider.GetName())
+		if err := idProvider.DeleteIdentity(ctx, identity); err != nil {
+			log.Error(err, "Failed to delete identity on identity provider")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if identity.Spec.DeletionPolicy == aegisv1.DeletionPolicyOrphan {
+		if err := r.orphanServiceAccount(ctx, identity); err != nil {
+			log.Error(err, "Failed to orphan service account")
+			return ctrl.Result{}, err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(identity, identityFinalizerName)
+	if err := r.Update(ctx, identity); err != nil {
+		log.Error(err, "Failed to update Identity to remove finalizer")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("identity deleted", "identity", identity.Name)
+	return ctrl.Result{}, nil
+}
+
+// orphanServiceAccount removes the owner reference of the service account of
+// the identity, so that it is not garbage collected with the identity
+func (r *IdentityReconciler) orphanServiceAccount(ctx context.Context, identity *aegisv1.Identity) error {
+	serviceAccount := &corev1.ServiceAccount{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: identity.Namespace, Name: identity.Name}, serviceAccount); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	owners := []metav1.OwnerReference{}
+	for _, owner := range serviceAccount.OwnerReferences {
+		if owner.UID != identity.UID {
+			owners = append(owners, owner)
+		}
+	}
+	if len(owners) == len(serviceAccount.OwnerReferences) {
+		return nil
+	}
+	serviceAccount.OwnerReferences = owners
+	return r.Update(ctx, serviceAccount)
+}
+
+var syncMessages = map[string]string{
+	"Created":   "Identity created on the identity provider",
+	"InSync":    "Identity in sync with the identity provider",
+	"Recreated": "Identity drifted on the identity provider and has been recreated",
+}
+
+// syncIdentity checks the identity on the provider and (re)creates it when it
+// is missing or does not match the spec. It returns the identity metadata and
+// the reason of the Synced condition.
+func (r *IdentityReconciler) syncIdentity(ctx context.Context, idProvider IdentityHelper, identity *aegisv1.Identity) (map[string]string, string, error) {
+	log := log.FromContext(ctx)
+
+	exists, err := idProvider.GetIdentity(ctx, identity)
+	if err != nil {
+		return nil, "", err
+	}
+	if exists {
+		return identity.Status.Metadata, "InSync", nil
+	}
+
+	reason := "Created"
+	if len(identity.Status.Metadata) > 0 {
+		log.Info("identity drifted on identity provider, recreating it", "identity", identity.Name, "idProvider", idProvider.GetName())
+		reason = "Recreated"
+	}
+	idmeta, err := idProvider.CreateIdentity(ctx, identity)
+	if err != nil {
+		return nil, "", err
+	}
+	return idmeta, reason, nil
+}
+
 func (r *IdentityReconciler) bindRoleToServiceAccount(ctx context.Context, namespace, serviceAccountName string, roleName string, withOwnership bool) error {
 
 	serviceAccount := &corev1.ServiceAccount{}
@@ -273,63 +392,10 @@ func (r *IdentityReconciler) createPolicyReaderRole(ctx context.Context, service
 
 }
 
-func (r *IdentityReconciler) findProvider(ctx context.Context, req ctrl.Request, providerName string) (IdentityHelper, error) {
-	log := log.FromContext(ctx)
-
-	// try hashicorp vault provider first
-	provider := &aegisv1.HashicorpVaultProvider{}
-	err := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: providerName}, provider)
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			log.Info("HashicorpVaultProvider not found, trying AzureProvider")
-			azprovider := &aegisv1.AzureProvider{}
-			err = r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: providerName}, azprovider)
-			if err == nil {
-				log.Info("AzureProvider found", "tenantID", azprovider.Spec.TenantID, "clientID", azprovider.Spec.ClientID)
-				return azure.New(azprovider.Spec.TenantID, azprovider.Spec.ClientID), nil
-			} else {
-				if apierrors.IsNotFound(err) {
-					log.Info("AzureProvider not found, trying KubernetesProvider")
-					kubeProvider := &aegisv1.KubernetesProvider{}
-					err = r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: providerName}, kubeProvider)
-					if apierrors.IsNotFound(err) {
-						log.Info("KubernetesProvider not found trying AWSProvider")
-						awsProvider := &aegisv1.AWSProvider{}
-						err = r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: providerName}, awsProvider)
-						if err == nil {
-							// get kubernetes client
-							config, err := rest.InClusterConfig()
-							if err != nil {
-								return nil, err
-							}
-
-							clientset, err := kubernetes.NewForConfig(config)
-							if err != nil {
-								return nil, err
-							}
-
-							log.Info("AWSProvider found", "region", awsProvider.Spec.Region)
-							return aws.New(awsProvider.Spec.Region, awsProvider.Spec.RoleARN, awsProvider.Spec.IdentityPoolID, clientset), nil
-						}
-						return nil, err
-					}
-					return kubeidp.New(), nil
-				}
-				log.Error(err, "Failed to find AzureProvider")
-				return nil, err
-			}
-		}
-		log.Error(err, "Failed to find provider")
-		return nil, err
-	}
-	log.Info("HashicorpVaultProvider found", "vaultAddress", provider.Spec.VaultAddress)
-	return hashicorpvault.New(provider.Spec.VaultAddress), nil
-
-}
-
 // SetupWithManager sets up the controller with the Manager.
 func (r *IdentityReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&aegisv1.Identity{}).
+		WithOptions(r.Options.controllerOptions()).
 		Complete(r)
 }
@@ -0,0 +1,61 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+var _ = Describe("getProviderByRef", func() {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	Expect(aegisv1.AddToScheme(scheme)).To(Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&aegisv1.AzureProvider{ObjectMeta: metav1.ObjectMeta{Name: "azure", Namespace: "team-b"}},
+		&aegisv1.ClusterAzureProvider{ObjectMeta: metav1.ObjectMeta{Name: "azure"}},
+	).Build()
+
+	It("should resolve a namespaced provider of the namespace of the identity", func() {
+		match, err := getProviderByRef(ctx, c, &aegisv1.ProviderRef{Kind: "AzureProvider", Name: "azure", Namespace: "team-b"}, "team-b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.object.GetNamespace()).To(Equal("team-b"))
+	})
+
+	It("should refuse a namespaced provider of another namespace", func() {
+		_, err := getProviderByRef(ctx, c, &aegisv1.ProviderRef{Kind: "AzureProvider", Name: "azure", Namespace: "team-b"}, "team-a")
+		Expect(err).To(MatchError(ContainSubstring("cannot be referenced from namespace team-a")))
+	})
+
+	It("should report the kind of the provider object", func() {
+		match, err := getProviderByRef(ctx, c, &aegisv1.ProviderRef{Kind: "AzureProvider", Name: "azure"}, "team-b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.kind()).To(Equal("AzureProvider"))
+
+		match, err = getProviderByRef(ctx, c, &aegisv1.ProviderRef{Kind: "ClusterAzureProvider", Name: "azure"}, "team-b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.kind()).To(Equal("ClusterAzureProvider"))
+	})
+})
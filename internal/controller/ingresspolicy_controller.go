@@ -18,6 +18,9 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -25,19 +28,29 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
 )
 
 const (
-	typeAvailableIngressPolicy = "Available"
+	typeAvailableIngressPolicy     = "Available"
+	typeAccessGrantedIngressPolicy = "AccessGranted"
+	ingressPolicyFinalizerName     = "ingresspolicy.aegis.aegisproxy.io"
 )
 
+// errProviderGone is returned by syncAccess when the provider of the identity does not exist
+var errProviderGone = errors.New("provider of the identity not found")
+
 // IngressPolicyReconciler reconciles a IngressPolicy object
 type IngressPolicyReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme  *runtime.Scheme
+	Options ReconcileOptions
 }
 
 //+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=ingresspolicies,verbs=get;list;watch;create;update;patch;delete
@@ -54,12 +67,18 @@ type IngressPolicyReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.3/pkg/reconcile
 func (r *IngressPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ingressPolicy := &aegisv1.IngressPolicy{}
+	return r.Options.reconcile(ctx, r.Client, req, ingressPolicy, &ingressPolicy.Status.ReconcileStatus, func() (ctrl.Result, error) {
+		return r.reconcile(ctx, req, ingressPolicy)
+	})
+}
+
+func (r *IngressPolicyReconciler) reconcile(ctx context.Context, req ctrl.Request, ingressPolicy *aegisv1.IngressPolicy) (ctrl.Result, error) {
 	var err error
 	log := log.FromContext(ctx)
 
 	log.Info("Reconciling Identity", "name", req.Name, "namespace", req.Namespace, "request", req)
 	// Fetch the Identity object
-	ingressPolicy := &aegisv1.IngressPolicy{}
 	if err := r.Get(ctx, req.NamespacedName, ingressPolicy); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Info("ingresspolicy resource not found. Ignoring since object must be deleted")
@@ -71,7 +90,24 @@ func (r *IngressPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	// check deletion timestamp
 	if !ingressPolicy.ObjectMeta.DeletionTimestamp.IsZero() {
-
+		if controllerutil.ContainsFinalizer(ingressPolicy, ingressPolicyFinalizerName) {
+			// the access granted by the policy is revoked on the identity provider
+			for _, name := range []string{ingressPolicy.Status.Identity, ingressPolicy.Spec.Identity} {
+				if _, err := r.syncAccess(ctx, ingressPolicy.Namespace, name); err != nil {
+					// the access granted on a deleted provider was removed with it
+					if !errors.Is(err, errProviderGone) {
+						log.Error(err, "Failed to revoke the access granted by the ingresspolicy", "identity", name)
+						return ctrl.Result{}, err
+					}
+					log.Info("Provider of the identity not found, no access to revoke", "identity", name)
+				}
+			}
+			controllerutil.RemoveFinalizer(ingressPolicy, ingressPolicyFinalizerName)
+			if err := r.Update(ctx, ingressPolicy); err != nil {
+				log.Error(err, "Failed to update IngressPolicy to remove finalizer")
+				return ctrl.Result{}, err
+			}
+		}
 		return ctrl.Result{}, nil
 	}
 
@@ -89,6 +125,56 @@ func (r *IngressPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 	}
 
+	// the finalizer revokes the access granted on the identity provider
+	if ingressPolicy.Spec.Identity != "" && !controllerutil.ContainsFinalizer(ingressPolicy, ingressPolicyFinalizerName) {
+		controllerutil.AddFinalizer(ingressPolicy, ingressPolicyFinalizerName)
+		if err := r.Update(ctx, ingressPolicy); err != nil {
+			log.Error(err, "Failed to update IngressPolicy to add finalizer")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// the previous identity of the policy loses the access granted by the policy
+	if ingressPolicy.Status.Identity != "" && ingressPolicy.Status.Identity != ingressPolicy.Spec.Identity {
+		if _, err := r.syncAccess(ctx, ingressPolicy.Namespace, ingressPolicy.Status.Identity); err != nil {
+			log.Error(err, "Failed to revoke the access granted by the ingresspolicy", "identity", ingressPolicy.Status.Identity)
+			return ctrl.Result{}, err
+		}
+		ingressPolicy.Status.Identity = ""
+	}
+
+	if ingressPolicy.Spec.Identity == "" {
+		meta.RemoveStatusCondition(&ingressPolicy.Status.Conditions, typeAccessGrantedIngressPolicy)
+	} else {
+		// recorded before the grant, which can partially succeed
+		ingressPolicy.Status.Identity = ingressPolicy.Spec.Identity
+		granted, err := r.syncAccess(ctx, ingressPolicy.Namespace, ingressPolicy.Spec.Identity)
+		if err != nil {
+			log.Error(err, "Failed to grant access on identity provider", "identity", ingressPolicy.Spec.Identity)
+			meta.SetStatusCondition(&ingressPolicy.Status.Conditions,
+				metav1.Condition{Type: typeAccessGrantedIngressPolicy, Status: metav1.ConditionFalse, Reason: "GrantFailed", Message: err.Error()})
+			if err := r.Status().Update(ctx, ingressPolicy); err != nil {
+				log.Error(err, "Failed to update IngressPolicy status")
+			}
+			return ctrl.Result{}, err
+		}
+		identityKey := client.ObjectKey{Namespace: ingressPolicy.Namespace, Name: ingressPolicy.Spec.Identity}
+		if granted {
+			meta.SetStatusCondition(&ingressPolicy.Status.Conditions,
+				metav1.Condition{Type: typeAccessGrantedIngressPolicy, Status: metav1.ConditionTrue, Reason: "Granted",
+					Message: "Access to the identity granted to the identities of the rules on the identity provider"})
+		} else if err := r.Get(ctx, identityKey, &aegisv1.Identity{}); apierrors.IsNotFound(err) {
+			meta.SetStatusCondition(&ingressPolicy.Status.Conditions,
+				metav1.Condition{Type: typeAccessGrantedIngressPolicy, Status: metav1.ConditionFalse, Reason: "IdentityNotFound",
+					Message: fmt.Sprintf("Identity %s not found, the access is granted once it is created", ingressPolicy.Spec.Identity)})
+		} else {
+			meta.SetStatusCondition(&ingressPolicy.Status.Conditions,
+				metav1.Condition{Type: typeAccessGrantedIngressPolicy, Status: metav1.ConditionFalse, Reason: "NotSupported",
+					Message: "The identity provider does not enforce ingress policies, they are only enforced by the proxy"})
+		}
+	}
+
 	meta.SetStatusCondition(&ingressPolicy.Status.Conditions,
 		metav1.Condition{Type: typeAvailableIngressPolicy, Status: metav1.ConditionTrue, Reason: "Reconciled", Message: "IngressPolicy reconciled"})
 	if err := r.Status().Update(ctx, ingressPolicy); err != nil {
@@ -96,12 +182,126 @@ func (r *IngressPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	// no access is left to revoke
+	if ingressPolicy.Spec.Identity == "" && controllerutil.ContainsFinalizer(ingressPolicy, ingressPolicyFinalizerName) {
+		controllerutil.RemoveFinalizer(ingressPolicy, ingressPolicyFinalizerName)
+		if err := r.Update(ctx, ingressPolicy); err != nil {
+			log.Error(err, "Failed to update IngressPolicy to remove finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// syncAccess grants the access to the identity name of namespace to the
+// callers allowed by the ingress policies protecting it, or revokes it when no
+// policy protects it anymore. It reports whether the provider of the identity
+// enforces the ingress policies. Missing identities are skipped: the access of
+// a deleted identity is removed with it, and the policies are reconciled again
+// when the identity is created.
+func (r *IngressPolicyReconciler) syncAccess(ctx context.Context, namespace, name string) (bool, error) {
+	log := log.FromContext(ctx)
+	if name == "" {
+		return false, nil
+	}
+
+	policies := &aegisv1.IngressPolicyList{}
+	if err := r.List(ctx, policies, client.InNamespace(namespace)); err != nil {
+		return false, err
+	}
+	callers, protected := policyCallers(policies.Items, name)
+
+	identity := &aegisv1.Identity{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, identity); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("Identity not found, no access to sync", "identity", name)
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get identity %s/%s: %w", namespace, name, err)
+	}
+	providerMatch, _, err := findIdentityProvider(ctx, r.Client, identity)
+	if isProviderNotFound(err) {
+		return false, fmt.Errorf("%w: %v", errProviderGone, err)
+	}
+	if err != nil {
+		return false, err
+	}
+	idProvider, err := providerMatch.provider.New(ctx, r.Client, providerMatch.object)
+	if err != nil {
+		return false, err
+	}
+	granter, ok := idProvider.(idp.AccessGranter)
+	if !ok {
+		return false, nil
+	}
+
+	if !protected {
+		log.Info("Revoking access", "identity", name, "idProvider", idProvider.GetName())
+		return true, granter.RevokeAccess(ctx, identity)
+	}
+	log.Info("Granting access", "identity", name, "idProvider", idProvider.GetName(), "callers", callers)
+	return true, granter.GrantAccess(ctx, identity, callers)
+}
+
+// policyCallers returns the sorted identities allowed by the rules of the
+// policies protecting the identity name, and whether any policy protects it.
+// The policies being deleted are ignored.
+func policyCallers(policies []aegisv1.IngressPolicy, name string) ([]string, bool) {
+	protected := false
+	seen := map[string]bool{}
+	callers := []string{}
+	for _, policy := range policies {
+		if policy.Spec.Identity != name || !policy.DeletionTimestamp.IsZero() {
+			continue
+		}
+		protected = true
+		for _, rule := range policy.Spec.Rules {
+			for _, caller := range rule.Identities {
+				if !seen[caller] {
+					seen[caller] = true
+					callers = append(callers, caller)
+				}
+			}
+		}
+	}
+	sort.Strings(callers)
+	return callers, protected
+}
+
+// policiesForIdentity returns the ingress policies protecting the identity or
+// allowing it in their rules, so that the access is granted once the identity
+// exists on the identity provider
+func (r *IngressPolicyReconciler) policiesForIdentity(ctx context.Context, obj client.Object) []reconcile.Request {
+	policies := &aegisv1.IngressPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list ingresspolicies")
+		return nil
+	}
+	subject := fmt.Sprintf("system:serviceaccount:%s:%s", obj.GetNamespace(), obj.GetName())
+	requests := []reconcile.Request{}
+	for _, policy := range policies.Items {
+		if policy.Spec.Identity == "" {
+			continue
+		}
+		matches := policy.Namespace == obj.GetNamespace() && policy.Spec.Identity == obj.GetName()
+		for _, rule := range policy.Spec.Rules {
+			for _, caller := range rule.Identities {
+				matches = matches || caller == subject
+			}
+		}
+		if matches {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&policy)})
+		}
+	}
+	return requests
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *IngressPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&aegisv1.IngressPolicy{}).
+		Watches(&aegisv1.Identity{}, handler.EnqueueRequestsFromMapFunc(r.policiesForIdentity)).
+		WithOptions(r.Options.controllerOptions()).
 		Complete(r)
 }
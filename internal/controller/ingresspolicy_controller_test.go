@@ -18,11 +18,15 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -82,3 +86,74 @@ var _ = Describe("IngressPolicy Controller", func() {
 		})
 	})
 })
+
+var _ = Describe("policyCallers", func() {
+	policy := func(name, identity string, callers ...string) aegisv1.IngressPolicy {
+		return aegisv1.IngressPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: aegisv1.IngressPolicySpec{
+				Identity: identity,
+				Rules:    []aegisv1.Rule{{Name: "rule", Identities: callers}},
+			},
+		}
+	}
+
+	It("should merge the callers of the policies protecting the identity", func() {
+		deleted := policy("deleted", "callee", "system:serviceaccount:default:c")
+		deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		policies := []aegisv1.IngressPolicy{
+			policy("p1", "callee", "system:serviceaccount:default:b", "system:serviceaccount:default:a"),
+			policy("p2", "callee", "system:serviceaccount:default:a"),
+			policy("other", "other", "system:serviceaccount:default:d"),
+			deleted,
+		}
+		callers, protected := policyCallers(policies, "callee")
+		Expect(protected).To(BeTrue())
+		Expect(callers).To(Equal([]string{"system:serviceaccount:default:a", "system:serviceaccount:default:b"}))
+	})
+
+	It("should report identities no policy protects", func() {
+		_, protected := policyCallers([]aegisv1.IngressPolicy{policy("p1", "callee")}, "other")
+		Expect(protected).To(BeFalse())
+	})
+})
+
+var _ = Describe("IngressPolicy access", func() {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	Expect(aegisv1.AddToScheme(scheme)).To(Succeed())
+	protecting := func(name string) *aegisv1.IngressPolicy {
+		return &aegisv1.IngressPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Finalizers: []string{ingressPolicyFinalizerName}},
+			Spec:       aegisv1.IngressPolicySpec{Identity: "callee"},
+			Status:     aegisv1.IngressPolicyStatus{Identity: "callee"},
+		}
+	}
+
+	It("should wait for the identity protected by a policy to exist", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(protecting("p1")).Build()
+		r := &IngressPolicyReconciler{Client: c, Scheme: scheme}
+		granted, err := r.syncAccess(ctx, "default", "callee")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(granted).To(BeFalse())
+	})
+
+	It("should release a deleted policy whose identity or provider is gone", func() {
+		identity := &aegisv1.Identity{
+			ObjectMeta: metav1.ObjectMeta{Name: "callee", Namespace: "default"},
+			Spec:       aegisv1.IdentitySpec{ProviderRef: &aegisv1.ProviderRef{Kind: "AzureProvider", Name: "deleted"}},
+		}
+		for _, objs := range [][]client.Object{{}, {identity}} {
+			deleted := protecting("deleted")
+			deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&aegisv1.IngressPolicy{}).
+				WithObjects(append(objs, deleted, protecting("sibling"))...).Build()
+			r := &IngressPolicyReconciler{Client: c, Scheme: scheme}
+
+			_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(deleted)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(deleted), &aegisv1.IngressPolicy{}))).To(BeTrue())
+		}
+	})
+})
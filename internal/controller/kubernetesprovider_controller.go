@@ -18,194 +18,248 @@ package controller
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"os"
-	"strings"
+	"net/http"
+	"time"
 
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"github.com/vmarchese/aegis-operator/internal/identity/kubernetes"
+	"github.com/vmarchese/aegis-operator/internal/logging"
 )
 
 const (
-	kubernetesProviderFinalizerName = "idprovider.aegis.aegisproxy.io"
-	typeAvailableKubernetesProvider = "Available"
+	typeKeySetReadyKubernetesProvider = "KeySetReady"
+
+	// defaultKeySetRefreshInterval is the delay between two fetches of the key
+	// set of a remote cluster when the provider does not set one
+	defaultKeySetRefreshInterval = time.Hour
+	// localKeySetRefreshInterval is the delay between two fetches of the key
+	// set of the local cluster, short since the tokens signed with a new key
+	// are issued as soon as the API server serves it
+	localKeySetRefreshInterval = 5 * time.Minute
+	// remoteKeySetTimeout bounds the requests fetching the key set of a remote cluster
+	remoteKeySetTimeout = 30 * time.Second
 )
 
-// KubernetesProviderReconciler reconciles a KubernetesProvider object
-type KubernetesProviderReconciler struct {
-	client.Client
-	Scheme *runtime.Scheme
+//+kubebuilder:rbac:urls=/.well-known/openid-configuration,verbs=get
+//+kubebuilder:rbac:urls=/openid/v1/jwks,verbs=get
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+
+// kubernetesProviderExtension publishes the key set of the issuer accepted by
+// the provider in the namespaces it serves
+var kubernetesProviderExtension = providerExtension{
+	sync: func(ctx context.Context, r *ProviderReconciler, kind string, obj providerObject) (ctrl.Result, error) {
+		switch p := obj.(type) {
+		case *aegisv1.KubernetesProvider:
+			return syncKubernetesIssuer(ctx, r.Client, r.Scheme, kind, p, &p.Spec, &p.Status, []string{p.Namespace})
+		case *aegisv1.ClusterKubernetesProvider:
+			namespaces, err := keySetNamespaces(ctx, r.Client, p)
+			if err != nil {
+				log.FromContext(ctx).Error(err, "Failed to list the namespaces allowed by "+kind)
+				return ctrl.Result{}, err
+			}
+			return syncKubernetesIssuer(ctx, r.Client, r.Scheme, kind, p, &p.Spec.KubernetesProviderSpec, &p.Status, namespaces)
+		}
+		return ctrl.Result{}, fmt.Errorf("unexpected %s object %T", kind, obj)
+	},
+	watch: func(r *ProviderReconciler, kind string, b *builder.Builder) *builder.Builder {
+		b = b.Owns(&corev1.ConfigMap{})
+		if kind == "ClusterKubernetesProvider" {
+			b = b.Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(clusterKubernetesProvidersForNamespace(r.Client)))
+		}
+		return b
+	},
 }
 
-//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=kubernetesproviders,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=kubernetesproviders/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=kubernetesproviders/finalizers,verbs=update
-
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the KubernetesProvider object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.3/pkg/reconcile
-func (r *KubernetesProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+// syncKubernetesIssuer records in status the issuer whose tokens the proxies
+// accept, the local one or the one of the remote cluster of spec, with the ids
+// and the hash of its key set, and mirrors the key set into the ConfigMap
+// mounted into the proxies in namespaces. The key set is refetched after the
+// refresh interval so that rotations reach the proxies; on failure the last
+// one is kept and the KeySetReady condition is set to False.
+func syncKubernetesIssuer(ctx context.Context, c client.Client, scheme *runtime.Scheme, kind string, owner client.Object, spec *aegisv1.KubernetesProviderSpec, status *aegisv1.KubernetesProviderStatus, namespaces []string) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
-	// Log the request details
-	log.Info("Reconciling KubernetesProvider", "name", req.Name, "namespace", req.Namespace)
-	// Fetch the Identity object
-	thisKube := &aegisv1.KubernetesProvider{}
-	err := r.Get(ctx, req.NamespacedName, thisKube)
-	if err != nil {
-
-		if apierrors.IsNotFound(err) {
-			log.Info("KubernetesProvider resource not found. Ignoring since object must be deleted")
-			return ctrl.Result{}, nil
-		}
-		log.Error(err, "unable to fetch KubernetesProvider")
+	keySetFailed := func(reason string, err error) (ctrl.Result, error) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    typeKeySetReadyKubernetesProvider,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: err.Error(),
+		})
 		return ctrl.Result{}, err
 	}
 
-	if !thisKube.ObjectMeta.DeletionTimestamp.IsZero() {
-		log.Info("KubernetesProvider is being deleted")
-		// delete all identities
-		// List all identities with matching provider label
-		identityList := &aegisv1.IdentityList{}
-		if err := r.List(ctx, identityList, client.MatchingLabels{
-			"aegis.aegisproxy.io/identity.provider": thisKube.Name,
-		}); err != nil {
-			log.Error(err, "Failed to list identities")
-			return ctrl.Result{}, err
-		}
-
-		// Delete each identity
-		for _, identity := range identityList.Items {
-			log.Info("Deleting identity", "identity", identity.Name)
-			if err := r.Delete(ctx, &identity); err != nil {
-				log.Error(err, "Failed to delete identity", "identity", identity.Name)
-				return ctrl.Result{}, err
-			}
-		}
-		// check for deletion
-		for _, identity := range identityList.Items {
-			idObj := &aegisv1.Identity{}
-			if err := r.Get(ctx, types.NamespacedName{Name: identity.Name, Namespace: identity.Namespace}, idObj); err == nil {
-				log.Error(err, "identity not deleted", "identity", identity.Name)
-				return ctrl.Result{Requeue: true}, nil
-			}
-		}
+	keySet, err := fetchKubernetesKeySet(ctx, c, spec, owner.GetNamespace())
+	if err != nil {
+		log.Error(err, "Failed to fetch the key set of the issuer")
+		return keySetFailed("FetchFailed", err)
+	}
 
-		// now delete the vault provider finalizer
-		if controllerutil.ContainsFinalizer(thisKube, kubernetesProviderFinalizerName) {
-			log.Info("Deleting KubernetesProvider finalizer")
-			updated := controllerutil.RemoveFinalizer(thisKube, kubernetesProviderFinalizerName)
-			if !updated {
-				return ctrl.Result{}, err
-			}
-			if err := r.Update(ctx, thisKube); err != nil {
-				log.Error(err, "Failed to update KubernetesProvider to remove finalizer")
-				return ctrl.Result{}, err
-			}
-		}
-		return ctrl.Result{}, nil
-	}
-
-	if len(thisKube.Status.Conditions) == 0 {
-		meta.SetStatusCondition(&thisKube.Status.Conditions,
-			metav1.Condition{Type: typeAvailableKubernetesProvider,
-				Status:  metav1.ConditionUnknown,
-				Reason:  "Reconciling",
-				Message: "Starting reconciliation"})
-		if err = r.Status().Update(ctx, thisKube); err != nil {
-			log.Error(err, "Failed to update KubernetesProvider status to Reconciling")
-			return ctrl.Result{}, err
-		}
+	// the update time only moves on rotations, so that refreshes of an
+	// unchanged key set do not change the status
+	status.Issuer = keySet.Issuer
+	if hash := keySet.Hash(); hash != status.JWKSHash {
+		log.Info("Key set of the issuer changed", "issuer", keySet.Issuer, "keyIDs", keySet.KeyIDs())
+		now := metav1.Now()
+		status.JWKSHash, status.KeyIDs, status.KeySetUpdateTime = hash, keySet.KeyIDs(), &now
+	}
+	status.JWKS = ""
+	if spec.Remote != nil {
+		status.JWKS = keySet.JWKS
+	}
 
-		if err := r.Get(ctx, req.NamespacedName, thisKube); err != nil {
-			log.Error(err, "Failed to re-fetch KubernetesProvider")
-			return ctrl.Result{}, err
-		}
+	configMap := kubernetesKeySetConfigMapName(kind, owner.GetName())
+	if err := mirrorKubernetesKeySet(ctx, c, scheme, kind, owner, configMap, keySet.JWKS, namespaces); err != nil {
+		log.Error(err, "Failed to mirror the key set of the issuer", "configMap", configMap)
+		return keySetFailed("MirrorFailed", err)
 	}
+	status.JWKSConfigMap = configMap
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    typeKeySetReadyKubernetesProvider,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Published",
+		Message: fmt.Sprintf("Key set of issuer %s published in ConfigMap %s", keySet.Issuer, configMap),
+	})
 
-	// appending finalizer
-	if !controllerutil.ContainsFinalizer(thisKube, kubernetesProviderFinalizerName) {
-		updated := controllerutil.AddFinalizer(thisKube, kubernetesProviderFinalizerName)
-		if !updated {
-			log.Error(err, "Failed to update KubernetesProvider with finalizer")
-			return ctrl.Result{}, err
+	refresh := localKeySetRefreshInterval
+	if spec.Remote != nil {
+		refresh = defaultKeySetRefreshInterval
+		if spec.Remote.RefreshInterval != nil && spec.Remote.RefreshInterval.Duration > 0 {
+			refresh = spec.Remote.RefreshInterval.Duration
 		}
-		if err := r.Update(ctx, thisKube); err != nil {
-			log.Error(err, "Failed to update KubernetesProvider to add finalizer")
-			return ctrl.Result{}, err
-		}
-		return ctrl.Result{Requeue: true}, nil
 	}
+	return ctrl.Result{RequeueAfter: refresh}, nil
+}
 
-	meta.SetStatusCondition(&thisKube.Status.Conditions,
-		metav1.Condition{Type: typeAvailableKubernetesProvider,
-			Status:  metav1.ConditionTrue,
-			Reason:  "Reconciled",
-			Message: "KubernetesProvider reconciled"})
-	issuer, err := r.getIssuer()
-	if err != nil {
-		log.Error(err, "Failed to get issuer")
-		return ctrl.Result{}, err
+// fetchKubernetesKeySet returns the issuer and the key set of the local
+// cluster, or of the remote cluster of spec. namespace is the one of the
+// provider, empty for the cluster scoped ones.
+func fetchKubernetesKeySet(ctx context.Context, c client.Reader, spec *aegisv1.KubernetesProviderSpec, namespace string) (kubernetes.KeySet, error) {
+	if spec.Remote == nil {
+		return kubernetes.LocalKeySet(ctx)
 	}
-	thisKube.Status.Issuer = issuer
-	if err := r.Status().Update(ctx, thisKube); err != nil {
-		log.Error(err, "Failed to update KubernetesProvider status to Reconciled")
-		return ctrl.Result{}, err
+	var kubeconfig []byte
+	if ref := spec.Remote.KubeconfigSecretRef; ref != nil {
+		var err error
+		if kubeconfig, err = idp.ReadSecretKey(ctx, c, ref, namespace); err != nil {
+			return kubernetes.KeySet{}, err
+		}
 	}
-
-	return ctrl.Result{}, nil
+	httpClient := logging.HTTPClient(&http.Client{Timeout: remoteKeySetTimeout})
+	return kubernetes.FetchRemoteKeySet(ctx, spec.Remote, kubeconfig, httpClient)
 }
-func (r *KubernetesProviderReconciler) getIssuer() (string, error) {
-	token, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
-	if err != nil {
-		return "", err
-	}
 
-	// Split the token into its parts
-	parts := strings.Split(string(token), ".")
-	if len(parts) != 3 {
-		return "", fmt.Errorf("invalid token format")
+// kubernetesKeySetConfigMapName returns the name of the ConfigMap the key set
+// of the provider kind/name is mirrored into
+func kubernetesKeySetConfigMapName(kind, name string) string {
+	if kind == "ClusterKubernetesProvider" {
+		return "aegis-cluster-jwks-" + name
 	}
+	return "aegis-jwks-" + name
+}
 
-	// Decode the payload part (second part)
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
-	if err != nil {
-		return "", err
+// mirrorKubernetesKeySet creates or updates the ConfigMap configMap holding
+// jwks in namespaces, owned by the provider, and deletes the ones of the
+// provider left in the other namespaces. Only the ConfigMaps controlled by the
+// provider are deleted, in its namespace when it is namespaced.
+func mirrorKubernetesKeySet(ctx context.Context, c client.Client, scheme *runtime.Scheme, kind string, owner client.Object, configMap, jwks string, namespaces []string) error {
+	log := log.FromContext(ctx)
+	providerLabels := client.MatchingLabels{
+		labelIdentityProvider:     owner.GetName(),
+		labelIdentityProviderKind: kind,
 	}
 
-	// Define a struct to hold the payload data
-	var claims struct {
-		Issuer string `json:"iss"`
+	wanted := map[string]bool{}
+	for _, namespace := range namespaces {
+		wanted[namespace] = true
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: configMap}}
+		result, err := controllerutil.CreateOrUpdate(ctx, c, cm, func() error {
+			cm.Labels = providerLabels
+			cm.Data = map[string]string{kubernetes.KeySetConfigMapKey: jwks}
+			return ctrl.SetControllerReference(owner, cm, scheme)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mirror the key set into ConfigMap %s/%s: %w", namespace, configMap, err)
+		}
+		if result != controllerutil.OperationResultNone {
+			log.Info("Key set mirrored", "configMap", configMap, "namespace", namespace, "operation", result)
+		}
 	}
 
-	// Unmarshal the payload into the struct
-	if err := json.Unmarshal(payload, &claims); err != nil {
-		return "", err
+	listOpts := []client.ListOption{providerLabels}
+	if owner.GetNamespace() != "" {
+		listOpts = append(listOpts, client.InNamespace(owner.GetNamespace()))
 	}
+	configMaps := &corev1.ConfigMapList{}
+	if err := c.List(ctx, configMaps, listOpts...); err != nil {
+		return fmt.Errorf("failed to list the ConfigMaps of the key set: %w", err)
+	}
+	for i := range configMaps.Items {
+		cm := &configMaps.Items[i]
+		// the labels can be set by anyone: only the ConfigMaps of this provider are deleted
+		if ref := metav1.GetControllerOf(cm); ref == nil || ref.UID != owner.GetUID() || wanted[cm.Namespace] {
+			continue
+		}
+		log.Info("Deleting key set ConfigMap of a namespace no longer allowed", "configMap", cm.Name, "namespace", cm.Namespace)
+		if err := c.Delete(ctx, cm); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete ConfigMap %s/%s: %w", cm.Namespace, cm.Name, err)
+		}
+	}
+	return nil
+}
 
-	return claims.Issuer, nil
+// keySetNamespaces returns the namespaces allowed by the provider, where its
+// key set is mirrored for the proxies to mount
+func keySetNamespaces(ctx context.Context, c client.Reader, provider *aegisv1.ClusterKubernetesProvider) ([]string, error) {
+	selector := labels.Everything()
+	if provider.Spec.AllowedNamespaces != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(provider.Spec.AllowedNamespaces); err != nil {
+			return nil, fmt.Errorf("invalid allowedNamespaces: %w", err)
+		}
+	}
+	namespaceList := &corev1.NamespaceList{}
+	if err := c.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	namespaces := []string{}
+	for _, ns := range namespaceList.Items {
+		if ns.Status.Phase != corev1.NamespaceTerminating {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+	return namespaces, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *KubernetesProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&aegisv1.KubernetesProvider{}).
-		Complete(r)
+// clusterKubernetesProvidersForNamespace returns the map function enqueueing
+// all the ClusterKubernetesProviders when a namespace changes, so that their
+// key set is mirrored into the namespaces they allow
+func clusterKubernetesProvidersForNamespace(c client.Reader) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		providers := &aegisv1.ClusterKubernetesProviderList{}
+		if err := c.List(ctx, providers); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list ClusterKubernetesProviders")
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for _, provider := range providers.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&provider)})
+		}
+		return requests
+	}
 }
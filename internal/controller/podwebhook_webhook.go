@@ -23,8 +23,10 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
 	corev1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -35,14 +37,15 @@ import (
 )
 
 const (
-	annotationEgressKey        = "aegisproxy.io/egress"
-	annotationIngressKey       = "aegisproxy.io/ingress"
-	annotationIngressPort      = "aegisproxy.io/ingress.port"
-	annotationType             = "aegisproxy.io/type"
-	annotationIdentity         = "aegisproxy.io/identity"
-	annotationPolicy           = "aegisproxy.io/ingress.policy"
-	annotationIdentityProvider = "aegisproxy.io/identity.provider"
-	annotationValue            = "true"
+	annotationEgressKey            = "aegisproxy.io/egress"
+	annotationIngressKey           = "aegisproxy.io/ingress"
+	annotationIngressPort          = "aegisproxy.io/ingress.port"
+	annotationType                 = "aegisproxy.io/type"
+	annotationIdentity             = "aegisproxy.io/identity"
+	annotationPolicy               = "aegisproxy.io/ingress.policy"
+	annotationIdentityProvider     = "aegisproxy.io/identity.provider"
+	annotationIdentityProviderKind = "aegisproxy.io/identity.provider.kind" // optional, disambiguates the provider name
+	annotationValue                = "true"
 
 	ingressType       = "ingress"
 	egressType        = "egress"
@@ -112,6 +115,17 @@ func (m *PodWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
 //+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=azureproviders,verbs=get;list;watch
 //+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=kubernetesproviders,verbs=get;list;watch
 //+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=awsproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=gcpproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=oidcproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=spireproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=clusterhashicorpvaultproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=clusterazureproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=clusterkubernetesproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=clusterawsproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=clustergcpproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=clusteroidcproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="aegis.aegisproxy.io",resources=clusterspireproviders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 func (m *PodWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
 	fmt.Println("Handle")
@@ -219,27 +233,36 @@ func (m *PodWebhook) injectProxy(ctx context.Context, pod *corev1.Pod, policy, i
 	proxyContainerName := aegisProxyContainerName
 	serviceAccount := identityOut
 
-	providerType := ""
-	if proxyType == ingressType {
-		providerType, err = m.findProviderTypeByName(ctx, identityProvider, pod.Namespace)
-		if err != nil {
-			return err
-		}
-	} else {
-		identityObj := aegisv1.Identity{}
-		if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: identityOut}, &identityObj); err != nil {
-			return fmt.Errorf("failed to get identity %s: %v", identityOut, err)
-		}
-		providerType = identityObj.Status.Provider
+	identityObj, err := m.getIdentity(ctx, pod, proxyType, identityOut)
+	if err != nil {
+		return err
+	}
+
+	idHelper, err := m.findIdentityHelper(ctx, pod, proxyType, identityObj, identityProvider)
+	if err != nil {
+		return err
+	}
+	providerType := idHelper.GetName()
+	tokenOptions, err := idp.GetTokenOptions(idHelper, identityObj)
+	if err != nil {
+		return err
 	}
 
 	// provider args
 	providerArgs := []string{}
 	// getting identities for provider
-	pargs, err := m.getProviderArgs(ctx, pod, proxyType, identityOut, identityProvider, providerType)
+	pargs, err := m.getProviderArgs(ctx, pod, idHelper, identityObj)
 	if err != nil {
 		return err
 	}
+	// providers with their own proxy volume do not use the projected token
+	volumeProvider, hasProxyVolume := idHelper.(idp.ProxyVolumeProvider)
+	if !hasProxyVolume && identityObj != nil && identityObj.Spec.TokenTTL != nil {
+		pargs = append(pargs, "--token-ttl", tokenOptions.TTL.String())
+	}
+	if !hasProxyVolume && identityObj != nil && len(identityObj.Spec.Audiences) > 0 {
+		pargs = append(pargs, "--token-audience", strings.Join(tokenOptions.Audiences, ","))
+	}
 
 	providerArgs = append(providerArgs, pargs...)
 
@@ -247,6 +270,33 @@ func (m *PodWebhook) injectProxy(ctx context.Context, pod *corev1.Pod, policy, i
 		serviceAccount = "default"
 	}
 
+	// the projected service account token, unless the provider mounts its own volume
+	proxyVolume := idp.ProxyVolume{MountPath: tokenMountPath}
+	if hasProxyVolume {
+		proxyVolume = volumeProvider.GetProxyVolume()
+	} else {
+		exp := int64(tokenOptions.TTLOrDefault(expirationSeconds * time.Second).Seconds())
+		proxyVolume.Volume = corev1.Volume{
+			Name: "satoken",
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{
+						{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							Path:              "token",
+							Audience:          tokenOptions.Audiences[0],
+							ExpirationSeconds: &exp,
+						}}},
+				},
+			},
+		}
+	}
+
+	// volumes mounted besides the token one, e.g. the key set of the issuer
+	additionalVolumes := []idp.ProxyVolume{}
+	if additionalProvider, ok := idHelper.(idp.AdditionalProxyVolumeProvider); ok {
+		additionalVolumes = additionalProvider.GetAdditionalProxyVolumes()
+	}
+
 	// Inject the aegis-proxy container if not already present
 	if !hasContainer(pod, proxyContainerName) {
 		args := []string{
@@ -254,11 +304,15 @@ func (m *PodWebhook) injectProxy(ctx context.Context, pod *corev1.Pod, policy, i
 			"--type", proxyType,
 			"--inport", inboundPort,
 			"--outport", outboundPort,
-			"--token", fmt.Sprintf("%s%c%s", tokenMountPath, os.PathSeparator, tokenFile),
+		}
+		if !hasProxyVolume {
+			args = append(args, "--token", fmt.Sprintf("%s%c%s", tokenMountPath, os.PathSeparator, tokenFile))
+		}
+		args = append(args,
 			"--identity", serviceAccount,
 			"--identity-provider", providerType,
 			"-vvvvv",
-		}
+		)
 		if policy != "" {
 			args = append(args, "--policy", policy)
 		}
@@ -278,11 +332,19 @@ func (m *PodWebhook) injectProxy(ctx context.Context, pod *corev1.Pod, policy, i
 			Args: args,
 			VolumeMounts: []corev1.VolumeMount{
 				{
-					Name:      "satoken",
-					MountPath: tokenMountPath,
+					Name:      proxyVolume.Volume.Name,
+					MountPath: proxyVolume.MountPath,
+					ReadOnly:  hasProxyVolume,
 				},
 			},
 		}
+		for _, volume := range additionalVolumes {
+			aegisProxyContainer.VolumeMounts = append(aegisProxyContainer.VolumeMounts, corev1.VolumeMount{
+				Name:      volume.Volume.Name,
+				MountPath: volume.MountPath,
+				ReadOnly:  true,
+			})
+		}
 		// adding env variables
 		for _, prefix := range envPrefixesToCopy {
 			for _, container := range pod.Spec.Containers {
@@ -299,33 +361,10 @@ func (m *PodWebhook) injectProxy(ctx context.Context, pod *corev1.Pod, policy, i
 
 	// Inject the init container if not already present
 	if !hasContainer(pod, initContainerName) {
-		exp := int64(expirationSeconds)
-
-		audience := ""
-		switch providerType {
-		case "hashicorp.vault":
-			audience = "vault"
-		case "azure":
-			audience = "api://AzureADTokenExchange"
-		case "kubernetes":
-			audience = "kubernetes"
-		case "aws":
-			audience = "sts.amazonaws.com"
+		pod.Spec.Volumes = append(pod.Spec.Volumes, proxyVolume.Volume)
+		for _, volume := range additionalVolumes {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, volume.Volume)
 		}
-
-		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
-			Name: "satoken",
-			VolumeSource: corev1.VolumeSource{
-				Projected: &corev1.ProjectedVolumeSource{
-					Sources: []corev1.VolumeProjection{
-						{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
-							Path:              "token",
-							Audience:          audience, //TODO: depends on the identity
-							ExpirationSeconds: &exp,
-						}}},
-				},
-			},
-		})
 		log.Info("injecting aegis-iptables init container", "name", pod.Name)
 		initContainer := corev1.Container{
 			Name:  initContainerName,
@@ -348,131 +387,63 @@ func (m *PodWebhook) injectProxy(ctx context.Context, pod *corev1.Pod, policy, i
 	return nil
 }
 
-func (m *PodWebhook) getProviderArgs(ctx context.Context, pod *corev1.Pod, proxyType, identityOut, identityProvider, providerType string) ([]string, error) {
-	log := podwebhooklog.WithValues("name", pod.Name)
-
-	// select identity based on proxy type
-	identity := ""
-	providerArgs := []string{}
-	switch proxyType {
-	case egressType:
-		identity = identityOut
-	case ingressType:
-		identity = aegisProxyIdentity
-	case ingressEgressType:
-		identity = identityOut
+// getIdentity returns the identity of the proxy. Ingress only proxies run as
+// aegisproxy and have no identity: nil is returned.
+func (m *PodWebhook) getIdentity(ctx context.Context, pod *corev1.Pod, proxyType, identityOut string) (*aegisv1.Identity, error) {
+	if proxyType != egressType && proxyType != ingressEgressType {
+		return nil, nil
 	}
-
-	log.Info("getting provider args", "name", pod.Name, "identity", identity, "proxyType", proxyType, "pod", pod.Name, "provider", identityProvider)
-
-	providerName := ""
-	if identityProvider != "" { // this is the case of a simple ingress proxy with no identity associated, we must find the provider by name
-		providerName = identityProvider
-
-	} else {
-		identityObj := aegisv1.Identity{}
-		if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: identity}, &identityObj); err != nil {
-			return nil, fmt.Errorf("failed to get identity %s: %v", identity, err)
-		}
-		providerName = identityObj.Spec.Provider
+	identityObj := &aegisv1.Identity{}
+	if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: identityOut}, identityObj); err != nil {
+		return nil, fmt.Errorf("failed to get identity %s: %v", identityOut, err)
 	}
+	return identityObj, nil
+}
 
-	switch providerType {
-	case "hashicorp.vault":
-		vault := aegisv1.HashicorpVaultProvider{}
-		if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: providerName}, &vault); err != nil {
-			return nil, fmt.Errorf("failed to get hashicorp vault provider %s: %v", providerName, err)
-		}
-		log.Info("vault provider", "name", pod.Name, "address", vault.Spec.VaultAddress)
-		providerArgs = append(providerArgs,
-			"--identity-provider", "hashicorp.vault",
-			"--vault-address", vault.Spec.VaultAddress)
-	case "kubernetes":
-		kube := aegisv1.KubernetesProvider{}
-		if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: providerName}, &kube); err != nil {
-			return nil, fmt.Errorf("failed to get kubernetes provider %s: %v", providerName, err)
-		}
-		providerArgs = append(providerArgs,
-			"--identity-provider", "kubernetes",
-			"--kubernetes-issuer", kube.Status.Issuer,
-		)
-	case "aws":
-		aws := aegisv1.AWSProvider{}
-		if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: providerName}, &aws); err != nil {
-			return nil, fmt.Errorf("failed to get aws provider %s: %v", providerName, err)
-		}
-		providerArgs = append(providerArgs,
-			"--aws-region", aws.Spec.Region,
-		)
-		if proxyType == egressType || proxyType == ingressEgressType {
-			identityObj := aegisv1.Identity{}
-			if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: identity}, &identityObj); err != nil {
-				return nil, fmt.Errorf("failed to get identity %s: %v", identity, err)
-			}
-
-			identityId := identityObj.Status.Metadata["aegis.identity.id"]
-			if identityId == "" {
-				return nil, fmt.Errorf("identity id is not set for identity %s", identity)
-			}
-			providerArgs = append(providerArgs,
-				"--aws-identity-id", identityId,
-			)
-		}
-	case "azure":
-		azure := aegisv1.AzureProvider{}
-		if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: providerName}, &azure); err != nil {
-			return nil, fmt.Errorf("failed to get azure provider %s: %v", providerName, err)
-		}
-		log.Info("azure provider", "name", pod.Name, "tenantID", azure.Spec.TenantID, "clientID", azure.Spec.ClientID)
-
-		providerArgs = append(providerArgs,
-			"--azure-tenant-id", azure.Spec.TenantID,
-		)
-		if proxyType == egressType || proxyType == ingressEgressType {
-			// get identity
-			identityObj := aegisv1.Identity{}
-			if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: identity}, &identityObj); err != nil {
-				return nil, fmt.Errorf("failed to get identity %s: %v", identity, err)
-			}
+func (m *PodWebhook) getProviderArgs(ctx context.Context, pod *corev1.Pod, idHelper IdentityHelper, identityObj *aegisv1.Identity) ([]string, error) {
+	log := podwebhooklog.WithValues("name", pod.Name)
 
-			clientId := identityObj.Status.Metadata["aegis.identity.id"]
-			if clientId == "" {
-				return nil, fmt.Errorf("client id is not set for identity %s", identity)
-			}
+	log.Info("getting provider args", "name", pod.Name, "provider", idHelper.GetName())
 
-			providerArgs = append(providerArgs,
-				"--azure-client-id", clientId,
-			)
-		}
-	default:
-		return nil, fmt.Errorf("unknown provider type %s", providerType)
+	providerArgs, err := idHelper.GetProxyArgs(ctx, identityObj)
+	if err != nil {
+		return nil, err
 	}
-	log.Info("provider type", "name", pod.Name, "type", providerType, "args", providerArgs)
+	log.Info("provider type", "name", pod.Name, "type", idHelper.GetName(), "args", providerArgs)
 
 	return providerArgs, nil
 }
 
-func (m *PodWebhook) findProviderTypeByName(ctx context.Context, providerName, namespace string) (string, error) {
-
-	// try hashicorp vault provider first
-	var hProvider aegisv1.HashicorpVaultProvider
-	if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: providerName}, &hProvider); err != nil {
-		var aProvider aegisv1.AzureProvider
-		if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: providerName}, &aProvider); err != nil {
-			var kProvider aegisv1.KubernetesProvider
-			if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: providerName}, &kProvider); err != nil {
-				var aProvider aegisv1.AWSProvider
-				if err := m.kubeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: providerName}, &aProvider); err != nil {
-					return "", err
-				}
-				return "aws", nil
+// findIdentityHelper returns the IdentityHelper of the provider used by the proxy:
+// the provider named in the pod annotations for ingress proxies, the provider of
+// identityObj, the identity of the proxy, otherwise.
+func (m *PodWebhook) findIdentityHelper(ctx context.Context, pod *corev1.Pod, proxyType string, identityObj *aegisv1.Identity, identityProvider string) (IdentityHelper, error) {
+	var match providerMatch
+	if proxyType == ingressType {
+		if kind, ok := pod.Annotations[annotationIdentityProviderKind]; ok && kind != "" {
+			var err error
+			match, err = getProviderByRef(ctx, m.kubeClient, &aegisv1.ProviderRef{Kind: kind, Name: identityProvider}, pod.Namespace)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			matches, err := findProvidersByName(ctx, m.kubeClient, pod.Namespace, identityProvider)
+			if err != nil {
+				return nil, err
 			}
-			return "kubernetes", nil
+			match = matches[0]
+		}
+	} else {
+		var err error
+		match, _, err = findIdentityProvider(ctx, m.kubeClient, identityObj)
+		if err != nil {
+			return nil, err
 		}
-		return "azure", nil
 	}
-	return "hashicorp.vault", nil
-
+	if err := checkProviderUsable(match); err != nil {
+		return nil, err
+	}
+	return match.provider.New(ctx, m.kubeClient, match.object)
 }
 
 func hasContainer(pod *corev1.Pod, containerName string) bool {
@@ -0,0 +1,281 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+const (
+	typeAvailableProvider = "Available"
+	providerFinalizerName = "idprovider.aegis.aegisproxy.io"
+)
+
+// providerObject is implemented by the provider CRDs
+type providerObject interface {
+	client.Object
+	conditionsGetter
+	StatusConditions() *[]metav1.Condition
+	GetReconcileStatus() *aegisv1.ReconcileStatus
+}
+
+// healthStatusGetter is implemented by the provider CRDs of the backends
+// whose connectivity is checked
+type healthStatusGetter interface {
+	GetHealthStatus() *aegisv1.ProviderHealthStatus
+}
+
+// providerExtension holds the steps of the reconciliation of the CRDs of a
+// backend that are specific to it
+type providerExtension struct {
+	// sync runs after the health check of the provider object obj of the
+	// given kind; the status of obj is updated after it returns
+	sync func(ctx context.Context, r *ProviderReconciler, kind string, obj providerObject) (ctrl.Result, error)
+	// watch adds the watches of the controller of the given kind
+	watch func(r *ProviderReconciler, kind string, b *builder.Builder) *builder.Builder
+}
+
+// providerExtensions are the extensions of the backends, by namespaced provider kind
+var providerExtensions = map[string]providerExtension{
+	"AWSProvider":        awsProviderExtension,
+	"KubernetesProvider": kubernetesProviderExtension,
+}
+
+// ProviderReconciler reconciles the namespaced or cluster scoped CRDs of a
+// kind of the provider registry
+type ProviderReconciler struct {
+	client.Client
+	Scheme  *runtime.Scheme
+	Options ReconcileOptions
+	// Kind is the namespaced or cluster scoped provider kind reconciled
+	Kind string
+}
+
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=hashicorpvaultproviders;clusterhashicorpvaultproviders,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=hashicorpvaultproviders/status;clusterhashicorpvaultproviders/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=hashicorpvaultproviders/finalizers;clusterhashicorpvaultproviders/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=azureproviders;clusterazureproviders,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=azureproviders/status;clusterazureproviders/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=azureproviders/finalizers;clusterazureproviders/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=kubernetesproviders;clusterkubernetesproviders,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=kubernetesproviders/status;clusterkubernetesproviders/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=kubernetesproviders/finalizers;clusterkubernetesproviders/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=awsproviders;clusterawsproviders,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=awsproviders/status;clusterawsproviders/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=awsproviders/finalizers;clusterawsproviders/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=gcpproviders;clustergcpproviders,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=gcpproviders/status;clustergcpproviders/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=gcpproviders/finalizers;clustergcpproviders/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=oidcproviders;clusteroidcproviders,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=oidcproviders/status;clusteroidcproviders/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=oidcproviders/finalizers;clusteroidcproviders/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=spireproviders;clusterspireproviders,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=spireproviders/status;clusterspireproviders/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aegis.aegisproxy.io,resources=spireproviders/finalizers;clusterspireproviders/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.3/pkg/reconcile
+func (r *ProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	provider, obj, err := r.newObject()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return r.Options.reconcile(ctx, r.Client, req, obj, obj.GetReconcileStatus(), func() (ctrl.Result, error) {
+		return r.reconcile(ctx, req, provider, obj)
+	})
+}
+
+// newObject returns the registry entry of the kind of r and an empty object of the kind
+func (r *ProviderReconciler) newObject() (idp.Provider, providerObject, error) {
+	provider, ok := idp.Lookup(r.Kind)
+	if !ok {
+		return provider, nil, fmt.Errorf("unknown identity provider kind %s", r.Kind)
+	}
+	obj, ok := provider.NewObjectForKind(r.Kind).(providerObject)
+	if !ok {
+		return provider, nil, fmt.Errorf("identity provider kind %s has no status conditions", r.Kind)
+	}
+	return provider, obj, nil
+}
+
+func (r *ProviderReconciler) reconcile(ctx context.Context, req ctrl.Request, provider idp.Provider, obj providerObject) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// Log the request details
+	log.Info("Reconciling "+r.Kind, "name", req.Name, "namespace", req.Namespace)
+	// Fetch the provider object
+	err := r.Get(ctx, req.NamespacedName, obj)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info(r.Kind + " resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "unable to fetch "+r.Kind)
+		return ctrl.Result{}, err
+	}
+
+	if !obj.GetDeletionTimestamp().IsZero() {
+		log.Info(r.Kind + " is being deleted")
+		return r.finalize(ctx, obj)
+	}
+
+	if len(obj.GetConditions()) == 0 {
+		meta.SetStatusCondition(obj.StatusConditions(),
+			metav1.Condition{Type: typeAvailableProvider,
+				Status:  metav1.ConditionUnknown,
+				Reason:  "Reconciling",
+				Message: "Starting reconciliation"})
+		if err = r.Status().Update(ctx, obj); err != nil {
+			log.Error(err, "Failed to update "+r.Kind+" status to Reconciling")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+			log.Error(err, "Failed to re-fetch "+r.Kind)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// appending finalizer
+	if controllerutil.AddFinalizer(obj, providerFinalizerName) {
+		if err := r.Update(ctx, obj); err != nil {
+			log.Error(err, "Failed to update "+r.Kind+" to add finalizer")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// check the connectivity with the backend
+	var healthErr error
+	if health, ok := obj.(healthStatusGetter); ok {
+		healthErr = checkProviderHealth(ctx, r.Client, r.Kind, obj, obj.StatusConditions(), health.GetHealthStatus())
+	}
+
+	available := metav1.Condition{Type: typeAvailableProvider,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Reconciled",
+		Message: r.Kind + " reconciled"}
+	if healthErr != nil {
+		available.Status, available.Reason, available.Message = metav1.ConditionFalse, "Unhealthy", healthErr.Error()
+	}
+	meta.SetStatusCondition(obj.StatusConditions(), available)
+
+	var result ctrl.Result
+	var syncErr error
+	if ext := providerExtensions[provider.Kind]; ext.sync != nil {
+		result, syncErr = ext.sync(ctx, r, r.Kind, obj)
+	}
+
+	if err := r.Status().Update(ctx, obj); err != nil {
+		log.Error(err, "Failed to update "+r.Kind+" status to Reconciled")
+		return ctrl.Result{}, err
+	}
+	// unhealthy providers are retried with the backoff of the options, not at
+	// the next resync
+	if healthErr != nil {
+		log.Error(healthErr, r.Kind+" health check failed")
+		return ctrl.Result{}, healthErr
+	}
+
+	return result, syncErr
+}
+
+// finalize deletes the identities of the provider object obj being deleted
+// and removes its finalizer once they are gone
+func (r *ProviderReconciler) finalize(ctx context.Context, obj providerObject) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// List all identities with matching provider label. The identities of a
+	// namespaced provider live in its namespace, those of a cluster scoped
+	// one in any namespace.
+	identityList := &aegisv1.IdentityList{}
+	opts := []client.ListOption{client.MatchingLabels{
+		labelIdentityProvider:     obj.GetName(),
+		labelIdentityProviderKind: r.Kind,
+	}}
+	if obj.GetNamespace() != "" {
+		opts = append(opts, client.InNamespace(obj.GetNamespace()))
+	}
+	if err := r.List(ctx, identityList, opts...); err != nil {
+		log.Error(err, "Failed to list identities")
+		return ctrl.Result{}, err
+	}
+
+	// Delete each identity
+	for _, identity := range identityList.Items {
+		log.Info("Deleting identity", "identity", identity.Name)
+		if err := r.Delete(ctx, &identity); err != nil {
+			log.Error(err, "Failed to delete identity", "identity", identity.Name)
+			return ctrl.Result{}, err
+		}
+	}
+	// check for deletion
+	for _, identity := range identityList.Items {
+		idObj := &aegisv1.Identity{}
+		if err := r.Get(ctx, types.NamespacedName{Name: identity.Name, Namespace: identity.Namespace}, idObj); err == nil {
+			log.Info("identity not deleted yet", "identity", identity.Name)
+			return ctrl.Result{Requeue: true}, nil
+		}
+	}
+
+	// now delete the provider finalizer
+	if controllerutil.RemoveFinalizer(obj, providerFinalizerName) {
+		log.Info("Deleting " + r.Kind + " finalizer")
+		if err := r.Update(ctx, obj); err != nil {
+			log.Error(err, "Failed to update "+r.Kind+" to remove finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	provider, obj, err := r.newObject()
+	if err != nil {
+		return err
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
+		// status updates of the health checks must not trigger a new check
+		For(obj, builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	if ext := providerExtensions[provider.Kind]; ext.watch != nil {
+		b = ext.watch(r, r.Kind, b)
+	}
+	return b.WithOptions(r.Options.controllerOptions()).
+		Complete(r)
+}
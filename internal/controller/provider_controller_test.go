@@ -0,0 +1,197 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+// providerFixture is a provider object reconciled by the tests, with the
+// spec fields required by its CRD
+type providerFixture struct {
+	kind   string
+	object func() client.Object
+}
+
+func providerFixtures(name string) []providerFixture {
+	namespaced := metav1.ObjectMeta{Name: name, Namespace: "default"}
+	cluster := metav1.ObjectMeta{Name: name}
+	gcp := aegisv1.GCPProviderSpec{
+		ProjectID:     "aegis-project",
+		ProjectNumber: "123456",
+		PoolID:        "aegis-pool",
+	}
+	oidc := aegisv1.OIDCProviderSpec{
+		IssuerURL:       "https://keycloak.example.com/realms/aegis",
+		ClientID:        "aegis-operator",
+		ClientSecretRef: aegisv1.SecretKeyRef{Name: "aegis-operator", Key: "clientSecret"},
+	}
+	clusterOIDC := oidc
+	clusterOIDC.ClientSecretRef.Namespace = "default"
+	spire := aegisv1.SPIREProviderSpec{
+		TrustDomain: "example.org",
+		ParentID:    "spiffe://example.org/spire/agent/k8s_psat/cluster",
+	}
+
+	return []providerFixture{
+		{"HashicorpVaultProvider", func() client.Object { return &aegisv1.HashicorpVaultProvider{ObjectMeta: namespaced} }},
+		{"ClusterHashicorpVaultProvider", func() client.Object { return &aegisv1.ClusterHashicorpVaultProvider{ObjectMeta: cluster} }},
+		{"AzureProvider", func() client.Object { return &aegisv1.AzureProvider{ObjectMeta: namespaced} }},
+		{"ClusterAzureProvider", func() client.Object { return &aegisv1.ClusterAzureProvider{ObjectMeta: cluster} }},
+		{"KubernetesProvider", func() client.Object { return &aegisv1.KubernetesProvider{ObjectMeta: namespaced} }},
+		{"ClusterKubernetesProvider", func() client.Object { return &aegisv1.ClusterKubernetesProvider{ObjectMeta: cluster} }},
+		{"AWSProvider", func() client.Object { return &aegisv1.AWSProvider{ObjectMeta: namespaced} }},
+		{"ClusterAWSProvider", func() client.Object { return &aegisv1.ClusterAWSProvider{ObjectMeta: cluster} }},
+		{"GCPProvider", func() client.Object { return &aegisv1.GCPProvider{ObjectMeta: namespaced, Spec: gcp} }},
+		{"ClusterGCPProvider", func() client.Object {
+			return &aegisv1.ClusterGCPProvider{ObjectMeta: cluster, Spec: aegisv1.ClusterGCPProviderSpec{GCPProviderSpec: gcp}}
+		}},
+		{"OIDCProvider", func() client.Object { return &aegisv1.OIDCProvider{ObjectMeta: namespaced, Spec: oidc} }},
+		{"ClusterOIDCProvider", func() client.Object {
+			return &aegisv1.ClusterOIDCProvider{ObjectMeta: cluster, Spec: aegisv1.ClusterOIDCProviderSpec{OIDCProviderSpec: clusterOIDC}}
+		}},
+		{"SPIREProvider", func() client.Object { return &aegisv1.SPIREProvider{ObjectMeta: namespaced, Spec: spire} }},
+		{"ClusterSPIREProvider", func() client.Object {
+			return &aegisv1.ClusterSPIREProvider{ObjectMeta: cluster, Spec: aegisv1.ClusterSPIREProviderSpec{SPIREProviderSpec: spire}}
+		}},
+	}
+}
+
+var _ = Describe("Provider Controller", func() {
+	const resourceName = "test-resource"
+
+	ctx := context.Background()
+
+	It("should cover every registered provider kind", func() {
+		covered := map[string]bool{}
+		for _, fixture := range providerFixtures(resourceName) {
+			covered[fixture.kind] = true
+		}
+		for _, provider := range idp.Providers() {
+			Expect(covered).To(HaveKey(provider.Kind))
+			Expect(covered).To(HaveKey(provider.ClusterKind))
+		}
+	})
+
+	for _, fixture := range providerFixtures(resourceName) {
+		fixture := fixture
+
+		Context("When reconciling a "+fixture.kind, func() {
+			BeforeEach(func() {
+				By("creating the custom resource for the Kind " + fixture.kind)
+				resource := fixture.object()
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(resource), fixture.object())
+				if err != nil && errors.IsNotFound(err) {
+					Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+				}
+			})
+
+			AfterEach(func() {
+				resource := fixture.object()
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(resource), resource)
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Cleanup the specific resource instance " + fixture.kind)
+				Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			})
+			It("should successfully reconcile the resource", func() {
+				By("Reconciling the created resource")
+				controllerReconciler := &ProviderReconciler{
+					Client: k8sClient,
+					Scheme: k8sClient.Scheme(),
+					Kind:   fixture.kind,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: client.ObjectKeyFromObject(fixture.object()),
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	}
+})
+
+var _ = Describe("Key set mirroring", func() {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	Expect(aegisv1.AddToScheme(scheme)).To(Succeed())
+	Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	// keySetConfigMap returns a ConfigMap labeled as the key set of the
+	// KubernetesProvider "remote", controlled by the owner with uid
+	keySetConfigMap := func(namespace string, uid types.UID) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      kubernetesKeySetConfigMapName("KubernetesProvider", "remote"),
+			Labels: map[string]string{
+				labelIdentityProvider:     "remote",
+				labelIdentityProviderKind: "KubernetesProvider",
+			},
+		}}
+		if uid != "" {
+			controller := true
+			cm.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: aegisv1.GroupVersion.String(),
+				Kind:       "KubernetesProvider",
+				Name:       "remote",
+				UID:        uid,
+				Controller: &controller,
+			}}
+		}
+		return cm
+	}
+
+	It("should only delete the ConfigMaps controlled by the provider", func() {
+		owner := &aegisv1.KubernetesProvider{ObjectMeta: metav1.ObjectMeta{Name: "remote", Namespace: "team-a", UID: "uid-a"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			// the provider of the same name in another namespace
+			keySetConfigMap("team-b", "uid-b"),
+			// a ConfigMap labeled by anyone
+			keySetConfigMap("team-c", ""),
+		).Build()
+
+		name := kubernetesKeySetConfigMapName("KubernetesProvider", "remote")
+		Expect(mirrorKubernetesKeySet(ctx, c, scheme, "KubernetesProvider", owner, name, `{"keys":[]}`, []string{"team-a"})).To(Succeed())
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "team-a", Name: name}, cm)).To(Succeed())
+		Expect(metav1.IsControlledBy(cm, owner)).To(BeTrue())
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "team-b", Name: name}, cm)).To(Succeed())
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "team-c", Name: name}, cm)).To(Succeed())
+
+		// the ConfigMaps of the provider no longer wanted are deleted
+		other := &aegisv1.KubernetesProvider{ObjectMeta: metav1.ObjectMeta{Name: "remote", Namespace: "team-b", UID: "uid-b"}}
+		Expect(mirrorKubernetesKeySet(ctx, c, scheme, "KubernetesProvider", other, name, `{"keys":[]}`, nil)).To(Succeed())
+		Expect(errors.IsNotFound(c.Get(ctx, client.ObjectKey{Namespace: "team-b", Name: name}, cm))).To(BeTrue())
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "team-a", Name: name}, cm)).To(Succeed())
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "team-c", Name: name}, cm)).To(Succeed())
+	})
+})
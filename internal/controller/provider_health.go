@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+const (
+	typeReachableProvider     = "Reachable"
+	typeAuthenticatedProvider = "Authenticated"
+)
+
+// conditionsGetter is implemented by the provider CRDs
+type conditionsGetter interface {
+	GetConditions() []metav1.Condition
+}
+
+// checkProviderHealth probes the backend configured by the provider object obj
+// of the given kind and records the result in its Reachable and Authenticated
+// conditions and in its health status. Providers whose configuration cannot be
+// read are not Authenticated. The probe error is returned so that
+// failed checks are retried with backoff.
+func checkProviderHealth(ctx context.Context, c client.Client, kind string, obj client.Object, conditions *[]metav1.Condition, health *aegisv1.ProviderHealthStatus) error {
+	log := log.FromContext(ctx)
+
+	provider, ok := idp.Lookup(kind)
+	if !ok {
+		return fmt.Errorf("unknown identity provider kind %s", kind)
+	}
+	idHelper, err := provider.New(ctx, c, obj)
+	if err != nil {
+		// the credentials or the other objects referenced by the provider
+		// cannot be read, e.g. because they are in another namespace
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:    typeAuthenticatedProvider,
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidConfiguration",
+			Message: err.Error(),
+		})
+		return err
+	}
+	checker, ok := idHelper.(idp.HealthChecker)
+	if !ok {
+		return nil
+	}
+
+	log.Info("Checking identity provider health", "kind", kind, "provider", obj.GetName())
+	result := checker.CheckHealth(ctx)
+
+	reachable := metav1.Condition{Type: typeReachableProvider, Status: metav1.ConditionTrue, Reason: "Reachable", Message: "Backend reachable"}
+	authenticated := metav1.Condition{Type: typeAuthenticatedProvider, Status: metav1.ConditionTrue, Reason: "Authenticated", Message: "Logged in to the backend"}
+	switch {
+	case !result.Reachable:
+		reachable.Status, reachable.Reason, reachable.Message = metav1.ConditionFalse, "Unreachable", errorMessage(result.Err)
+		authenticated.Status, authenticated.Reason, authenticated.Message = metav1.ConditionUnknown, "Unreachable", "Backend unreachable"
+	case !result.Authenticated:
+		authenticated.Status, authenticated.Reason, authenticated.Message = metav1.ConditionFalse, "AuthenticationFailed", errorMessage(result.Err)
+	}
+	meta.SetStatusCondition(conditions, reachable)
+	meta.SetStatusCondition(conditions, authenticated)
+
+	if result.Version != "" {
+		health.BackendVersion = result.Version
+	}
+	if result.Reachable && result.Authenticated && result.Err == nil {
+		now := metav1.Now()
+		health.LastSuccessfulCheckTime = &now
+		return nil
+	}
+	if result.Err == nil {
+		return fmt.Errorf("%s %s health check failed", kind, obj.GetName())
+	}
+	return result.Err
+}
+
+// checkProviderUsable returns an error if the last health check of the
+// provider failed. Providers never checked are considered usable.
+func checkProviderUsable(match providerMatch) error {
+	cg, ok := match.object.(conditionsGetter)
+	if !ok {
+		return nil
+	}
+	for _, conditionType := range []string{typeReachableProvider, typeAuthenticatedProvider} {
+		if c := meta.FindStatusCondition(cg.GetConditions(), conditionType); c != nil && c.Status == metav1.ConditionFalse {
+			return fmt.Errorf("identity provider %s %s is not healthy: %s", match.kind(), match.object.GetName(), c.Message)
+		}
+	}
+	return nil
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+const (
+	DefaultIdentityResyncInterval      = 10 * time.Minute
+	DefaultProviderResyncInterval      = 30 * time.Minute
+	DefaultIngressPolicyResyncInterval = 30 * time.Minute
+	DefaultBaseBackoff                 = 5 * time.Second
+	DefaultMaxBackoff                  = 5 * time.Minute
+)
+
+// ReconcileOptions configures how often objects are reconciled again and how
+// failed reconciliations are retried
+type ReconcileOptions struct {
+	// ResyncInterval is the delay before reconciling a successfully reconciled object again.
+	// Zero disables the periodic resync.
+	ResyncInterval time.Duration
+	// BaseBackoff is the delay before retrying the first failure; it doubles on each
+	// consecutive failure up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// MaxConcurrentReconciles is the maximum number of concurrent reconciles of the controller
+	MaxConcurrentReconciles int
+	// RateLimiterQPS and RateLimiterBurst bound the overall rate of the controller work queue.
+	// The default controller-runtime rate limiter is used when RateLimiterQPS is zero.
+	RateLimiterQPS   float64
+	RateLimiterBurst int
+}
+
+// controllerOptions returns the controller-runtime options of a controller.
+// Every controller gets its own rate limiter.
+func (o ReconcileOptions) controllerOptions() crcontroller.Options {
+	opts := crcontroller.Options{
+		MaxConcurrentReconciles: o.MaxConcurrentReconciles,
+	}
+	if o.RateLimiterQPS > 0 {
+		opts.RateLimiter = workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(o.baseBackoff(), o.maxBackoff()),
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(o.RateLimiterQPS), o.RateLimiterBurst)},
+		)
+	}
+	return opts
+}
+
+func (o ReconcileOptions) baseBackoff() time.Duration {
+	if o.BaseBackoff <= 0 {
+		return DefaultBaseBackoff
+	}
+	return o.BaseBackoff
+}
+
+func (o ReconcileOptions) maxBackoff() time.Duration {
+	if o.MaxBackoff <= 0 {
+		return DefaultMaxBackoff
+	}
+	return o.MaxBackoff
+}
+
+// backoff returns the delay before retrying after failures consecutive failures
+func (o ReconcileOptions) backoff(failures int32) time.Duration {
+	delay := o.baseBackoff()
+	for i := int32(1); i < failures && delay < o.maxBackoff(); i++ {
+		delay *= 2
+	}
+	if delay > o.maxBackoff() {
+		return o.maxBackoff()
+	}
+	return delay
+}
+
+// pendingBackoff returns the time left before obj can be reconciled again
+// after a failure, or zero if it can be reconciled now. Objects being
+// deleted or whose spec changed since the failure are never delayed.
+func (o ReconcileOptions) pendingBackoff(obj client.Object, status *aegisv1.ReconcileStatus) time.Duration {
+	if status.ConsecutiveFailures == 0 || status.LastAttemptTime == nil || !obj.GetDeletionTimestamp().IsZero() ||
+		status.LastAttemptGeneration != obj.GetGeneration() {
+		return 0
+	}
+	remaining := time.Until(status.LastAttemptTime.Add(o.backoff(status.ConsecutiveFailures)))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// reconcile runs reconcileFn on obj unless obj is backing off after a failed
+// attempt, then requeues obj. reconcileFn fetches obj itself; status must point
+// to the ReconcileStatus of obj.
+func (o ReconcileOptions) reconcile(ctx context.Context, c client.Client, req ctrl.Request, obj client.Object, status *aegisv1.ReconcileStatus, reconcileFn func() (ctrl.Result, error)) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if err := c.Get(ctx, req.NamespacedName, obj); err == nil {
+		if delay := o.pendingBackoff(obj, status); delay > 0 {
+			log.Info("Backing off after a failed reconciliation", "consecutiveFailures", status.ConsecutiveFailures, "retryAfter", delay)
+			return ctrl.Result{RequeueAfter: delay}, nil
+		}
+	}
+
+	result, err := reconcileFn()
+	return o.requeue(ctx, c, obj, status, result, err)
+}
+
+// requeue records the outcome of a reconciliation in the status of obj and
+// computes when obj must be reconciled again: failures are retried with an
+// exponential backoff, successes after the resync interval.
+func (o ReconcileOptions) requeue(ctx context.Context, c client.Client, obj client.Object, status *aegisv1.ReconcileStatus, result ctrl.Result, err error) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// object not found or being deleted
+	if obj.GetResourceVersion() == "" || !obj.GetDeletionTimestamp().IsZero() {
+		return result, err
+	}
+
+	if err != nil {
+		orig := obj.DeepCopyObject().(client.Object)
+		// the failures of a previous spec do not count
+		if status.LastAttemptGeneration != obj.GetGeneration() {
+			status.ConsecutiveFailures = 0
+		}
+		status.ConsecutiveFailures++
+		status.LastAttemptTime = &metav1.Time{Time: time.Now()}
+		status.LastAttemptGeneration = obj.GetGeneration()
+		if perr := c.Status().Patch(ctx, obj, client.MergeFrom(orig)); perr != nil {
+			log.Error(perr, "Failed to record failed reconciliation attempt")
+			return ctrl.Result{}, err
+		}
+		delay := o.backoff(status.ConsecutiveFailures)
+		log.Error(err, "Reconciliation failed, backing off", "consecutiveFailures", status.ConsecutiveFailures, "retryAfter", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	if status.ConsecutiveFailures > 0 {
+		orig := obj.DeepCopyObject().(client.Object)
+		status.ConsecutiveFailures = 0
+		status.LastAttemptTime = nil
+		status.LastAttemptGeneration = 0
+		if perr := c.Status().Patch(ctx, obj, client.MergeFrom(orig)); perr != nil {
+			log.Error(perr, "Failed to reset failed reconciliation attempts")
+			return ctrl.Result{}, perr
+		}
+	}
+
+	if result.IsZero() && o.ResyncInterval > 0 {
+		result.RequeueAfter = o.ResyncInterval
+	}
+	return result, nil
+}
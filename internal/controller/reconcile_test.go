@@ -0,0 +1,71 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+var _ = Describe("ReconcileOptions", func() {
+	opts := ReconcileOptions{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	It("should double the backoff up to the maximum", func() {
+		Expect(opts.backoff(1)).To(Equal(time.Second))
+		Expect(opts.backoff(2)).To(Equal(2 * time.Second))
+		Expect(opts.backoff(4)).To(Equal(8 * time.Second))
+		Expect(opts.backoff(5)).To(Equal(10 * time.Second))
+		Expect(opts.backoff(100)).To(Equal(10 * time.Second))
+	})
+
+	It("should delay objects that failed recently", func() {
+		identity := &aegisv1.Identity{}
+		Expect(opts.pendingBackoff(identity, &identity.Status.ReconcileStatus)).To(BeZero())
+
+		identity.Status.ConsecutiveFailures = 3
+		identity.Status.LastAttemptTime = &metav1.Time{Time: time.Now()}
+		Expect(opts.pendingBackoff(identity, &identity.Status.ReconcileStatus)).To(BeNumerically(">", 3*time.Second))
+
+		identity.Status.LastAttemptTime = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+		Expect(opts.pendingBackoff(identity, &identity.Status.ReconcileStatus)).To(BeZero())
+	})
+
+	It("should not delay objects whose spec changed since the failure", func() {
+		identity := &aegisv1.Identity{}
+		identity.Generation = 2
+		identity.Status.ConsecutiveFailures = 3
+		identity.Status.LastAttemptTime = &metav1.Time{Time: time.Now()}
+		identity.Status.LastAttemptGeneration = 2
+		Expect(opts.pendingBackoff(identity, &identity.Status.ReconcileStatus)).To(BeNumerically(">", 3*time.Second))
+
+		identity.Generation = 3
+		Expect(opts.pendingBackoff(identity, &identity.Status.ReconcileStatus)).To(BeZero())
+	})
+
+	It("should not delay objects being deleted", func() {
+		identity := &aegisv1.Identity{}
+		identity.Status.ConsecutiveFailures = 3
+		identity.Status.LastAttemptTime = &metav1.Time{Time: time.Now()}
+		identity.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		Expect(opts.pendingBackoff(identity, &identity.Status.ReconcileStatus)).To(BeZero())
+	})
+})
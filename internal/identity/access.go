@@ -0,0 +1,23 @@
+package identity
+
+import (
+	"context"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+// AccessGranter is implemented by the backends able to enforce the ingress
+// policies on the IdP itself, so that it refuses to issue tokens for an
+// identity to the callers not allowed by its policies. It is optional: the
+// ingress policies of the identities of other providers are only enforced by
+// the aegis-proxy.
+type AccessGranter interface {
+	// GrantAccess restricts the access to callee to the callers, the subjects
+	// of the service account tokens of the allowed identities (e.g.
+	// system:serviceaccount:default:app), and revokes it from any other
+	// identity. Callers unknown to the IdP are ignored.
+	GrantAccess(ctx context.Context, callee *aegisv1.Identity, callers []string) error
+	// RevokeAccess revokes the access granted to callee and lifts the
+	// restriction, once no policy protects it anymore
+	RevokeAccess(ctx context.Context, callee *aegisv1.Identity) error
+}
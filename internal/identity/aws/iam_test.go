@@ -0,0 +1,466 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	testIssuer  = "https://oidc.example.com/cluster"
+	testAccount = "123456789012"
+)
+
+type iamRole struct {
+	Path                     string
+	RoleName                 string
+	RoleId                   string
+	Arn                      string
+	AssumeRolePolicyDocument string
+	PermissionsBoundary      *iamPermissionsBoundary `xml:",omitempty"`
+	Tags                     []iamTag                `xml:"Tags>member,omitempty"`
+	// Policies are the ARNs of the managed policies attached to the role
+	Policies map[string]bool `xml:"-"`
+	// InlinePolicies are the names of the inline policies of the role
+	InlinePolicies []string `xml:"-"`
+}
+
+type iamTag struct {
+	Key   string
+	Value string
+}
+
+type iamPermissionsBoundary struct {
+	PermissionsBoundaryType string
+	PermissionsBoundaryArn  string
+}
+
+type iamAttachedPolicy struct {
+	PolicyName string
+	PolicyArn  string
+}
+
+type iamOIDCProvider struct {
+	Url            string
+	ClientIDList   []string `xml:"ClientIDList>member"`
+	ThumbprintList []string `xml:"ThumbprintList>member"`
+	Tags           []iamTag `xml:"Tags>member,omitempty"`
+}
+
+type cognitoIdentityPool struct {
+	IdentityPoolId                 string
+	IdentityPoolName               string
+	AllowUnauthenticatedIdentities bool
+	OpenIdConnectProviderARNs      []string          `json:",omitempty"`
+	SupportedLoginProviders        map[string]string `json:",omitempty"`
+}
+
+type cognitoRequest struct {
+	cognitoIdentityPool
+	IdentityId          string
+	Logins              map[string]string
+	LoginsToRemove      []string
+	IdentityIdsToDelete []string
+}
+
+type stsCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string
+}
+
+// assumedRole is a role assumed on the fake STS
+type assumedRole struct {
+	Action     string
+	RoleArn    string
+	ExternalId string
+	// Token is the web identity token of AssumeRoleWithWebIdentity
+	Token string
+	// Caller is the access key that signed the request
+	Caller string
+}
+
+// fakeIAM is an in memory stand-in of the IAM, STS and Cognito endpoints used by the helper
+type fakeIAM struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	roles map[string]*iamRole
+	// oidcProviders are the OpenID Connect providers by ARN
+	oidcProviders map[string]*iamOIDCProvider
+	// pools are the Cognito identity pools by id
+	pools map[string]*cognitoIdentityPool
+	// identities are the logins of the Cognito identities by id, the tokens by provider
+	identities map[string]map[string]string
+	// assumed are the roles assumed with STS, in order
+	assumed []assumedRole
+	// cognitoCallers are the access keys that signed the Cognito requests
+	cognitoCallers map[string]bool
+}
+
+func newFakeIAM(t *testing.T) *fakeIAM {
+	f := &fakeIAM{
+		roles:          map[string]*iamRole{},
+		oidcProviders:  map[string]*iamOIDCProvider{},
+		pools:          map[string]*cognitoIdentityPool{},
+		identities:     map[string]map[string]string{},
+		cognitoCallers: map[string]bool{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// newHelper returns a helper managing the roles on the fake IAM with static credentials
+func (f *fakeIAM) newHelper(t *testing.T) *IdentityHelper {
+	h := New("eu-west-1", "", "", nil, &idp.Credentials{Secret: map[string][]byte{
+		idp.CredentialAccessKeyID:     []byte("AKIDEXAMPLE"),
+		idp.CredentialSecretAccessKey: []byte("secret"),
+	}})
+	h.clientKey = idp.ClientKey{UID: types.UID(t.Name())}
+	h.endpoint = f.URL
+	h.issuer = func(ctx context.Context) (string, error) { return testIssuer, nil }
+	return h
+}
+
+// role returns a copy of the role name
+func (f *fakeIAM) role(name string) (iamRole, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	role, ok := f.roles[name]
+	if !ok {
+		return iamRole{}, false
+	}
+	return *role, true
+}
+
+// policies returns the sorted ARNs of the managed policies attached to the role name
+func (f *fakeIAM) policies(name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policies := []string{}
+	if role, ok := f.roles[name]; ok {
+		for policyARN := range role.Policies {
+			policies = append(policies, policyARN)
+		}
+	}
+	sort.Strings(policies)
+	return policies
+}
+
+func (f *fakeIAM) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		// GetId and UnlinkIdentity are not signed
+		if key := accessKey(r); key != "" {
+			f.cognitoCallers[key] = true
+		}
+		f.serveCognito(w, r, strings.TrimPrefix(target, "AWSCognitoIdentityService."))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := r.Form.Get("Action")
+	if action == "AssumeRoleWithWebIdentity" || action == "AssumeRole" {
+		assumed := assumedRole{
+			Action:     action,
+			RoleArn:    r.Form.Get("RoleArn"),
+			ExternalId: r.Form.Get("ExternalId"),
+			Token:      r.Form.Get("WebIdentityToken"),
+			Caller:     accessKey(r),
+		}
+		f.assumed = append(f.assumed, assumed)
+		respond(w, action, struct{ Credentials stsCredentials }{stsCredentials{
+			AccessKeyId:     fmt.Sprintf("ASIA%d", len(f.assumed)),
+			SecretAccessKey: "secret",
+			SessionToken:    "session",
+			Expiration:      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		}})
+		return
+	}
+	if action == "GetCallerIdentity" {
+		respond(w, action, struct {
+			Arn     string
+			Account string
+			UserId  string
+		}{Arn: "arn:aws:iam::" + testAccount + ":user/operator", Account: testAccount, UserId: "AIDAOPERATOR"})
+		return
+	}
+
+	if strings.HasSuffix(action, "OpenIDConnectProvider") || strings.HasSuffix(action, "OpenIDConnectProviderThumbprint") {
+		f.serveOIDCProvider(w, r, action)
+		return
+	}
+
+	name := r.Form.Get("RoleName")
+	role, exists := f.roles[name]
+	if action == "CreateRole" {
+		if exists {
+			respondError(w, http.StatusConflict, "EntityAlreadyExists", "Role "+name+" already exists")
+			return
+		}
+		role = &iamRole{
+			Path:                     r.Form.Get("Path"),
+			RoleName:                 name,
+			RoleId:                   "AROA" + name,
+			Arn:                      fmt.Sprintf("arn:aws:iam::%s:role%s%s", testAccount, r.Form.Get("Path"), name),
+			AssumeRolePolicyDocument: r.Form.Get("AssumeRolePolicyDocument"),
+			Policies:                 map[string]bool{},
+		}
+		for i := 1; r.Form.Has(fmt.Sprintf("Tags.member.%d.Key", i)); i++ {
+			role.Tags = append(role.Tags, iamTag{Key: r.Form.Get(fmt.Sprintf("Tags.member.%d.Key", i)), Value: r.Form.Get(fmt.Sprintf("Tags.member.%d.Value", i))})
+		}
+		if boundary := r.Form.Get("PermissionsBoundary"); boundary != "" {
+			role.PermissionsBoundary = &iamPermissionsBoundary{PermissionsBoundaryType: "Policy", PermissionsBoundaryArn: boundary}
+		}
+		f.roles[name] = role
+		respond(w, action, struct{ Role *iamRole }{role})
+		return
+	}
+	if !exists {
+		respondError(w, http.StatusNotFound, "NoSuchEntity", "The role with name "+name+" cannot be found.")
+		return
+	}
+
+	switch action {
+	case "GetRole":
+		// IAM returns the trust policy URL encoded
+		encoded := *role
+		encoded.AssumeRolePolicyDocument = url.QueryEscape(role.AssumeRolePolicyDocument)
+		respond(w, action, struct{ Role *iamRole }{&encoded})
+	case "UpdateAssumeRolePolicy":
+		role.AssumeRolePolicyDocument = r.Form.Get("PolicyDocument")
+		respond(w, action, struct{}{})
+	case "PutRolePermissionsBoundary":
+		role.PermissionsBoundary = &iamPermissionsBoundary{PermissionsBoundaryType: "Policy", PermissionsBoundaryArn: r.Form.Get("PermissionsBoundary")}
+		respond(w, action, struct{}{})
+	case "DeleteRolePermissionsBoundary":
+		role.PermissionsBoundary = nil
+		respond(w, action, struct{}{})
+	case "ListAttachedRolePolicies":
+		policies := []iamAttachedPolicy{}
+		for policyARN := range role.Policies {
+			policies = append(policies, iamAttachedPolicy{PolicyName: policyARN, PolicyArn: policyARN})
+		}
+		respond(w, action, struct {
+			AttachedPolicies []iamAttachedPolicy `xml:"AttachedPolicies>member"`
+			IsTruncated      bool
+		}{AttachedPolicies: policies})
+	case "AttachRolePolicy":
+		role.Policies[r.Form.Get("PolicyArn")] = true
+		respond(w, action, struct{}{})
+	case "DetachRolePolicy":
+		if !role.Policies[r.Form.Get("PolicyArn")] {
+			respondError(w, http.StatusNotFound, "NoSuchEntity", "Policy "+r.Form.Get("PolicyArn")+" was not found.")
+			return
+		}
+		delete(role.Policies, r.Form.Get("PolicyArn"))
+		respond(w, action, struct{}{})
+	case "ListRolePolicies":
+		respond(w, action, struct {
+			PolicyNames []string `xml:"PolicyNames>member"`
+			IsTruncated bool
+		}{PolicyNames: role.InlinePolicies})
+	case "DeleteRolePolicy":
+		for i, policyName := range role.InlinePolicies {
+			if policyName == r.Form.Get("PolicyName") {
+				role.InlinePolicies = append(role.InlinePolicies[:i], role.InlinePolicies[i+1:]...)
+				break
+			}
+		}
+		respond(w, action, struct{}{})
+	case "DeleteRole":
+		if len(role.Policies) > 0 || len(role.InlinePolicies) > 0 {
+			respondError(w, http.StatusConflict, "DeleteConflict", "Cannot delete entity, must detach all policies first.")
+			return
+		}
+		delete(f.roles, name)
+		respond(w, action, struct{}{})
+	default:
+		respondError(w, http.StatusBadRequest, "InvalidAction", "Unexpected action "+action)
+	}
+}
+
+func (f *fakeIAM) serveOIDCProvider(w http.ResponseWriter, r *http.Request, action string) {
+	if action == "CreateOpenIDConnectProvider" {
+		providerARN := fmt.Sprintf("arn:aws:iam::%s:oidc-provider/%s", testAccount, strings.TrimPrefix(r.Form.Get("Url"), "https://"))
+		if _, exists := f.oidcProviders[providerARN]; exists {
+			respondError(w, http.StatusConflict, "EntityAlreadyExists", "Provider with url "+r.Form.Get("Url")+" already exists.")
+			return
+		}
+		provider := &iamOIDCProvider{
+			Url:            strings.TrimPrefix(r.Form.Get("Url"), "https://"),
+			ClientIDList:   formList(r.Form, "ClientIDList"),
+			ThumbprintList: formList(r.Form, "ThumbprintList"),
+		}
+		for i := 1; r.Form.Has(fmt.Sprintf("Tags.member.%d.Key", i)); i++ {
+			provider.Tags = append(provider.Tags, iamTag{Key: r.Form.Get(fmt.Sprintf("Tags.member.%d.Key", i)), Value: r.Form.Get(fmt.Sprintf("Tags.member.%d.Value", i))})
+		}
+		f.oidcProviders[providerARN] = provider
+		respond(w, action, struct{ OpenIDConnectProviderArn string }{providerARN})
+		return
+	}
+
+	providerARN := r.Form.Get("OpenIDConnectProviderArn")
+	provider, exists := f.oidcProviders[providerARN]
+	if !exists {
+		respondError(w, http.StatusNotFound, "NoSuchEntity", "OpenIDConnect Provider not found for arn "+providerARN)
+		return
+	}
+	switch action {
+	case "GetOpenIDConnectProvider":
+		respond(w, action, provider)
+	case "AddClientIDToOpenIDConnectProvider":
+		provider.ClientIDList = append(provider.ClientIDList, r.Form.Get("ClientID"))
+		respond(w, action, struct{}{})
+	case "RemoveClientIDFromOpenIDConnectProvider":
+		clientIDs := []string{}
+		for _, clientID := range provider.ClientIDList {
+			if clientID != r.Form.Get("ClientID") {
+				clientIDs = append(clientIDs, clientID)
+			}
+		}
+		provider.ClientIDList = clientIDs
+		respond(w, action, struct{}{})
+	case "UpdateOpenIDConnectProviderThumbprint":
+		provider.ThumbprintList = formList(r.Form, "ThumbprintList")
+		respond(w, action, struct{}{})
+	default:
+		respondError(w, http.StatusBadRequest, "InvalidAction", "Unexpected action "+action)
+	}
+}
+
+func (f *fakeIAM) serveCognito(w http.ResponseWriter, r *http.Request, operation string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	req := &cognitoRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respondJSON := func(status int, body interface{}) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+	notFound := func(message string) {
+		respondJSON(http.StatusBadRequest, map[string]string{"__type": "ResourceNotFoundException", "message": message})
+	}
+
+	switch operation {
+	case "DescribeIdentityPool", "UpdateIdentityPool":
+		current, exists := f.pools[req.IdentityPoolId]
+		if !exists {
+			notFound("IdentityPool " + req.IdentityPoolId + " not found")
+			return
+		}
+		if operation == "UpdateIdentityPool" {
+			current = &req.cognitoIdentityPool
+			f.pools[req.IdentityPoolId] = current
+		}
+		respondJSON(http.StatusOK, current)
+	case "GetId":
+		if _, exists := f.pools[req.IdentityPoolId]; !exists {
+			notFound("IdentityPool " + req.IdentityPoolId + " not found")
+			return
+		}
+		for id, logins := range f.identities {
+			for provider, token := range req.Logins {
+				if logins[provider] == token && strings.HasPrefix(id, req.IdentityPoolId) {
+					respondJSON(http.StatusOK, map[string]string{"IdentityId": id})
+					return
+				}
+			}
+		}
+		id := fmt.Sprintf("%s-%d", req.IdentityPoolId, len(f.identities)+1)
+		f.identities[id] = req.Logins
+		respondJSON(http.StatusOK, map[string]string{"IdentityId": id})
+	case "DescribeIdentity":
+		logins, exists := f.identities[req.IdentityId]
+		if !exists {
+			notFound("Identity " + req.IdentityId + " not found")
+			return
+		}
+		providers := []string{}
+		for provider := range logins {
+			providers = append(providers, provider)
+		}
+		respondJSON(http.StatusOK, map[string]interface{}{"IdentityId": req.IdentityId, "Logins": providers})
+	case "UnlinkIdentity":
+		logins, exists := f.identities[req.IdentityId]
+		if !exists {
+			notFound("Identity " + req.IdentityId + " not found")
+			return
+		}
+		for provider, token := range req.Logins {
+			if logins[provider] != token {
+				respondJSON(http.StatusBadRequest, map[string]string{"__type": "NotAuthorizedException", "message": "Invalid login token"})
+				return
+			}
+		}
+		for _, provider := range req.LoginsToRemove {
+			delete(logins, provider)
+		}
+		respondJSON(http.StatusOK, struct{}{})
+	case "DeleteIdentities":
+		for _, id := range req.IdentityIdsToDelete {
+			delete(f.identities, id)
+		}
+		respondJSON(http.StatusOK, map[string]interface{}{"UnprocessedIdentityIds": []interface{}{}})
+	default:
+		respondJSON(http.StatusBadRequest, map[string]string{"__type": "InvalidParameterException", "message": "Unexpected operation " + operation})
+	}
+}
+
+// accessKey returns the access key that signed r, empty for unsigned requests
+func accessKey(r *http.Request) string {
+	_, credential, found := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+	if !found {
+		return ""
+	}
+	key, _, _ := strings.Cut(credential, "/")
+	return key
+}
+
+// formList returns the members of the awsQuery list name of form
+func formList(form url.Values, name string) []string {
+	members := []string{}
+	for i := 1; form.Has(fmt.Sprintf("%s.member.%d", name, i)); i++ {
+		members = append(members, form.Get(fmt.Sprintf("%s.member.%d", name, i)))
+	}
+	return members
+}
+
+// respond writes the awsQuery response of action with result
+func respond(w http.ResponseWriter, action string, result interface{}) {
+	body := &bytes.Buffer{}
+	if err := xml.NewEncoder(body).EncodeElement(result, xml.StartElement{Name: xml.Name{Local: action + "Result"}}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, "<%sResponse>%s<ResponseMetadata><RequestId>request</RequestId></ResponseMetadata></%sResponse>", action, body, action)
+}
+
+// respondError writes an awsQuery error
+func respondError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>request</RequestId></ErrorResponse>", code, message)
+}
@@ -0,0 +1,443 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	defaultRolePath = "/aegis/"
+	// maxRoleNameLength is the maximum length of the name of an IAM role
+	maxRoleNameLength = 64
+	// roleNameDigestLength is the length of the digest ending the role names
+	roleNameDigestLength = 16
+
+	// tags of the roles naming the identity owning them
+	tagIdentity          = "aegis.identity"
+	tagIdentityNamespace = "aegis.identity.namespace"
+)
+
+// IAMRoleHelper manages an IAM role per identity, trusting the tokens of the
+// service account of the identity issued by the cluster. The operator
+// credentials and the health check are the ones of the Cognito mode.
+type IAMRoleHelper struct {
+	*IdentityHelper
+	config aegisv1.AWSIAMRoleConfig
+}
+
+// NewIAMRole returns an IAMRoleHelper managing the roles with the credentials of h
+func NewIAMRole(h *IdentityHelper, config *aegisv1.AWSIAMRoleConfig) *IAMRoleHelper {
+	r := &IAMRoleHelper{IdentityHelper: h}
+	if config != nil {
+		r.config = *config
+	}
+	if r.config.Path == "" {
+		r.config.Path = defaultRolePath
+	}
+	return r
+}
+
+// roleName returns the name of the IAM role of identity: its namespace and
+// name, shortened to the IAM limit, followed by a digest of namespace/name.
+// Namespaces and names cannot contain a slash, so two identities never get
+// the same digest even when their readable prefixes are the same.
+func roleName(identity *aegisv1.Identity) string {
+	digest := sha256.Sum256([]byte(identity.Namespace + "/" + identity.Name))
+	suffix := "-" + hex.EncodeToString(digest[:])[:roleNameDigestLength]
+	name := fmt.Sprintf("aegis-%s-%s", identity.Namespace, identity.Name)
+	if len(name)+len(suffix) > maxRoleNameLength {
+		name = name[:maxRoleNameLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// checkRoleOwner refuses the roles not tagged with identity: the roles of
+// other identities and the ones created outside of the operator
+func checkRoleOwner(role *types.Role, identity *aegisv1.Identity) error {
+	tags := map[string]string{}
+	for _, tag := range role.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if tags[tagIdentity] != identity.Name || tags[tagIdentityNamespace] != identity.Namespace {
+		return fmt.Errorf("role %s is not owned by identity %s/%s", aws.ToString(role.RoleName), identity.Namespace, identity.Name)
+	}
+	return nil
+}
+
+func (r *IAMRoleHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	args := []string{
+		"--aws-region", r.region,
+	}
+	if identity != nil {
+		roleARN := identity.Status.Metadata[identityMetaID]
+		if roleARN == "" {
+			return nil, fmt.Errorf("role arn is not set for identity %s", identity.Name)
+		}
+		args = append(args, "--aws-role-arn", roleARN)
+	}
+	return args, nil
+}
+
+// oidcProviderARN returns the ARN of the IAM OIDC identity provider of the
+// issuer: the configured one, or the one of the account of the operator
+func (r *IAMRoleHelper) oidcProviderARN(ctx context.Context, issuer string) (string, error) {
+	if r.config.OIDCProviderARN != "" {
+		return r.config.OIDCProviderARN, nil
+	}
+	return r.issuerOIDCProviderARN(ctx, issuer)
+}
+
+// trustPolicy returns the trust policy of the role of identity, allowing the
+// tokens of its service account issued by issuer for its audiences
+func (r *IAMRoleHelper) trustPolicy(ctx context.Context, identity *aegisv1.Identity) (map[string]interface{}, error) {
+	options, err := idp.GetTokenOptions(r, identity)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := r.GetIssuer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	providerARN, err := r.oidcProviderARN(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	issuerHost := strings.TrimPrefix(issuer, "https://")
+	audiences := make([]interface{}, 0, len(options.Audiences))
+	for _, audience := range options.Audiences {
+		audiences = append(audiences, audience)
+	}
+	return map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []interface{}{
+			map[string]interface{}{
+				"Effect":    "Allow",
+				"Principal": map[string]interface{}{"Federated": providerARN},
+				"Action":    "sts:AssumeRoleWithWebIdentity",
+				"Condition": map[string]interface{}{
+					"StringEquals": map[string]interface{}{
+						issuerHost + ":sub": fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name),
+						issuerHost + ":aud": audiences,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// CreateIdentity creates the role of the identity, or updates its trust
+// policy, permissions boundary and managed policies when they drifted
+func (r *IAMRoleHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (_ map[string]string, err error) {
+	defer r.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	client, err := r.getIAMClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trustPolicy, err := r.trustPolicy(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	document, err := json.Marshal(trustPolicy)
+	if err != nil {
+		return nil, err
+	}
+	name := roleName(identity)
+
+	role, err := r.getRole(ctx, client, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		log.Info("Creating IAM role", "role", name)
+		input := &iam.CreateRoleInput{
+			RoleName:                 aws.String(name),
+			Path:                     aws.String(r.config.Path),
+			AssumeRolePolicyDocument: aws.String(string(document)),
+			Description:              aws.String(fmt.Sprintf("Aegis identity %s/%s", identity.Namespace, identity.Name)),
+			Tags: []types.Tag{
+				{Key: aws.String(tagIdentity), Value: aws.String(identity.Name)},
+				{Key: aws.String(tagIdentityNamespace), Value: aws.String(identity.Namespace)},
+			},
+		}
+		if r.config.PermissionsBoundary != "" {
+			input.PermissionsBoundary = aws.String(r.config.PermissionsBoundary)
+		}
+		out, err := client.CreateRole(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create role %s: %w", name, err)
+		}
+		role = out.Role
+	} else {
+		if err := checkRoleOwner(role, identity); err != nil {
+			return nil, err
+		}
+		matches, err := trustPolicyMatches(role, trustPolicy)
+		if err != nil {
+			return nil, err
+		}
+		if !matches {
+			log.Info("Updating drifted trust policy", "role", name)
+			_, err = client.UpdateAssumeRolePolicy(ctx, &iam.UpdateAssumeRolePolicyInput{
+				RoleName:       aws.String(name),
+				PolicyDocument: aws.String(string(document)),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to update the trust policy of role %s: %w", name, err)
+			}
+		}
+		if err := r.syncPermissionsBoundary(ctx, client, role); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.syncPolicies(ctx, client, name, identity.Spec.PolicyARNs); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{identityMetaID: aws.ToString(role.Arn)}, nil
+}
+
+// GetIdentity checks that the role of the identity exists and matches the identity spec
+func (r *IAMRoleHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (_ bool, err error) {
+	defer r.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	client, err := r.getIAMClient(ctx)
+	if err != nil {
+		return false, err
+	}
+	name := roleName(identity)
+	role, err := r.getRole(ctx, client, name)
+	if err != nil {
+		return false, err
+	}
+	if role == nil {
+		log.Info("IAM role not found", "role", name)
+		return false, nil
+	}
+	if err := checkRoleOwner(role, identity); err != nil {
+		return false, err
+	}
+
+	trustPolicy, err := r.trustPolicy(ctx, identity)
+	if err != nil {
+		return false, err
+	}
+	if matches, err := trustPolicyMatches(role, trustPolicy); err != nil || !matches {
+		log.Info("Trust policy does not match", "role", name)
+		return false, err
+	}
+	if permissionsBoundary(role) != r.config.PermissionsBoundary {
+		log.Info("Permissions boundary does not match", "role", name)
+		return false, nil
+	}
+
+	attached, err := r.attachedPolicies(ctx, client, name)
+	if err != nil {
+		return false, err
+	}
+	want := append([]string{}, identity.Spec.PolicyARNs...)
+	sort.Strings(want)
+	if len(attached) != len(want) || (len(want) > 0 && !reflect.DeepEqual(attached, want)) {
+		log.Info("Managed policies do not match", "role", name)
+		return false, nil
+	}
+	return true, nil
+}
+
+// DeleteIdentity detaches the policies of the role of the identity and deletes it
+func (r *IAMRoleHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) (err error) {
+	defer r.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	client, err := r.getIAMClient(ctx)
+	if err != nil {
+		return err
+	}
+	name := roleName(identity)
+	role, err := r.getRole(ctx, client, name)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		log.Info("IAM role already deleted", "role", name)
+		return nil
+	}
+	// the roles of other owners are left alone
+	if err := checkRoleOwner(role, identity); err != nil {
+		log.Info("IAM role not deleted", "role", name, "reason", err.Error())
+		return nil
+	}
+
+	// a role can only be deleted without policies
+	if err := r.syncPolicies(ctx, client, name, nil); err != nil {
+		if isNoSuchEntity(err) {
+			log.Info("IAM role already deleted", "role", name)
+			return nil
+		}
+		return err
+	}
+	inline, err := client.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{RoleName: aws.String(name)})
+	if err != nil {
+		return fmt.Errorf("failed to list the inline policies of role %s: %w", name, err)
+	}
+	for _, policyName := range inline.PolicyNames {
+		_, err := client.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{RoleName: aws.String(name), PolicyName: aws.String(policyName)})
+		if err != nil && !isNoSuchEntity(err) {
+			return fmt.Errorf("failed to delete the inline policy %s of role %s: %w", policyName, name, err)
+		}
+	}
+
+	log.Info("Deleting IAM role", "role", name)
+	if _, err := client.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: aws.String(name)}); err != nil && !isNoSuchEntity(err) {
+		return fmt.Errorf("failed to delete role %s: %w", name, err)
+	}
+	return nil
+}
+
+// getRole returns the role name, nil when missing
+func (r *IAMRoleHelper) getRole(ctx context.Context, client *iam.Client, name string) (*types.Role, error) {
+	out, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+	if err != nil {
+		if isNoSuchEntity(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get role %s: %w", name, err)
+	}
+	return out.Role, nil
+}
+
+// syncPermissionsBoundary sets or removes the permissions boundary of the role
+func (r *IAMRoleHelper) syncPermissionsBoundary(ctx context.Context, client *iam.Client, role *types.Role) error {
+	log := log.FromContext(ctx)
+
+	if permissionsBoundary(role) == r.config.PermissionsBoundary {
+		return nil
+	}
+	log.Info("Updating drifted permissions boundary", "role", aws.ToString(role.RoleName))
+	var err error
+	if r.config.PermissionsBoundary == "" {
+		_, err = client.DeleteRolePermissionsBoundary(ctx, &iam.DeleteRolePermissionsBoundaryInput{RoleName: role.RoleName})
+	} else {
+		_, err = client.PutRolePermissionsBoundary(ctx, &iam.PutRolePermissionsBoundaryInput{
+			RoleName:            role.RoleName,
+			PermissionsBoundary: aws.String(r.config.PermissionsBoundary),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update the permissions boundary of role %s: %w", aws.ToString(role.RoleName), err)
+	}
+	return nil
+}
+
+// syncPolicies attaches the managed policies policyARNs to the role name and
+// detaches the other ones
+func (r *IAMRoleHelper) syncPolicies(ctx context.Context, client *iam.Client, name string, policyARNs []string) error {
+	log := log.FromContext(ctx)
+
+	attached, err := r.attachedPolicies(ctx, client, name)
+	if err != nil {
+		return err
+	}
+	want := map[string]bool{}
+	for _, policyARN := range policyARNs {
+		want[policyARN] = true
+	}
+	for _, policyARN := range attached {
+		if want[policyARN] {
+			delete(want, policyARN)
+			continue
+		}
+		log.Info("Detaching policy", "role", name, "policy", policyARN)
+		_, err := client.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{RoleName: aws.String(name), PolicyArn: aws.String(policyARN)})
+		if err != nil && !isNoSuchEntity(err) {
+			return fmt.Errorf("failed to detach policy %s from role %s: %w", policyARN, name, err)
+		}
+	}
+	for _, policyARN := range policyARNs {
+		if !want[policyARN] {
+			continue
+		}
+		delete(want, policyARN)
+		log.Info("Attaching policy", "role", name, "policy", policyARN)
+		_, err := client.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{RoleName: aws.String(name), PolicyArn: aws.String(policyARN)})
+		if err != nil {
+			return fmt.Errorf("failed to attach policy %s to role %s: %w", policyARN, name, err)
+		}
+	}
+	return nil
+}
+
+// attachedPolicies returns the sorted ARNs of the managed policies attached to the role name
+func (r *IAMRoleHelper) attachedPolicies(ctx context.Context, client *iam.Client, name string) ([]string, error) {
+	policyARNs := []string{}
+	paginator := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(name)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			if isNoSuchEntity(err) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to list the policies of role %s: %w", name, err)
+		}
+		for _, policy := range page.AttachedPolicies {
+			policyARNs = append(policyARNs, aws.ToString(policy.PolicyArn))
+		}
+	}
+	sort.Strings(policyARNs)
+	return policyARNs, nil
+}
+
+// trustPolicyMatches reports whether the trust policy of the role, URL
+// encoded by IAM, is equivalent to trustPolicy
+func trustPolicyMatches(role *types.Role, trustPolicy map[string]interface{}) (bool, error) {
+	document, err := url.QueryUnescape(aws.ToString(role.AssumeRolePolicyDocument))
+	if err != nil {
+		return false, fmt.Errorf("invalid trust policy of role %s: %w", aws.ToString(role.RoleName), err)
+	}
+	var current interface{}
+	if err := json.Unmarshal([]byte(document), &current); err != nil {
+		return false, fmt.Errorf("invalid trust policy of role %s: %w", aws.ToString(role.RoleName), err)
+	}
+	// normalize the desired policy to the JSON types of the current one
+	desired, err := json.Marshal(trustPolicy)
+	if err != nil {
+		return false, err
+	}
+	var want interface{}
+	if err := json.Unmarshal(desired, &want); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(current, want), nil
+}
+
+// permissionsBoundary returns the ARN of the permissions boundary of the role
+func permissionsBoundary(role *types.Role) string {
+	if role.PermissionsBoundary == nil {
+		return ""
+	}
+	return aws.ToString(role.PermissionsBoundary.PermissionsBoundaryArn)
+}
+
+// isNoSuchEntity reports whether err is a NoSuchEntity error of IAM
+func isNoSuchEntity(err error) bool {
+	var notFound *types.NoSuchEntityException
+	return errors.As(err, &notFound)
+}
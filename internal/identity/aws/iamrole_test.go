@@ -0,0 +1,163 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newIdentity(namespace, name string, policyARNs ...string) *aegisv1.Identity {
+	return &aegisv1.Identity{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       aegisv1.IdentitySpec{PolicyARNs: policyARNs},
+	}
+}
+
+func TestIAMRoleLifecycle(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeIAM(t)
+	h := NewIAMRole(fake.newHelper(t), nil)
+	identity := newIdentity("default", "app", "arn:aws:iam::aws:policy/ReadOnlyAccess", "arn:aws:iam::123456789012:policy/app")
+
+	metadata, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	role, ok := fake.role(roleName(identity))
+	if !ok {
+		t.Fatalf("role %s not created", roleName(identity))
+	}
+	if role.Path != defaultRolePath || metadata[identityMetaID] != role.Arn {
+		t.Errorf("role %+v, metadata %v", role, metadata)
+	}
+
+	// the role trusts the tokens of the service account of the identity
+	var trustPolicy struct {
+		Statement []struct {
+			Principal map[string]string
+			Action    string
+			Condition map[string]map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal([]byte(role.AssumeRolePolicyDocument), &trustPolicy); err != nil {
+		t.Fatal(err)
+	}
+	statement := trustPolicy.Statement[0]
+	if want := "arn:aws:iam::" + testAccount + ":oidc-provider/oidc.example.com/cluster"; statement.Principal["Federated"] != want {
+		t.Errorf("federated principal = %s, want %s", statement.Principal["Federated"], want)
+	}
+	conditions := statement.Condition["StringEquals"]
+	if conditions["oidc.example.com/cluster:sub"] != "system:serviceaccount:default:app" ||
+		!reflect.DeepEqual(conditions["oidc.example.com/cluster:aud"], []interface{}{Audience}) {
+		t.Errorf("trust policy conditions = %v", conditions)
+	}
+	if want := []string{"arn:aws:iam::123456789012:policy/app", "arn:aws:iam::aws:policy/ReadOnlyAccess"}; !reflect.DeepEqual(fake.policies(role.RoleName), want) {
+		t.Errorf("attached policies = %v, want %v", fake.policies(role.RoleName), want)
+	}
+
+	identity.Status.Metadata = metadata
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || !exists {
+		t.Errorf("GetIdentity() = %v, %v after CreateIdentity", exists, err)
+	}
+	args, err := h.GetProxyArgs(ctx, identity)
+	if err != nil || !reflect.DeepEqual(args, []string{"--aws-region", "eu-west-1", "--aws-role-arn", role.Arn}) {
+		t.Errorf("GetProxyArgs() = %v, %v", args, err)
+	}
+
+	// a drifted role is out of sync and restored by CreateIdentity
+	fake.mu.Lock()
+	fake.roles[role.RoleName].AssumeRolePolicyDocument = `{"Version":"2012-10-17","Statement":[]}`
+	fake.roles[role.RoleName].Policies["arn:aws:iam::aws:policy/AdministratorAccess"] = true
+	fake.mu.Unlock()
+	identity.Spec.PolicyARNs = identity.Spec.PolicyARNs[:1]
+	h.config.PermissionsBoundary = "arn:aws:iam::123456789012:policy/boundary"
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || exists {
+		t.Errorf("GetIdentity() = %v, %v for a drifted role", exists, err)
+	}
+	if _, err := h.CreateIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || !exists {
+		t.Errorf("GetIdentity() = %v, %v after restoring the role", exists, err)
+	}
+	role, _ = fake.role(role.RoleName)
+	if role.PermissionsBoundary == nil || role.PermissionsBoundary.PermissionsBoundaryArn != h.config.PermissionsBoundary {
+		t.Errorf("permissions boundary = %+v, want %s", role.PermissionsBoundary, h.config.PermissionsBoundary)
+	}
+	if want := []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}; !reflect.DeepEqual(fake.policies(role.RoleName), want) {
+		t.Errorf("attached policies = %v, want %v", fake.policies(role.RoleName), want)
+	}
+
+	// the policies are removed before the role, deleting a deleted role succeeds
+	fake.mu.Lock()
+	fake.roles[role.RoleName].InlinePolicies = []string{"inline"}
+	fake.mu.Unlock()
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.role(role.RoleName); ok {
+		t.Errorf("role %s not deleted", role.RoleName)
+	}
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Errorf("DeleteIdentity() = %v for a deleted role", err)
+	}
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || exists {
+		t.Errorf("GetIdentity() = %v, %v for a deleted role", exists, err)
+	}
+}
+
+func TestRoleName(t *testing.T) {
+	if name := roleName(newIdentity("default", "app")); !strings.HasPrefix(name, "aegis-default-app-") || len(name) != len("aegis-default-app-")+roleNameDigestLength {
+		t.Errorf("roleName() = %s, want aegis-default-app-<digest>", name)
+	}
+	long := newIdentity(strings.Repeat("n", 40), strings.Repeat("a", 40))
+	name := roleName(long)
+	if len(name) != maxRoleNameLength || !strings.HasPrefix(name, "aegis-nnnn") {
+		t.Errorf("roleName() = %s, want a %d characters name", name, maxRoleNameLength)
+	}
+	other := newIdentity(strings.Repeat("n", 40), strings.Repeat("a", 39)+"b")
+	if roleName(other) == name {
+		t.Errorf("roleName() = %s for two identities", name)
+	}
+	// the dashes of the namespaces and of the names are not separators
+	if roleName(newIdentity("a-b", "c")) == roleName(newIdentity("a", "b-c")) {
+		t.Errorf("roleName() = %s for a-b/c and a/b-c", roleName(newIdentity("a", "b-c")))
+	}
+}
+
+func TestIAMRoleOwner(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeIAM(t)
+	h := NewIAMRole(fake.newHelper(t), nil)
+	owner, identity := newIdentity("a-b", "c", "arn:aws:iam::aws:policy/ReadOnlyAccess"), newIdentity("a", "b-c")
+
+	// a role of another identity named as the role of identity
+	if _, err := h.CreateIdentity(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	fake.roles[roleName(identity)] = fake.roles[roleName(owner)]
+	delete(fake.roles, roleName(owner))
+	fake.mu.Unlock()
+	taken, _ := fake.role(roleName(identity))
+	policies := fake.policies(roleName(identity))
+
+	if _, err := h.CreateIdentity(ctx, identity); err == nil || !strings.Contains(err.Error(), "not owned by identity a/b-c") {
+		t.Errorf("CreateIdentity() error = %v for a role of another identity", err)
+	}
+	if exists, err := h.GetIdentity(ctx, identity); err == nil || exists {
+		t.Errorf("GetIdentity() = %v, %v for a role of another identity", exists, err)
+	}
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Errorf("DeleteIdentity() = %v for a role of another identity", err)
+	}
+	if role, ok := fake.role(roleName(identity)); !ok || role.AssumeRolePolicyDocument != taken.AssumeRolePolicyDocument ||
+		!reflect.DeepEqual(fake.policies(roleName(identity)), policies) {
+		t.Errorf("role of another identity changed: %+v", role)
+	}
+}
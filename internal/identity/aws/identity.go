@@ -2,45 +2,80 @@ package aws
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentity"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentity/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"github.com/vmarchese/aegis-operator/internal/identity/k8stoken"
+	"github.com/vmarchese/aegis-operator/internal/logging"
 	authenticationv1 "k8s.io/api/authentication/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 const (
 	ProviderName = "aws"
+	Audience     = "sts.amazonaws.com"
 	K8STokenPath = "/var/run/secrets/tokens/aws_token"
 
 	awsProviderName = "aegis-operator"
 	identityMetaID  = "aegis.identity.id"
+
+	// tokenRequestTimeout bounds the requests of the operator tokens exchanged for AWS credentials
+	tokenRequestTimeout = 30 * time.Second
+	// issuerRequestTimeout bounds the requests to the discovery endpoints of the cluster issuer
+	issuerRequestTimeout = 30 * time.Second
 )
 
 type IdentityHelper struct {
 	region         string
 	roleARN        string
 	identityPoolId string
-	clientset      *kubernetes.Clientset
+	// client issues the tokens of the service accounts of the identities
+	client client.Client
+	// credentials of the operator, the mounted token when nil
+	credentials *idp.Credentials
+	// clientKey identifies the cached clients of the provider
+	clientKey idp.ClientKey
+
+	// assumeRole is chained after the credentials of the operator when set
+	assumeRole *aegisv1.AWSAssumeRoleConfig
+	// endpoint overrides the endpoint of the AWS APIs when set
+	endpoint string
+	// oidcProvider configures the OpenID Connect provider of the cluster
+	// issuer, managed manually when nil
+	oidcProvider *aegisv1.AWSOIDCProviderConfig
+
+	// issuer and issuerClient are replaced by the tests
+	issuer func(ctx context.Context) (string, error)
+	// issuerClient fetches the certificates of the issuer
+	issuerClient *http.Client
 }
 
-func New(region string, roleARN string, identityPoolId string, clientset *kubernetes.Clientset) *IdentityHelper {
+// New returns an AWS IdentityHelper issuing the tokens of the identities with c
+func New(region string, roleARN string, identityPoolId string, c client.Client, credentials *idp.Credentials) *IdentityHelper {
 	return &IdentityHelper{
 		region:         region,
 		identityPoolId: identityPoolId,
-		clientset:      clientset,
+		client:         c,
 		roleARN:        roleARN,
+		credentials:    credentials,
+		issuer:         k8stoken.Issuer,
+		issuerClient:   logging.HTTPClient(&http.Client{Timeout: issuerRequestTimeout}),
 	}
 }
 
@@ -48,34 +83,45 @@ func (h *IdentityHelper) GetName() string {
 	return ProviderName
 }
 
-func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (map[string]string, error) {
-	log := log.FromContext(ctx)
+func (h *IdentityHelper) GetAudience() string {
+	return Audience
+}
 
-	// get service account
-	sa, err := h.clientset.CoreV1().ServiceAccounts(identity.Namespace).Get(ctx, identity.Name, metav1.GetOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get service account: %v", err)
+func (h *IdentityHelper) GetTokenBounds() idp.TokenBounds {
+	return idp.TokenBounds{
+		MinTTL: idp.MinTokenTTL,
 	}
+}
 
-	// create token request for service  account
-	tr := &authenticationv1.TokenRequest{
-		Spec: authenticationv1.TokenRequestSpec{
-			ExpirationSeconds: &[]int64{3600}[0],
-			Audiences:         []string{"sts.amazonaws.com"},
-		},
+func (h *IdentityHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	args := []string{
+		"--aws-region", h.region,
 	}
+	if identity != nil {
+		identityID := identity.Status.Metadata[identityMetaID]
+		if identityID == "" {
+			return nil, fmt.Errorf("identity id is not set for identity %s", identity.Name)
+		}
+		args = append(args, "--aws-identity-id", identityID)
+	}
+	return args, nil
+}
+
+// CreateIdentity gets the Cognito identity of the logins of the service
+// account of the identity, creating it on first use
+func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (_ map[string]string, err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
 
-	tokenRequest, err := h.clientset.CoreV1().ServiceAccounts(identity.Namespace).CreateToken(ctx, sa.Name, tr, metav1.CreateOptions{})
+	token, err := h.identityToken(ctx, identity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create token request: %v", err)
+		return nil, err
 	}
 
-	token := tokenRequest.Status.Token
-
-	// Create a Cognito Identity client
-	cognitoClient := cognitoidentity.NewFromConfig(aws.Config{
-		Region: h.region,
-	})
+	cognitoClient, err := h.getCognitoClient(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	issuer, err := h.GetIssuer(ctx)
 	if err != nil {
@@ -86,8 +132,7 @@ func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.I
 	providerName := strings.ReplaceAll(issuer, "https://", "")
 	// Create the identity on Cognito
 	input := &cognitoidentity.GetIdInput{
-
-		IdentityPoolId: aws.String(h.identityPoolId), // Replace with your Identity Pool ID
+		IdentityPoolId: aws.String(h.identityPoolId),
 		Logins: map[string]string{
 			providerName: token,
 		},
@@ -95,115 +140,402 @@ func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.I
 
 	result, err := cognitoClient.GetId(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create identity on Cognito: %v", err)
+		return nil, fmt.Errorf("failed to create identity on Cognito: %w", err)
 	}
 
 	return map[string]string{identityMetaID: *result.IdentityId}, nil
 }
 
-func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (bool, error) {
+// identityToken returns a token of the service account of the identity,
+// the login of its Cognito identity
+func (h *IdentityHelper) identityToken(ctx context.Context, identity *aegisv1.Identity) (string, error) {
+	// get service account
+	sa := &corev1.ServiceAccount{}
+	if err := h.client.Get(ctx, client.ObjectKey{Namespace: identity.Namespace, Name: identity.Name}, sa); err != nil {
+		return "", fmt.Errorf("failed to get service account: %v", err)
+	}
+
+	options, err := idp.GetTokenOptions(h, identity)
+	if err != nil {
+		return "", err
+	}
 
-	return false, fmt.Errorf("not implemented")
+	// create token request for service  account
+	tr := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &[]int64{int64(options.TTLOrDefault(time.Hour).Seconds())}[0],
+			Audiences:         options.Audiences,
+		},
+	}
+
+	if err := h.client.SubResource("token").Create(ctx, sa, tr); err != nil {
+		return "", fmt.Errorf("failed to create token request: %v", err)
+	}
+	return tr.Status.Token, nil
 }
 
-func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) error {
+// GetIdentity checks that the Cognito identity of the identity exists and is
+// linked to the cluster issuer.
+func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (_ bool, err error) {
+	defer h.invalidateOnAuthFailure(&err)
 	log := log.FromContext(ctx)
-	cfg := aws.Config{
-		Region: h.region,
+
+	identityID := identity.Status.Metadata[identityMetaID]
+	if identityID == "" {
+		return false, nil
+	}
+
+	cognitoClient, err := h.getCognitoClient(ctx)
+	if err != nil {
+		return false, err
 	}
 
-	stsClient := sts.NewFromConfig(cfg)
+	out, err := cognitoClient.DescribeIdentity(ctx, &cognitoidentity.DescribeIdentityInput{
+		IdentityId: aws.String(identityID),
+	})
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			log.Info("Identity not found on Cognito", "identityId", identityID)
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to describe identity on Cognito: %w", err)
+	}
 
-	// Assume the role using the service account token
-	provider := stscreds.NewWebIdentityRoleProvider(
-		stsClient,
-		h.roleARN,
-		stscreds.IdentityTokenFile(K8STokenPath),
-		func(o *stscreds.WebIdentityRoleOptions) {
-			o.RoleSessionName = "k8s-service-account-session"
-		})
+	issuer, err := h.GetIssuer(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get issuer")
+		return false, err
+	}
+	providerName := strings.ReplaceAll(issuer, "https://", "")
+	for _, login := range out.Logins {
+		if login == providerName {
+			return true, nil
+		}
+	}
+	log.Info("Identity is not linked to the issuer", "identityId", identityID, "issuer", providerName)
+	return false, nil
+}
 
-	awsCfg, err := config.LoadDefaultConfig(ctx,
-		config.WithCredentialsProvider(aws.NewCredentialsCache(provider)),
-		config.WithRegion(h.region),
-	)
+// CheckHealth gets the caller identity of the credentials of the operator,
+// assuming its roles
+func (h *IdentityHelper) CheckHealth(ctx context.Context) idp.Health {
+	awsCfg, err := h.newConfig(ctx)
 	if err != nil {
-		log.Error(err, "Failed to create AWS session with temporary credentials")
-		return err
+		return idp.Health{Err: err}
 	}
+	// the credentials of the cached clients are not reused
+	_, err = sts.NewFromConfig(awsCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		// STS answered but refused the token, the keys or the role
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			return idp.Health{Reachable: true, Err: err}
+		}
+		return idp.Health{Err: err}
+	}
+	return idp.Health{Reachable: true, Authenticated: true}
+}
 
-	// Create a Cognito Identity client
-	cognitoClient := cognitoidentity.NewFromConfig(awsCfg)
+// getCognitoClient returns a Cognito Identity client authenticated with the
+// credentials of the operator. The client is shared by the identities of the
+// provider; its credentials cache renews the role credentials before they expire.
+func (h *IdentityHelper) getCognitoClient(ctx context.Context) (*cognitoidentity.Client, error) {
+	return idp.CachedClient(ctx, h.clientKey, "cognito", func(ctx context.Context) (*cognitoidentity.Client, time.Time, error) {
+		client, err := h.newCognitoClient(ctx)
+		return client, time.Time{}, err
+	})
+}
+
+func (h *IdentityHelper) newCognitoClient(ctx context.Context) (*cognitoidentity.Client, error) {
+	awsCfg, err := h.newConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cognitoidentity.NewFromConfig(awsCfg), nil
+}
 
-	/*
-		issuer, err := h.GetIssuer(ctx)
+// getIAMClient returns an IAM client shared by the identities of the provider
+func (h *IdentityHelper) getIAMClient(ctx context.Context) (*iam.Client, error) {
+	return idp.CachedClient(ctx, h.clientKey, "iam", func(ctx context.Context) (*iam.Client, time.Time, error) {
+		awsCfg, err := h.newConfig(ctx)
 		if err != nil {
-			log.Error(err, "Failed to get issuer")
-			return err
+			return nil, time.Time{}, err
 		}
+		return iam.NewFromConfig(awsCfg), time.Time{}, nil
+	})
+}
 
-		providerName := strings.ReplaceAll(issuer, "https://", "")
-		unlinkInput := &cognitoidentity.UnlinkIdentityInput{
-			IdentityId: aws.String(identity.Status.Metadata[identityMetaID]),
-			Logins: map[string]*string{
-				providerName: aws.String(token),
-			},
-			LoginsToRemove: []*string{
-				aws.String(providerName),
-			},
+// getSTSClient returns an STS client shared by the identities of the provider
+func (h *IdentityHelper) getSTSClient(ctx context.Context) (*sts.Client, error) {
+	return idp.CachedClient(ctx, h.clientKey, "sts", func(ctx context.Context) (*sts.Client, time.Time, error) {
+		awsCfg, err := h.newConfig(ctx)
+		if err != nil {
+			return nil, time.Time{}, err
 		}
-		unlinkOut, err := cognitoClient.UnlinkIdentity(unlinkInput)
+		return sts.NewFromConfig(awsCfg), time.Time{}, nil
+	})
+}
+
+// callerAccount returns the partition and the account of the operator credentials
+func (h *IdentityHelper) callerAccount(ctx context.Context) (string, string, error) {
+	stsClient, err := h.getSTSClient(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	caller, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get the account of the operator: %w", err)
+	}
+	partition := "aws"
+	if parts := strings.SplitN(aws.ToString(caller.Arn), ":", 3); len(parts) == 3 {
+		partition = parts[1]
+	}
+	return partition, aws.ToString(caller.Account), nil
+}
+
+// issuerOIDCProviderARN returns the ARN of the IAM OIDC identity provider of
+// the issuer in the account of the operator
+func (h *IdentityHelper) issuerOIDCProviderARN(ctx context.Context, issuer string) (string, error) {
+	partition, account, err := h.callerAccount(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:oidc-provider/%s", partition, account, strings.TrimPrefix(issuer, "https://")), nil
+}
+
+// newConfig returns the AWS configuration of the clients of the operator
+func (h *IdentityHelper) newConfig(ctx context.Context) (aws.Config, error) {
+	provider, err := h.credentialsProvider()
+	if err != nil {
+		return aws.Config{}, err
+	}
+	return aws.Config{
+		Region:       h.region,
+		Credentials:  aws.NewCredentialsCache(provider),
+		HTTPClient:   newHTTPClient(),
+		BaseEndpoint: h.baseEndpoint(),
+	}, nil
+}
+
+// credentialsProvider returns the credentials chain of the operator: the
+// static access keys of the credentials secret, or RoleARN assumed with a web
+// identity token, followed by AssumeRole when set
+func (h *IdentityHelper) credentialsProvider() (aws.CredentialsProvider, error) {
+	var provider aws.CredentialsProvider
+	if h.hasStaticCredentials() {
+		var err error
+		provider, err = h.staticCredentials()
 		if err != nil {
-			log.Error(err, "Failed to unlink identity")
-			return err
+			return nil, err
 		}
+	} else {
+		if h.roleARN == "" {
+			return nil, fmt.Errorf("roleARN is required without static credentials")
+		}
+		stsClient := sts.NewFromConfig(aws.Config{
+			Region:       h.region,
+			HTTPClient:   newHTTPClient(),
+			BaseEndpoint: h.baseEndpoint(),
+		})
+
+		// Assume the role using the service account token
+		provider = stscreds.NewWebIdentityRoleProvider(
+			stsClient,
+			h.roleARN,
+			tokenRetriever{token: h.operatorToken()},
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = "k8s-service-account-session"
+			})
+	}
+	if h.assumeRole == nil {
+		return provider, nil
+	}
 
-		log.Info("Unlinked identity from Cognito", "identityId", identity.Status.Metadata[identityMetaID], "output", unlinkOut)
-	*/
+	stsClient := sts.NewFromConfig(aws.Config{
+		Region:       h.region,
+		Credentials:  aws.NewCredentialsCache(provider),
+		HTTPClient:   newHTTPClient(),
+		BaseEndpoint: h.baseEndpoint(),
+	})
+	return stscreds.NewAssumeRoleProvider(stsClient, h.assumeRole.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = "aegis-operator"
+		if h.assumeRole.SessionName != "" {
+			o.RoleSessionName = h.assumeRole.SessionName
+		}
+		if h.assumeRole.ExternalID != "" {
+			o.ExternalID = aws.String(h.assumeRole.ExternalID)
+		}
+	}), nil
+}
+
+// baseEndpoint returns the endpoint of the AWS APIs, nil for the default endpoints
+func (h *IdentityHelper) baseEndpoint() *string {
+	if h.endpoint == "" {
+		return nil
+	}
+	return aws.String(h.endpoint)
+}
+
+// DeleteIdentity unlinks the cluster issuer from the Cognito identity of the
+// identity and deletes it. Missing identities are ignored.
+func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) (err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	identityID := identity.Status.Metadata[identityMetaID]
+	if identityID == "" {
+		log.Info("Identity has no Cognito identity", "identity", identity.Name)
+		return nil
+	}
+
+	// Create a Cognito Identity client
+	cognitoClient, err := h.getCognitoClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.unlinkIdentity(ctx, cognitoClient, identity); err != nil {
+		return err
+	}
 
 	// Delete the identity from Cognito
 	cinput := &cognitoidentity.DeleteIdentitiesInput{
-		IdentityIdsToDelete: []string{
-			identity.Status.Metadata[identityMetaID],
-		},
+		IdentityIdsToDelete: []string{identityID},
 	}
-	log.Info("Deleting identity from Cognito", "identityId", cinput)
+	log.Info("Deleting identity from Cognito", "identityId", identityID)
 
 	out, err := cognitoClient.DeleteIdentities(ctx, cinput)
 	if err != nil {
-		log.Error(err, "Failed to delete identity from Cognito", "output", out)
-		return fmt.Errorf("failed to delete identity from Cognito: %v", err)
+		log.Error(err, "Failed to delete identity from Cognito")
+		return fmt.Errorf("failed to delete identity from Cognito: %w", err)
+	}
+	if len(out.UnprocessedIdentityIds) > 0 {
+		return fmt.Errorf("failed to delete identity %s from Cognito: %s", identityID, out.UnprocessedIdentityIds[0].ErrorCode)
 	}
 
-	log.Info("Identity deleted from Cognito", "identityId", identity.Status.Metadata[identityMetaID], "output", out)
+	log.Info("Identity deleted from Cognito", "identityId", identityID)
 
 	return nil
 }
 
-func (h *IdentityHelper) GetIssuer(ctx context.Context) (string, error) {
-	token, err := os.ReadFile(K8STokenPath)
+// isAuthFailure reports whether AWS rejected the credentials of the client
+func isAuthFailure(err error) bool {
+	var respErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &respErr) && (respErr.HTTPStatusCode() == http.StatusUnauthorized || respErr.HTTPStatusCode() == http.StatusForbidden)
+}
+
+// invalidateOnAuthFailure drops the cached clients of the provider when AWS
+// rejected their credentials (e.g. access keys deactivated before a rotation),
+// so that the next call builds them again
+func (h *IdentityHelper) invalidateOnAuthFailure(err *error) {
+	if isAuthFailure(*err) {
+		idp.Clients.Invalidate(h.clientKey.UID)
+	}
+}
+
+// unlinkIdentity removes the login of the cluster issuer from the Cognito
+// identity of the identity, which requires a current token of its service
+// account. The identity is deleted anyway when the token cannot be issued.
+func (h *IdentityHelper) unlinkIdentity(ctx context.Context, cognitoClient *cognitoidentity.Client, identity *aegisv1.Identity) error {
+	log := log.FromContext(ctx)
+
+	identityID := identity.Status.Metadata[identityMetaID]
+	out, err := cognitoClient.DescribeIdentity(ctx, &cognitoidentity.DescribeIdentityInput{
+		IdentityId: aws.String(identityID),
+	})
 	if err != nil {
-		return "", err
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			log.Info("Identity not found on Cognito", "identityId", identityID)
+			return nil
+		}
+		return fmt.Errorf("failed to describe identity on Cognito: %w", err)
+	}
+
+	issuer, err := h.GetIssuer(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get issuer")
+		return err
+	}
+	providerName := strings.ReplaceAll(issuer, "https://", "")
+	linked := false
+	for _, login := range out.Logins {
+		linked = linked || login == providerName
 	}
-	parts := strings.Split(string(token), ".")
-	if len(parts) < 2 {
-		return "", fmt.Errorf("invalid token")
+	if !linked {
+		return nil
 	}
 
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	token, err := h.identityToken(ctx, identity)
 	if err != nil {
-		return "", err
+		log.Error(err, "Failed to get a token to unlink the identity, deleting it linked", "identityId", identityID)
+		return nil
+	}
+	_, err = cognitoClient.UnlinkIdentity(ctx, &cognitoidentity.UnlinkIdentityInput{
+		IdentityId:     aws.String(identityID),
+		Logins:         map[string]string{providerName: token},
+		LoginsToRemove: []string{providerName},
+	})
+	if err != nil {
+		log.Error(err, "Failed to unlink identity")
+		return fmt.Errorf("failed to unlink identity %s from %s: %w", identityID, providerName, err)
 	}
+	log.Info("Unlinked identity from Cognito", "identityId", identityID, "issuer", providerName)
+	return nil
+}
 
-	var claims map[string]interface{}
-	if err := json.Unmarshal(payload, &claims); err != nil {
-		return "", err
+// hasStaticCredentials reports whether the provider references static access keys
+func (h *IdentityHelper) hasStaticCredentials() bool {
+	return h.credentials != nil && h.credentials.Secret != nil
+}
+
+// staticCredentials returns the static access keys of the credentials secret
+func (h *IdentityHelper) staticCredentials() (aws.CredentialsProvider, error) {
+	accessKeyID, err := h.credentials.SecretValue(idp.CredentialAccessKeyID)
+	if err != nil {
+		return nil, err
+	}
+	secretAccessKey, err := h.credentials.SecretValue(idp.CredentialSecretAccessKey)
+	if err != nil {
+		return nil, err
 	}
+	// the session token is optional
+	sessionToken, _ := h.credentials.SecretValue(idp.CredentialSessionToken)
+	return credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken), nil
+}
 
-	issuer, ok := claims["iss"].(string)
-	if !ok {
-		return "", fmt.Errorf("issuer not found in token")
+// operatorToken returns the web identity token of the operator: a token of
+// the service account of the credentials, or the token mounted into the
+// operator when no service account is configured
+func (h *IdentityHelper) operatorToken() idp.TokenFunc {
+	if h.credentials != nil && h.credentials.Token != nil {
+		return h.credentials.Token
 	}
+	return idp.FileToken(K8STokenPath)
+}
+
+// tokenRetriever adapts a TokenFunc to stscreds.IdentityTokenRetriever. The
+// retriever outlives the reconciliation that built the cached Cognito client,
+// so tokens are not issued with its context.
+type tokenRetriever struct {
+	token idp.TokenFunc
+}
+
+func (r tokenRetriever) GetIdentityToken() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+	defer cancel()
+	token, err := r.token(ctx)
+	return []byte(token), err
+}
+
+// GetIssuer returns the issuer of the service account tokens of the cluster
+func (h *IdentityHelper) GetIssuer(ctx context.Context) (string, error) {
+	return h.issuer(ctx)
+}
 
-	return issuer, nil
+// newHTTPClient returns the default HTTP client of the AWS SDK, logging the
+// calls to the AWS APIs when enabled
+func newHTTPClient() aws.HTTPClient {
+	return logging.WrapDoer(awshttp.NewBuildableClient())
 }
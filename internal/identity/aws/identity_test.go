@@ -0,0 +1,134 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// newTokenClient returns a client issuing the token-<namespace>-<name>
+// tokens of the service accounts
+func newTokenClient(serviceAccounts ...*corev1.ServiceAccount) client.Client {
+	objects := []client.Object{}
+	for _, sa := range serviceAccounts {
+		objects = append(objects, sa)
+	}
+	return fake.NewClientBuilder().WithObjects(objects...).WithInterceptorFuncs(interceptor.Funcs{
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, subResourceObj client.Object, opts ...client.SubResourceCreateOption) error {
+			if subResource != "token" {
+				return fmt.Errorf("unexpected %s request", subResource)
+			}
+			subResourceObj.(*authenticationv1.TokenRequest).Status.Token = fmt.Sprintf("token-%s-%s", obj.GetNamespace(), obj.GetName())
+			return nil
+		},
+	}).Build()
+}
+
+func TestIdentityLifecycle(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeIAM(t)
+	fake.pools["eu-west-1:pool"] = &cognitoIdentityPool{IdentityPoolId: "eu-west-1:pool", IdentityPoolName: "aegis"}
+	h := fake.newHelper(t)
+	h.identityPoolId = "eu-west-1:pool"
+	h.client = newTokenClient(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}})
+	identity := newIdentity("default", "app")
+
+	metadata, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityID := metadata[identityMetaID]
+	fake.mu.Lock()
+	logins := fake.identities[identityID]
+	if logins["oidc.example.com/cluster"] != "token-default-app" {
+		t.Errorf("logins of %s = %v, want the token of the service account", identityID, logins)
+	}
+	fake.mu.Unlock()
+
+	identity.Status.Metadata = metadata
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || !exists {
+		t.Errorf("GetIdentity() = %v, %v after CreateIdentity", exists, err)
+	}
+	// the signed Cognito requests use the operator credentials
+	fake.mu.Lock()
+	if !reflect.DeepEqual(fake.cognitoCallers, map[string]bool{"AKIDEXAMPLE": true}) {
+		t.Errorf("Cognito callers = %v, want AKIDEXAMPLE", fake.cognitoCallers)
+	}
+	fake.mu.Unlock()
+	if again, err := h.CreateIdentity(ctx, identity); err != nil || again[identityMetaID] != identityID {
+		t.Errorf("CreateIdentity() = %v, %v, want the same identity %s", again, err, identityID)
+	}
+
+	// the login is unlinked before the identity is deleted
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	if len(logins) != 0 {
+		t.Errorf("logins = %v after DeleteIdentity, want them unlinked", logins)
+	}
+	fake.mu.Unlock()
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || exists {
+		t.Errorf("GetIdentity() = %v, %v for a deleted identity", exists, err)
+	}
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Errorf("DeleteIdentity() = %v for a deleted identity", err)
+	}
+}
+
+func TestCredentialsChain(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeIAM(t)
+	fake.pools["eu-west-1:pool"] = &cognitoIdentityPool{IdentityPoolId: "eu-west-1:pool", IdentityPoolName: "aegis"}
+
+	// the web identity role of the operator assumes the role of another account
+	h := New("eu-west-1", "arn:aws:iam::111111111111:role/operator", "eu-west-1:pool", nil, &idp.Credentials{
+		Token: func(ctx context.Context) (string, error) { return "operator-token", nil },
+	})
+	h.clientKey = idp.ClientKey{UID: types.UID(t.Name())}
+	h.endpoint = fake.URL
+	h.issuer = func(ctx context.Context) (string, error) { return testIssuer, nil }
+	h.assumeRole = &aegisv1.AWSAssumeRoleConfig{RoleARN: "arn:aws:iam::" + testAccount + ":role/aegis", ExternalID: "tenant-a"}
+
+	if health := h.CheckHealth(ctx); !health.Reachable || !health.Authenticated || health.Err != nil {
+		t.Fatalf("CheckHealth() = %+v", health)
+	}
+	fake.mu.Lock()
+	fake.identities["eu-west-1:pool-1"] = map[string]string{}
+	fake.mu.Unlock()
+	identity := newIdentity("default", "app")
+	identity.Status.Metadata = map[string]string{identityMetaID: "eu-west-1:pool-1"}
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || exists {
+		t.Errorf("GetIdentity() = %v, %v for an identity without logins", exists, err)
+	}
+
+	// the health check and the Cognito client each assume both roles
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.assumed) != 4 {
+		t.Fatalf("assumed roles = %+v, want the web identity and the chained role twice", fake.assumed)
+	}
+	for i := 0; i < len(fake.assumed); i += 2 {
+		web, chained := fake.assumed[i], fake.assumed[i+1]
+		if web.Action != "AssumeRoleWithWebIdentity" || web.RoleArn != h.roleARN || web.Token != "operator-token" || web.Caller != "" {
+			t.Errorf("assumed role %+v, want %s with the operator token", web, h.roleARN)
+		}
+		if chained.Action != "AssumeRole" || chained.RoleArn != h.assumeRole.RoleARN || chained.ExternalId != "tenant-a" || chained.Caller != fmt.Sprintf("ASIA%d", i+1) {
+			t.Errorf("assumed role %+v, want %s with the web identity credentials", chained, h.assumeRole.RoleARN)
+		}
+	}
+	if !reflect.DeepEqual(fake.cognitoCallers, map[string]bool{"ASIA4": true}) {
+		t.Errorf("Cognito callers = %v, want the chained role credentials ASIA4", fake.cognitoCallers)
+	}
+}
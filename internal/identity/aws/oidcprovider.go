@@ -0,0 +1,283 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentity"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// tagIssuer marks the OpenID Connect providers created by the operator
+const tagIssuer = "aegis.issuer"
+
+// BootstrapOIDCProvider creates or updates the IAM OpenID Connect provider of
+// the cluster issuer and attaches it to the Cognito identity pool
+func (h *IdentityHelper) BootstrapOIDCProvider(ctx context.Context) (_ aegisv1.AWSOIDCProviderStatus, err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	status := aegisv1.AWSOIDCProviderStatus{}
+	providerARN, err := h.ensureOIDCProvider(ctx)
+	if err != nil {
+		return status, err
+	}
+	status.OIDCProviderARN = providerARN
+	if h.identityPoolId == "" {
+		return status, nil
+	}
+	status.IdentityPoolARN, err = h.attachOIDCProvider(ctx, providerARN)
+	return status, err
+}
+
+// BootstrapOIDCProvider creates or updates the IAM OpenID Connect provider of
+// the cluster issuer trusted by the roles of the identities
+func (r *IAMRoleHelper) BootstrapOIDCProvider(ctx context.Context) (_ aegisv1.AWSOIDCProviderStatus, err error) {
+	defer r.invalidateOnAuthFailure(&err)
+	providerARN, err := r.ensureOIDCProvider(ctx)
+	return aegisv1.AWSOIDCProviderStatus{OIDCProviderARN: providerARN}, err
+}
+
+// ensureOIDCProvider creates the IAM OpenID Connect provider of the cluster
+// issuer, or updates its client ids and thumbprints when they drifted, and
+// returns its ARN. The extra client ids and thumbprints are only removed from
+// the providers created by the operator: the others can be shared, e.g. with
+// EKS, and only get the missing ones added
+func (h *IdentityHelper) ensureOIDCProvider(ctx context.Context) (string, error) {
+	log := log.FromContext(ctx)
+
+	issuer, err := h.GetIssuer(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(issuer, "https://") {
+		return "", fmt.Errorf("issuer %s is not an https URL", issuer)
+	}
+	providerARN, err := h.issuerOIDCProviderARN(ctx, issuer)
+	if err != nil {
+		return "", err
+	}
+
+	config := aegisv1.AWSOIDCProviderConfig{}
+	if h.oidcProvider != nil {
+		config = *h.oidcProvider
+	}
+	clientIDs := config.ClientIDs
+	if len(clientIDs) == 0 {
+		clientIDs = []string{Audience}
+	}
+	thumbprints := config.Thumbprints
+	if len(thumbprints) == 0 {
+		thumbprint, err := h.issuerThumbprint(ctx, issuer)
+		if err != nil {
+			return "", err
+		}
+		thumbprints = []string{thumbprint}
+	}
+
+	client, err := h.getIAMClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	provider, err := client.GetOpenIDConnectProvider(ctx, &iam.GetOpenIDConnectProviderInput{OpenIDConnectProviderArn: aws.String(providerARN)})
+	if err != nil {
+		if !isNoSuchEntity(err) {
+			return "", fmt.Errorf("failed to get OpenID Connect provider %s: %w", providerARN, err)
+		}
+		log.Info("Creating OpenID Connect provider", "issuer", issuer)
+		out, err := client.CreateOpenIDConnectProvider(ctx, &iam.CreateOpenIDConnectProviderInput{
+			Url:            aws.String(issuer),
+			ClientIDList:   clientIDs,
+			ThumbprintList: thumbprints,
+			Tags:           []types.Tag{{Key: aws.String(tagIssuer), Value: aws.String(issuer)}},
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create the OpenID Connect provider of %s: %w", issuer, err)
+		}
+		return aws.ToString(out.OpenIDConnectProviderArn), nil
+	}
+
+	owned := false
+	for _, tag := range provider.Tags {
+		if aws.ToString(tag.Key) == tagIssuer && aws.ToString(tag.Value) == issuer {
+			owned = true
+		}
+	}
+
+	current := map[string]bool{}
+	for _, clientID := range provider.ClientIDList {
+		current[clientID] = true
+	}
+	for _, clientID := range clientIDs {
+		if current[clientID] {
+			delete(current, clientID)
+			continue
+		}
+		log.Info("Adding client id to OpenID Connect provider", "provider", providerARN, "clientID", clientID)
+		_, err := client.AddClientIDToOpenIDConnectProvider(ctx, &iam.AddClientIDToOpenIDConnectProviderInput{
+			OpenIDConnectProviderArn: aws.String(providerARN),
+			ClientID:                 aws.String(clientID),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to add client id %s to OpenID Connect provider %s: %w", clientID, providerARN, err)
+		}
+	}
+	// the extra client ids of the shared providers belong to their other consumers
+	if owned {
+		for clientID := range current {
+			log.Info("Removing client id from OpenID Connect provider", "provider", providerARN, "clientID", clientID)
+			_, err := client.RemoveClientIDFromOpenIDConnectProvider(ctx, &iam.RemoveClientIDFromOpenIDConnectProviderInput{
+				OpenIDConnectProviderArn: aws.String(providerARN),
+				ClientID:                 aws.String(clientID),
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to remove client id %s from OpenID Connect provider %s: %w", clientID, providerARN, err)
+			}
+		}
+	}
+
+	if !owned {
+		thumbprints = mergeThumbprints(provider.ThumbprintList, thumbprints)
+	}
+	if !sameThumbprints(provider.ThumbprintList, thumbprints) {
+		log.Info("Updating drifted OpenID Connect provider thumbprints", "provider", providerARN)
+		_, err := client.UpdateOpenIDConnectProviderThumbprint(ctx, &iam.UpdateOpenIDConnectProviderThumbprintInput{
+			OpenIDConnectProviderArn: aws.String(providerARN),
+			ThumbprintList:           thumbprints,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to update the thumbprints of OpenID Connect provider %s: %w", providerARN, err)
+		}
+	}
+	return providerARN, nil
+}
+
+// issuerThumbprint returns the SHA-1 thumbprint of the top certificate
+// authority of the chain served by the JWKS endpoint of the issuer, the one
+// IAM checks when it cannot verify the endpoint with a trusted root
+func (h *IdentityHelper) issuerThumbprint(ctx context.Context, issuer string) (string, error) {
+	discovery := struct {
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	resp, err := h.getIssuerURL(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return "", fmt.Errorf("invalid discovery document of issuer %s: %w", issuer, err)
+	}
+	if discovery.JWKSURI == "" {
+		return "", fmt.Errorf("discovery document of issuer %s has no jwks_uri", issuer)
+	}
+
+	jwks, err := h.getIssuerURL(ctx, discovery.JWKSURI)
+	if err != nil {
+		return "", err
+	}
+	defer jwks.Body.Close()
+	if jwks.TLS == nil || len(jwks.TLS.PeerCertificates) == 0 {
+		return "", fmt.Errorf("JWKS endpoint %s of issuer %s is not served over TLS", discovery.JWKSURI, issuer)
+	}
+	chain := jwks.TLS.PeerCertificates
+	digest := sha1.Sum(chain[len(chain)-1].Raw)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// getIssuerURL gets url with the issuer client, failing on an unexpected status
+func (h *IdentityHelper) getIssuerURL(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.issuerClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get %s: status %d", url, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// attachOIDCProvider adds the OpenID Connect provider providerARN to the
+// providers of the Cognito identity pool and returns the ARN of the pool
+func (h *IdentityHelper) attachOIDCProvider(ctx context.Context, providerARN string) (string, error) {
+	log := log.FromContext(ctx)
+
+	client, err := h.getCognitoClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	pool, err := client.DescribeIdentityPool(ctx, &cognitoidentity.DescribeIdentityPoolInput{IdentityPoolId: aws.String(h.identityPoolId)})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe identity pool %s: %w", h.identityPoolId, err)
+	}
+	attached := false
+	for _, arn := range pool.OpenIdConnectProviderARNs {
+		attached = attached || arn == providerARN
+	}
+	if !attached {
+		log.Info("Attaching OpenID Connect provider to identity pool", "provider", providerARN, "identityPoolId", h.identityPoolId)
+		// the update replaces the whole configuration of the pool
+		_, err := client.UpdateIdentityPool(ctx, &cognitoidentity.UpdateIdentityPoolInput{
+			IdentityPoolId:                 pool.IdentityPoolId,
+			IdentityPoolName:               pool.IdentityPoolName,
+			AllowUnauthenticatedIdentities: pool.AllowUnauthenticatedIdentities,
+			AllowClassicFlow:               pool.AllowClassicFlow,
+			CognitoIdentityProviders:       pool.CognitoIdentityProviders,
+			DeveloperProviderName:          pool.DeveloperProviderName,
+			IdentityPoolTags:               pool.IdentityPoolTags,
+			OpenIdConnectProviderARNs:      append(pool.OpenIdConnectProviderARNs, providerARN),
+			SamlProviderARNs:               pool.SamlProviderARNs,
+			SupportedLoginProviders:        pool.SupportedLoginProviders,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to attach OpenID Connect provider %s to identity pool %s: %w", providerARN, h.identityPoolId, err)
+		}
+	}
+
+	partition, account, err := h.callerAccount(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("arn:%s:cognito-identity:%s:%s:identitypool/%s", partition, h.region, account, h.identityPoolId), nil
+}
+
+// mergeThumbprints returns the current thumbprints followed by the desired
+// ones missing from them
+func mergeThumbprints(current, desired []string) []string {
+	merged := append([]string{}, current...)
+	for _, thumbprint := range desired {
+		found := false
+		for _, c := range current {
+			found = found || strings.EqualFold(c, thumbprint)
+		}
+		if !found {
+			merged = append(merged, thumbprint)
+		}
+	}
+	return merged
+}
+
+// sameThumbprints reports whether the thumbprints a and b are the same set
+func sameThumbprints(a, b []string) bool {
+	normalize := func(thumbprints []string) []string {
+		normalized := make([]string, 0, len(thumbprints))
+		for _, thumbprint := range thumbprints {
+			normalized = append(normalized, strings.ToLower(thumbprint))
+		}
+		sort.Strings(normalized)
+		return normalized
+	}
+	return strings.Join(normalize(a), ",") == strings.Join(normalize(b), ",")
+}
@@ -0,0 +1,141 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+// newIssuer returns a TLS issuer serving its discovery document and the
+// thumbprint of its certificate
+func newIssuer(t *testing.T) (*httptest.Server, string) {
+	var issuer *httptest.Server
+	issuer = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.URL, "jwks_uri": issuer.URL + "/openid/v1/jwks"})
+		case "/openid/v1/jwks":
+			_, _ = w.Write([]byte(`{"keys":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(issuer.Close)
+	digest := sha1.Sum(issuer.Certificate().Raw)
+	return issuer, hex.EncodeToString(digest[:])
+}
+
+func TestBootstrapOIDCProvider(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeIAM(t)
+	issuer, thumbprint := newIssuer(t)
+	fake.pools["eu-west-1:pool"] = &cognitoIdentityPool{
+		IdentityPoolId:            "eu-west-1:pool",
+		IdentityPoolName:          "aegis",
+		OpenIdConnectProviderARNs: []string{"arn:aws:iam::123456789012:oidc-provider/other.example.com"},
+		SupportedLoginProviders:   map[string]string{"accounts.google.com": "client"},
+	}
+
+	h := fake.newHelper(t)
+	h.identityPoolId = "eu-west-1:pool"
+	h.issuer = func(ctx context.Context) (string, error) { return issuer.URL, nil }
+	h.issuerClient = issuer.Client()
+	h.oidcProvider = &aegisv1.AWSOIDCProviderConfig{ClientIDs: []string{Audience, "aegis"}}
+
+	status, err := h.BootstrapOIDCProvider(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerARN := "arn:aws:iam::" + testAccount + ":oidc-provider/" + strings.TrimPrefix(issuer.URL, "https://")
+	want := aegisv1.AWSOIDCProviderStatus{
+		OIDCProviderARN: providerARN,
+		IdentityPoolARN: "arn:aws:cognito-identity:eu-west-1:" + testAccount + ":identitypool/eu-west-1:pool",
+	}
+	if status != want {
+		t.Errorf("BootstrapOIDCProvider() = %+v, want %+v", status, want)
+	}
+	checkProvider := func(clientIDs ...string) {
+		t.Helper()
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		provider, ok := fake.oidcProviders[providerARN]
+		if !ok {
+			t.Fatalf("OpenID Connect provider %s not created", providerARN)
+		}
+		got := append([]string{}, provider.ClientIDList...)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, clientIDs) || !reflect.DeepEqual(provider.ThumbprintList, []string{thumbprint}) {
+			t.Errorf("OpenID Connect provider %+v, want client ids %v and thumbprint %s", provider, clientIDs, thumbprint)
+		}
+		// the other providers of the pool are kept
+		pool := fake.pools["eu-west-1:pool"]
+		if len(pool.OpenIdConnectProviderARNs) != 2 || pool.OpenIdConnectProviderARNs[1] != providerARN || pool.SupportedLoginProviders["accounts.google.com"] != "client" {
+			t.Errorf("identity pool %+v, want the OpenID Connect provider attached once", pool)
+		}
+	}
+	checkProvider("aegis", Audience)
+
+	// the drifted client ids and thumbprints are restored
+	fake.mu.Lock()
+	fake.oidcProviders[providerARN].ClientIDList = []string{"other", Audience}
+	fake.oidcProviders[providerARN].ThumbprintList = []string{strings.Repeat("0", 40)}
+	fake.mu.Unlock()
+	h.oidcProvider.ClientIDs = nil
+	if _, err := h.BootstrapOIDCProvider(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkProvider(Audience)
+
+	// the roles of the IAMRole mode trust the provider without a pool
+	status, err = NewIAMRole(h, nil).BootstrapOIDCProvider(ctx)
+	if err != nil || status != (aegisv1.AWSOIDCProviderStatus{OIDCProviderARN: providerARN}) {
+		t.Errorf("BootstrapOIDCProvider() = %+v, %v in IAMRole mode", status, err)
+	}
+
+	h.issuer = func(ctx context.Context) (string, error) { return "http://oidc.example.com", nil }
+	if _, err := h.BootstrapOIDCProvider(ctx); err == nil {
+		t.Errorf("BootstrapOIDCProvider() succeeded for an http issuer")
+	}
+}
+
+func TestBootstrapSharedOIDCProvider(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeIAM(t)
+	issuer, thumbprint := newIssuer(t)
+	providerARN := "arn:aws:iam::" + testAccount + ":oidc-provider/" + strings.TrimPrefix(issuer.URL, "https://")
+	// a provider registered outside of the operator, e.g. for EKS
+	other := strings.Repeat("0", 40)
+	fake.oidcProviders[providerARN] = &iamOIDCProvider{
+		Url:            strings.TrimPrefix(issuer.URL, "https://"),
+		ClientIDList:   []string{"sts.amazonaws.com"},
+		ThumbprintList: []string{other},
+	}
+
+	h := fake.newHelper(t)
+	h.issuer = func(ctx context.Context) (string, error) { return issuer.URL, nil }
+	h.issuerClient = issuer.Client()
+	h.oidcProvider = &aegisv1.AWSOIDCProviderConfig{ClientIDs: []string{"aegis"}}
+	for i := 0; i < 2; i++ {
+		if _, err := NewIAMRole(h, nil).BootstrapOIDCProvider(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	provider := fake.oidcProviders[providerARN]
+	clientIDs := append([]string{}, provider.ClientIDList...)
+	sort.Strings(clientIDs)
+	if !reflect.DeepEqual(clientIDs, []string{"aegis", "sts.amazonaws.com"}) || !reflect.DeepEqual(provider.ThumbprintList, []string{other, thumbprint}) {
+		t.Errorf("OpenID Connect provider %+v, want the client ids and thumbprints of the other consumers kept", provider)
+	}
+}
@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	identity.Register(identity.Provider{
+		Kind:             "AWSProvider",
+		ClusterKind:      "ClusterAWSProvider",
+		Name:             ProviderName,
+		Precedence:       40,
+		NewObject:        func() client.Object { return &aegisv1.AWSProvider{} },
+		NewClusterObject: func() client.Object { return &aegisv1.ClusterAWSProvider{} },
+		New: func(ctx context.Context, c client.Client, obj client.Object) (identity.IdentityHelper, error) {
+			var spec aegisv1.AWSProviderSpec
+			switch provider := obj.(type) {
+			case *aegisv1.AWSProvider:
+				spec = provider.Spec
+			case *aegisv1.ClusterAWSProvider:
+				spec = provider.Spec.AWSProviderSpec
+			default:
+				return nil, fmt.Errorf("expected an AWSProvider, got %T", obj)
+			}
+			credentials, err := identity.ReadCredentials(ctx, c, spec.CredentialsRef, obj.GetNamespace(), Audience)
+			if err != nil {
+				return nil, err
+			}
+			h := New(spec.Region, spec.RoleARN, spec.IdentityPoolID, c, credentials)
+			h.clientKey = identity.ClientKeyFor(obj, credentials)
+			h.assumeRole = spec.AssumeRole
+			h.endpoint = spec.Endpoint
+			h.oidcProvider = spec.OIDCProvider
+			if spec.Mode == aegisv1.AWSProviderModeIAMRole {
+				return NewIAMRole(h, spec.IAMRole), nil
+			}
+			return h, nil
+		},
+	})
+}
@@ -0,0 +1,204 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/applications"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ idp.AccessGranter = &IdentityHelper{}
+
+// GrantAccess assigns the app role of the application of callee to the
+// service principals of the callers and requires the assignment on the
+// service principal of callee, so that Entra ID refuses to issue tokens for
+// callee to any other application. The assignments of the callers no longer
+// allowed are removed; the assignment of callee to itself is kept.
+func (h *IdentityHelper) GrantAccess(ctx context.Context, callee *aegisv1.Identity, callers []string) (err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	client, err := h.getGraphClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	resource, err := h.findAppRegistration(ctx, client, subjectOf(callee))
+	if err != nil {
+		return err
+	}
+	if resource == nil || resource.servicePrincipalID == "" {
+		return fmt.Errorf("application of identity %s/%s not found", callee.Namespace, callee.Name)
+	}
+
+	principals := map[string]bool{resource.servicePrincipalID: true}
+	for _, caller := range callers {
+		principal, err := h.findAppRegistration(ctx, client, caller)
+		if err != nil {
+			return err
+		}
+		if principal == nil || principal.servicePrincipalID == "" {
+			log.Info("Caller has no service principal, ignoring it", "caller", caller)
+			continue
+		}
+		principals[principal.servicePrincipalID] = true
+	}
+
+	// the callers are granted access before it is restricted
+	if err := h.syncAppRoleAssignments(ctx, client, resource, principals); err != nil {
+		return err
+	}
+	return h.setAppRoleAssignmentRequired(ctx, client, resource, true)
+}
+
+// RevokeAccess lifts the assignment requirement on the service principal of
+// callee and removes the assignments of its app role to the callers
+func (h *IdentityHelper) RevokeAccess(ctx context.Context, callee *aegisv1.Identity) (err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	client, err := h.getGraphClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	resource, err := h.findAppRegistration(ctx, client, subjectOf(callee))
+	if err != nil {
+		return err
+	}
+	if resource == nil || resource.servicePrincipalID == "" {
+		log.Info("Application not found, no access to revoke", "subject", subjectOf(callee))
+		return nil
+	}
+
+	// the restriction is lifted before the callers lose their assignments
+	if err := h.setAppRoleAssignmentRequired(ctx, client, resource, false); err != nil {
+		return err
+	}
+	return h.syncAppRoleAssignments(ctx, client, resource, map[string]bool{resource.servicePrincipalID: true})
+}
+
+// findAppRegistration returns the app registration of the application named
+// subject, nil when missing. The service principal id is empty when the
+// application has no service principal.
+func (h *IdentityHelper) findAppRegistration(ctx context.Context, client *msgraphsdk.GraphServiceClient, subject string) (*appRegistration, error) {
+	log := log.FromContext(ctx)
+
+	filterQuery := fmt.Sprintf("displayName eq %s", odataString(subject))
+	apps, err := client.Applications().Get(ctx, &applications.ApplicationsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &applications.ApplicationsRequestBuilderGetQueryParameters{
+			Filter: &filterQuery,
+		},
+	})
+	if err != nil {
+		log.Error(err, "Failed to list applications")
+		return nil, err
+	}
+	if len(apps.GetValue()) == 0 {
+		return nil, nil
+	}
+	app := apps.GetValue()[0]
+
+	registration := &appRegistration{
+		subject:  subject,
+		objectID: *app.GetId(),
+		clientID: *app.GetAppId(),
+	}
+	for _, role := range app.GetAppRoles() {
+		if role.GetValue() != nil && *role.GetValue() == subject {
+			registration.roleID = role.GetId()
+		}
+	}
+
+	servicePrincipal, err := h.findServicePrincipal(ctx, client, registration.clientID)
+	if err != nil {
+		return nil, err
+	}
+	if servicePrincipal != nil {
+		registration.servicePrincipalID = *servicePrincipal.GetId()
+		registration.assignmentRequired = servicePrincipal.GetAppRoleAssignmentRequired() != nil && *servicePrincipal.GetAppRoleAssignmentRequired()
+	}
+	return registration, nil
+}
+
+// syncAppRoleAssignments assigns the app role of resource to the service
+// principals in principals and removes its assignments to any other one
+func (h *IdentityHelper) syncAppRoleAssignments(ctx context.Context, client *msgraphsdk.GraphServiceClient, resource *appRegistration, principals map[string]bool) error {
+	log := log.FromContext(ctx)
+
+	if resource.roleID == nil {
+		return fmt.Errorf("application %s has no app role %s", resource.objectID, resource.subject)
+	}
+	assignedTo := client.ServicePrincipals().ByServicePrincipalId(resource.servicePrincipalID).AppRoleAssignedTo()
+	assignments, err := assignedTo.Get(ctx, nil)
+	if err != nil {
+		log.Error(err, "Failed to get app role assignments")
+		return err
+	}
+
+	assigned := map[string]bool{}
+	for _, assignment := range assignments.GetValue() {
+		if assignment.GetAppRoleId() == nil || *assignment.GetAppRoleId() != *resource.roleID || assignment.GetPrincipalId() == nil {
+			continue
+		}
+		principalID := assignment.GetPrincipalId().String()
+		if principals[principalID] {
+			assigned[principalID] = true
+			continue
+		}
+		log.Info("Removing app role assignment", "servicePrincipalID", resource.servicePrincipalID, "principalID", principalID)
+		if err := assignedTo.ByAppRoleAssignmentId(*assignment.GetId()).Delete(ctx, nil); err != nil {
+			log.Error(err, "Failed to remove app role assignment", "principalID", principalID)
+			return err
+		}
+	}
+
+	resourceID, err := uuid.Parse(resource.servicePrincipalID)
+	if err != nil {
+		return fmt.Errorf("invalid service principal id %s: %w", resource.servicePrincipalID, err)
+	}
+	for principalID := range principals {
+		if assigned[principalID] {
+			continue
+		}
+		principalUUID, err := uuid.Parse(principalID)
+		if err != nil {
+			return fmt.Errorf("invalid service principal id %s: %w", principalID, err)
+		}
+		log.Info("Adding app role assignment", "servicePrincipalID", resource.servicePrincipalID, "principalID", principalID)
+		assignment := models.NewAppRoleAssignment()
+		assignment.SetPrincipalId(&principalUUID)
+		assignment.SetResourceId(&resourceID)
+		assignment.SetAppRoleId(resource.roleID)
+		if _, err := assignedTo.Post(ctx, assignment, nil); err != nil {
+			log.Error(err, "Failed to create app role assignment", "principalID", principalID)
+			return err
+		}
+	}
+	return nil
+}
+
+// setAppRoleAssignmentRequired sets whether Entra ID issues tokens for
+// resource only to the applications assigned one of its app roles
+func (h *IdentityHelper) setAppRoleAssignmentRequired(ctx context.Context, client *msgraphsdk.GraphServiceClient, resource *appRegistration, required bool) error {
+	log := log.FromContext(ctx)
+
+	if resource.assignmentRequired == required {
+		return nil
+	}
+	log.Info("Updating app role assignment requirement", "servicePrincipalID", resource.servicePrincipalID, "required", required)
+	patch := models.NewServicePrincipal()
+	patch.SetAppRoleAssignmentRequired(&required)
+	if _, err := client.ServicePrincipals().ByServicePrincipalId(resource.servicePrincipalID).Patch(ctx, patch, nil); err != nil {
+		log.Error(err, "Failed to update service principal", "servicePrincipalID", resource.servicePrincipalID)
+		return err
+	}
+	resource.assignmentRequired = required
+	return nil
+}
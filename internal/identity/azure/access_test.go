@@ -0,0 +1,86 @@
+package azure
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+func TestGrantAccess(t *testing.T) {
+	ctx := context.Background()
+	graph := newFakeGraph(t)
+	h := graph.newHelper()
+
+	callee, caller1, caller2 := newIdentity("default", "callee"), newIdentity("default", "caller1"), newIdentity("other", "caller2")
+	servicePrincipals := map[*aegisv1.Identity]string{}
+	for _, identity := range []*aegisv1.Identity{callee, caller1, caller2} {
+		if _, err := h.CreateIdentity(ctx, identity); err != nil {
+			t.Fatal(err)
+		}
+		sp, _ := graph.servicePrincipal(subjectOf(identity))
+		servicePrincipals[identity] = sp.ID
+	}
+	calleeSP := servicePrincipals[callee]
+	checkAccess := func(required bool, callers ...*aegisv1.Identity) {
+		t.Helper()
+		want := map[string]bool{}
+		for _, caller := range callers {
+			want[servicePrincipals[caller]] = true
+		}
+		if got := graph.assignedTo(calleeSP); !reflect.DeepEqual(got, want) {
+			t.Errorf("app role assigned to %v, want %v", got, want)
+		}
+		if sp, _ := graph.servicePrincipal(subjectOf(callee)); sp.AppRoleAssignmentRequired != required {
+			t.Errorf("appRoleAssignmentRequired = %v, want %v", sp.AppRoleAssignmentRequired, required)
+		}
+	}
+
+	// callers without an application on Entra ID are ignored
+	if err := h.GrantAccess(ctx, callee, []string{subjectOf(caller1), "system:serviceaccount:default:unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	checkAccess(true, caller1)
+
+	// the callers no longer allowed lose their assignment
+	if err := h.GrantAccess(ctx, callee, []string{subjectOf(caller2)}); err != nil {
+		t.Fatal(err)
+	}
+	checkAccess(true, caller2)
+
+	// reconciling the callee keeps its assignment to itself
+	if _, err := h.CreateIdentity(ctx, callee); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, assignments := graph.counts(); assignments != 4 {
+		t.Errorf("%d role assignments, want one per identity and one for caller2", assignments)
+	}
+
+	if err := h.RevokeAccess(ctx, callee); err != nil {
+		t.Fatal(err)
+	}
+	checkAccess(false)
+	if _, _, assignments := graph.counts(); assignments != 3 {
+		t.Errorf("%d role assignments after RevokeAccess, want one per identity", assignments)
+	}
+
+	// the access of a deleted identity cannot be granted but there is nothing to revoke
+	if err := h.DeleteIdentity(ctx, callee); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.GrantAccess(ctx, callee, []string{subjectOf(caller1)}); err == nil {
+		t.Errorf("GrantAccess() succeeded for a deleted identity")
+	}
+	if err := h.RevokeAccess(ctx, callee); err != nil {
+		t.Errorf("RevokeAccess() = %v for a deleted identity", err)
+	}
+}
+
+func TestODataString(t *testing.T) {
+	// a quote in a caller cannot change the filter of the lookup
+	caller := "x' or displayName eq 'system:serviceaccount:default:callee"
+	if got, want := "displayName eq "+odataString(caller), "displayName eq 'x'' or displayName eq ''system:serviceaccount:default:callee'"; got != want {
+		t.Errorf("filter = %s, want %s", got, want)
+	}
+}
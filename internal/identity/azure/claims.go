@@ -0,0 +1,305 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/applications"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/policies"
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	aegisClaimsMappingPolicyName = "aegis_id"
+	defaultNamespaceClaim        = "aegis_namespace"
+	defaultIdentityClaim         = "aegis_identity"
+
+	// directory extensions of the applications of the identities, registered on the operator application
+	extensionNamespace = "aegisNamespace"
+	extensionIdentity  = "aegisIdentity"
+)
+
+// claimsMappingMu serializes the creation of the directory extensions and of
+// the claims mapping policy shared by the identities of a tenant
+var claimsMappingMu sync.Mutex
+
+// claimsMapping is the claims mapping policy assigned to the service
+// principals of the identities
+type claimsMapping struct {
+	policyName     string
+	namespaceClaim string
+	identityClaim  string
+}
+
+// newClaimsMapping returns the claims mapping policy configured by spec, nil when disabled
+func newClaimsMapping(spec *aegisv1.AzureClaimsMapping) *claimsMapping {
+	if spec == nil {
+		return nil
+	}
+	m := &claimsMapping{
+		policyName:     spec.PolicyName,
+		namespaceClaim: spec.NamespaceClaim,
+		identityClaim:  spec.IdentityClaim,
+	}
+	if m.policyName == "" {
+		m.policyName = aegisClaimsMappingPolicyName
+	}
+	if m.namespaceClaim == "" {
+		m.namespaceClaim = defaultNamespaceClaim
+	}
+	if m.identityClaim == "" {
+		m.identityClaim = defaultIdentityClaim
+	}
+	return m
+}
+
+type claimsMappingDefinition struct {
+	ClaimsMappingPolicy claimsMappingPolicy `json:"ClaimsMappingPolicy"`
+}
+
+type claimsMappingPolicy struct {
+	Version              int           `json:"Version"`
+	IncludeBasicClaimSet string        `json:"IncludeBasicClaimSet"`
+	ClaimsSchema         []claimSchema `json:"ClaimsSchema"`
+}
+
+type claimSchema struct {
+	Source       string `json:"Source"`
+	ExtensionID  string `json:"ExtensionID"`
+	JwtClaimType string `json:"JwtClaimType"`
+}
+
+// definition returns the definition of the policy emitting the directory
+// extensions of the calling application as claims
+func (m *claimsMapping) definition(extensions map[string]string) string {
+	definition, _ := json.Marshal(claimsMappingDefinition{
+		ClaimsMappingPolicy: claimsMappingPolicy{
+			Version:              1,
+			IncludeBasicClaimSet: "true",
+			ClaimsSchema: []claimSchema{
+				{Source: "application", ExtensionID: extensions[extensionNamespace], JwtClaimType: m.namespaceClaim},
+				{Source: "application", ExtensionID: extensions[extensionIdentity], JwtClaimType: m.identityClaim},
+			},
+		},
+	})
+	return string(definition)
+}
+
+// applyClaimsMapping sets the namespace and the name of identity in the
+// directory extensions of its application and assigns the claims mapping
+// policy to its service principal
+func (h *IdentityHelper) applyClaimsMapping(ctx context.Context, client *msgraphsdk.GraphServiceClient, identity *aegisv1.Identity, registration *appRegistration) error {
+	extensions, policyID, err := h.ensureClaimsMappingPolicy(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	err = h.setExtensionValues(ctx, client, registration.objectID, map[string]string{
+		extensions[extensionNamespace]: identity.Namespace,
+		extensions[extensionIdentity]:  identity.Name,
+	})
+	if err != nil {
+		return err
+	}
+	return h.ensureAssignClaimsMappingPolicyToServicePrincipal(ctx, client, registration.servicePrincipalID, policyID)
+}
+
+// ensureClaimsMappingPolicy registers the directory extensions on the operator
+// application and creates or updates the claims mapping policy. It returns the
+// names of the extensions and the id of the policy.
+func (h *IdentityHelper) ensureClaimsMappingPolicy(ctx context.Context, client *msgraphsdk.GraphServiceClient) (map[string]string, string, error) {
+	log := log.FromContext(ctx)
+
+	claimsMappingMu.Lock()
+	defer claimsMappingMu.Unlock()
+
+	// the extensions are registered on the operator application, so that
+	// their names are the same for all the identities
+	filterQuery := fmt.Sprintf("appId eq %s", odataString(h.clientID))
+	apps, err := client.Applications().Get(ctx, &applications.ApplicationsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &applications.ApplicationsRequestBuilderGetQueryParameters{
+			Filter: &filterQuery,
+		},
+	})
+	if err != nil {
+		log.Error(err, "Failed to list applications")
+		return nil, "", err
+	}
+	if len(apps.GetValue()) == 0 {
+		return nil, "", fmt.Errorf("operator application %s not found", h.clientID)
+	}
+	operatorObjectID := *apps.GetValue()[0].GetId()
+
+	extensions := map[string]string{}
+	for _, exName := range []string{extensionNamespace, extensionIdentity} {
+		extensions[exName] = "extension_" + strings.ReplaceAll(h.clientID, "-", "") + "_" + exName
+		err = h.createExtensionProperty(ctx, client, operatorObjectID, exName, extensions[exName])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	definition := h.claimsMapping.definition(extensions)
+	existing, err := h.getClaimsMappingPolicy(ctx, client)
+	if err != nil {
+		log.Error(err, "Failed to get claims mapping policy", "name", h.claimsMapping.policyName)
+		return nil, "", err
+	}
+	if existing == nil {
+		log.Info("Creating claims mapping policy", "name", h.claimsMapping.policyName)
+		policy := models.NewClaimsMappingPolicy()
+		policy.SetDisplayName(&h.claimsMapping.policyName)
+		policy.SetDefinition([]string{definition})
+		created, err := client.Policies().ClaimsMappingPolicies().Post(ctx, policy, nil)
+		if err != nil {
+			log.Error(err, "Failed to create claims mapping policy", "name", h.claimsMapping.policyName)
+			return nil, "", err
+		}
+		return extensions, *created.GetId(), nil
+	}
+
+	if len(existing.GetDefinition()) != 1 || existing.GetDefinition()[0] != definition {
+		log.Info("Updating drifted claims mapping policy", "name", h.claimsMapping.policyName)
+		patch := models.NewClaimsMappingPolicy()
+		patch.SetDefinition([]string{definition})
+		_, err = client.Policies().ClaimsMappingPolicies().ByClaimsMappingPolicyId(*existing.GetId()).Patch(ctx, patch, nil)
+		if err != nil {
+			log.Error(err, "Failed to update claims mapping policy", "name", h.claimsMapping.policyName)
+			return nil, "", err
+		}
+	}
+	return extensions, *existing.GetId(), nil
+}
+
+// setExtensionValues sets the directory extensions of the application objectID
+func (h *IdentityHelper) setExtensionValues(ctx context.Context, client *msgraphsdk.GraphServiceClient, objectID string, values map[string]string) error {
+	log := log.FromContext(ctx)
+
+	additionalData := map[string]interface{}{}
+	for name, value := range values {
+		additionalData[name] = value
+	}
+	app := models.NewApplication()
+	app.SetAdditionalData(additionalData)
+	if _, err := client.Applications().ByApplicationId(objectID).Patch(ctx, app, nil); err != nil {
+		log.Error(err, "Failed to set directory extensions", "objectID", objectID)
+		return err
+	}
+	return nil
+}
+
+// ensureAssignClaimsMappingPolicyToServicePrincipal assigns the claims mapping
+// policy policyID to the service principal when not yet assigned
+func (h *IdentityHelper) ensureAssignClaimsMappingPolicyToServicePrincipal(ctx context.Context, client *msgraphsdk.GraphServiceClient, servicePrincipalID string, policyID string) error {
+	log := log.FromContext(ctx)
+
+	// Check if the claims mapping policy is already assigned to the service principal
+	log.Info("Checking if claims mapping policy is already assigned", "servicePrincipalID", servicePrincipalID, "policy", policyID)
+	assignedPolicies, err := client.ServicePrincipals().ByServicePrincipalId(servicePrincipalID).ClaimsMappingPolicies().Get(ctx, nil)
+	if err != nil {
+		log.Error(err, "Failed to get claims mapping policies for service principal")
+		return err
+	}
+
+	for _, policy := range assignedPolicies.GetValue() {
+		if *policy.GetId() == policyID {
+			log.Info("Claims mapping policy is already assigned to the service principal", "servicePrincipalID", servicePrincipalID, "policy", policyID)
+			return nil // Policy is already assigned, no action needed
+		}
+	}
+
+	log.Info("Trying to assign service principal to claims mapping policy", "servicePrincipalID", servicePrincipalID, "policy", policyID)
+	ref := models.NewReferenceCreate()
+	refString := fmt.Sprintf("%s/policies/claimsMappingPolicies/%s", h.graphURL, policyID)
+	ref.SetOdataId(&refString)
+	err = client.ServicePrincipals().ByServicePrincipalId(servicePrincipalID).ClaimsMappingPolicies().Ref().Post(ctx, ref, nil)
+	if err != nil {
+		log.Error(err, "Failed to set claims mapping policy to service principal", "policy", h.claimsMapping.policyName)
+		return err
+	}
+
+	return nil
+}
+
+// hasClaimsMappingPolicy reports whether the claims mapping policy is assigned to the service principal
+func (h *IdentityHelper) hasClaimsMappingPolicy(ctx context.Context, client *msgraphsdk.GraphServiceClient, servicePrincipalID string) (bool, error) {
+	assignedPolicies, err := client.ServicePrincipals().ByServicePrincipalId(servicePrincipalID).ClaimsMappingPolicies().Get(ctx, nil)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to get claims mapping policies for service principal")
+		return false, err
+	}
+	for _, policy := range assignedPolicies.GetValue() {
+		if policy.GetDisplayName() != nil && *policy.GetDisplayName() == h.claimsMapping.policyName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getClaimsMappingPolicy returns the claims mapping policy, nil when missing
+func (h *IdentityHelper) getClaimsMappingPolicy(ctx context.Context, client *msgraphsdk.GraphServiceClient) (models.ClaimsMappingPolicyable, error) {
+	log := log.FromContext(ctx)
+
+	filterQuery := fmt.Sprintf("displayName eq %s", odataString(h.claimsMapping.policyName))
+	queryParameters := &policies.ClaimsMappingPoliciesRequestBuilderGetQueryParameters{
+		Filter: &filterQuery,
+	}
+	requestOptions := &policies.ClaimsMappingPoliciesRequestBuilderGetRequestConfiguration{
+		QueryParameters: queryParameters,
+	}
+
+	cresp, err := client.Policies().ClaimsMappingPolicies().Get(ctx, requestOptions)
+	if err != nil {
+		log.Error(err, "Failed to get claims mapping policy")
+		return nil, err
+	}
+
+	if len(cresp.GetValue()) == 0 {
+		log.Info("Claims mapping policy not found", "desiredPolicyName", h.claimsMapping.policyName)
+		return nil, nil
+	}
+
+	log.Info("Found claims mapping policy", "policy", *cresp.GetValue()[0].GetId())
+	return cresp.GetValue()[0], nil
+}
+
+// createExtensionProperty registers the directory extension exName on the
+// application objectID when the extension extensionPropName is missing
+func (h *IdentityHelper) createExtensionProperty(ctx context.Context, client *msgraphsdk.GraphServiceClient, objectID string, exName string, extensionPropName string) error {
+	log := log.FromContext(ctx)
+
+	// Check if the extension already exists
+	log.Info("Checking if directory extension already exists", "extension", extensionPropName, "objectID", objectID)
+	extensions, err := client.Applications().ByApplicationId(objectID).ExtensionProperties().Get(ctx, nil)
+	if err != nil {
+		log.Error(err, "Failed to get directory extension")
+		return err
+	}
+	for _, ext := range extensions.GetValue() {
+		if ext.GetName() != nil && *ext.GetName() == extensionPropName {
+			log.Info("Directory extension already exists", "extension", extensionPropName)
+			return nil
+		}
+	}
+
+	log.Info("Creating directory extension", "extension", exName)
+	dataType := "String"
+	extension := models.NewExtensionProperty()
+	extension.SetName(&exName)
+	extension.SetDataType(&dataType)
+	extension.SetTargetObjects([]string{"Application"})
+	isMultiValued := false
+	extension.SetIsMultiValued(&isMultiValued)
+	if _, err := client.Applications().ByApplicationId(objectID).ExtensionProperties().Post(ctx, extension, nil); err != nil {
+		log.Error(err, "Failed to create directory extension", "extension", exName)
+		return err
+	}
+	log.Info("Directory extension created", "extension", exName)
+	return nil
+}
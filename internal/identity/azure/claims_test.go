@@ -0,0 +1,93 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+// claimsMappingPolicies returns copies of the claims mapping policies of the fake Graph
+func (g *fakeGraph) claimsMappingPolicies() []graphClaimsMappingPolicy {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	policies := []graphClaimsMappingPolicy{}
+	for _, policy := range g.policies {
+		policies = append(policies, *policy)
+	}
+	return policies
+}
+
+func TestClaimsMapping(t *testing.T) {
+	ctx := context.Background()
+	graph := newFakeGraph(t)
+	graph.applications["operator"] = &graphApplication{ID: "operator", AppID: "operator-client-id", DisplayName: "aegis-operator"}
+	h := graph.newHelper()
+	h.claimsMapping = newClaimsMapping(&aegisv1.AzureClaimsMapping{IdentityClaim: "aegis_sa"})
+
+	identities := []*aegisv1.Identity{newIdentity("default", "app"), newIdentity("other", "app")}
+	for _, identity := range identities {
+		if _, err := h.CreateIdentity(ctx, identity); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the extensions are registered once on the operator application
+	operator, _ := graph.application("aegis-operator")
+	if len(operator.ExtensionProperties) != 2 {
+		t.Fatalf("extension properties = %+v, want 2", operator.ExtensionProperties)
+	}
+	policies := graph.claimsMappingPolicies()
+	if len(policies) != 1 || policies[0].DisplayName != aegisClaimsMappingPolicyName || len(policies[0].Definition) != 1 {
+		t.Fatalf("claims mapping policies = %+v, want one %s policy", policies, aegisClaimsMappingPolicyName)
+	}
+	definition := claimsMappingDefinition{}
+	if err := json.Unmarshal([]byte(policies[0].Definition[0]), &definition); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"aegis_namespace": "extension_operatorclientid_aegisNamespace",
+		"aegis_sa":        "extension_operatorclientid_aegisIdentity",
+	}
+	for _, claim := range definition.ClaimsMappingPolicy.ClaimsSchema {
+		if claim.Source != "application" || want[claim.JwtClaimType] != claim.ExtensionID {
+			t.Errorf("claim %+v, want one of %v", claim, want)
+		}
+	}
+
+	for _, identity := range identities {
+		app, _ := graph.application(subjectOf(identity))
+		if app.Extensions["extension_operatorclientid_aegisNamespace"] != identity.Namespace || app.Extensions["extension_operatorclientid_aegisIdentity"] != identity.Name {
+			t.Errorf("extensions of %s = %v", app.DisplayName, app.Extensions)
+		}
+		if sp, _ := graph.servicePrincipal(subjectOf(identity)); len(sp.ClaimsMappingPolicies) != 1 || sp.ClaimsMappingPolicies[0] != policies[0].ID {
+			t.Errorf("claims mapping policies of %s = %v", app.DisplayName, sp.ClaimsMappingPolicies)
+		}
+		if exists, err := h.GetIdentity(ctx, identity); err != nil || !exists {
+			t.Errorf("GetIdentity(%s) = %v, %v", app.DisplayName, exists, err)
+		}
+	}
+
+	// a drifted policy is updated and an identity without the policy is out of sync
+	sp, _ := graph.servicePrincipal(subjectOf(identities[0]))
+	graph.mu.Lock()
+	graph.policies[policies[0].ID].Definition = []string{"{}"}
+	graph.servicePrincipals[sp.ID].ClaimsMappingPolicies = nil
+	graph.mu.Unlock()
+	if exists, err := h.GetIdentity(ctx, identities[0]); err != nil || exists {
+		t.Errorf("GetIdentity() = %v, %v without the claims mapping policy", exists, err)
+	}
+	if _, err := h.CreateIdentity(ctx, identities[0]); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := h.GetIdentity(ctx, identities[0]); err != nil || !exists {
+		t.Errorf("GetIdentity() = %v, %v after CreateIdentity", exists, err)
+	}
+	if policies := graph.claimsMappingPolicies(); len(policies) != 1 || policies[0].Definition[0] != h.claimsMapping.definition(map[string]string{
+		extensionNamespace: "extension_operatorclientid_aegisNamespace",
+		extensionIdentity:  "extension_operatorclientid_aegisIdentity",
+	}) {
+		t.Errorf("claims mapping policies = %+v, want the updated definition", policies)
+	}
+}
@@ -0,0 +1,417 @@
+package azure
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/google/uuid"
+)
+
+const testIssuer = "https://oidc.example.com/cluster"
+
+// fakeCredential issues Microsoft Graph tokens without calling Entra ID
+type fakeCredential struct{}
+
+func (fakeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "graph-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+type graphApplication struct {
+	ID          string                `json:"id"`
+	AppID       string                `json:"appId"`
+	DisplayName string                `json:"displayName"`
+	Tags        []string              `json:"tags,omitempty"`
+	AppRoles    []graphAppRole        `json:"appRoles,omitempty"`
+	FICs        []graphFederatedCreds `json:"-"`
+	// Extensions are the values of the directory extensions of the application
+	Extensions          map[string]string        `json:"-"`
+	ExtensionProperties []graphExtensionProperty `json:"-"`
+}
+
+type graphExtensionProperty struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	DataType      string   `json:"dataType"`
+	TargetObjects []string `json:"targetObjects"`
+}
+
+type graphClaimsMappingPolicy struct {
+	ID          string   `json:"id"`
+	DisplayName string   `json:"displayName"`
+	Definition  []string `json:"definition"`
+}
+
+type graphAppRole struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+}
+
+type graphFederatedCreds struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Issuer    string   `json:"issuer"`
+	Subject   string   `json:"subject"`
+	Audiences []string `json:"audiences"`
+}
+
+type graphServicePrincipal struct {
+	ID                        string `json:"id"`
+	AppID                     string `json:"appId"`
+	AppRoleAssignmentRequired bool   `json:"appRoleAssignmentRequired"`
+	// ClaimsMappingPolicies are the ids of the claims mapping policies assigned to the service principal
+	ClaimsMappingPolicies []string `json:"-"`
+}
+
+type graphAppRoleAssignment struct {
+	ID          string `json:"id"`
+	PrincipalID string `json:"principalId"`
+	ResourceID  string `json:"resourceId"`
+	AppRoleID   string `json:"appRoleId"`
+}
+
+// fakeGraph is an in memory stand-in of the Microsoft Graph endpoints used by the helper
+type fakeGraph struct {
+	*httptest.Server
+
+	mu                sync.Mutex
+	applications      map[string]*graphApplication
+	servicePrincipals map[string]*graphServicePrincipal
+	assignments       map[string]*graphAppRoleAssignment
+	policies          map[string]*graphClaimsMappingPolicy
+	// deletedItems are the ids of the soft deleted applications and service principals
+	deletedItems map[string]bool
+}
+
+var filterPattern = regexp.MustCompile(`^(\w+) eq '(.*)'$`)
+
+func newFakeGraph(t *testing.T) *fakeGraph {
+	g := &fakeGraph{
+		applications:      map[string]*graphApplication{},
+		servicePrincipals: map[string]*graphServicePrincipal{},
+		assignments:       map[string]*graphAppRoleAssignment{},
+		policies:          map[string]*graphClaimsMappingPolicy{},
+		deletedItems:      map[string]bool{},
+	}
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serveHTTP))
+	t.Cleanup(g.Close)
+	return g
+}
+
+// newHelper returns a helper managing the identities on the fake Graph
+func (g *fakeGraph) newHelper() *IdentityHelper {
+	h := New("tenant", "operator-client-id", nil)
+	h.graphURL = g.URL + "/v1.0"
+	h.credential = fakeCredential{}
+	h.issuer = func(ctx context.Context) (string, error) { return testIssuer, nil }
+	return h
+}
+
+// application returns a copy of the application named displayName
+func (g *fakeGraph) application(displayName string) (graphApplication, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, app := range g.applications {
+		if app.DisplayName == displayName {
+			return *app, true
+		}
+	}
+	return graphApplication{}, false
+}
+
+// servicePrincipal returns a copy of the service principal of the application named displayName
+func (g *fakeGraph) servicePrincipal(displayName string) (graphServicePrincipal, bool) {
+	app, ok := g.application(displayName)
+	if !ok {
+		return graphServicePrincipal{}, false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, sp := range g.servicePrincipals {
+		if sp.AppID == app.AppID {
+			return *sp, true
+		}
+	}
+	return graphServicePrincipal{}, false
+}
+
+// assignedTo returns the ids of the service principals assigned an app role of
+// the service principal resourceID, other than itself
+func (g *fakeGraph) assignedTo(resourceID string) map[string]bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	principals := map[string]bool{}
+	for _, assignment := range g.assignments {
+		if assignment.ResourceID == resourceID && assignment.PrincipalID != resourceID {
+			principals[assignment.PrincipalID] = true
+		}
+	}
+	return principals
+}
+
+// counts returns the number of applications, service principals and app role assignments
+func (g *fakeGraph) counts() (int, int, int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.applications), len(g.servicePrincipals), len(g.assignments)
+}
+
+func (g *fakeGraph) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer graph-token" {
+		http.Error(w, `{"error":{"code":"InvalidAuthenticationToken"}}`, http.StatusUnauthorized)
+		return
+	}
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+	data, _ := io.ReadAll(body)
+
+	var filter []string
+	if f := r.URL.Query().Get("$filter"); f != "" {
+		filter = filterPattern.FindStringSubmatch(f)
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1.0"), "/"), "/")
+	route := r.Method + " "
+	if path[0] == "policies" || path[0] == "directory" {
+		route += path[0] + "/"
+		path = path[1:]
+	}
+	route += path[0]
+	if len(path) > 2 {
+		route += "/{id}/" + path[2]
+	}
+	if len(path) == 2 || len(path) > 3 {
+		route += "/{id}"
+	}
+
+	switch route {
+	case "GET applications":
+		apps := []interface{}{}
+		for _, app := range g.applications {
+			if filter != nil && (filter[1] == "displayName" && app.DisplayName == filter[2] || filter[1] == "appId" && app.AppID == filter[2]) {
+				apps = append(apps, app)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"value": apps})
+	case "POST applications":
+		app := &graphApplication{}
+		_ = json.Unmarshal(data, app)
+		app.ID, app.AppID = uuid.NewString(), uuid.NewString()
+		g.applications[app.ID] = app
+		writeJSON(w, http.StatusCreated, app)
+	case "PATCH applications/{id}":
+		app, ok := g.applications[path[1]]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"code": "Request_ResourceNotFound"}})
+			return
+		}
+		values := map[string]interface{}{}
+		_ = json.Unmarshal(data, &values)
+		for name, value := range values {
+			if strings.HasPrefix(name, "extension_") {
+				if app.Extensions == nil {
+					app.Extensions = map[string]string{}
+				}
+				app.Extensions[name], _ = value.(string)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "GET applications/{id}/extensionProperties":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"value": g.applications[path[1]].ExtensionProperties})
+	case "POST applications/{id}/extensionProperties":
+		app := g.applications[path[1]]
+		extension := graphExtensionProperty{}
+		_ = json.Unmarshal(data, &extension)
+		extension.ID = uuid.NewString()
+		extension.Name = "extension_" + strings.ReplaceAll(app.AppID, "-", "") + "_" + extension.Name
+		app.ExtensionProperties = append(app.ExtensionProperties, extension)
+		writeJSON(w, http.StatusCreated, extension)
+	case "DELETE applications/{id}":
+		app, ok := g.applications[path[1]]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"code": "Request_ResourceNotFound"}})
+			return
+		}
+		delete(g.applications, app.ID)
+		g.deletedItems[app.ID] = true
+		for id, sp := range g.servicePrincipals {
+			if sp.AppID == app.AppID {
+				g.deleteServicePrincipal(id)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE servicePrincipals/{id}":
+		if _, ok := g.servicePrincipals[path[1]]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"code": "Request_ResourceNotFound"}})
+			return
+		}
+		g.deleteServicePrincipal(path[1])
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE directory/deletedItems/{id}":
+		if !g.deletedItems[path[1]] {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"code": "Request_ResourceNotFound"}})
+			return
+		}
+		delete(g.deletedItems, path[1])
+		w.WriteHeader(http.StatusNoContent)
+	case "GET applications/{id}/federatedIdentityCredentials":
+		app, ok := g.applications[path[1]]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"code": "Request_ResourceNotFound"}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"value": app.FICs})
+	case "POST applications/{id}/federatedIdentityCredentials":
+		app := g.applications[path[1]]
+		fic := graphFederatedCreds{}
+		_ = json.Unmarshal(data, &fic)
+		fic.ID = uuid.NewString()
+		app.FICs = append(app.FICs, fic)
+		writeJSON(w, http.StatusCreated, fic)
+	case "PATCH applications/{id}/federatedIdentityCredentials/{id}":
+		app := g.applications[path[1]]
+		for i := range app.FICs {
+			if app.FICs[i].ID == path[3] {
+				_ = json.Unmarshal(data, &app.FICs[i])
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "GET servicePrincipals":
+		sps := []interface{}{}
+		for _, sp := range g.servicePrincipals {
+			if filter != nil && filter[1] == "appId" && sp.AppID == filter[2] {
+				sps = append(sps, sp)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"value": sps})
+	case "POST servicePrincipals":
+		sp := &graphServicePrincipal{}
+		_ = json.Unmarshal(data, sp)
+		sp.ID = uuid.NewString()
+		g.servicePrincipals[sp.ID] = sp
+		writeJSON(w, http.StatusCreated, sp)
+	case "PATCH servicePrincipals/{id}":
+		sp, ok := g.servicePrincipals[path[1]]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"code": "Request_ResourceNotFound"}})
+			return
+		}
+		_ = json.Unmarshal(data, sp)
+		sp.ID = path[1]
+		w.WriteHeader(http.StatusNoContent)
+	case "GET servicePrincipals/{id}/claimsMappingPolicies":
+		policies := []interface{}{}
+		for _, id := range g.servicePrincipals[path[1]].ClaimsMappingPolicies {
+			policies = append(policies, g.policies[id])
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"value": policies})
+	case "POST servicePrincipals/{id}/claimsMappingPolicies/{id}":
+		ref := map[string]string{}
+		_ = json.Unmarshal(data, &ref)
+		id := ref["@odata.id"][strings.LastIndex(ref["@odata.id"], "/")+1:]
+		sp := g.servicePrincipals[path[1]]
+		if _, ok := g.policies[id]; !ok || path[3] != "$ref" || len(sp.ClaimsMappingPolicies) > 0 {
+			http.Error(w, `{"error":{"code":"Request_BadRequest"}}`, http.StatusBadRequest)
+			return
+		}
+		sp.ClaimsMappingPolicies = append(sp.ClaimsMappingPolicies, id)
+		w.WriteHeader(http.StatusNoContent)
+	case "GET policies/claimsMappingPolicies":
+		policies := []interface{}{}
+		for _, policy := range g.policies {
+			if filter != nil && filter[1] == "displayName" && policy.DisplayName == filter[2] {
+				policies = append(policies, policy)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"value": policies})
+	case "POST policies/claimsMappingPolicies":
+		policy := &graphClaimsMappingPolicy{}
+		_ = json.Unmarshal(data, policy)
+		policy.ID = uuid.NewString()
+		g.policies[policy.ID] = policy
+		writeJSON(w, http.StatusCreated, policy)
+	case "PATCH policies/claimsMappingPolicies/{id}":
+		policy, ok := g.policies[path[1]]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"code": "Request_ResourceNotFound"}})
+			return
+		}
+		_ = json.Unmarshal(data, policy)
+		policy.ID = path[1]
+		w.WriteHeader(http.StatusNoContent)
+	case "GET servicePrincipals/{id}/appRoleAssignedTo":
+		assignments := []interface{}{}
+		for _, assignment := range g.assignments {
+			if assignment.ResourceID == path[1] {
+				assignments = append(assignments, assignment)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"value": assignments})
+	case "POST servicePrincipals/{id}/appRoleAssignments":
+		assignment := &graphAppRoleAssignment{}
+		_ = json.Unmarshal(data, assignment)
+		if assignment.PrincipalID != path[1] {
+			http.Error(w, `{"error":{"code":"Request_BadRequest"}}`, http.StatusBadRequest)
+			return
+		}
+		assignment.ID = uuid.NewString()
+		g.assignments[assignment.ID] = assignment
+		writeJSON(w, http.StatusCreated, assignment)
+	case "POST servicePrincipals/{id}/appRoleAssignedTo":
+		assignment := &graphAppRoleAssignment{}
+		_ = json.Unmarshal(data, assignment)
+		if assignment.ResourceID != path[1] {
+			http.Error(w, `{"error":{"code":"Request_BadRequest"}}`, http.StatusBadRequest)
+			return
+		}
+		assignment.ID = uuid.NewString()
+		g.assignments[assignment.ID] = assignment
+		writeJSON(w, http.StatusCreated, assignment)
+	case "DELETE servicePrincipals/{id}/appRoleAssignedTo/{id}":
+		assignment, ok := g.assignments[path[3]]
+		if !ok || assignment.ResourceID != path[1] {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"code": "Request_ResourceNotFound"}})
+			return
+		}
+		delete(g.assignments, assignment.ID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"error":{"code":"UnknownRoute","message":"`+route+`"}}`, http.StatusNotImplemented)
+	}
+}
+
+// deleteServicePrincipal soft deletes the service principal id and its app role assignments
+func (g *fakeGraph) deleteServicePrincipal(id string) {
+	delete(g.servicePrincipals, id)
+	g.deletedItems[id] = true
+	for assignmentID, assignment := range g.assignments {
+		if assignment.PrincipalID == id || assignment.ResourceID == id {
+			delete(g.assignments, assignmentID)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -2,10 +2,9 @@ package azure
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"net/http"
 	"strings"
 	"time"
 
@@ -15,16 +14,20 @@ import (
 	"github.com/google/uuid"
 	azureauth "github.com/microsoft/kiota-authentication-azure-go"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	msgraphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
 	"github.com/microsoftgraph/msgraph-sdk-go/applications"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
-	"github.com/microsoftgraph/msgraph-sdk-go/policies"
 	"github.com/microsoftgraph/msgraph-sdk-go/serviceprincipals"
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"github.com/vmarchese/aegis-operator/internal/identity/k8stoken"
+	"github.com/vmarchese/aegis-operator/internal/logging"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 const (
 	ProviderName = "azure"
+	Audience     = "api://AzureADTokenExchange"
 	K8STokenPath = "/var/run/secrets/tokens/azure_token"
 
 	StatusMetaAegisIdentityObjectID = "aegis.identity.objectid"
@@ -32,68 +35,192 @@ const (
 	StatusMetaAegisAzureTenantID    = "aegis.identity.azure.tenantid"
 	StatusMetaAegisProvider         = "aegis.identity.provider"
 
-	aegisClaimsMappingPolicyName = "aegis_id"
+	graphScope = "https://graph.microsoft.com/.default"
+	graphURL   = "https://graph.microsoft.com/v1.0"
 )
 
+// IdentityHelper manages the app registrations of the identities on Entra ID.
+// It is not modified after New, so a helper can be cached and used by
+// concurrent reconciliations: the state of an identity flows through an
+// appRegistration.
 type IdentityHelper struct {
 	tenantID string
+	// clientID is the client id of the operator application
 	clientID string
-	retries  int
-	timeout  time.Duration
+	// credentials of the operator application, the mounted token when nil
+	credentials *idp.Credentials
+	retries     int
+	timeout     time.Duration
+	// clientKey identifies the cached clients of the provider
+	clientKey idp.ClientKey
+	// claimsMapping is the claims mapping policy of the identities, nil when disabled
+	claimsMapping *claimsMapping
+	// permanentDeletion purges the deleted applications from the deleted items of the directory
+	permanentDeletion bool
+
+	// graphURL, credential and issuer are replaced by the tests
+	graphURL   string
+	credential azcore.TokenCredential
+	issuer     func(ctx context.Context) (string, error)
+}
 
-	objectID           string
+// appRegistration is the app registration of an identity on Entra ID
+type appRegistration struct {
+	// subject is the subject of the service account tokens of the identity,
+	// also the display name of its application
+	subject string
+	// objectID and clientID are the object id and the app id of the application
+	objectID string
+	clientID string
+	// servicePrincipalID is the object id of the service principal of the application
 	servicePrincipalID string
-	subject            string
-	roleID             *uuid.UUID
+	// roleID is the id of the app role of the application
+	roleID *uuid.UUID
+	// assignmentRequired reports whether the service principal only gets
+	// tokens issued for the applications assigned its app role
+	assignmentRequired bool
 }
 
-func New(tenantID string, clientID string) *IdentityHelper {
+func New(tenantID string, clientID string, credentials *idp.Credentials) *IdentityHelper {
 	return &IdentityHelper{
-		tenantID: tenantID,
-		clientID: clientID,
-		retries:  3,
-		timeout:  10 * time.Second,
+		tenantID:    tenantID,
+		clientID:    clientID,
+		credentials: credentials,
+		retries:     3,
+		timeout:     10 * time.Second,
+		graphURL:    graphURL,
+		issuer:      k8stoken.Issuer,
 	}
 }
 
+// subjectOf returns the subject of the service account tokens of identity
+func subjectOf(identity *aegisv1.Identity) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name)
+}
+
 func (h *IdentityHelper) GetName() string {
 	return ProviderName
 }
 
-func (h *IdentityHelper) getGraphClient(ctx context.Context) (*msgraphsdk.GraphServiceClient, error) {
+func (h *IdentityHelper) GetAudience() string {
+	return Audience
+}
+
+// GetTokenBounds allows a single audience, the only one accepted by federated identity credentials
+func (h *IdentityHelper) GetTokenBounds() idp.TokenBounds {
+	return idp.TokenBounds{
+		MinTTL:       idp.MinTokenTTL,
+		MaxAudiences: 1,
+	}
+}
+
+func (h *IdentityHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	args := []string{
+		"--azure-tenant-id", h.tenantID,
+	}
+	if identity != nil {
+		clientID := identity.Status.Metadata[StatusMetaAegisIdentityID]
+		if clientID == "" {
+			return nil, fmt.Errorf("client id is not set for identity %s", identity.Name)
+		}
+		args = append(args, "--azure-client-id", clientID)
+	}
+	return args, nil
+}
+
+// CheckHealth acquires a Microsoft Graph token with the credential of the operator application
+func (h *IdentityHelper) CheckHealth(ctx context.Context) idp.Health {
+	cred, err := h.getCredential(ctx)
+	if err != nil {
+		return idp.Health{Err: err}
+	}
+	_, err = cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{graphScope}})
+	if err != nil {
+		// Entra ID answered but refused the assertion
+		var authErr *azidentity.AuthenticationFailedError
+		if errors.As(err, &authErr) {
+			return idp.Health{Reachable: true, Err: err}
+		}
+		return idp.Health{Err: err}
+	}
+	return idp.Health{Reachable: true, Authenticated: true}
+}
+
+// getCredential returns a client secret credential when the provider
+// references a client secret, a client assertion credential otherwise
+func (h *IdentityHelper) getCredential(ctx context.Context) (azcore.TokenCredential, error) {
 	log := log.FromContext(ctx)
+	if h.credential != nil {
+		return h.credential, nil
+	}
 
-	cred, err := azidentity.NewClientAssertionCredential(h.tenantID, h.clientID, h.GetToken, &azidentity.ClientAssertionCredentialOptions{
-		ClientOptions: azcore.ClientOptions{
-			Retry: policy.RetryOptions{
-				MaxRetries: int32(h.retries),
-				TryTimeout: h.timeout,
-			},
+	clientOptions := azcore.ClientOptions{
+		Retry: policy.RetryOptions{
+			MaxRetries: int32(h.retries),
+			TryTimeout: h.timeout,
 		},
-	})
+		Transport: logging.HTTPClient(nil),
+	}
+	var cred azcore.TokenCredential
+	var err error
+	if h.credentials != nil && h.credentials.Secret != nil {
+		var secret string
+		secret, err = h.credentials.SecretValue(idp.CredentialClientSecret)
+		if err != nil {
+			return nil, err
+		}
+		cred, err = azidentity.NewClientSecretCredential(h.tenantID, h.clientID, secret, &azidentity.ClientSecretCredentialOptions{ClientOptions: clientOptions})
+	} else {
+		cred, err = azidentity.NewClientAssertionCredential(h.tenantID, h.clientID, h.GetToken, &azidentity.ClientAssertionCredentialOptions{ClientOptions: clientOptions})
+	}
 	if err != nil {
 		log.Error(err, "Failed to create Azure Identity credential")
 		return nil, err
 	}
+	return cred, nil
+}
+
+// getGraphClient returns a Microsoft Graph client shared by the identities of
+// the provider. Its credential renews the Graph tokens before they expire.
+func (h *IdentityHelper) getGraphClient(ctx context.Context) (*msgraphsdk.GraphServiceClient, error) {
+	return idp.CachedClient(ctx, h.clientKey, "graph", func(ctx context.Context) (*msgraphsdk.GraphServiceClient, time.Time, error) {
+		client, err := h.newGraphClient(ctx)
+		return client, time.Time{}, err
+	})
+}
+
+func (h *IdentityHelper) newGraphClient(ctx context.Context) (*msgraphsdk.GraphServiceClient, error) {
+	log := log.FromContext(ctx)
+
+	cred, err := h.getCredential(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	authProvider, err := azureauth.NewAzureIdentityAuthenticationProviderWithScopes(cred, []string{"https://graph.microsoft.com/.default"})
+	authProvider, err := azureauth.NewAzureIdentityAuthenticationProviderWithScopes(cred, []string{graphScope})
 	if err != nil {
 		log.Error(err, "Failed to create Azure AuthenticationProvider")
 		return nil, err
 	}
 
-	adapter, err := msgraphsdk.NewGraphRequestAdapter(authProvider)
+	clientOptions := msgraphsdk.GetDefaultClientOptions()
+	httpClient := msgraphcore.GetDefaultClient(&clientOptions)
+	httpClient.Transport = logging.Transport(httpClient.Transport)
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(authProvider, nil, nil, httpClient)
 	if err != nil {
 		log.Error(err, "Failed to create Azure GraphRequestAdapter")
 		return nil, err
 	}
 
+	adapter.SetBaseUrl(h.graphURL)
+
 	log.Info("Creating Azure GraphServiceClient")
 	client := msgraphsdk.NewGraphServiceClient(adapter)
 	return client, nil
 }
 
-func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (map[string]string, error) {
+func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (_ map[string]string, err error) {
+	defer h.invalidateOnAuthFailure(&err)
 	log := log.FromContext(ctx)
 
 	client, err := h.getGraphClient(ctx)
@@ -101,54 +228,56 @@ func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.I
 		return nil, err
 	}
 
+	options, err := idp.GetTokenOptions(h, identity)
+	if err != nil {
+		return nil, err
+	}
+
 	log.Info("Getting issuer")
 	issuer, err := h.GetIssuer(ctx)
 	if err != nil {
 		log.Error(err, "Failed to get issuer")
 		return nil, err
 	}
-	h.subject = fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name)
 
 	// Check and create application registration
-	err = h.ensureAppRegistration(ctx, client, identity, issuer)
+	registration, err := h.ensureAppRegistration(ctx, client, identity, issuer)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create directory extension
-	/*
-		exName := "federatedSubject"
-		extensionPropName := "extension_" + strings.Replace(h.clientID, "-", "", -1) + "_federatedSubject"
-
-			err = h.createExtensionProperty(ctx, client, exName, extensionPropName)
-			if err != nil {
-				return nil, err
-			}
-	*/
-
 	// creating federated identity credential
 	log.Info("Creating FederatedIdentityCredential")
-	err = h.createFederatedIdentityCredential(ctx, client, identity.Name, issuer)
+	err = h.createFederatedIdentityCredential(ctx, client, registration, identity.Name, issuer, options.Audiences)
 	if err != nil {
 		log.Error(err, "Failed to create FederatedIdentityCredential")
 		return nil, err
 	}
 
 	// adding claim mapping policy
+	if h.claimsMapping != nil {
+		err = h.applyClaimsMapping(ctx, client, identity, registration)
+		if err != nil {
+			log.Error(err, "Failed to apply claims mapping policy")
+			return nil, err
+		}
+	}
 
 	return map[string]string{
-		StatusMetaAegisIdentityObjectID: h.objectID,
-		StatusMetaAegisIdentityID:       h.clientID,
+		StatusMetaAegisIdentityObjectID: registration.objectID,
+		StatusMetaAegisIdentityID:       registration.clientID,
 		StatusMetaAegisAzureTenantID:    h.tenantID,
 		StatusMetaAegisProvider:         ProviderName,
 	}, nil
 }
 
-// New method to check and create app registration
-func (h *IdentityHelper) ensureAppRegistration(ctx context.Context, client *msgraphsdk.GraphServiceClient, identity *aegisv1.Identity, issuer string) error {
+// ensureAppRegistration creates the application, its app role and its service
+// principal when missing and returns the app registration of the identity
+func (h *IdentityHelper) ensureAppRegistration(ctx context.Context, client *msgraphsdk.GraphServiceClient, identity *aegisv1.Identity, issuer string) (*appRegistration, error) {
 	log := log.FromContext(ctx)
 
-	filterQuery := fmt.Sprintf("displayName eq '%s'", h.subject)
+	registration := &appRegistration{subject: subjectOf(identity)}
+	filterQuery := fmt.Sprintf("displayName eq %s", odataString(registration.subject))
 
 	queryParameters := &applications.ApplicationsRequestBuilderGetQueryParameters{
 		Filter: &filterQuery,
@@ -161,7 +290,7 @@ func (h *IdentityHelper) ensureAppRegistration(ctx context.Context, client *msgr
 	result, err := client.Applications().Get(ctx, requestConfig)
 	if err != nil {
 		log.Error(err, "Failed to list applications")
-		return err
+		return nil, err
 	}
 
 	mustCreate := false
@@ -173,7 +302,7 @@ func (h *IdentityHelper) ensureAppRegistration(ctx context.Context, client *msgr
 
 	if mustCreate {
 		app := models.NewApplication()
-		app.SetDisplayName(&h.subject)
+		app.SetDisplayName(&registration.subject)
 		app.SetTags([]string{
 			"aegis",
 			fmt.Sprintf("identity:%s", identity.Name),
@@ -186,14 +315,14 @@ func (h *IdentityHelper) ensureAppRegistration(ctx context.Context, client *msgr
 		app.SetApi(api)
 
 		roleID := uuid.New()
-		h.roleID = &roleID
+		registration.roleID = &roleID
 		roles := models.NewAppRole()
 		roleEnabled := true
-		roles.SetId(h.roleID)
-		roles.SetDisplayName(&h.subject)
-		roles.SetValue(&h.subject)
+		roles.SetId(registration.roleID)
+		roles.SetDisplayName(&registration.subject)
+		roles.SetValue(&registration.subject)
 		roles.SetAllowedMemberTypes([]string{"Application"})
-		roles.SetDescription(&h.subject)
+		roles.SetDescription(&registration.subject)
 		roles.SetIsEnabled(&roleEnabled)
 		app.SetAppRoles([]models.AppRoleable{roles})
 
@@ -201,160 +330,130 @@ func (h *IdentityHelper) ensureAppRegistration(ctx context.Context, client *msgr
 		createdApp, err := client.Applications().Post(ctx, app, nil)
 		if err != nil {
 			log.Error(err, "Failed to create Azure Application")
-			return err
-		}
-		h.objectID = *createdApp.GetId()
-		h.clientID = *createdApp.GetAppId()
-
-		servicePrincipal := models.NewServicePrincipal()
-		servicePrincipal.SetAppId(&h.clientID)
-		spResp, err := client.ServicePrincipals().Post(ctx, servicePrincipal, nil)
-		if err != nil {
-			log.Error(err, "Failed to create Azure ServicePrincipal")
-			return err
+			return nil, err
 		}
-		h.servicePrincipalID = *spResp.GetId()
-
+		registration.objectID = *createdApp.GetId()
+		registration.clientID = *createdApp.GetAppId()
 	} else {
-		h.clientID = *apps[0].GetAppId()
-		h.objectID = *apps[0].GetId()
-
-		filterQuery := fmt.Sprintf("appId eq '%s'", h.clientID)
-		queryParameters := &serviceprincipals.ServicePrincipalsRequestBuilderGetQueryParameters{
-			Filter: &filterQuery,
-		}
-		requestConfig := &serviceprincipals.ServicePrincipalsRequestBuilderGetRequestConfiguration{
-			QueryParameters: queryParameters,
-		}
-		spResp, err := client.ServicePrincipals().Get(ctx, requestConfig)
-		if err != nil {
-			log.Error(err, "Failed to get service principal")
-			return err
+		registration.clientID = *apps[0].GetAppId()
+		registration.objectID = *apps[0].GetId()
+		for _, role := range apps[0].GetAppRoles() {
+			if role.GetValue() != nil && *role.GetValue() == registration.subject {
+				registration.roleID = role.GetId()
+			}
 		}
-		h.servicePrincipalID = *spResp.GetValue()[0].GetId()
 	}
 
-	err = h.addAppRoleAssignment(ctx, client)
+	servicePrincipalID, err := h.ensureServicePrincipal(ctx, client, registration.clientID)
 	if err != nil {
-		log.Error(err, "Failed to add app role assignment")
-		return err
+		return nil, err
 	}
-	// Call the new method to assign claims mapping policy to the service principal
-	/*
-		err = h.ensureAssignClaimsMappingPolicyToServicePrincipal(ctx, client)
-		if err != nil {
-			return err
-		}
-	*/
+	registration.servicePrincipalID = servicePrincipalID
 
-	return nil
+	err = h.addAppRoleAssignment(ctx, client, registration)
+	if err != nil {
+		log.Error(err, "Failed to add app role assignment")
+		return nil, err
+	}
+	return registration, nil
 }
 
-func (h *IdentityHelper) addAppRoleAssignment(ctx context.Context, client *msgraphsdk.GraphServiceClient) error {
+// ensureServicePrincipal returns the object id of the service principal of
+// the application appID, created when missing
+func (h *IdentityHelper) ensureServicePrincipal(ctx context.Context, client *msgraphsdk.GraphServiceClient, appID string) (string, error) {
 	log := log.FromContext(ctx)
 
-	// check if the app role assignment already exists
-
-	rolesAssigned, err := client.ServicePrincipals().ByServicePrincipalId(h.servicePrincipalID).AppRoleAssignedTo().Get(ctx, nil)
+	existing, err := h.findServicePrincipal(ctx, client, appID)
 	if err != nil {
-		log.Error(err, "Failed to get app role assignments")
-		return err
+		return "", err
 	}
-	if len(rolesAssigned.GetValue()) > 0 {
-		log.Info("App role assignment already exists")
-		h.roleID = rolesAssigned.GetValue()[0].GetAppRoleId()
-		return nil
+	if existing != nil {
+		return *existing.GetId(), nil
 	}
 
-	servicePrincipalIDUUID := uuid.MustParse(h.servicePrincipalID)
-	appRoleAssignment := models.NewAppRoleAssignment()
-	appRoleAssignment.SetPrincipalId(&servicePrincipalIDUUID)
-	appRoleAssignment.SetResourceId(&servicePrincipalIDUUID)
-	appRoleAssignment.SetAppRoleId(h.roleID)
-
-	_, err = client.ServicePrincipals().ByServicePrincipalId(h.servicePrincipalID).AppRoleAssignments().Post(context.Background(), appRoleAssignment, nil)
+	servicePrincipal := models.NewServicePrincipal()
+	servicePrincipal.SetAppId(&appID)
+	created, err := client.ServicePrincipals().Post(ctx, servicePrincipal, nil)
 	if err != nil {
-		log.Error(err, "Failed to create app role assignment")
-		return err
+		log.Error(err, "Failed to create Azure ServicePrincipal")
+		return "", err
 	}
-
-	return nil
+	return *created.GetId(), nil
 }
 
-// New method to assign claims mapping policy to the service principal
-func (h *IdentityHelper) ensureAssignClaimsMappingPolicyToServicePrincipal(ctx context.Context, client *msgraphsdk.GraphServiceClient) error {
+// findServicePrincipal returns the service principal of the application appID, nil when missing
+func (h *IdentityHelper) findServicePrincipal(ctx context.Context, client *msgraphsdk.GraphServiceClient, appID string) (models.ServicePrincipalable, error) {
 	log := log.FromContext(ctx)
 
-	cmID, err := h.getClaimsMappingPolicy(ctx, client)
-	if err != nil {
-		log.Error(err, "Failed to get claims mapping policy", "name", aegisClaimsMappingPolicyName)
-		return err
-	}
-	log.Info("Found claims mapping policy", "policy", cmID)
-
-	// Check if the claims mapping policy is already assigned to the service principal
-	log.Info("Checking if claims mapping policy is already assigned", "servicePrincipalID", h.servicePrincipalID, "policy", cmID)
-	assignedPolicies, err := client.ServicePrincipals().ByServicePrincipalId(h.servicePrincipalID).ClaimsMappingPolicies().Get(ctx, nil)
-	if err != nil {
-		log.Error(err, "Failed to get claims mapping policies for service principal")
-		return err
+	filterQuery := fmt.Sprintf("appId eq %s", odataString(appID))
+	queryParameters := &serviceprincipals.ServicePrincipalsRequestBuilderGetQueryParameters{
+		Filter: &filterQuery,
 	}
-
-	for _, policy := range assignedPolicies.GetValue() {
-		if *policy.GetId() == cmID {
-			log.Info("Claims mapping policy is already assigned to the service principal", "servicePrincipalID", h.servicePrincipalID, "policy", cmID)
-			return nil // Policy is already assigned, no action needed
-		}
+	requestConfig := &serviceprincipals.ServicePrincipalsRequestBuilderGetRequestConfiguration{
+		QueryParameters: queryParameters,
 	}
-
-	log.Info("Trying to assign service principal to claims mapping policy", "servicePrincipalID", h.servicePrincipalID, "policy", cmID)
-	ref := models.NewReferenceCreate()
-	refString := fmt.Sprintf("https://graph.microsoft.com/v1.0/policies/claimsMappingPolicies/%s", cmID)
-	ref.SetOdataId(&refString)
-	err = client.ServicePrincipals().ByServicePrincipalId(h.servicePrincipalID).ClaimsMappingPolicies().Ref().Post(ctx, ref, nil)
+	spResp, err := client.ServicePrincipals().Get(ctx, requestConfig)
 	if err != nil {
-		log.Error(err, "Failed to set claims mapping policy to service principal", "policy", aegisClaimsMappingPolicyName)
-		return err
+		log.Error(err, "Failed to get service principal")
+		return nil, err
 	}
-
-	return nil
+	if len(spResp.GetValue()) == 0 {
+		return nil, nil
+	}
+	return spResp.GetValue()[0], nil
 }
 
-func (h *IdentityHelper) getClaimsMappingPolicy(ctx context.Context, client *msgraphsdk.GraphServiceClient) (string, error) {
+func (h *IdentityHelper) addAppRoleAssignment(ctx context.Context, client *msgraphsdk.GraphServiceClient, registration *appRegistration) error {
 	log := log.FromContext(ctx)
 
-	filterQuery := fmt.Sprintf("displayName eq '%s'", aegisClaimsMappingPolicyName)
-	queryParameters := &policies.ClaimsMappingPoliciesRequestBuilderGetQueryParameters{
-		Filter: &filterQuery,
+	// check if the app role assignment already exists
+
+	rolesAssigned, err := client.ServicePrincipals().ByServicePrincipalId(registration.servicePrincipalID).AppRoleAssignedTo().Get(ctx, nil)
+	if err != nil {
+		log.Error(err, "Failed to get app role assignments")
+		return err
 	}
-	requestOptions := &policies.ClaimsMappingPoliciesRequestBuilderGetRequestConfiguration{
-		QueryParameters: queryParameters,
+	// the role is also assigned to the callers granted access by the ingress policies
+	for _, assignment := range rolesAssigned.GetValue() {
+		if assignment.GetPrincipalId() != nil && assignment.GetPrincipalId().String() == registration.servicePrincipalID {
+			log.Info("App role assignment already exists")
+			registration.roleID = assignment.GetAppRoleId()
+			return nil
+		}
+	}
+	if registration.roleID == nil {
+		return fmt.Errorf("application %s has no app role %s", registration.objectID, registration.subject)
 	}
 
-	cresp, err := client.Policies().ClaimsMappingPolicies().Get(ctx, requestOptions)
+	servicePrincipalIDUUID, err := uuid.Parse(registration.servicePrincipalID)
 	if err != nil {
-		log.Error(err, "Failed to get claims mapping policy")
-		return "", err
+		return fmt.Errorf("invalid service principal id %s: %w", registration.servicePrincipalID, err)
 	}
+	appRoleAssignment := models.NewAppRoleAssignment()
+	appRoleAssignment.SetPrincipalId(&servicePrincipalIDUUID)
+	appRoleAssignment.SetResourceId(&servicePrincipalIDUUID)
+	appRoleAssignment.SetAppRoleId(registration.roleID)
 
-	if len(cresp.GetValue()) == 0 {
-		log.Info("Claims mapping policy not found", "desiredPolicyName", aegisClaimsMappingPolicyName)
-		return "", fmt.Errorf("claims mapping policy not found: %s", aegisClaimsMappingPolicyName)
+	_, err = client.ServicePrincipals().ByServicePrincipalId(registration.servicePrincipalID).AppRoleAssignments().Post(ctx, appRoleAssignment, nil)
+	if err != nil {
+		log.Error(err, "Failed to create app role assignment")
+		return err
 	}
 
-	log.Info("Found claims mapping policy", "policy", cresp.GetValue()[0])
-	return *cresp.GetValue()[0].GetId(), nil
+	return nil
 }
 
 func (h *IdentityHelper) createFederatedIdentityCredential(ctx context.Context,
 	client *msgraphsdk.GraphServiceClient,
+	registration *appRegistration,
 	name string,
-	issuer string) error {
+	issuer string,
+	audiences []string) error {
 
 	log := log.FromContext(ctx)
 	// Check if the federated identity credential already exists
 	existingFICs, err := client.Applications().
-		ByApplicationId(h.objectID).
+		ByApplicationId(registration.objectID).
 		FederatedIdentityCredentials().
 		Get(ctx, nil)
 	if err != nil {
@@ -364,10 +463,28 @@ func (h *IdentityHelper) createFederatedIdentityCredential(ctx context.Context,
 
 	// Check if a FIC with matching name already exists
 	for _, fic := range existingFICs.GetValue() {
-		if *fic.GetName() == name {
+		if *fic.GetName() != name {
+			continue
+		}
+		if ficMatches(fic, issuer, registration.subject, audiences) {
 			log.Info("FederatedIdentityCredential already exists", "name", name)
 			return nil
 		}
+
+		log.Info("Updating drifted FederatedIdentityCredential", "name", name)
+		patch := models.NewFederatedIdentityCredential()
+		patch.SetIssuer(&issuer)
+		patch.SetSubject(&registration.subject)
+		patch.SetAudiences(audiences)
+		_, err = client.
+			Applications().ByApplicationId(registration.objectID).
+			FederatedIdentityCredentials().ByFederatedIdentityCredentialId(*fic.GetId()).
+			Patch(ctx, patch, nil)
+		if err != nil {
+			log.Error(err, "Failed to update FederatedIdentityCredential")
+			return err
+		}
+		return nil
 	}
 
 	log.Info("Creating new FederatedIdentityCredential", "name", name)
@@ -375,13 +492,13 @@ func (h *IdentityHelper) createFederatedIdentityCredential(ctx context.Context,
 	federatedIdentity := models.NewFederatedIdentityCredential()
 	federatedIdentity.SetName(&name)
 	federatedIdentity.SetIssuer(&issuer)
-	federatedIdentity.SetSubject(&h.subject)
-	federatedIdentity.SetAudiences([]string{"api://AzureADTokenExchange"})
+	federatedIdentity.SetSubject(&registration.subject)
+	federatedIdentity.SetAudiences(audiences)
 
 	fiRequestBody := federatedIdentity
 
 	_, err = client.
-		Applications().ByApplicationId(h.objectID).
+		Applications().ByApplicationId(registration.objectID).
 		FederatedIdentityCredentials().
 		Post(ctx, fiRequestBody, nil)
 	if err != nil {
@@ -391,130 +508,224 @@ func (h *IdentityHelper) createFederatedIdentityCredential(ctx context.Context,
 	return nil
 }
 
-func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (bool, error) {
-	return false, fmt.Errorf("not implemented")
-}
-
-func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) error {
+// GetIdentity checks that the app registration, the service principal and the
+// federated identity credential of the identity exist on Entra ID and match
+// the identity spec, and that the claims mapping policy is assigned when enabled.
+func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (_ bool, err error) {
+	defer h.invalidateOnAuthFailure(&err)
 	log := log.FromContext(ctx)
 
 	client, err := h.getGraphClient(ctx)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// Find the application by name
-	log.Info("Finding application to delete")
-
-	appName := fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name)
-
-	filterQuery := fmt.Sprintf("displayName eq '%s'", appName)
-	queryParameters := &applications.ApplicationsRequestBuilderGetQueryParameters{
-		Filter: &filterQuery,
+	issuer, err := h.GetIssuer(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get issuer")
+		return false, err
 	}
-	requestConfig := &applications.ApplicationsRequestBuilderGetRequestConfiguration{
-		QueryParameters: queryParameters,
+	subject := subjectOf(identity)
+	options, err := idp.GetTokenOptions(h, identity)
+	if err != nil {
+		return false, err
 	}
 
-	apps, err := client.Applications().Get(ctx, requestConfig)
+	// app registration
+	filterQuery := fmt.Sprintf("displayName eq %s", odataString(subject))
+	apps, err := client.Applications().Get(ctx, &applications.ApplicationsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &applications.ApplicationsRequestBuilderGetQueryParameters{
+			Filter: &filterQuery,
+		},
+	})
 	if err != nil {
 		log.Error(err, "Failed to list applications")
-		return err
+		return false, err
 	}
-
-	var applicationID string
-	if len(apps.GetValue()) > 0 {
-		applicationID = *apps.GetValue()[0].GetId()
-	} else {
-		log.Info("Application not found", "name", identity.Name)
-		return fmt.Errorf("application not found: %s", identity.Name)
+	if len(apps.GetValue()) == 0 {
+		log.Info("Application not found", "filter", filterQuery)
+		return false, nil
 	}
+	app := apps.GetValue()[0]
 
-	// Delete the application
-	log.Info("Deleting application", "applicationID", applicationID)
-	err = client.Applications().ByApplicationId(applicationID).Delete(ctx, nil)
+	// service principal
+	filterQuery = fmt.Sprintf("appId eq %s", odataString(*app.GetAppId()))
+	sps, err := client.ServicePrincipals().Get(ctx, &serviceprincipals.ServicePrincipalsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &serviceprincipals.ServicePrincipalsRequestBuilderGetQueryParameters{
+			Filter: &filterQuery,
+		},
+	})
 	if err != nil {
-		log.Error(err, "Failed to delete application", "applicationID", applicationID)
-		return err
+		log.Error(err, "Failed to get service principal")
+		return false, err
+	}
+	if len(sps.GetValue()) == 0 {
+		log.Info("Service principal not found", "filter", filterQuery)
+		return false, nil
 	}
 
-	log.Info("Application deleted successfully", "applicationID", applicationID)
-	return nil
-}
+	// claims mapping policy
+	if h.claimsMapping != nil {
+		assigned, err := h.hasClaimsMappingPolicy(ctx, client, *sps.GetValue()[0].GetId())
+		if err != nil {
+			return false, err
+		}
+		if !assigned {
+			log.Info("Claims mapping policy not assigned", "policy", h.claimsMapping.policyName)
+			return false, nil
+		}
+	}
 
-func (h *IdentityHelper) GetToken(ctx context.Context) (string, error) {
-	token, err := os.ReadFile(K8STokenPath)
+	// federated identity credential
+	fics, err := client.Applications().ByApplicationId(*app.GetId()).FederatedIdentityCredentials().Get(ctx, nil)
 	if err != nil {
-		return "", err
+		log.Error(err, "Failed to list FederatedIdentityCredentials")
+		return false, err
 	}
-	return string(token), nil
+	for _, fic := range fics.GetValue() {
+		if fic.GetName() == nil || *fic.GetName() != identity.Name {
+			continue
+		}
+		if !ficMatches(fic, issuer, subject, options.Audiences) {
+			log.Info("FederatedIdentityCredential does not match", "name", identity.Name)
+			return false, nil
+		}
+		return true, nil
+	}
+	log.Info("FederatedIdentityCredential not found", "name", identity.Name)
+	return false, nil
 }
 
-func (h *IdentityHelper) GetIssuer(ctx context.Context) (string, error) {
-	token, err := os.ReadFile(K8STokenPath)
-	if err != nil {
-		return "", err
+// ficMatches reports whether the federated identity credential trusts the given issuer, subject and audiences
+func ficMatches(fic models.FederatedIdentityCredentialable, issuer, subject string, audiences []string) bool {
+	if fic.GetIssuer() == nil || *fic.GetIssuer() != issuer || fic.GetSubject() == nil || *fic.GetSubject() != subject {
+		return false
+	}
+	if len(fic.GetAudiences()) != len(audiences) {
+		return false
 	}
-	parts := strings.Split(string(token), ".")
-	if len(parts) < 2 {
-		return "", fmt.Errorf("invalid token")
+	for i, audience := range audiences {
+		if fic.GetAudiences()[i] != audience {
+			return false
+		}
 	}
+	return true
+}
+
+// DeleteIdentity deletes the service principal and the application of the
+// identity, and purges them from the deleted items of the directory when the
+// provider requires a permanent deletion. Objects already deleted are skipped,
+// so that a deletion interrupted midway can be retried.
+func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) (err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
 
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	client, err := h.getGraphClient(ctx)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	var claims map[string]interface{}
-	if err := json.Unmarshal(payload, &claims); err != nil {
-		return "", err
+	// Find the application by name
+	log.Info("Finding application to delete")
+	registration, err := h.findAppRegistration(ctx, client, subjectOf(identity))
+	if err != nil {
+		return err
+	}
+	if registration == nil {
+		log.Info("Application already deleted", "name", identity.Name)
+		// a previous deletion may have failed before purging the application
+		if objectID := identity.Status.Metadata[StatusMetaAegisIdentityObjectID]; objectID != "" && h.permanentDeletion {
+			return h.purgeDeletedItem(ctx, client, objectID)
+		}
+		return nil
 	}
 
-	issuer, ok := claims["iss"].(string)
-	if !ok {
-		return "", fmt.Errorf("issuer not found in token")
+	if registration.servicePrincipalID != "" {
+		log.Info("Deleting service principal", "servicePrincipalID", registration.servicePrincipalID)
+		err = client.ServicePrincipals().ByServicePrincipalId(registration.servicePrincipalID).Delete(ctx, nil)
+		if err != nil && !isNotFound(err) {
+			log.Error(err, "Failed to delete service principal", "servicePrincipalID", registration.servicePrincipalID)
+			return err
+		}
+		if h.permanentDeletion {
+			if err := h.purgeDeletedItem(ctx, client, registration.servicePrincipalID); err != nil {
+				return err
+			}
+		}
 	}
 
-	return issuer, nil
+	// Delete the application
+	log.Info("Deleting application", "applicationID", registration.objectID)
+	err = client.Applications().ByApplicationId(registration.objectID).Delete(ctx, nil)
+	if err != nil && !isNotFound(err) {
+		log.Error(err, "Failed to delete application", "applicationID", registration.objectID)
+		return err
+	}
+	if h.permanentDeletion {
+		if err := h.purgeDeletedItem(ctx, client, registration.objectID); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Application deleted successfully", "applicationID", registration.objectID)
+	return nil
 }
 
-// New method to create the extension property
-func (h *IdentityHelper) createExtensionProperty(ctx context.Context, client *msgraphsdk.GraphServiceClient, exName string, extensionPropName string) error {
+// purgeDeletedItem permanently deletes the object id from the deleted items of the directory
+func (h *IdentityHelper) purgeDeletedItem(ctx context.Context, client *msgraphsdk.GraphServiceClient, id string) error {
 	log := log.FromContext(ctx)
 
-	// Check if the extension already exists
-	log.Info("Checking if directory extension already exists", "extension", extensionPropName, "objectID", h.objectID)
-	extensionExists := false
-	extensions, err := client.Applications().ByApplicationId(h.objectID).ExtensionProperties().Get(ctx, nil)
-	if err != nil {
-		log.Error(err, "Failed to get directory extension")
+	log.Info("Permanently deleting directory object", "id", id)
+	err := client.Directory().DeletedItems().ByDirectoryObjectId(id).Delete(ctx, nil)
+	if err != nil && !isNotFound(err) {
+		log.Error(err, "Failed to permanently delete directory object", "id", id)
 		return err
 	}
-	log.Info("extensions list", "extensions", extensions)
-	for _, ext := range extensions.GetValue() {
-		log.Info("extension", "name", *ext.GetName())
-		if *ext.GetName() == extensionPropName {
-			log.Info("Directory extension already exists", "extension", extensionPropName)
-			extensionExists = true
-			break
-		}
+	return nil
+}
+
+// odataString returns s as an OData string literal, its single quotes escaped
+func odataString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// isNotFound reports whether err is a Not Found error of Microsoft Graph
+func isNotFound(err error) bool {
+	var apiErr interface{ GetStatusCode() int }
+	return errors.As(err, &apiErr) && apiErr.GetStatusCode() == http.StatusNotFound
+}
+
+// isAuthFailure reports whether Entra ID refused the credential of the
+// operator or Microsoft Graph rejected its token
+func isAuthFailure(err error) bool {
+	var authErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authErr) {
+		return true
 	}
-	if !extensionExists {
-		log.Info("Creating directory extension", "extension", exName)
-		dataType := "String"
-		extension := models.NewExtensionProperty()
-		extension.SetName(&exName)
-		extension.SetDataType(&dataType)
-		extension.SetTargetObjects([]string{"Application", "User"})
-		isMultiValued := false
-		extension.SetIsMultiValued(&isMultiValued)
-		exresp, err := client.Applications().ByApplicationId(h.objectID).ExtensionProperties().Post(ctx, extension, nil)
-		if err != nil {
-			log.Error(err, "Failed to create directory extension", "exresp", exresp)
-			return err
-		}
-		log.Info("Directory extension created", "exresp", exresp)
+	var apiErr interface{ GetStatusCode() int }
+	return errors.As(err, &apiErr) && (apiErr.GetStatusCode() == http.StatusUnauthorized || apiErr.GetStatusCode() == http.StatusForbidden)
+}
+
+// invalidateOnAuthFailure drops the cached Graph client of the provider when
+// its credential was refused (e.g. a client secret revoked before a rotation),
+// so that the next call builds it again
+func (h *IdentityHelper) invalidateOnAuthFailure(err *error) {
+	if isAuthFailure(*err) {
+		idp.Clients.Invalidate(h.clientKey.UID)
 	}
+}
 
-	return nil
+// GetToken returns the client assertion of the operator: a token of the
+// service account of the credentials, or the token mounted into the operator
+// when no service account is configured
+func (h *IdentityHelper) GetToken(ctx context.Context) (string, error) {
+	if h.credentials != nil && h.credentials.Token != nil {
+		return h.credentials.Token(ctx)
+	}
+	return idp.FileToken(K8STokenPath)(ctx)
+}
+
+// GetIssuer returns the issuer of the service account tokens of the cluster
+func (h *IdentityHelper) GetIssuer(ctx context.Context) (string, error) {
+	return h.issuer(ctx)
 }
@@ -0,0 +1,196 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+func newIdentity(namespace, name string) *aegisv1.Identity {
+	return &aegisv1.Identity{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       aegisv1.IdentitySpec{Audiences: []string{Audience}},
+	}
+}
+
+func TestIdentityLifecycle(t *testing.T) {
+	ctx := context.Background()
+	graph := newFakeGraph(t)
+	h := graph.newHelper()
+	identity := newIdentity("default", "app")
+
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || exists {
+		t.Fatalf("GetIdentity() = %v, %v before CreateIdentity", exists, err)
+	}
+
+	metadata, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, ok := graph.application("system:serviceaccount:default:app")
+	if !ok {
+		t.Fatalf("application not created")
+	}
+	if metadata[StatusMetaAegisIdentityObjectID] != app.ID || metadata[StatusMetaAegisIdentityID] != app.AppID || metadata[StatusMetaAegisAzureTenantID] != "tenant" {
+		t.Errorf("CreateIdentity() = %v, want the ids of application %+v", metadata, app)
+	}
+	if len(app.FICs) != 1 || app.FICs[0].Issuer != testIssuer || app.FICs[0].Subject != app.DisplayName {
+		t.Errorf("federated identity credentials = %+v", app.FICs)
+	}
+	if h.clientID != "operator-client-id" {
+		t.Errorf("CreateIdentity() changed the client id of the operator to %s", h.clientID)
+	}
+	identity.Status.Metadata = metadata
+
+	// reconciling again reuses the application, its service principal and its role assignment
+	again, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[StatusMetaAegisIdentityID] != app.AppID {
+		t.Errorf("CreateIdentity() = %v, want application %s", again, app.AppID)
+	}
+	if apps, sps, assignments := graph.counts(); apps != 1 || sps != 1 || assignments != 1 {
+		t.Errorf("%d applications, %d service principals, %d role assignments, want 1 each", apps, sps, assignments)
+	}
+
+	// a changed audience is patched
+	identity.Spec.Audiences = []string{"api://custom"}
+	if _, err := h.CreateIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+	if app, _ := graph.application(app.DisplayName); len(app.FICs) != 1 || app.FICs[0].Audiences[0] != "api://custom" {
+		t.Errorf("federated identity credentials = %+v, want the new audience", app.FICs)
+	}
+
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || !exists {
+		t.Fatalf("GetIdentity() = %v, %v after CreateIdentity", exists, err)
+	}
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := h.GetIdentity(ctx, identity); err != nil || exists {
+		t.Fatalf("GetIdentity() = %v, %v after DeleteIdentity", exists, err)
+	}
+}
+
+// TestConcurrentIdentities reconciles identities concurrently with a single
+// cached helper and Graph client. Run it with -race.
+func TestConcurrentIdentities(t *testing.T) {
+	ctx := context.Background()
+	graph := newFakeGraph(t)
+	h := graph.newHelper()
+	h.clientKey = idp.ClientKey{UID: "azure-concurrent", Generation: 1}
+	defer idp.Clients.Invalidate(h.clientKey.UID)
+
+	const count = 10
+	identities := make([]*aegisv1.Identity, count)
+	for i := range identities {
+		identities[i] = newIdentity("default", fmt.Sprintf("app-%d", i))
+	}
+
+	var wg sync.WaitGroup
+	for _, identity := range identities {
+		wg.Add(1)
+		go func(identity *aegisv1.Identity) {
+			defer wg.Done()
+			metadata, err := h.CreateIdentity(ctx, identity)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			app, ok := graph.application(subjectOf(identity))
+			if !ok || metadata[StatusMetaAegisIdentityObjectID] != app.ID || metadata[StatusMetaAegisIdentityID] != app.AppID {
+				t.Errorf("CreateIdentity(%s) = %v, want the ids of application %+v", identity.Name, metadata, app)
+			}
+			if exists, err := h.GetIdentity(ctx, identity); err != nil || !exists {
+				t.Errorf("GetIdentity(%s) = %v, %v", identity.Name, exists, err)
+			}
+		}(identity)
+	}
+	wg.Wait()
+	if apps, sps, assignments := graph.counts(); apps != count || sps != count || assignments != count {
+		t.Errorf("%d applications, %d service principals, %d role assignments, want %d each", apps, sps, assignments, count)
+	}
+
+	for _, identity := range identities {
+		wg.Add(1)
+		go func(identity *aegisv1.Identity) {
+			defer wg.Done()
+			if err := h.DeleteIdentity(ctx, identity); err != nil {
+				t.Error(err)
+			}
+		}(identity)
+	}
+	wg.Wait()
+	if apps, _, _ := graph.counts(); apps != 0 {
+		t.Errorf("%d applications left after DeleteIdentity", apps)
+	}
+}
+
+func TestDeleteIdentity(t *testing.T) {
+	ctx := context.Background()
+	graph := newFakeGraph(t)
+	h := graph.newHelper()
+	identity := newIdentity("default", "app")
+
+	// an identity never created or already deleted is deleted
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatalf("DeleteIdentity() = %v for a missing application", err)
+	}
+
+	metadata, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity.Status.Metadata = metadata
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+	if apps, sps, assignments := graph.counts(); apps != 0 || sps != 0 || assignments != 0 {
+		t.Errorf("%d applications, %d service principals, %d role assignments left after DeleteIdentity", apps, sps, assignments)
+	}
+	graph.mu.Lock()
+	deleted := len(graph.deletedItems)
+	graph.mu.Unlock()
+	if deleted != 2 {
+		t.Errorf("%d deleted items, want the application and its service principal", deleted)
+	}
+
+	// the permanent deletion purges the deleted items, also when retried
+	h.permanentDeletion = true
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+	graph.mu.Lock()
+	_, purged := graph.deletedItems[metadata[StatusMetaAegisIdentityObjectID]]
+	graph.mu.Unlock()
+	if purged {
+		t.Errorf("application %s not purged on retry", metadata[StatusMetaAegisIdentityObjectID])
+	}
+
+	// a deletion interrupted after the service principal is completed
+	metadata, err = h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity.Status.Metadata = metadata
+	sp, _ := graph.servicePrincipal(subjectOf(identity))
+	graph.mu.Lock()
+	graph.deleteServicePrincipal(sp.ID)
+	graph.mu.Unlock()
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatal(err)
+	}
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+	if len(graph.applications) != 0 || len(graph.deletedItems) != 2 {
+		t.Errorf("%d applications and deleted items %v left, want the service principals deleted before the permanent deletion", len(graph.applications), graph.deletedItems)
+	}
+}
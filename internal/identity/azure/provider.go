@@ -0,0 +1,41 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	identity.Register(identity.Provider{
+		Kind:             "AzureProvider",
+		ClusterKind:      "ClusterAzureProvider",
+		Name:             ProviderName,
+		Precedence:       20,
+		NewObject:        func() client.Object { return &aegisv1.AzureProvider{} },
+		NewClusterObject: func() client.Object { return &aegisv1.ClusterAzureProvider{} },
+		New: func(ctx context.Context, c client.Client, obj client.Object) (identity.IdentityHelper, error) {
+			var spec aegisv1.AzureProviderSpec
+			switch provider := obj.(type) {
+			case *aegisv1.AzureProvider:
+				spec = provider.Spec
+			case *aegisv1.ClusterAzureProvider:
+				spec = provider.Spec.AzureProviderSpec
+			default:
+				return nil, fmt.Errorf("expected an AzureProvider, got %T", obj)
+			}
+			credentials, err := identity.ReadCredentials(ctx, c, spec.CredentialsRef, obj.GetNamespace(), Audience)
+			if err != nil {
+				return nil, err
+			}
+			h := New(spec.TenantID, spec.ClientID, credentials)
+			h.clientKey = identity.ClientKeyFor(obj, credentials)
+			h.claimsMapping = newClaimsMapping(spec.ClaimsMapping)
+			h.permanentDeletion = spec.PermanentDeletion
+			return h, nil
+		},
+	})
+}
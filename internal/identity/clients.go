@@ -0,0 +1,191 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultClientMaxAge is the lifetime of the cached clients whose credentials
+// do not expire, so that they are eventually rebuilt (e.g. after a secret
+// referenced by the provider is rotated in place)
+const DefaultClientMaxAge = 15 * time.Minute
+
+// clientRefreshRatio is the fraction of the client lifetime left when a cached client is renewed
+const clientRefreshRatio = 5
+
+// ClientKey identifies the clients built from a provider object. A change of
+// the spec of the provider (its generation) or of the secret of its
+// credentials invalidates them.
+type ClientKey struct {
+	UID        types.UID
+	Generation int64
+	// Credentials is a digest of the secret of the credentials
+	Credentials string
+}
+
+// ClientKeyFor returns the key of the clients built from the provider obj
+// with credentials, which can be nil
+func ClientKeyFor(obj client.Object, credentials *Credentials) ClientKey {
+	key := ClientKey{UID: obj.GetUID(), Generation: obj.GetGeneration()}
+	if credentials != nil && credentials.Secret != nil {
+		names := make([]string, 0, len(credentials.Secret))
+		for name := range credentials.Secret {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		digest := sha256.New()
+		for _, name := range names {
+			digest.Write([]byte(name))
+			digest.Write([]byte{0})
+			digest.Write(credentials.Secret[name])
+			digest.Write([]byte{0})
+		}
+		key.Credentials = hex.EncodeToString(digest.Sum(nil))
+	}
+	return key
+}
+
+// ClientCache caches the authenticated clients of the providers (e.g. a Vault
+// client logged in with the operator role), so that the identities of a
+// provider do not log in on every reconciliation. It is safe for concurrent
+// use; the clients of a key are built once even when requested concurrently.
+type ClientCache struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[types.UID]map[string]*cachedClient
+}
+
+type cachedClient struct {
+	mu      sync.Mutex
+	key     ClientKey
+	client  interface{}
+	created time.Time
+	expires time.Time
+}
+
+// NewClientCache returns a ClientCache keeping the clients whose credentials
+// do not expire for maxAge
+func NewClientCache(maxAge time.Duration) *ClientCache {
+	return &ClientCache{
+		maxAge:  maxAge,
+		now:     time.Now,
+		entries: map[types.UID]map[string]*cachedClient{},
+	}
+}
+
+// Clients is the client cache shared by the controllers and the webhook
+var Clients = NewClientCache(DefaultClientMaxAge)
+
+// BuildClientFunc builds a client and returns the expiry of its credentials,
+// the zero time when they do not expire
+type BuildClientFunc func(ctx context.Context) (interface{}, time.Time, error)
+
+// Get returns the client name of the provider identified by key, built with
+// build when none is cached, the cached one was built for another generation
+// or credentials of the provider, or it expires in less than a fifth of its
+// lifetime. Clients of objects without UID are not cached.
+func (c *ClientCache) Get(ctx context.Context, key ClientKey, name string, build BuildClientFunc) (interface{}, error) {
+	if key.UID == "" {
+		client, _, err := build(ctx)
+		return client, err
+	}
+
+	entry := c.entry(key, name)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	now := c.now()
+	if entry.client != nil && entry.key == key && entry.expires.Sub(now) > entry.expires.Sub(entry.created)/clientRefreshRatio {
+		return entry.client, nil
+	}
+
+	client, expires, err := build(ctx)
+	if err != nil {
+		if entry.client == nil {
+			c.drop(key.UID, name, entry)
+		}
+		return nil, err
+	}
+	if expires.IsZero() || expires.Sub(now) > c.maxAge {
+		expires = now.Add(c.maxAge)
+	}
+	entry.key, entry.client, entry.created, entry.expires = key, client, now, expires
+	return client, nil
+}
+
+// entry returns the entry of the client name of the provider, dropping the
+// clients of the other generations of the provider and the expired clients
+func (c *ClientCache) entry(key ClientKey, name string) *cachedClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for uid, clients := range c.entries {
+		for clientName, entry := range clients {
+			if entry.mu.TryLock() {
+				stale := entry.client != nil && (!now.Before(entry.expires) || (uid == key.UID && entry.key != key))
+				entry.mu.Unlock()
+				if stale {
+					delete(clients, clientName)
+				}
+			}
+		}
+		if len(clients) == 0 {
+			delete(c.entries, uid)
+		}
+	}
+
+	clients, ok := c.entries[key.UID]
+	if !ok {
+		clients = map[string]*cachedClient{}
+		c.entries[key.UID] = clients
+	}
+	entry, ok := clients[name]
+	if !ok {
+		entry = &cachedClient{key: key}
+		clients[name] = entry
+	}
+	return entry
+}
+
+// drop removes the entry of the client name of the provider uid
+func (c *ClientCache) drop(uid types.UID, name string, entry *cachedClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if clients, ok := c.entries[uid]; ok && clients[name] == entry {
+		delete(clients, name)
+		if len(clients) == 0 {
+			delete(c.entries, uid)
+		}
+	}
+}
+
+// Invalidate drops the cached clients of the provider uid, e.g. after its
+// credentials were rejected
+func (c *ClientCache) Invalidate(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, uid)
+}
+
+// CachedClient returns the client name of the provider identified by key from
+// the shared cache, built with build when needed
+func CachedClient[T any](ctx context.Context, key ClientKey, name string, build func(ctx context.Context) (T, time.Time, error)) (T, error) {
+	client, err := Clients.Get(ctx, key, name, func(ctx context.Context) (interface{}, time.Time, error) {
+		return build(ctx)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return client.(T), nil
+}
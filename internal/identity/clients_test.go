@@ -0,0 +1,111 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+func TestClientCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewClientCache(DefaultClientMaxAge)
+	cache.now = func() time.Time { return now }
+
+	builds := 0
+	tokenTTL := time.Hour
+	build := func(ctx context.Context) (interface{}, time.Time, error) {
+		builds++
+		return fmt.Sprintf("client-%d", builds), now.Add(tokenTTL), nil
+	}
+	get := func(key ClientKey) string {
+		t.Helper()
+		client, err := cache.Get(ctx, key, "vault", build)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client.(string)
+	}
+
+	provider := &aegisv1.HashicorpVaultProvider{}
+	provider.UID, provider.Generation = types.UID("uid-1"), 1
+	key := ClientKeyFor(provider, nil)
+
+	if got := get(key); got != "client-1" {
+		t.Fatalf("Get() = %s", got)
+	}
+	// the lifetime of the clients is bounded by the max age
+	now = now.Add(DefaultClientMaxAge - DefaultClientMaxAge/clientRefreshRatio - time.Second)
+	if got := get(key); got != "client-1" {
+		t.Errorf("Get() = %s, want the cached client", got)
+	}
+	now = now.Add(2 * time.Second)
+	if got := get(key); got != "client-2" {
+		t.Errorf("Get() = %s, want a client renewed before the max age", got)
+	}
+
+	// a spec change invalidates the clients
+	provider.Generation = 2
+	if got := get(ClientKeyFor(provider, nil)); got != "client-3" {
+		t.Errorf("Get() = %s, want a client of the new generation", got)
+	}
+	// as does the rotation of the secret of the credentials
+	rotated := ClientKeyFor(provider, &Credentials{Secret: map[string][]byte{"secretID": []byte("rotated")}})
+	if got := get(rotated); got != "client-4" {
+		t.Errorf("Get() = %s, want a client of the rotated credentials", got)
+	}
+	if got := get(rotated); got != "client-4" {
+		t.Errorf("Get() = %s, want the cached client", got)
+	}
+
+	// clients expiring before the max age are renewed when a fifth of their lifetime is left
+	tokenTTL = 5 * time.Minute
+	cache.Invalidate(provider.UID)
+	if got := get(rotated); got != "client-5" {
+		t.Errorf("Get() = %s, want a client after Invalidate", got)
+	}
+	now = now.Add(tokenTTL - tokenTTL/clientRefreshRatio + time.Second)
+	if got := get(rotated); got != "client-6" {
+		t.Errorf("Get() = %s, want a client renewed before its token expires", got)
+	}
+
+	// objects without UID are not cached
+	if get(ClientKey{}) == get(ClientKey{}) {
+		t.Errorf("Get() cached the client of an object without UID")
+	}
+}
+
+func TestClientCacheBuildsOnce(t *testing.T) {
+	key := ClientKey{UID: "uid-1", Generation: 1}
+	defer Clients.Invalidate(key.UID)
+
+	var builds atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := CachedClient(context.Background(), key, "graph", func(ctx context.Context) (*int, time.Time, error) {
+				builds.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				client := 0
+				return &client, time.Time{}, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if builds.Load() != 1 {
+		t.Errorf("%d clients built, want 1", builds.Load())
+	}
+}
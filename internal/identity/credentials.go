@@ -0,0 +1,97 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity/k8stoken"
+)
+
+// Keys of the secrets referenced by the credentialsRef of the providers
+const (
+	CredentialClientSecret    = "clientSecret"
+	CredentialRoleID          = "roleID"
+	CredentialSecretID        = "secretID"
+	CredentialAccessKeyID     = "accessKeyID"
+	CredentialSecretAccessKey = "secretAccessKey"
+	CredentialSessionToken    = "sessionToken"
+)
+
+// TokenFunc returns a Kubernetes token the operator authenticates to an IdP with
+type TokenFunc func(ctx context.Context) (string, error)
+
+// FileToken returns a TokenFunc reading the token mounted at path
+func FileToken(path string) TokenFunc {
+	return func(ctx context.Context) (string, error) {
+		token, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+}
+
+// Credentials are the credentials of the operator read from a credentialsRef.
+// Exactly one of Secret and Token is set.
+type Credentials struct {
+	// Secret is the data of the referenced secret
+	Secret map[string][]byte
+	// Token issues tokens of the referenced service account
+	Token TokenFunc
+}
+
+// SecretValue returns the value of key in the referenced secret
+func (c *Credentials) SecretValue(key string) (string, error) {
+	if c.Secret == nil {
+		return "", fmt.Errorf("credentials are not a secret")
+	}
+	value, ok := c.Secret[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in the credentials secret", key)
+	}
+	return string(value), nil
+}
+
+// ReadCredentials reads the credentials referenced by ref. namespace is the
+// namespace of the provider, empty for the cluster scoped ones; only the latter
+// can reference the secrets and service accounts of other namespaces. The
+// tokens of a referenced service account are issued for audience when the
+// returned Token is called. When ref is nil, the credentials are the tokens of
+// the operator service account, or nil when it is not configured.
+func ReadCredentials(ctx context.Context, c client.Client, ref *aegisv1.CredentialsRef, namespace, audience string) (*Credentials, error) {
+	if ref == nil {
+		if operator := k8stoken.Operator(); operator != nil {
+			return &Credentials{Token: operator.TokenFunc(audience)}, nil
+		}
+		return nil, nil
+	}
+	name := ref.SecretName
+	if name == "" {
+		name = ref.ServiceAccountName
+	}
+	namespace, err := referencedNamespace("credentials", name, ref.Namespace, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case ref.SecretName != "" && ref.ServiceAccountName != "":
+		return nil, fmt.Errorf("credentials reference both secret %s and service account %s", ref.SecretName, ref.ServiceAccountName)
+	case ref.SecretName != "":
+		secret := &corev1.Secret{}
+		if err := secretReaderFor(c).Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.SecretName}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, ref.SecretName, err)
+		}
+		return &Credentials{Secret: secret.Data}, nil
+	case ref.ServiceAccountName != "":
+		return &Credentials{Token: k8stoken.ForServiceAccount(c, namespace, ref.ServiceAccountName).TokenFunc(audience)}, nil
+	default:
+		return nil, fmt.Errorf("credentials reference neither a secret nor a service account")
+	}
+}
@@ -0,0 +1,91 @@
+package identity
+
+import (
+	"context"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+func TestReadCredentials(t *testing.T) {
+	ctx := context.Background()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault-approle", Namespace: "tenant-a"},
+		Data:       map[string][]byte{CredentialRoleID: []byte("role"), CredentialSecretID: []byte("secret")},
+	}
+	var requested *authenticationv1.TokenRequest
+	c := fake.NewClientBuilder().WithObjects(secret).WithInterceptorFuncs(interceptor.Funcs{
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, subResourceObj client.Object, opts ...client.SubResourceCreateOption) error {
+			if subResource != "token" || obj.GetNamespace() != "tenant-b" || obj.GetName() != "operator" {
+				t.Errorf("unexpected %s request for %s/%s", subResource, obj.GetNamespace(), obj.GetName())
+			}
+			requested = subResourceObj.(*authenticationv1.TokenRequest)
+			requested.Status.Token = "sa-token"
+			return nil
+		},
+	}).Build()
+
+	credentials, err := ReadCredentials(ctx, c, nil, "tenant-a", "vault")
+	if err != nil || credentials != nil {
+		t.Fatalf("ReadCredentials(nil) = %v, %v, want nil", credentials, err)
+	}
+
+	credentials, err = ReadCredentials(ctx, c, &aegisv1.CredentialsRef{SecretName: "vault-approle"}, "tenant-a", "vault")
+	if err != nil {
+		t.Fatalf("ReadCredentials(secret) error = %v", err)
+	}
+	if roleID, err := credentials.SecretValue(CredentialRoleID); err != nil || roleID != "role" {
+		t.Errorf("SecretValue(roleID) = %q, %v", roleID, err)
+	}
+	if _, err := credentials.SecretValue(CredentialClientSecret); err == nil {
+		t.Errorf("SecretValue(clientSecret) succeeded for a missing key")
+	}
+
+	// only cluster scoped providers reference the credentials of other namespaces
+	if _, err := ReadCredentials(ctx, c, &aegisv1.CredentialsRef{ServiceAccountName: "operator", Namespace: "tenant-b"}, "tenant-a", "vault"); err == nil {
+		t.Errorf("ReadCredentials() succeeded for a service account of another namespace")
+	}
+	if _, err := ReadCredentials(ctx, c, &aegisv1.CredentialsRef{SecretName: "vault-approle", Namespace: "tenant-a"}, "tenant-b", "vault"); err == nil {
+		t.Errorf("ReadCredentials() succeeded for a secret of another namespace")
+	}
+	credentials, err = ReadCredentials(ctx, c, &aegisv1.CredentialsRef{ServiceAccountName: "operator", Namespace: "tenant-b"}, "", "vault")
+	if err != nil {
+		t.Fatalf("ReadCredentials(service account) error = %v", err)
+	}
+	token, err := credentials.Token(ctx)
+	if err != nil || token != "sa-token" {
+		t.Fatalf("Token() = %q, %v", token, err)
+	}
+	if len(requested.Spec.Audiences) != 1 || requested.Spec.Audiences[0] != "vault" {
+		t.Errorf("token requested for audiences %v, want [vault]", requested.Spec.Audiences)
+	}
+
+	if _, err := ReadCredentials(ctx, c, &aegisv1.CredentialsRef{SecretName: "vault-approle"}, "", "vault"); err == nil {
+		t.Errorf("ReadCredentials() without namespace succeeded")
+	}
+	if _, err := ReadCredentials(ctx, c, &aegisv1.CredentialsRef{SecretName: "missing"}, "tenant-a", "vault"); err == nil {
+		t.Errorf("ReadCredentials() with a missing secret succeeded")
+	}
+
+	// secrets are read with the secret reader when set
+	reader := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault-approle", Namespace: "tenant-a"},
+		Data:       map[string][]byte{CredentialRoleID: []byte("api-reader")},
+	}).Build()
+	SetSecretReader(reader)
+	defer SetSecretReader(nil)
+	credentials, err = ReadCredentials(ctx, c, &aegisv1.CredentialsRef{SecretName: "vault-approle"}, "tenant-a", "vault")
+	if err != nil {
+		t.Fatalf("ReadCredentials(secret) error = %v", err)
+	}
+	if roleID, _ := credentials.SecretValue(CredentialRoleID); roleID != "api-reader" {
+		t.Errorf("SecretValue(roleID) = %q, want the value of the secret reader", roleID)
+	}
+}
@@ -0,0 +1,190 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+const (
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	tokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Endpoints are the base URLs of the Google REST APIs used by the helper
+type Endpoints struct {
+	IAM            string
+	STS            string
+	IAMCredentials string
+}
+
+// DefaultEndpoints are the public Google API endpoints
+var DefaultEndpoints = Endpoints{
+	IAM:            "https://iam.googleapis.com",
+	STS:            "https://sts.googleapis.com",
+	IAMCredentials: "https://iamcredentials.googleapis.com",
+}
+
+// apiError is an error answer of a Google API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("google api error %d: %s", e.StatusCode, e.Message)
+}
+
+// isNotFound reports whether err is a 404 answer of a Google API
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// restClient calls the Google REST APIs with the access token of the operator
+type restClient struct {
+	http        *http.Client
+	accessToken string
+}
+
+// do sends in as the JSON body of the request and decodes the answer into out.
+// in and out can be nil.
+func (c *restClient) do(ctx context.Context, method, url string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &apiError{StatusCode: resp.StatusCode, Message: errorMessage(data)}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// errorMessage extracts the message of a Google API or OAuth error body
+func errorMessage(data []byte) string {
+	var body struct {
+		Error json.RawMessage `json:"error"`
+		// OAuth errors of the STS API
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return strings.TrimSpace(string(data))
+	}
+	if body.ErrorDescription != "" {
+		return body.ErrorDescription
+	}
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body.Error, &apiErr); err == nil && apiErr.Message != "" {
+		return apiErr.Message
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// getClient returns a client authenticated as the operator, shared by the
+// identities of the provider until its access token is close to expiry
+func (h *IdentityHelper) getClient(ctx context.Context) (*restClient, error) {
+	return idp.CachedClient(ctx, h.clientKey, "gcp", h.newClient)
+}
+
+// newClient returns a client authenticated as the operator together with the
+// expiry of its access token. The service account token of the operator is
+// exchanged on STS for a federated token, which is then used to impersonate
+// the operator service account, if set.
+func (h *IdentityHelper) newClient(ctx context.Context) (*restClient, time.Time, error) {
+	token, err := h.config.Token(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	client := &restClient{http: h.config.HTTPClient}
+	exchange := map[string]string{
+		"grantType":          grantTypeTokenExchange,
+		"audience":           h.operatorAudience(),
+		"scope":              cloudPlatformScope,
+		"requestedTokenType": tokenTypeAccessToken,
+		"subjectToken":       token,
+		"subjectTokenType":   tokenTypeJWT,
+	}
+	var federated struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := client.do(ctx, http.MethodPost, h.config.Endpoints.STS+"/v1/token", exchange, &federated); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to exchange the operator token: %w", err)
+	}
+	client.accessToken = federated.AccessToken
+	var expires time.Time
+	if federated.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(federated.ExpiresIn) * time.Second)
+	}
+
+	if h.config.OperatorServiceAccount == "" {
+		return client, expires, nil
+	}
+	url := fmt.Sprintf("%s/v1/projects/-/serviceAccounts/%s:generateAccessToken", h.config.Endpoints.IAMCredentials, h.config.OperatorServiceAccount)
+	var impersonated struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := client.do(ctx, http.MethodPost, url, map[string][]string{"scope": {cloudPlatformScope}}, &impersonated); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to impersonate %s: %w", h.config.OperatorServiceAccount, err)
+	}
+	client.accessToken = impersonated.AccessToken
+	return client, impersonated.ExpireTime, nil
+}
+
+// isAuthFailure reports whether a Google API rejected the access token of the client
+func isAuthFailure(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
+
+// invalidateOnAuthFailure drops the cached client of the provider when a
+// Google API rejected its access token, so that the next call exchanges the
+// operator token again
+func (h *IdentityHelper) invalidateOnAuthFailure(err *error) {
+	if isAuthFailure(*err) {
+		idp.Clients.Invalidate(h.clientKey.UID)
+	}
+}
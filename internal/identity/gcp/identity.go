@@ -0,0 +1,544 @@
+package gcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"github.com/vmarchese/aegis-operator/internal/identity/k8stoken"
+	"github.com/vmarchese/aegis-operator/internal/logging"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	ProviderName = "gcp"
+	K8STokenPath = "/var/run/secrets/tokens/gcp_token"
+	// OperatorTokenAudience is the audience of the service account token of the operator
+	OperatorTokenAudience = "gcp"
+
+	DefaultProviderID = "aegis"
+
+	workloadIdentityUserRole = "roles/iam.workloadIdentityUser"
+	identityMetaID           = "aegis.identity.id"
+
+	stateDeleted = "DELETED"
+)
+
+// Config is the configuration of a GCP provider. Empty fields get the defaults.
+type Config struct {
+	ProjectID     string
+	ProjectNumber string
+	PoolID        string
+	ProviderID    string
+	// AllowedAudiences are the audiences accepted by the workload identity pool provider
+	AllowedAudiences []string
+	// OperatorAudience is the audience the operator exchanges its token with
+	OperatorAudience string
+	// OperatorServiceAccount is the service account impersonated by the operator
+	OperatorServiceAccount string
+	// TokenPath is the path of the service account token of the operator
+	TokenPath string
+	// Token returns the service account token of the operator, TokenPath is read when nil
+	Token idp.TokenFunc
+	// Issuer returns the issuer of the cluster, discovered from the API server when nil
+	Issuer     func(ctx context.Context) (string, error)
+	Endpoints  Endpoints
+	HTTPClient *http.Client
+}
+
+type IdentityHelper struct {
+	config Config
+	// clientKey identifies the cached clients of the provider
+	clientKey idp.ClientKey
+}
+
+func New(config Config) *IdentityHelper {
+	if config.ProviderID == "" {
+		config.ProviderID = DefaultProviderID
+	}
+	if config.TokenPath == "" {
+		config.TokenPath = K8STokenPath
+	}
+	if config.Token == nil {
+		config.Token = idp.FileToken(config.TokenPath)
+	}
+	if config.Issuer == nil {
+		config.Issuer = k8stoken.Issuer
+	}
+	if config.Endpoints.IAM == "" {
+		config.Endpoints.IAM = DefaultEndpoints.IAM
+	}
+	if config.Endpoints.STS == "" {
+		config.Endpoints.STS = DefaultEndpoints.STS
+	}
+	if config.Endpoints.IAMCredentials == "" {
+		config.Endpoints.IAMCredentials = DefaultEndpoints.IAMCredentials
+	}
+	config.HTTPClient = logging.HTTPClient(config.HTTPClient)
+	return &IdentityHelper{config: config}
+}
+
+func (h *IdentityHelper) GetName() string {
+	return ProviderName
+}
+
+// GetAudience returns the first allowed audience of the workload identity pool
+// provider, or its full resource name, which GCP accepts by default.
+func (h *IdentityHelper) GetAudience() string {
+	if audiences := h.allowedAudiences(); len(audiences) > 0 {
+		return audiences[0]
+	}
+	return h.providerAudience()
+}
+
+// allowedAudiences are the audiences accepted by the workload identity pool
+// provider. When the operator exchanges its own token with the same provider,
+// the audience of the operator token is allowed too.
+func (h *IdentityHelper) allowedAudiences() []string {
+	if h.config.OperatorAudience != "" {
+		return h.config.AllowedAudiences
+	}
+	for _, aud := range h.config.AllowedAudiences {
+		if aud == OperatorTokenAudience {
+			return h.config.AllowedAudiences
+		}
+	}
+	return append(append([]string{}, h.config.AllowedAudiences...), OperatorTokenAudience)
+}
+
+// GetTokenBounds limits the identities to one audience, the token STS exchanges
+func (h *IdentityHelper) GetTokenBounds() idp.TokenBounds {
+	return idp.TokenBounds{
+		MinTTL:       idp.MinTokenTTL,
+		MaxAudiences: 1,
+	}
+}
+
+func (h *IdentityHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	args := []string{
+		"--gcp-project-id", h.config.ProjectID,
+		"--gcp-workload-identity-provider", h.providerAudience(),
+	}
+	if identity != nil {
+		email := identity.Status.Metadata[identityMetaID]
+		if email == "" {
+			return nil, fmt.Errorf("service account is not set for identity %s", identity.Name)
+		}
+		args = append(args, "--gcp-service-account", email)
+	}
+	return args, nil
+}
+
+// CreateIdentity federates the cluster issuer with the workload identity pool
+// and creates the service account of the identity, impersonable by the
+// kubernetes service account of the identity.
+func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (_ map[string]string, err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	client, err := h.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := h.GetIssuer(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get issuer")
+		return nil, err
+	}
+
+	if err := h.ensurePool(ctx, client); err != nil {
+		return nil, err
+	}
+	if err := h.ensurePoolProvider(ctx, client, issuer); err != nil {
+		return nil, err
+	}
+
+	sa, err := h.ensureServiceAccount(ctx, client, identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.ensureWorkloadIdentityUser(ctx, client, sa.Email, h.principal(identity)); err != nil {
+		return nil, err
+	}
+	log.Info("Service account federated", "serviceAccount", sa.Email, "principal", h.principal(identity))
+
+	return map[string]string{identityMetaID: sa.Email}, nil
+}
+
+// GetIdentity checks that the pool provider federates the cluster issuer and
+// that the service account of the identity exists, is enabled and can be
+// impersonated by the kubernetes service account of the identity.
+func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (_ bool, err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	email := identity.Status.Metadata[identityMetaID]
+	if email == "" {
+		return false, nil
+	}
+
+	client, err := h.getClient(ctx)
+	if err != nil {
+		return false, err
+	}
+	issuer, err := h.GetIssuer(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get issuer")
+		return false, err
+	}
+
+	provider := &poolProvider{}
+	if err := client.do(ctx, http.MethodGet, h.providerURL(), nil, provider); err != nil {
+		if isNotFound(err) {
+			log.Info("Workload identity pool provider not found", "provider", h.providerAudience())
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get workload identity pool provider: %w", err)
+	}
+	if provider.State == stateDeleted || provider.Disabled || !h.providerMatches(provider, issuer) {
+		log.Info("Workload identity pool provider drifted", "provider", h.providerAudience())
+		return false, nil
+	}
+
+	sa := &serviceAccount{}
+	if err := client.do(ctx, http.MethodGet, h.serviceAccountURL(email), nil, sa); err != nil {
+		if isNotFound(err) {
+			log.Info("Service account not found", "serviceAccount", email)
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get service account %s: %w", email, err)
+	}
+	if sa.Disabled {
+		log.Info("Service account is disabled", "serviceAccount", email)
+		return false, nil
+	}
+
+	policy, err := h.getIamPolicy(ctx, client, email)
+	if err != nil {
+		return false, err
+	}
+	if !policy.hasMember(workloadIdentityUserRole, h.principal(identity)) {
+		log.Info("Service account is not bound to the identity", "serviceAccount", email)
+		return false, nil
+	}
+	return true, nil
+}
+
+// DeleteIdentity deletes the service account of the identity. The pool and
+// its provider are shared by all the identities and are left in place.
+func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) (err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	email := identity.Status.Metadata[identityMetaID]
+	if email == "" {
+		email = h.serviceAccountEmail(identity)
+	}
+
+	client, err := h.getClient(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.do(ctx, http.MethodDelete, h.serviceAccountURL(email), nil, nil); err != nil {
+		if isNotFound(err) {
+			log.Info("Service account already deleted", "serviceAccount", email)
+			return nil
+		}
+		return fmt.Errorf("failed to delete service account %s: %w", email, err)
+	}
+	log.Info("Service account deleted", "serviceAccount", email)
+	return nil
+}
+
+// CheckHealth exchanges the operator token on STS. The cached client is not
+// reused, a fresh exchange verifies the current credentials of the operator.
+func (h *IdentityHelper) CheckHealth(ctx context.Context) idp.Health {
+	if _, _, err := h.newClient(ctx); err != nil {
+		// STS answered but refused the token
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			return idp.Health{Reachable: true, Err: err}
+		}
+		return idp.Health{Err: err}
+	}
+	return idp.Health{Reachable: true, Authenticated: true}
+}
+
+type workloadIdentityPool struct {
+	Name        string `json:"name,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	State       string `json:"state,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+type oidcConfig struct {
+	IssuerURI        string   `json:"issuerUri"`
+	AllowedAudiences []string `json:"allowedAudiences,omitempty"`
+}
+
+type poolProvider struct {
+	Name             string            `json:"name,omitempty"`
+	DisplayName      string            `json:"displayName,omitempty"`
+	State            string            `json:"state,omitempty"`
+	Disabled         bool              `json:"disabled,omitempty"`
+	AttributeMapping map[string]string `json:"attributeMapping,omitempty"`
+	OIDC             *oidcConfig       `json:"oidc,omitempty"`
+}
+
+type serviceAccount struct {
+	Name        string `json:"name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	Description string `json:"description,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+type binding struct {
+	Role      string          `json:"role"`
+	Members   []string        `json:"members"`
+	Condition json.RawMessage `json:"condition,omitempty"`
+}
+
+type iamPolicy struct {
+	Version  int       `json:"version,omitempty"`
+	Etag     string    `json:"etag,omitempty"`
+	Bindings []binding `json:"bindings,omitempty"`
+}
+
+// hasMember reports whether member is granted role without conditions
+func (p *iamPolicy) hasMember(role, member string) bool {
+	for _, b := range p.Bindings {
+		if b.Role != role || len(b.Condition) > 0 {
+			continue
+		}
+		for _, m := range b.Members {
+			if m == member {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addMember grants role to member without conditions
+func (p *iamPolicy) addMember(role, member string) {
+	for i, b := range p.Bindings {
+		if b.Role == role && len(b.Condition) == 0 {
+			p.Bindings[i].Members = append(p.Bindings[i].Members, member)
+			return
+		}
+	}
+	p.Bindings = append(p.Bindings, binding{Role: role, Members: []string{member}})
+}
+
+// ensurePool creates the workload identity pool, or restores it if it was deleted
+func (h *IdentityHelper) ensurePool(ctx context.Context, client *restClient) error {
+	log := log.FromContext(ctx)
+
+	pool := &workloadIdentityPool{}
+	err := client.do(ctx, http.MethodGet, h.poolURL(), nil, pool)
+	switch {
+	case isNotFound(err):
+		log.Info("Creating workload identity pool", "pool", h.config.PoolID)
+		createURL := fmt.Sprintf("%s/v1/projects/%s/locations/global/workloadIdentityPools?workloadIdentityPoolId=%s",
+			h.config.Endpoints.IAM, h.config.ProjectNumber, url.QueryEscape(h.config.PoolID))
+		if err := client.do(ctx, http.MethodPost, createURL, &workloadIdentityPool{DisplayName: "aegis"}, nil); err != nil {
+			return fmt.Errorf("failed to create workload identity pool %s: %w", h.config.PoolID, err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get workload identity pool %s: %w", h.config.PoolID, err)
+	case pool.State == stateDeleted:
+		log.Info("Restoring deleted workload identity pool", "pool", h.config.PoolID)
+		if err := client.do(ctx, http.MethodPost, h.poolURL()+":undelete", map[string]string{}, nil); err != nil {
+			return fmt.Errorf("failed to undelete workload identity pool %s: %w", h.config.PoolID, err)
+		}
+	}
+	return nil
+}
+
+// ensurePoolProvider creates the OIDC provider of the cluster issuer in the
+// pool, restores it if it was deleted and patches it if it drifted
+func (h *IdentityHelper) ensurePoolProvider(ctx context.Context, client *restClient, issuer string) error {
+	log := log.FromContext(ctx)
+
+	desired := &poolProvider{
+		DisplayName:      "aegis",
+		AttributeMapping: map[string]string{"google.subject": "assertion.sub"},
+		OIDC: &oidcConfig{
+			IssuerURI:        issuer,
+			AllowedAudiences: h.allowedAudiences(),
+		},
+	}
+
+	provider := &poolProvider{}
+	err := client.do(ctx, http.MethodGet, h.providerURL(), nil, provider)
+	if isNotFound(err) {
+		log.Info("Creating workload identity pool provider", "provider", h.config.ProviderID, "issuer", issuer)
+		createURL := fmt.Sprintf("%s/providers?workloadIdentityPoolProviderId=%s", h.poolURL(), url.QueryEscape(h.config.ProviderID))
+		if err := client.do(ctx, http.MethodPost, createURL, desired, nil); err != nil {
+			return fmt.Errorf("failed to create workload identity pool provider %s: %w", h.config.ProviderID, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get workload identity pool provider %s: %w", h.config.ProviderID, err)
+	}
+
+	if provider.State == stateDeleted {
+		log.Info("Restoring deleted workload identity pool provider", "provider", h.config.ProviderID)
+		if err := client.do(ctx, http.MethodPost, h.providerURL()+":undelete", map[string]string{}, nil); err != nil {
+			return fmt.Errorf("failed to undelete workload identity pool provider %s: %w", h.config.ProviderID, err)
+		}
+	}
+	if !h.providerMatches(provider, issuer) {
+		log.Info("Updating workload identity pool provider", "provider", h.config.ProviderID, "issuer", issuer)
+		patchURL := h.providerURL() + "?updateMask=attributeMapping,oidc.issuerUri,oidc.allowedAudiences"
+		if err := client.do(ctx, http.MethodPatch, patchURL, desired, nil); err != nil {
+			return fmt.Errorf("failed to update workload identity pool provider %s: %w", h.config.ProviderID, err)
+		}
+	}
+	return nil
+}
+
+// providerMatches reports whether the pool provider federates issuer with the configured audiences
+func (h *IdentityHelper) providerMatches(provider *poolProvider, issuer string) bool {
+	if provider.OIDC == nil || provider.OIDC.IssuerURI != issuer {
+		return false
+	}
+	if provider.AttributeMapping["google.subject"] != "assertion.sub" {
+		return false
+	}
+	audiences := h.allowedAudiences()
+	if len(provider.OIDC.AllowedAudiences) != len(audiences) {
+		return false
+	}
+	for i, aud := range audiences {
+		if provider.OIDC.AllowedAudiences[i] != aud {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureServiceAccount creates the service account of the identity if missing
+func (h *IdentityHelper) ensureServiceAccount(ctx context.Context, client *restClient, identity *aegisv1.Identity) (*serviceAccount, error) {
+	log := log.FromContext(ctx)
+	email := h.serviceAccountEmail(identity)
+
+	sa := &serviceAccount{}
+	err := client.do(ctx, http.MethodGet, h.serviceAccountURL(email), nil, sa)
+	if err == nil {
+		if sa.Disabled {
+			log.Info("Enabling service account", "serviceAccount", email)
+			if err := client.do(ctx, http.MethodPost, h.serviceAccountURL(email)+":enable", map[string]string{}, nil); err != nil {
+				return nil, fmt.Errorf("failed to enable service account %s: %w", email, err)
+			}
+		}
+		return sa, nil
+	}
+	if !isNotFound(err) {
+		return nil, fmt.Errorf("failed to get service account %s: %w", email, err)
+	}
+
+	log.Info("Creating service account", "serviceAccount", email)
+	request := map[string]interface{}{
+		"accountId": h.accountID(identity),
+		"serviceAccount": &serviceAccount{
+			DisplayName: subject(identity),
+			Description: fmt.Sprintf("aegis identity %s/%s", identity.Namespace, identity.Name),
+		},
+	}
+	createURL := fmt.Sprintf("%s/v1/projects/%s/serviceAccounts", h.config.Endpoints.IAM, h.config.ProjectID)
+	sa = &serviceAccount{}
+	if err := client.do(ctx, http.MethodPost, createURL, request, sa); err != nil {
+		return nil, fmt.Errorf("failed to create service account %s: %w", email, err)
+	}
+	return sa, nil
+}
+
+// ensureWorkloadIdentityUser lets member impersonate the service account email
+func (h *IdentityHelper) ensureWorkloadIdentityUser(ctx context.Context, client *restClient, email, member string) error {
+	policy, err := h.getIamPolicy(ctx, client, email)
+	if err != nil {
+		return err
+	}
+	if policy.hasMember(workloadIdentityUserRole, member) {
+		return nil
+	}
+	policy.addMember(workloadIdentityUserRole, member)
+	policy.Version = 3
+	if err := client.do(ctx, http.MethodPost, h.serviceAccountURL(email)+":setIamPolicy", map[string]*iamPolicy{"policy": policy}, nil); err != nil {
+		return fmt.Errorf("failed to set IAM policy of service account %s: %w", email, err)
+	}
+	return nil
+}
+
+func (h *IdentityHelper) getIamPolicy(ctx context.Context, client *restClient, email string) (*iamPolicy, error) {
+	policy := &iamPolicy{}
+	request := map[string]interface{}{
+		"options": map[string]int{"requestedPolicyVersion": 3},
+	}
+	if err := client.do(ctx, http.MethodPost, h.serviceAccountURL(email)+":getIamPolicy", request, policy); err != nil {
+		return nil, fmt.Errorf("failed to get IAM policy of service account %s: %w", email, err)
+	}
+	return policy, nil
+}
+
+func (h *IdentityHelper) poolURL() string {
+	return fmt.Sprintf("%s/v1/projects/%s/locations/global/workloadIdentityPools/%s", h.config.Endpoints.IAM, h.config.ProjectNumber, h.config.PoolID)
+}
+
+func (h *IdentityHelper) providerURL() string {
+	return fmt.Sprintf("%s/providers/%s", h.poolURL(), h.config.ProviderID)
+}
+
+func (h *IdentityHelper) serviceAccountURL(email string) string {
+	return fmt.Sprintf("%s/v1/projects/%s/serviceAccounts/%s", h.config.Endpoints.IAM, h.config.ProjectID, email)
+}
+
+// providerAudience is the full resource name of the workload identity pool provider
+func (h *IdentityHelper) providerAudience() string {
+	return fmt.Sprintf("//iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/providers/%s",
+		h.config.ProjectNumber, h.config.PoolID, h.config.ProviderID)
+}
+
+func (h *IdentityHelper) operatorAudience() string {
+	if h.config.OperatorAudience != "" {
+		return h.config.OperatorAudience
+	}
+	return h.providerAudience()
+}
+
+// principal is the federated principal of the kubernetes service account of the identity
+func (h *IdentityHelper) principal(identity *aegisv1.Identity) string {
+	return fmt.Sprintf("principal://iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/subject/%s",
+		h.config.ProjectNumber, h.config.PoolID, subject(identity))
+}
+
+// accountID is the id of the service account of the identity. Service account
+// ids are limited to 30 characters, so it is derived from a hash of the
+// namespace and name of the identity.
+func (h *IdentityHelper) accountID(identity *aegisv1.Identity) string {
+	sum := sha256.Sum256([]byte(identity.Namespace + "/" + identity.Name))
+	return "aegis-" + hex.EncodeToString(sum[:])[:24]
+}
+
+func (h *IdentityHelper) serviceAccountEmail(identity *aegisv1.Identity) string {
+	return fmt.Sprintf("%s@%s.iam.gserviceaccount.com", h.accountID(identity), h.config.ProjectID)
+}
+
+func subject(identity *aegisv1.Identity) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name)
+}
+
+// GetIssuer returns the issuer of the service account tokens of the cluster
+func (h *IdentityHelper) GetIssuer(ctx context.Context) (string, error) {
+	return h.config.Issuer(ctx)
+}
@@ -0,0 +1,314 @@
+package gcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+const (
+	testIssuer      = "https://oidc.example.com/cluster"
+	testAccessToken = "federated-token"
+)
+
+// fakeGoogle is an in memory stand-in for the IAM and STS REST APIs
+type fakeGoogle struct {
+	mu        sync.Mutex
+	pools     map[string]*workloadIdentityPool
+	providers map[string]*poolProvider
+	accounts  map[string]*serviceAccount
+	policies  map[string]*iamPolicy
+	// audiences are the audiences of the token exchanges
+	audiences []string
+	// revoked rejects the access tokens issued
+	revoked bool
+}
+
+func newFakeGoogle() *fakeGoogle {
+	return &fakeGoogle{
+		pools:     map[string]*workloadIdentityPool{},
+		providers: map[string]*poolProvider{},
+		accounts:  map[string]*serviceAccount{},
+		policies:  map[string]*iamPolicy{},
+	}
+}
+
+func (f *fakeGoogle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := r.URL.Path
+	if path == "/v1/token" {
+		var exchange map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&exchange)
+		if exchange["grantType"] != grantTypeTokenExchange || exchange["subjectToken"] == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": "bad exchange"})
+			return
+		}
+		f.audiences = append(f.audiences, exchange["audience"])
+		writeJSON(w, http.StatusOK, map[string]string{"access_token": testAccessToken})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+testAccessToken || f.revoked {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": map[string]string{"message": "unauthenticated"}})
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(path, "/workloadIdentityPools") && r.Method == http.MethodPost:
+		pool := &workloadIdentityPool{}
+		_ = json.NewDecoder(r.Body).Decode(pool)
+		f.pools[path+"/"+r.URL.Query().Get("workloadIdentityPoolId")] = pool
+		writeJSON(w, http.StatusOK, map[string]string{"name": "operation"})
+	case strings.HasSuffix(path, "/providers") && r.Method == http.MethodPost:
+		provider := &poolProvider{}
+		_ = json.NewDecoder(r.Body).Decode(provider)
+		f.providers[path+"/"+r.URL.Query().Get("workloadIdentityPoolProviderId")] = provider
+		writeJSON(w, http.StatusOK, map[string]string{"name": "operation"})
+	case strings.Contains(path, "/providers/") && r.Method == http.MethodPatch:
+		provider := &poolProvider{}
+		_ = json.NewDecoder(r.Body).Decode(provider)
+		f.providers[path] = provider
+		writeJSON(w, http.StatusOK, map[string]string{"name": "operation"})
+	case strings.Contains(path, "/providers/") && r.Method == http.MethodGet:
+		obj, found := f.providers[path]
+		writeObject(w, obj, found)
+	case strings.Contains(path, "/workloadIdentityPools/") && r.Method == http.MethodGet:
+		obj, found := f.pools[path]
+		writeObject(w, obj, found)
+	case strings.HasSuffix(path, "/serviceAccounts") && r.Method == http.MethodPost:
+		var request struct {
+			AccountID      string         `json:"accountId"`
+			ServiceAccount serviceAccount `json:"serviceAccount"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		project := strings.Split(path, "/")[3]
+		sa := request.ServiceAccount
+		sa.Email = request.AccountID + "@" + project + ".iam.gserviceaccount.com"
+		f.accounts[path+"/"+sa.Email] = &sa
+		writeJSON(w, http.StatusOK, sa)
+	case strings.HasSuffix(path, ":getIamPolicy"):
+		policy := f.policies[strings.TrimSuffix(path, ":getIamPolicy")]
+		if policy == nil {
+			policy = &iamPolicy{Etag: "ACAB"}
+		}
+		writeJSON(w, http.StatusOK, policy)
+	case strings.HasSuffix(path, ":setIamPolicy"):
+		var request struct {
+			Policy *iamPolicy `json:"policy"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		f.policies[strings.TrimSuffix(path, ":setIamPolicy")] = request.Policy
+		writeJSON(w, http.StatusOK, request.Policy)
+	case strings.Contains(path, "/serviceAccounts/") && r.Method == http.MethodGet:
+		obj, found := f.accounts[path]
+		writeObject(w, obj, found)
+	case strings.Contains(path, "/serviceAccounts/") && r.Method == http.MethodDelete:
+		if _, found := f.accounts[path]; !found {
+			writeObject(w, nil, false)
+			return
+		}
+		delete(f.accounts, path)
+		delete(f.policies, path)
+		writeJSON(w, http.StatusOK, map[string]string{})
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": map[string]string{"message": "unexpected " + r.Method + " " + path}})
+	}
+}
+
+// writeObject answers with obj, or with a 404 if it was not found
+func writeObject(w http.ResponseWriter, obj interface{}, found bool) {
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"message": "not found"}})
+		return
+	}
+	writeJSON(w, http.StatusOK, obj)
+}
+
+func writeJSON(w http.ResponseWriter, status int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func newTestHelper(t *testing.T, config Config) (*IdentityHelper, *fakeGoogle) {
+	t.Helper()
+	fake := newFakeGoogle()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	claims, _ := json.Marshal(map[string]string{"iss": testIssuer, "sub": "system:serviceaccount:aegis-system:operator"})
+	token := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".signature"
+	tokenPath := filepath.Join(t.TempDir(), "gcp_token")
+	if err := os.WriteFile(tokenPath, []byte(token), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config.ProjectID = "aegis-project"
+	config.ProjectNumber = "123456"
+	config.PoolID = "aegis-pool"
+	config.TokenPath = tokenPath
+	config.Issuer = func(ctx context.Context) (string, error) { return testIssuer, nil }
+	config.Endpoints = Endpoints{IAM: server.URL, STS: server.URL, IAMCredentials: server.URL}
+	config.HTTPClient = server.Client()
+	return New(config), fake
+}
+
+func TestIdentityLifecycle(t *testing.T) {
+	ctx := context.Background()
+	h, fake := newTestHelper(t, Config{})
+	identity := &aegisv1.Identity{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"}}
+
+	meta, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatalf("CreateIdentity() error = %v", err)
+	}
+	email := meta[identityMetaID]
+	if !strings.HasSuffix(email, "@aegis-project.iam.gserviceaccount.com") || len(strings.Split(email, "@")[0]) > 30 {
+		t.Fatalf("unexpected service account email %q", email)
+	}
+	identity.Status.Metadata = meta
+
+	provider := fake.providers[h.providerURL()[len(h.config.Endpoints.IAM):]]
+	if provider == nil || provider.OIDC.IssuerURI != testIssuer {
+		t.Fatalf("pool provider not federating %s: %+v", testIssuer, provider)
+	}
+	if fake.audiences[0] != "//iam.googleapis.com/projects/123456/locations/global/workloadIdentityPools/aegis-pool/providers/aegis" {
+		t.Errorf("unexpected operator audience %q", fake.audiences[0])
+	}
+
+	found, err := h.GetIdentity(ctx, identity)
+	if err != nil || !found {
+		t.Fatalf("GetIdentity() = %v, %v, want true", found, err)
+	}
+	policy := fake.policies[h.serviceAccountURL(email)[len(h.config.Endpoints.IAM):]]
+	if !policy.hasMember(workloadIdentityUserRole, "principal://iam.googleapis.com/projects/123456/locations/global/workloadIdentityPools/aegis-pool/subject/system:serviceaccount:shop:frontend") {
+		t.Errorf("service account not bound to the identity: %+v", policy)
+	}
+
+	// creating again is a no-op
+	if _, err := h.CreateIdentity(ctx, identity); err != nil {
+		t.Fatalf("CreateIdentity() again error = %v", err)
+	}
+	policy = fake.policies[h.serviceAccountURL(email)[len(h.config.Endpoints.IAM):]]
+	if len(policy.Bindings) != 1 || len(policy.Bindings[0].Members) != 1 {
+		t.Errorf("duplicated binding: %+v", policy)
+	}
+
+	// drift of the issuer is detected and repaired
+	provider.OIDC.IssuerURI = "https://other.example.com"
+	if found, err := h.GetIdentity(ctx, identity); err != nil || found {
+		t.Fatalf("GetIdentity() with drifted provider = %v, %v, want false", found, err)
+	}
+	if _, err := h.CreateIdentity(ctx, identity); err != nil {
+		t.Fatalf("CreateIdentity() repair error = %v", err)
+	}
+	if found, err := h.GetIdentity(ctx, identity); err != nil || !found {
+		t.Fatalf("GetIdentity() after repair = %v, %v, want true", found, err)
+	}
+
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatalf("DeleteIdentity() error = %v", err)
+	}
+	if found, err := h.GetIdentity(ctx, identity); err != nil || found {
+		t.Fatalf("GetIdentity() after delete = %v, %v, want false", found, err)
+	}
+	// deleting again is a no-op
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatalf("DeleteIdentity() again error = %v", err)
+	}
+}
+
+func TestProxyArgsAndAudience(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHelper(t, Config{AllowedAudiences: []string{"aegis"}})
+
+	if got := h.GetAudience(); got != "aegis" {
+		t.Errorf("GetAudience() = %q, want aegis", got)
+	}
+	if got := strings.Join(h.allowedAudiences(), ","); got != "aegis,gcp" {
+		t.Errorf("allowedAudiences() = %q, want the operator audience appended", got)
+	}
+	separate, _ := newTestHelper(t, Config{OperatorAudience: "//iam.googleapis.com/projects/123456/locations/global/workloadIdentityPools/operator/providers/aegis"})
+	if got := separate.GetAudience(); got != separate.providerAudience() {
+		t.Errorf("GetAudience() = %q, want the provider resource name", got)
+	}
+	identity := &aegisv1.Identity{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"}}
+	if _, err := h.GetProxyArgs(ctx, identity); err == nil {
+		t.Errorf("GetProxyArgs() without service account should fail")
+	}
+	identity.Status.Metadata = map[string]string{identityMetaID: "sa@aegis-project.iam.gserviceaccount.com"}
+	args, err := h.GetProxyArgs(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--gcp-project-id aegis-project --gcp-workload-identity-provider //iam.googleapis.com/projects/123456/locations/global/workloadIdentityPools/aegis-pool/providers/aegis --gcp-service-account sa@aegis-project.iam.gserviceaccount.com"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("GetProxyArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	ctx := context.Background()
+	h, fake := newTestHelper(t, Config{})
+	h.clientKey = idp.ClientKey{UID: types.UID("gcp-provider")}
+	t.Cleanup(func() { idp.Clients.Invalidate(h.clientKey.UID) })
+	identity := &aegisv1.Identity{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"}}
+	identity.Status.Metadata = map[string]string{identityMetaID: "frontend@aegis-project.iam.gserviceaccount.com"}
+
+	// the federated token is exchanged once for the identities of the provider
+	for i := 0; i < 2; i++ {
+		if _, err := h.GetIdentity(ctx, identity); err != nil {
+			t.Fatalf("GetIdentity() error = %v", err)
+		}
+	}
+	if len(fake.audiences) != 1 {
+		t.Fatalf("%d token exchanges, want 1", len(fake.audiences))
+	}
+
+	// a rejected access token drops the cached client
+	fake.revoked = true
+	if _, err := h.GetIdentity(ctx, identity); err == nil {
+		t.Fatal("GetIdentity() succeeded with a revoked access token")
+	}
+	fake.revoked = false
+	if _, err := h.GetIdentity(ctx, identity); err != nil {
+		t.Fatalf("GetIdentity() error = %v", err)
+	}
+	if len(fake.audiences) != 2 {
+		t.Errorf("%d token exchanges, want 2 after the access token was rejected", len(fake.audiences))
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHelper(t, Config{})
+	if health := h.CheckHealth(ctx); !health.Reachable || !health.Authenticated {
+		t.Errorf("CheckHealth() = %+v, want reachable and authenticated", health)
+	}
+
+	if err := os.WriteFile(h.config.TokenPath, []byte(""), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if health := h.CheckHealth(ctx); !health.Reachable || health.Authenticated {
+		t.Errorf("CheckHealth() with an empty token = %+v, want reachable and not authenticated", health)
+	}
+
+	h.config.Endpoints.STS = "http://127.0.0.1:1"
+	if health := h.CheckHealth(ctx); health.Reachable {
+		t.Errorf("CheckHealth() with an unreachable STS = %+v, want unreachable", health)
+	}
+}
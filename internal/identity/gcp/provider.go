@@ -0,0 +1,54 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	identity.Register(identity.Provider{
+		Kind:             "GCPProvider",
+		ClusterKind:      "ClusterGCPProvider",
+		Name:             ProviderName,
+		Precedence:       50,
+		NewObject:        func() client.Object { return &aegisv1.GCPProvider{} },
+		NewClusterObject: func() client.Object { return &aegisv1.ClusterGCPProvider{} },
+		New: func(ctx context.Context, c client.Client, obj client.Object) (identity.IdentityHelper, error) {
+			var spec aegisv1.GCPProviderSpec
+			switch provider := obj.(type) {
+			case *aegisv1.GCPProvider:
+				spec = provider.Spec
+			case *aegisv1.ClusterGCPProvider:
+				spec = provider.Spec.GCPProviderSpec
+			default:
+				return nil, fmt.Errorf("expected a GCPProvider, got %T", obj)
+			}
+			credentials, err := identity.ReadCredentials(ctx, c, spec.CredentialsRef, obj.GetNamespace(), OperatorTokenAudience)
+			if err != nil {
+				return nil, err
+			}
+			config := Config{
+				ProjectID:              spec.ProjectID,
+				ProjectNumber:          spec.ProjectNumber,
+				PoolID:                 spec.PoolID,
+				ProviderID:             spec.ProviderID,
+				AllowedAudiences:       spec.AllowedAudiences,
+				OperatorAudience:       spec.OperatorAudience,
+				OperatorServiceAccount: spec.OperatorServiceAccount,
+			}
+			if credentials != nil {
+				if credentials.Token == nil {
+					return nil, fmt.Errorf("provider %s only supports service account credentials", obj.GetName())
+				}
+				config.Token = credentials.Token
+			}
+			h := New(config)
+			h.clientKey = identity.ClientKeyFor(obj, credentials)
+			return h, nil
+		},
+	})
+}
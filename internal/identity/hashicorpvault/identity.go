@@ -2,21 +2,34 @@ package hashicorpvault
 
 import (
 	"context"
+	"crypto/x509"
 	_ "embed"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"os"
+	"net/http"
+	"strconv"
+	"time"
 
 	vault_client "github.com/hashicorp/vault-client-go"
 	vault_client_schema "github.com/hashicorp/vault-client-go/schema"
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"github.com/vmarchese/aegis-operator/internal/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 const (
 	ProviderName = "hashicorp.vault"
-	AegisKeyName = "aegis-key"
-	TokenTTL     = "1h"
+
+	// defaults of the provider configuration
+	Audience         = "vault"
+	AegisKeyName     = "aegis-key"
+	TokenTTL         = "1h"
+	DefaultAuthMount = "jwt"
+	// DefaultAppRoleMount is the path of the approle auth method of AppRole credentials
+	DefaultAppRoleMount = "approle"
 
 	MetaAegisVersion   = "aegis_version"
 	MetaAegisIdentity  = "aegis_identity_name"
@@ -31,24 +44,97 @@ const (
 	K8STokenPath = "/var/run/secrets/tokens/hashicorpvault_token"
 )
 
+// DefaultPolicies are the default policies of the jwt roles of the identities
+var DefaultPolicies = []string{"default", "jwt_issuer"}
+
 //go:embed tokenTemplate.tpl
 var tokenTemplate string
 
+// Config is the configuration of a Vault provider. Empty fields get the defaults.
+type Config struct {
+	Address string
+	// Namespace is the Vault Enterprise namespace
+	Namespace string
+	// CABundle is the PEM encoded CA bundle verifying the Vault server certificate
+	CABundle     []byte
+	AuthMount    string
+	OperatorRole string
+	Policies     []string
+	Audience     string
+	OIDCKey      string
+	TokenTTL     string
+	// TokenTemplate is the default token template of the identities
+	TokenTemplate string
+	// Credentials of the operator, the mounted token when nil
+	Credentials  *idp.Credentials
+	AppRoleMount string
+}
+
 type IdentityHelper struct {
-	vaultAddress     string
-	tokenTemplateB64 string
+	config Config
+	// reader reads the config maps referenced by the identities
+	reader client.Reader
+	// clientKey identifies the cached clients of the provider
+	clientKey idp.ClientKey
 }
 
-func New(vaultAddress string) *IdentityHelper {
-	tokenTemplateB64 := base64.StdEncoding.EncodeToString([]byte(tokenTemplate))
-	return &IdentityHelper{vaultAddress: vaultAddress, tokenTemplateB64: tokenTemplateB64}
+func New(config Config) *IdentityHelper {
+	if config.AuthMount == "" {
+		config.AuthMount = DefaultAuthMount
+	}
+	if config.OperatorRole == "" {
+		config.OperatorRole = AegisOperatorRole
+	}
+	if len(config.Policies) == 0 {
+		config.Policies = DefaultPolicies
+	}
+	if config.Audience == "" {
+		config.Audience = Audience
+	}
+	if config.OIDCKey == "" {
+		config.OIDCKey = AegisKeyName
+	}
+	if config.TokenTTL == "" {
+		config.TokenTTL = TokenTTL
+	}
+	if config.AppRoleMount == "" {
+		config.AppRoleMount = DefaultAppRoleMount
+	}
+	return &IdentityHelper{config: config}
 }
 
 func (h *IdentityHelper) GetName() string {
 	return ProviderName
 }
 
-func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (map[string]string, error) {
+func (h *IdentityHelper) GetAudience() string {
+	return h.config.Audience
+}
+
+// GetTokenBounds bounds the token lifetime to the default verification TTL of the Vault OIDC keys
+func (h *IdentityHelper) GetTokenBounds() idp.TokenBounds {
+	return idp.TokenBounds{
+		MinTTL: idp.MinTokenTTL,
+		MaxTTL: 24 * time.Hour,
+	}
+}
+
+func (h *IdentityHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	args := []string{
+		"--identity-provider", ProviderName,
+		"--vault-address", h.config.Address,
+	}
+	if h.config.Namespace != "" {
+		args = append(args, "--vault-namespace", h.config.Namespace)
+	}
+	if h.config.AuthMount != DefaultAuthMount {
+		args = append(args, "--vault-auth-mount", h.config.AuthMount)
+	}
+	return args, nil
+}
+
+func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (_ map[string]string, err error) {
+	defer h.invalidateOnAuthFailure(&err)
 	client, err := h.getClient(ctx)
 	if err != nil {
 		return nil, err
@@ -58,10 +144,94 @@ func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.I
 
 }
 
-func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (bool, error) {
-	return false, nil
+// GetIdentity checks that the entity, the jwt role and the oidc role of the
+// identity exist on Vault and match the identity spec.
+func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (_ bool, err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+	saName := fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name)
+
+	client, err := h.getClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// entity
+	resp, err := client.Identity.EntityReadByName(ctx, saName)
+	if isNotFound(err) || (err == nil && resp.Data == nil) {
+		log.Info("entity not found", "entity", saName)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	expectedMetadata, err := entityMetadata(identity)
+	if err != nil {
+		return false, err
+	}
+	metadata, _ := resp.Data["metadata"].(map[string]interface{})
+	if !metadataMatches(metadata, expectedMetadata) {
+		log.Info("entity metadata does not match", "entity", saName, "metadata", metadata)
+		return false, nil
+	}
+	if aliases, _ := resp.Data["aliases"].([]interface{}); len(aliases) == 0 {
+		log.Info("entity alias not found", "entity", saName)
+		return false, nil
+	}
+
+	// jwt role
+	resp, err = client.Auth.JwtReadRole(ctx, identity.Name, vault_client.WithMountPath(h.config.AuthMount))
+	if isNotFound(err) || (err == nil && resp.Data == nil) {
+		log.Info("jwt role not found", "role", identity.Name)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	options, err := idp.GetTokenOptions(h, identity)
+	if err != nil {
+		return false, err
+	}
+	if resp.Data["bound_subject"] != saName || !containsAll(resp.Data["bound_audiences"], options.Audiences) {
+		log.Info("jwt role does not match", "role", identity.Name, "bound_subject", resp.Data["bound_subject"], "bound_audiences", resp.Data["bound_audiences"])
+		return false, nil
+	}
+
+	// oidc role
+	resp, err = client.Identity.OidcReadRole(ctx, identity.Name)
+	if isNotFound(err) || (err == nil && resp.Data == nil) {
+		log.Info("oidc role not found", "role", identity.Name)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if resp.Data["key"] != h.config.OIDCKey || resp.Data["client_id"] != saName {
+		log.Info("oidc role does not match", "role", identity.Name, "key", resp.Data["key"], "client_id", resp.Data["client_id"])
+		return false, nil
+	}
+	template, err := h.tokenTemplate(ctx, identity)
+	if err != nil {
+		return false, err
+	}
+	if resp.Data["template"] != template {
+		log.Info("oidc role template does not match", "role", identity.Name)
+		return false, nil
+	}
+	ttl, err := h.oidcTokenTTL(options)
+	if err != nil {
+		return false, err
+	}
+	if fmt.Sprint(resp.Data["ttl"]) != strconv.FormatInt(int64(ttl.Seconds()), 10) {
+		log.Info("oidc role ttl does not match", "role", identity.Name, "ttl", resp.Data["ttl"])
+		return false, nil
+	}
+
+	return true, nil
 }
-func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) error {
+
+func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) (err error) {
+	defer h.invalidateOnAuthFailure(&err)
 	log := log.FromContext(ctx)
 	saName := fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name)
 
@@ -70,40 +240,46 @@ func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.I
 		return err
 	}
 
+	// deletions are idempotent: the objects already missing are skipped
 	//delete jwt role
-	resp, err := client.Auth.JwtDeleteRole(ctx, identity.Name)
-	if err != nil {
+	if _, err := client.Auth.JwtDeleteRole(ctx, identity.Name, vault_client.WithMountPath(h.config.AuthMount)); err != nil && !isNotFound(err) {
 		return err
 	}
-	log.Info("deleted jwt role", "response", resp)
+	log.Info("deleted jwt role", "role", identity.Name)
 
 	// delete oidc role
-	resp, err = client.Identity.OidcDeleteRole(ctx, identity.Name)
-	if err != nil {
+	if _, err := client.Identity.OidcDeleteRole(ctx, identity.Name); err != nil && !isNotFound(err) {
 		return err
 	}
-	log.Info("deleted oidc role", "response", resp)
+	log.Info("deleted oidc role", "role", identity.Name)
 
 	// delete entity alias
-	resp, err = client.Identity.EntityReadByName(ctx, saName)
+	resp, err := client.Identity.EntityReadByName(ctx, saName)
+	if isNotFound(err) || (err == nil && (resp == nil || resp.Data == nil)) {
+		log.Info("entity not found", "entity", saName)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	aliases := resp.Data["aliases"].([]interface{})
+	aliases, _ := resp.Data["aliases"].([]interface{})
 	for _, alias := range aliases {
-		resp, err = client.Identity.EntityDeleteAliasById(ctx, alias.(map[string]interface{})["id"].(string))
-		if err != nil {
+		aliasData, _ := alias.(map[string]interface{})
+		aliasID, ok := aliasData["id"].(string)
+		if !ok {
+			continue
+		}
+		if _, err = client.Identity.EntityDeleteAliasById(ctx, aliasID); err != nil && !isNotFound(err) {
 			return err
 		}
-		log.Info("deleted alias", "response", resp)
+		log.Info("deleted alias", "id", aliasID)
 	}
 
 	log.Info("deleted entity aliases")
 
 	//delete entity
-	_, err = client.Identity.EntityDeleteByName(ctx, saName)
-	if err != nil {
+	if _, err := client.Identity.EntityDeleteByName(ctx, saName); err != nil && !isNotFound(err) {
 		return err
 	}
 
@@ -115,107 +291,292 @@ func (h *IdentityHelper) createIdentity(ctx context.Context, client *vault_clien
 
 	saName := fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name)
 
-	resp, err := client.Identity.EntityCreate(ctx, vault_client_schema.EntityCreateRequest{
-		Name: saName,
-		Metadata: map[string]interface{}{
-			MetaAegisVersion:   "1.0",
-			MetaAegisIdentity:  identity.Name,
-			MetaAegisNamespace: identity.Namespace,
-		},
+	// validate the identity before writing anything to vault
+	metadata, err := entityMetadata(identity)
+	if err != nil {
+		return nil, err
+	}
+	template, err := h.tokenTemplate(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	options, err := idp.GetTokenOptions(h, identity)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := h.oidcTokenTTL(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// create or update the entity by name so that a drifted identity can be recreated
+	resp, err := client.Identity.EntityUpdateByName(ctx, saName, vault_client_schema.EntityUpdateByNameRequest{
+		Metadata: metadata,
 	})
 	if err != nil {
 		log.Error(err, "unable to create identity")
 		return nil, err
 	}
-	log.Info("created identity", "response", resp)
+	log.Info("created identity", "name", saName)
 	resp, err = client.Identity.EntityReadByName(ctx, saName)
 	if err != nil {
 		return nil, err
 	}
-	log.Info("got identity", "response", resp, "id", resp.Data["id"])
+	log.Info("got identity", "id", resp.Data["id"])
 	e := resp.Data["id"]
 	entityId := e.(string)
+	entityAliases, _ := resp.Data["aliases"].([]interface{})
 
 	resp, err = client.Auth.JwtWriteRole(ctx, identity.Name, vault_client_schema.JwtWriteRoleRequest{
 		RoleType:       "jwt",
 		UserClaim:      "sub",
 		BoundSubject:   saName,
-		Policies:       []string{"default", "jwt_issuer"},
-		BoundAudiences: []string{"vault"},
-	})
+		Policies:       h.config.Policies,
+		BoundAudiences: options.Audiences,
+	}, vault_client.WithMountPath(h.config.AuthMount))
 	if err != nil {
 		log.Error(err, "unable to create jwt role")
 		return nil, err
 	}
-	log.Info("created jwt role", "response", resp)
+	log.Info("created jwt role", "role", identity.Name)
 
 	//get jwt accessor
 	resp, err = client.System.AuthListEnabledMethods(ctx)
 	if err != nil {
 		return nil, err
 	}
-	accessor := resp.Data["jwt/"].(map[string]interface{})["accessor"].(string)
-
-	// create entity alias
-	resp, err = client.Identity.EntityCreateAlias(ctx, vault_client_schema.EntityCreateAliasRequest{
-		Name:          saName,
-		CanonicalId:   entityId,
-		MountAccessor: accessor,
-	})
-	if err != nil {
-		return nil, err
+	mount, ok := resp.Data[h.config.AuthMount+"/"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("auth method %s not enabled", h.config.AuthMount)
+	}
+	accessor := mount["accessor"].(string)
+
+	// create entity alias if missing
+	if !hasAlias(entityAliases, accessor) {
+		resp, err = client.Identity.EntityCreateAlias(ctx, vault_client_schema.EntityCreateAliasRequest{
+			Name:          saName,
+			CanonicalId:   entityId,
+			MountAccessor: accessor,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Info("created alias", "name", saName, "accessor", accessor)
 	}
-	log.Info("created alias", "response", resp)
 
 	resp, err = client.Identity.OidcWriteRole(ctx, identity.Name, vault_client_schema.OidcWriteRoleRequest{
-		Key:      AegisKeyName,
-		Template: h.tokenTemplateB64,
-		Ttl:      TokenTTL,
+		Key:      h.config.OIDCKey,
+		Template: base64.StdEncoding.EncodeToString([]byte(template)),
+		Ttl:      fmt.Sprintf("%ds", int64(ttl.Seconds())),
 		ClientId: saName,
 	})
 	if err != nil {
 		return nil, err
 	}
-	log.Info("created oidc role", "response", resp)
+	log.Info("created oidc role", "role", identity.Name)
 
 	return map[string]string{
 		StatusMetaAegisIdentityID:   entityId,
 		StatusMetaAegisProvider:     ProviderName,
-		StatusMetaAegisVaultAddress: h.vaultAddress,
+		StatusMetaAegisVaultAddress: h.config.Address,
 	}, nil
 
 }
 
-func (h *IdentityHelper) getClient(ctx context.Context) (*vault_client.Client, error) {
-	var err error
-	log := log.FromContext(ctx)
+// hasAlias reports whether one of the entity aliases belongs to the auth mount with the given accessor
+func hasAlias(aliases []interface{}, accessor string) bool {
+	for _, alias := range aliases {
+		if a, ok := alias.(map[string]interface{}); ok && a["mount_accessor"] == accessor {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataMatches reports whether the entity metadata returned by Vault equals expected
+func metadataMatches(metadata map[string]interface{}, expected map[string]interface{}) bool {
+	if len(metadata) != len(expected) {
+		return false
+	}
+	for key, value := range expected {
+		if metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// oidcTokenTTL returns the TTL of the identity tokens: the TTL of the identity or the TTL of the provider
+func (h *IdentityHelper) oidcTokenTTL(options idp.TokenOptions) (time.Duration, error) {
+	ttl, err := time.ParseDuration(h.config.TokenTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid token TTL %s: %w", h.config.TokenTTL, err)
+	}
+	return options.TTLOrDefault(ttl), nil
+}
+
+// containsAll reports whether the list returned by Vault contains all the values
+func containsAll(list interface{}, values []string) bool {
+	items, _ := list.([]interface{})
+	for _, value := range values {
+		found := false
+		for _, item := range items {
+			if item == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func isNotFound(err error) bool {
+	return vault_client.IsErrorStatus(err, http.StatusNotFound)
+}
+
+// isAuthFailure reports whether Vault rejected the token of the client
+func isAuthFailure(err error) bool {
+	return vault_client.IsErrorStatus(err, http.StatusUnauthorized) || vault_client.IsErrorStatus(err, http.StatusForbidden)
+}
+
+// invalidateOnAuthFailure drops the cached client of the provider when Vault
+// rejected its token (e.g. revoked before its expiry), so that the next call
+// logs in again
+func (h *IdentityHelper) invalidateOnAuthFailure(err *error) {
+	if isAuthFailure(*err) {
+		idp.Clients.Invalidate(h.clientKey.UID)
+	}
+}
+
+// CheckHealth probes the Vault health endpoint and logs in with the operator role
+func (h *IdentityHelper) CheckHealth(ctx context.Context) idp.Health {
+	client, err := h.newClient()
+	if err != nil {
+		return idp.Health{Err: err}
+	}
+
+	// sys/health answers with a non 200 status code when vault is sealed or in standby
+	resp, err := client.ReadRaw(ctx, "/sys/health")
+	if err != nil {
+		return idp.Health{Err: err}
+	}
+	defer resp.Body.Close()
+	var status struct {
+		Initialized bool   `json:"initialized"`
+		Sealed      bool   `json:"sealed"`
+		Version     string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return idp.Health{Err: fmt.Errorf("invalid vault health response: %w", err)}
+	}
+	if !status.Initialized || status.Sealed {
+		return idp.Health{Reachable: true, Version: status.Version, Err: fmt.Errorf("vault is not initialized or sealed")}
+	}
+
+	// a fresh login verifies the current credentials of the operator
+	health := idp.Health{Reachable: true, Version: status.Version}
+	if _, _, err := h.newAuthenticatedClient(ctx); err != nil {
+		health.Err = err
+		return health
+	}
+	health.Authenticated = true
+	return health
+}
+
+// newClient returns an unauthenticated client of the configured Vault
+func (h *IdentityHelper) newClient() (*vault_client.Client, error) {
+	// the transport is configured here, vault_client.WithTLS requires the
+	// unwrapped transport of the client
+	httpClient := vault_client.DefaultConfiguration().HTTPClient
+	if len(h.config.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(h.config.CABundle) {
+			return nil, fmt.Errorf("invalid CA bundle")
+		}
+		httpClient.Transport.(*http.Transport).TLSClientConfig.RootCAs = pool
+	}
 	client, err := vault_client.New(
-		vault_client.WithAddress(h.vaultAddress),
+		vault_client.WithAddress(h.config.Address),
+		vault_client.WithHTTPClient(logging.HTTPClient(httpClient)),
 	)
 	if err != nil {
 		return nil, err
 	}
+	if h.config.Namespace != "" {
+		if err := client.SetNamespace(h.config.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// getClient returns a client logged in with the operator credentials, shared
+// by the identities of the provider until its token is close to expiry
+func (h *IdentityHelper) getClient(ctx context.Context) (*vault_client.Client, error) {
+	return idp.CachedClient(ctx, h.clientKey, "vault", h.newAuthenticatedClient)
+}
 
-	token, err := os.ReadFile(K8STokenPath)
+// newAuthenticatedClient logs in to Vault and returns the client together with
+// the expiry of its token
+func (h *IdentityHelper) newAuthenticatedClient(ctx context.Context) (*vault_client.Client, time.Time, error) {
+	log := log.FromContext(ctx)
+	client, err := h.newClient()
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
-	log.Info("vault token", "token", string(token))
 
-	authInfo, err := client.Auth.JwtLogin(ctx, vault_client_schema.JwtLoginRequest{
-		Jwt:  string(token),
-		Role: AegisOperatorRole,
-	})
+	authInfo, err := h.login(ctx, client)
 	if err != nil {
-		log.Error(err, "unable to log in with Kubernetes auth")
-		return nil, err
+		log.Error(err, "unable to log in to vault")
+		return nil, time.Time{}, err
 	}
 
-	vaultToken := authInfo.Auth.ClientToken
-	log.Info("vault token", "token", vaultToken)
-	if err := client.SetToken(vaultToken); err != nil {
+	if err := client.SetToken(authInfo.Auth.ClientToken); err != nil {
 		log.Error(err, "unable to set token")
+		return nil, time.Time{}, err
+	}
+	var expires time.Time
+	if authInfo.Auth.LeaseDuration > 0 {
+		expires = time.Now().Add(time.Duration(authInfo.Auth.LeaseDuration) * time.Second)
+	}
+	return client, expires, nil
+}
+
+// login logs the operator in with the AppRole of the credentials secret, or
+// with OperatorRole and a Kubernetes token: a token of the service account of
+// the credentials, or the token mounted into the operator when no service
+// account is configured
+func (h *IdentityHelper) login(ctx context.Context, client *vault_client.Client) (*vault_client.Response[map[string]interface{}], error) {
+
+	credentials := h.config.Credentials
+	if credentials != nil && credentials.Secret != nil {
+		roleID, err := credentials.SecretValue(idp.CredentialRoleID)
+		if err != nil {
+			return nil, err
+		}
+		secretID, err := credentials.SecretValue(idp.CredentialSecretID)
+		if err != nil {
+			return nil, err
+		}
+		return client.Auth.AppRoleLogin(ctx, vault_client_schema.AppRoleLoginRequest{
+			RoleId:   roleID,
+			SecretId: secretID,
+		}, vault_client.WithMountPath(h.config.AppRoleMount))
+	}
+
+	getToken := idp.FileToken(K8STokenPath)
+	if credentials != nil && credentials.Token != nil {
+		getToken = credentials.Token
+	}
+	token, err := getToken(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return client, nil
+	return client.Auth.JwtLogin(ctx, vault_client_schema.JwtLoginRequest{
+		Jwt:  token,
+		Role: h.config.OperatorRole,
+	}, vault_client.WithMountPath(h.config.AuthMount))
 }
@@ -0,0 +1,158 @@
+package hashicorpvault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+// fakeVault serves the AppRole logins and answers the other requests with
+// the body of their path in responses, 404 when missing, or 403 once denied
+type fakeVault struct {
+	mu        sync.Mutex
+	responses map[string]string
+	requests  []string
+	denied    bool
+}
+
+// deny makes the fake answer 403 to the requests other than the logins
+func (f *fakeVault) deny(denied bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.denied = denied
+}
+
+// logins returns the number of AppRole logins served
+func (f *fakeVault) logins() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	logins := 0
+	for _, request := range f.requests {
+		if request == "POST /v1/auth/approle/login" {
+			logins++
+		}
+	}
+	return logins
+}
+
+func newFakeVault(t *testing.T, responses map[string]string) (*fakeVault, *httptest.Server) {
+	fake := &fakeVault{responses: responses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		fake.requests = append(fake.requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/auth/approle/login" {
+			_, _ = w.Write([]byte(`{"data":{},"auth":{"client_token":"operator-token","lease_duration":3600}}`))
+			return
+		}
+		if fake.denied {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		body, ok := fake.responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func newTestHelper(address string) *IdentityHelper {
+	return New(Config{
+		Address: address,
+		Credentials: &idp.Credentials{Secret: map[string][]byte{
+			idp.CredentialRoleID:   []byte("role"),
+			idp.CredentialSecretID: []byte("secret"),
+		}},
+	})
+}
+
+func TestDeleteIdentityMissing(t *testing.T) {
+	ctx := context.Background()
+	identity := &aegisv1.Identity{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"}}
+
+	tests := []struct {
+		name      string
+		responses map[string]string
+	}{
+		{name: "nothing left", responses: map[string]string{}},
+		{name: "entity without aliases", responses: map[string]string{
+			"GET /v1/identity/entity/name/system:serviceaccount:shop:frontend": `{"data":{"id":"entity-1"}}`,
+		}},
+		{name: "malformed aliases", responses: map[string]string{
+			"GET /v1/identity/entity/name/system:serviceaccount:shop:frontend": `{"data":{"id":"entity-1","aliases":[{"name":"frontend"},"alias"]}}`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newFakeVault(t, tt.responses)
+			if err := newTestHelper(server.URL).DeleteIdentity(ctx, identity); err != nil {
+				t.Errorf("DeleteIdentity() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDeleteIdentityAliases(t *testing.T) {
+	ctx := context.Background()
+	identity := &aegisv1.Identity{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"}}
+	fake, server := newFakeVault(t, map[string]string{
+		"GET /v1/identity/entity/name/system:serviceaccount:shop:frontend": `{"data":{"id":"entity-1","aliases":[{"id":"alias-1"}]}}`,
+		"DELETE /v1/identity/entity-alias/id/alias-1":                      ``,
+	})
+
+	if err := newTestHelper(server.URL).DeleteIdentity(ctx, identity); err != nil {
+		t.Fatalf("DeleteIdentity() error = %v", err)
+	}
+	if requests := strings.Join(fake.requests, "\n"); !strings.Contains(requests, "DELETE /v1/identity/entity-alias/id/alias-1") ||
+		!strings.Contains(requests, "DELETE /v1/identity/entity/name/system:serviceaccount:shop:frontend") {
+		t.Errorf("alias and entity not deleted, requests:\n%s", requests)
+	}
+}
+
+func TestClientInvalidatedOnAuthFailure(t *testing.T) {
+	ctx := context.Background()
+	identity := &aegisv1.Identity{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"}}
+	fake, server := newFakeVault(t, map[string]string{})
+	h := newTestHelper(server.URL)
+	h.clientKey = idp.ClientKey{UID: types.UID("vault-provider")}
+	t.Cleanup(func() { idp.Clients.Invalidate(h.clientKey.UID) })
+
+	// the client logged in is reused while Vault accepts its token
+	for i := 0; i < 2; i++ {
+		if _, err := h.GetIdentity(ctx, identity); err != nil {
+			t.Fatalf("GetIdentity() error = %v", err)
+		}
+	}
+	if logins := fake.logins(); logins != 1 {
+		t.Fatalf("logins = %d, want 1", logins)
+	}
+
+	// a rejected token drops the cached client
+	fake.deny(true)
+	if _, err := h.GetIdentity(ctx, identity); err == nil {
+		t.Fatal("GetIdentity() succeeded with a rejected token")
+	}
+	fake.deny(false)
+	if _, err := h.GetIdentity(ctx, identity); err != nil {
+		t.Fatalf("GetIdentity() error = %v", err)
+	}
+	if logins := fake.logins(); logins != 2 {
+		t.Errorf("logins = %d, want 2 after the token was rejected", logins)
+	}
+}
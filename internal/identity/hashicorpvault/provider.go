@@ -0,0 +1,76 @@
+package hashicorpvault
+
+import (
+	"context"
+	"fmt"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	identity.Register(identity.Provider{
+		Kind:             "HashicorpVaultProvider",
+		ClusterKind:      "ClusterHashicorpVaultProvider",
+		Name:             ProviderName,
+		Precedence:       10,
+		NewObject:        func() client.Object { return &aegisv1.HashicorpVaultProvider{} },
+		NewClusterObject: func() client.Object { return &aegisv1.ClusterHashicorpVaultProvider{} },
+		New: func(ctx context.Context, c client.Client, obj client.Object) (identity.IdentityHelper, error) {
+			var spec aegisv1.HashicorpVaultProviderSpec
+			switch provider := obj.(type) {
+			case *aegisv1.HashicorpVaultProvider:
+				spec = provider.Spec
+			case *aegisv1.ClusterHashicorpVaultProvider:
+				spec = provider.Spec.HashicorpVaultProviderSpec
+			default:
+				return nil, fmt.Errorf("expected a HashicorpVaultProvider, got %T", obj)
+			}
+
+			config := Config{
+				Address:      spec.VaultAddress,
+				Namespace:    spec.VaultNamespace,
+				AuthMount:    spec.AuthMount,
+				OperatorRole: spec.OperatorRole,
+				Policies:     spec.Policies,
+				Audience:     spec.Audience,
+				OIDCKey:      spec.OIDCKey,
+				TokenTTL:     spec.TokenTTL,
+				AppRoleMount: spec.AppRoleMount,
+			}
+			// the operator role is bound to the audience of the provider
+			audience := spec.Audience
+			if audience == "" {
+				audience = Audience
+			}
+			credentials, err := identity.ReadCredentials(ctx, c, spec.CredentialsRef, obj.GetNamespace(), audience)
+			if err != nil {
+				return nil, err
+			}
+			config.Credentials = credentials
+			if spec.CABundleRef != nil {
+				caBundle, err := identity.ReadSecretKey(ctx, c, spec.CABundleRef, obj.GetNamespace())
+				if err != nil {
+					return nil, err
+				}
+				config.CABundle = caBundle
+			}
+			if spec.TokenTemplate != nil {
+				template, err := readTokenTemplate(ctx, c, spec.TokenTemplate, obj.GetNamespace())
+				if err != nil {
+					return nil, err
+				}
+				if err := ValidateTokenTemplate(template); err != nil {
+					return nil, fmt.Errorf("invalid token template for provider %s: %w", obj.GetName(), err)
+				}
+				config.TokenTemplate = template
+			}
+
+			h := New(config)
+			h.reader = c
+			h.clientKey = identity.ClientKeyFor(obj, credentials)
+			return h, nil
+		},
+	})
+}
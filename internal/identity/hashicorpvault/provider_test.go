@@ -0,0 +1,61 @@
+package hashicorpvault
+
+import (
+	"context"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+func TestNewCredentialsAudience(t *testing.T) {
+	ctx := context.Background()
+	var audiences []string
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, subResourceObj client.Object, opts ...client.SubResourceCreateOption) error {
+			request := subResourceObj.(*authenticationv1.TokenRequest)
+			audiences = append(audiences, request.Spec.Audiences...)
+			request.Status.Token = "sa-token"
+			return nil
+		},
+	}).Build()
+	provider, ok := identity.Lookup("HashicorpVaultProvider")
+	if !ok {
+		t.Fatal("HashicorpVaultProvider not registered")
+	}
+
+	for _, tt := range []struct {
+		name, serviceAccount, audience, want string
+	}{
+		{name: "provider audience", serviceAccount: "vault-a", audience: "vault.example.com", want: "vault.example.com"},
+		{name: "default audience", serviceAccount: "vault-b", want: Audience},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			audiences = nil
+			obj := &aegisv1.HashicorpVaultProvider{
+				ObjectMeta: metav1.ObjectMeta{Name: "vault", Namespace: "tenant-a"},
+				Spec: aegisv1.HashicorpVaultProviderSpec{
+					VaultAddress:   "https://vault.example.com",
+					Audience:       tt.audience,
+					CredentialsRef: &aegisv1.CredentialsRef{ServiceAccountName: tt.serviceAccount},
+				},
+			}
+			h, err := provider.New(ctx, c, obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := h.(*IdentityHelper).config.Credentials.Token(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if len(audiences) != 1 || audiences[0] != tt.want {
+				t.Errorf("credentials token requested for audiences %v, want [%s]", audiences, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package hashicorpvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reservedClaims are set by Vault and cannot be set by a token template
+var reservedClaims = map[string]bool{
+	"iat": true, "aud": true, "exp": true, "iss": true, "sub": true,
+	"namespace": true, "nonce": true, "auth_time": true, "at_hash": true, "c_hash": true,
+}
+
+var (
+	placeholderRe      = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+	validPlaceholderRe = regexp.MustCompile(`^(` +
+		`identity\.entity\.(id|name|groups\.ids|groups\.names|metadata(\.[\w.-]+)?)` +
+		`|identity\.entity\.aliases\.[\w.-]+\.(id|name|metadata(\.[\w.-]+)?)` +
+		`|identity\.groups\.(ids|names)\.[\w.-]+\.(id|name|metadata(\.[\w.-]+)?)` +
+		`|time\.now(\.(plus|minus)\.\w+)?` +
+		`)$`)
+)
+
+// ValidateTokenTemplate checks that template only uses Vault template
+// placeholders, that it is a JSON object once the placeholders are rendered
+// and that it does not set reserved claims.
+func ValidateTokenTemplate(template string) error {
+	var placeholderErr error
+	rendered := placeholderRe.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholderRe.FindStringSubmatch(placeholder)[1]
+		if placeholderErr == nil && !validPlaceholderRe.MatchString(name) {
+			placeholderErr = fmt.Errorf("invalid token template placeholder %s", placeholder)
+		}
+		return "null"
+	})
+	if placeholderErr != nil {
+		return placeholderErr
+	}
+	if strings.Contains(rendered, "{{") || strings.Contains(rendered, "}}") {
+		return fmt.Errorf("unbalanced braces in token template")
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal([]byte(rendered), &claims); err != nil {
+		return fmt.Errorf("token template is not a JSON object: %w", err)
+	}
+	for claim := range claims {
+		if reservedClaims[claim] {
+			return fmt.Errorf("token template cannot set the reserved claim %s", claim)
+		}
+	}
+	return nil
+}
+
+// readTokenTemplate returns the template set inline or in the config map
+// referenced by tpl. namespace is the namespace of the object setting tpl,
+// empty for the cluster scoped providers.
+func readTokenTemplate(ctx context.Context, c client.Reader, tpl *aegisv1.TokenTemplate, namespace string) (string, error) {
+	switch {
+	case tpl.Inline != "" && tpl.ConfigMapRef != nil:
+		return "", fmt.Errorf("token template cannot be both inline and from a config map")
+	case tpl.Inline != "":
+		return tpl.Inline, nil
+	case tpl.ConfigMapRef != nil:
+		if c == nil {
+			return "", fmt.Errorf("cannot read token template from config map %s", tpl.ConfigMapRef.Name)
+		}
+		return identity.ReadConfigMapKey(ctx, c, tpl.ConfigMapRef, namespace)
+	default:
+		return "", fmt.Errorf("token template is empty")
+	}
+}
+
+// tokenTemplate returns the validated token template of identity: the
+// template of the identity, else the template of the provider, else the default one
+func (h *IdentityHelper) tokenTemplate(ctx context.Context, identity *aegisv1.Identity) (string, error) {
+	template := tokenTemplate
+	if h.config.TokenTemplate != "" {
+		template = h.config.TokenTemplate
+	}
+	if identity.Spec.TokenTemplate != nil {
+		var err error
+		template, err = readTokenTemplate(ctx, h.reader, identity.Spec.TokenTemplate, identity.Namespace)
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := ValidateTokenTemplate(template); err != nil {
+		return "", fmt.Errorf("invalid token template for identity %s: %w", identity.Name, err)
+	}
+	return template, nil
+}
+
+// entityMetadata returns the metadata of the Vault entity of identity
+func entityMetadata(identity *aegisv1.Identity) (map[string]interface{}, error) {
+	metadata := map[string]interface{}{
+		MetaAegisVersion:   "1.0",
+		MetaAegisIdentity:  identity.Name,
+		MetaAegisNamespace: identity.Namespace,
+	}
+	for key, value := range identity.Spec.EntityMetadata {
+		if strings.HasPrefix(key, "aegis_") {
+			return nil, fmt.Errorf("entity metadata key %s is reserved", key)
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
@@ -0,0 +1,28 @@
+package hashicorpvault
+
+import "testing"
+
+func TestValidateTokenTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{name: "default template", template: tokenTemplate},
+		{name: "custom claims", template: `{"team": {{identity.entity.metadata.team}}, "env": "prod", "nbf": {{time.now}}}`},
+		{name: "alias placeholder", template: `{"username": {{identity.entity.aliases.auth_jwt_12345.name}}}`},
+		{name: "not json", template: `{"team": {{identity.entity.metadata.team}},}`, wantErr: true},
+		{name: "not an object", template: `[{{identity.entity.name}}]`, wantErr: true},
+		{name: "unknown placeholder", template: `{"team": {{identity.team}}}`, wantErr: true},
+		{name: "unbalanced braces", template: `{"team": {{identity.entity.name}}}}`, wantErr: true},
+		{name: "reserved claim", template: `{"sub": {{identity.entity.name}}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTokenTemplate(tt.template)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTokenTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package identity
+
+import "context"
+
+// Health is the result of a connectivity probe of an identity backend
+type Health struct {
+	// Reachable reports whether the backend answered the probe
+	Reachable bool
+	// Authenticated reports whether the operator could log in to the backend
+	Authenticated bool
+	// Version of the backend, when the backend reports it
+	Version string
+	// Err is the error of the failed probe
+	Err error
+}
+
+// HealthChecker is implemented by the backends able to probe their IdP. It is
+// optional: providers whose helper does not implement it are not probed.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) Health
+}
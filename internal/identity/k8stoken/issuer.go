@@ -0,0 +1,89 @@
+package k8stoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// discoveryPath is the OpenID Connect discovery document of the service account issuer
+	discoveryPath = "/.well-known/openid-configuration"
+	// jwksPath is the key set of the service account issuer served by the API server
+	jwksPath = "/openid/v1/jwks"
+)
+
+// issuerDiscovery reads the issuer from the discovery document of the API
+// server and its key set. The issuer does not change while the operator runs,
+// so it is cached once read; the key set rotates and is read on every call.
+type issuerDiscovery struct {
+	http *http.Client
+	host string
+
+	mu     sync.Mutex
+	cached string
+}
+
+func newIssuerDiscovery(config *rest.Config) (*issuerDiscovery, error) {
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+	return &issuerDiscovery{http: httpClient, host: strings.TrimSuffix(config.Host, "/")}, nil
+}
+
+func (d *issuerDiscovery) issuer(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cached != "" {
+		return d.cached, nil
+	}
+
+	data, err := d.get(ctx, discoveryPath, "the issuer discovery document")
+	if err != nil {
+		return "", err
+	}
+	var document struct {
+		Issuer string `json:"issuer"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return "", fmt.Errorf("invalid issuer discovery document: %w", err)
+	}
+	if document.Issuer == "" {
+		return "", fmt.Errorf("issuer not found in the discovery document")
+	}
+	d.cached = document.Issuer
+	return d.cached, nil
+}
+
+func (d *issuerDiscovery) jwks(ctx context.Context) ([]byte, error) {
+	return d.get(ctx, jwksPath, "the issuer key set")
+}
+
+// get returns the body of the API server path, described by what in the errors
+func (d *issuerDiscovery) get(ctx context.Context, path, what string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", what, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get %s: %s: %s", what, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
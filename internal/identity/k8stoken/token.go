@@ -0,0 +1,166 @@
+// Package k8stoken issues the Kubernetes tokens the operator authenticates to
+// the identity providers with, using the TokenRequest API, and discovers the
+// issuer of the cluster.
+package k8stoken
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultTTL is the lifetime of the issued tokens
+	DefaultTTL = time.Hour
+	// refreshRatio is the fraction of the token lifetime left when a cached token is renewed
+	refreshRatio = 5
+)
+
+// Source issues tokens of a service account and caches them per audience
+// until they are close to expiry. It is safe for concurrent use.
+type Source struct {
+	client         client.Client
+	serviceAccount types.NamespacedName
+	ttl            time.Duration
+	now            func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+type cachedToken struct {
+	value   string
+	expires time.Time
+}
+
+// NewSource returns a Source issuing tokens of the service account namespace/name with c
+func NewSource(c client.Client, namespace, name string) *Source {
+	return &Source{
+		client:         c,
+		serviceAccount: types.NamespacedName{Namespace: namespace, Name: name},
+		ttl:            DefaultTTL,
+		now:            time.Now,
+		tokens:         map[string]cachedToken{},
+	}
+}
+
+// Token returns a token for audience, issued when none is cached or the cached
+// one expires in less than a fifth of its lifetime
+func (s *Source) Token(ctx context.Context, audience string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, ok := s.tokens[audience]; ok && cached.expires.Sub(s.now()) > s.ttl/refreshRatio {
+		return cached.value, nil
+	}
+
+	serviceAccount := &corev1.ServiceAccount{}
+	serviceAccount.Namespace, serviceAccount.Name = s.serviceAccount.Namespace, s.serviceAccount.Name
+	expirationSeconds := int64(s.ttl.Seconds())
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         []string{audience},
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+	if err := s.client.SubResource("token").Create(ctx, serviceAccount, tokenRequest); err != nil {
+		return "", fmt.Errorf("failed to request a token for service account %s: %w", s.serviceAccount, err)
+	}
+
+	expires := tokenRequest.Status.ExpirationTimestamp.Time
+	if expires.IsZero() {
+		expires = s.now().Add(s.ttl)
+	}
+	s.tokens[audience] = cachedToken{value: tokenRequest.Status.Token, expires: expires}
+	return tokenRequest.Status.Token, nil
+}
+
+// TokenFunc returns a function issuing the tokens of audience
+func (s *Source) TokenFunc(audience string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		return s.Token(ctx, audience)
+	}
+}
+
+var (
+	mu       sync.Mutex
+	sources  = map[types.NamespacedName]*Source{}
+	operator *Source
+	issuer   *issuerDiscovery
+)
+
+// Setup configures the service account of the operator, whose tokens
+// authenticate the providers without credentials, and the API server the
+// issuer is discovered from. It is meant to be called once from main.
+func Setup(config *rest.Config, c client.Client, namespace, serviceAccount string) error {
+	discovery, err := newIssuerDiscovery(config)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	issuer = discovery
+	operator = nil
+	if namespace != "" && serviceAccount != "" {
+		operator = sourceFor(c, namespace, serviceAccount)
+	}
+	return nil
+}
+
+// Operator returns the source of the tokens of the operator service account,
+// nil when it is not configured (e.g. out of cluster)
+func Operator() *Source {
+	mu.Lock()
+	defer mu.Unlock()
+	return operator
+}
+
+// ForServiceAccount returns the source of the tokens of the service account
+// namespace/name. Sources are shared so that their tokens are cached across
+// reconciliations; c is only used by the first call for a service account.
+func ForServiceAccount(c client.Client, namespace, name string) *Source {
+	mu.Lock()
+	defer mu.Unlock()
+	return sourceFor(c, namespace, name)
+}
+
+func sourceFor(c client.Client, namespace, name string) *Source {
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	source, ok := sources[key]
+	if !ok {
+		source = NewSource(c, namespace, name)
+		sources[key] = source
+	}
+	return source
+}
+
+// Issuer returns the issuer of the service account tokens of the cluster
+func Issuer(ctx context.Context) (string, error) {
+	mu.Lock()
+	discovery := issuer
+	mu.Unlock()
+	if discovery == nil {
+		return "", fmt.Errorf("issuer discovery is not configured")
+	}
+	return discovery.issuer(ctx)
+}
+
+// JWKS returns the JSON web key set of the issuer of the service account
+// tokens of the cluster, as served by the API server
+func JWKS(ctx context.Context) ([]byte, error) {
+	mu.Lock()
+	discovery := issuer
+	mu.Unlock()
+	if discovery == nil {
+		return nil, fmt.Errorf("issuer discovery is not configured")
+	}
+	return discovery.jwks(ctx)
+}
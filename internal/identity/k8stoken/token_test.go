@@ -0,0 +1,102 @@
+package k8stoken
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestSourceCachesTokens(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	requests := 0
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, subResourceObj client.Object, opts ...client.SubResourceCreateOption) error {
+			requests++
+			tokenRequest := subResourceObj.(*authenticationv1.TokenRequest)
+			if obj.GetNamespace() != "aegis-system" || obj.GetName() != "operator" {
+				t.Errorf("token requested for %s/%s", obj.GetNamespace(), obj.GetName())
+			}
+			if *tokenRequest.Spec.ExpirationSeconds != int64(DefaultTTL.Seconds()) {
+				t.Errorf("token requested for %d seconds", *tokenRequest.Spec.ExpirationSeconds)
+			}
+			tokenRequest.Status.Token = fmt.Sprintf("%s-%d", tokenRequest.Spec.Audiences[0], requests)
+			tokenRequest.Status.ExpirationTimestamp = metav1.NewTime(now.Add(DefaultTTL))
+			return nil
+		},
+	}).Build()
+
+	source := NewSource(c, "aegis-system", "operator")
+	source.now = func() time.Time { return now }
+
+	for _, want := range []string{"vault-1", "vault-1"} {
+		if token, err := source.Token(ctx, "vault"); err != nil || token != want {
+			t.Fatalf("Token(vault) = %q, %v, want %q", token, err, want)
+		}
+	}
+	if token, _ := source.TokenFunc("gcp")(ctx); token != "gcp-2" {
+		t.Errorf("Token(gcp) = %q, want a token per audience", token)
+	}
+
+	// the cached token is renewed when less than a fifth of its lifetime is left
+	now = now.Add(DefaultTTL - DefaultTTL/refreshRatio + time.Second)
+	if token, _ := source.Token(ctx, "vault"); token != "vault-3" {
+		t.Errorf("Token(vault) = %q, want a renewed token", token)
+	}
+	if requests != 3 {
+		t.Errorf("%d token requests, want 3", requests)
+	}
+
+	if ForServiceAccount(c, "aegis-system", "operator") != ForServiceAccount(c, "aegis-system", "operator") {
+		t.Errorf("ForServiceAccount() does not share the sources")
+	}
+}
+
+func TestIssuerDiscovery(t *testing.T) {
+	ctx := context.Background()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case discoveryPath:
+			requests++
+			_, _ = w.Write([]byte(`{"issuer":"https://oidc.example.com/cluster","jwks_uri":"https://oidc.example.com/cluster/openid/v1/jwks"}`))
+		case jwksPath:
+			_, _ = w.Write([]byte(`{"keys":[{"kty":"RSA","kid":"key-1"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := Issuer(ctx); err == nil {
+		t.Errorf("Issuer() succeeded before Setup")
+	}
+	if err := Setup(&rest.Config{Host: server.URL}, fake.NewClientBuilder().Build(), "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if Operator() != nil {
+		t.Errorf("Operator() is set without a service account")
+	}
+	for i := 0; i < 2; i++ {
+		issuer, err := Issuer(ctx)
+		if err != nil || issuer != "https://oidc.example.com/cluster" {
+			t.Fatalf("Issuer() = %q, %v", issuer, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("%d discovery requests, want the issuer to be cached", requests)
+	}
+	if jwks, err := JWKS(ctx); err != nil || string(jwks) != `{"keys":[{"kty":"RSA","kid":"key-1"}]}` {
+		t.Errorf("JWKS() = %s, %v", jwks, err)
+	}
+}
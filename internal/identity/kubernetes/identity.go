@@ -2,27 +2,96 @@ package kubernetes
 
 import (
 	"context"
+	"fmt"
 
 	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	corev1 "k8s.io/api/core/v1"
 )
 
-const ProviderName = "kubernetes"
+const (
+	ProviderName = "kubernetes"
+	Audience     = "kubernetes"
+)
 
 type IdentityHelper struct {
+	issuer string
+	// remote is set for the issuer of a remote cluster
+	remote bool
+	// jwksConfigMap is the ConfigMap the key set of the issuer is mirrored
+	// into, empty until the provider published it
+	jwksConfigMap string
+}
+
+func New(issuer string) *IdentityHelper {
+	return &IdentityHelper{issuer: issuer}
 }
 
-func New() *IdentityHelper {
-	return &IdentityHelper{}
+// NewRemote returns an IdentityHelper validating the tokens of the issuer of
+// a remote cluster
+func NewRemote(issuer string) *IdentityHelper {
+	return &IdentityHelper{issuer: issuer, remote: true}
 }
 
 func (h *IdentityHelper) GetName() string {
 	return ProviderName
 }
 
+func (h *IdentityHelper) GetAudience() string {
+	return Audience
+}
+
+func (h *IdentityHelper) GetTokenBounds() idp.TokenBounds {
+	return idp.TokenBounds{
+		MinTTL: idp.MinTokenTTL,
+	}
+}
+
+func (h *IdentityHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	args := []string{
+		"--identity-provider", ProviderName,
+		"--kubernetes-issuer", h.issuer,
+	}
+	if h.jwksConfigMap != "" {
+		args = append(args, "--kubernetes-jwks-file", keySetMountPath+"/"+KeySetConfigMapKey)
+	}
+	return args, nil
+}
+
+// GetAdditionalProxyVolumes mounts the ConfigMap of the key set of the issuer,
+// so that the proxies validate the tokens without reaching the issuer. The
+// ConfigMap is optional: the ones of the cluster scoped providers may not be
+// mirrored yet into a new namespace.
+func (h *IdentityHelper) GetAdditionalProxyVolumes() []idp.ProxyVolume {
+	if h.jwksConfigMap == "" {
+		return nil
+	}
+	optional := true
+	return []idp.ProxyVolume{{
+		Volume: corev1.Volume{
+			Name: keySetVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: h.jwksConfigMap},
+					Optional:             &optional,
+				},
+			},
+		},
+		MountPath: keySetMountPath,
+	}}
+}
+
+// CreateIdentity has nothing to create. The identities cannot use the
+// provider of a remote cluster, whose tokens they do not get.
 func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (map[string]string, error) {
+	if h.remote {
+		return nil, fmt.Errorf("identity %s cannot use the provider of the remote issuer %s", identity.Name, h.issuer)
+	}
 	return map[string]string{}, nil
 }
 
+// GetIdentity always reports the identity as existing: kubernetes identities
+// are plain service accounts and have no external object.
 func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (bool, error) {
 	return true, nil
 }
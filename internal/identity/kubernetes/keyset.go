@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmarchese/aegis-operator/internal/identity/k8stoken"
+)
+
+const (
+	// KeySetConfigMapKey is the key of the ConfigMaps the key sets are mirrored into
+	KeySetConfigMapKey = "jwks.json"
+	// keySetVolumeName is the volume of the key set in the proxied pods
+	keySetVolumeName = "aegis-jwks"
+	// keySetMountPath is where the key set is mounted into the aegis-proxy container
+	keySetMountPath = "/var/run/aegis/jwks"
+)
+
+// KeySet is the issuer of the service account tokens of a cluster and its
+// JSON web key set
+type KeySet struct {
+	Issuer string
+	JWKS   string
+}
+
+// KeyIDs returns the ids of the keys of the key set, in their order
+func (k KeySet) KeyIDs() []string {
+	var keySet struct {
+		Keys []struct {
+			KeyID string `json:"kid"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal([]byte(k.JWKS), &keySet); err != nil {
+		return nil
+	}
+	keyIDs := []string{}
+	for _, key := range keySet.Keys {
+		if key.KeyID != "" {
+			keyIDs = append(keyIDs, key.KeyID)
+		}
+	}
+	return keyIDs
+}
+
+// Hash returns the hex encoded SHA-256 hash of the key set
+func (k KeySet) Hash() string {
+	digest := sha256.Sum256([]byte(k.JWKS))
+	return hex.EncodeToString(digest[:])
+}
+
+// LocalKeySet returns the issuer and the key set of the local cluster, read
+// from its API server
+func LocalKeySet(ctx context.Context) (KeySet, error) {
+	issuer, err := k8stoken.Issuer(ctx)
+	if err != nil {
+		return KeySet{}, err
+	}
+	jwks, err := k8stoken.JWKS(ctx)
+	if err != nil {
+		return KeySet{}, err
+	}
+	normalized, err := normalizeJWKS(jwks)
+	if err != nil {
+		return KeySet{}, fmt.Errorf("invalid key set of issuer %s: %w", issuer, err)
+	}
+	return KeySet{Issuer: issuer, JWKS: normalized}, nil
+}
+
+// normalizeJWKS checks that jwks is a key set with at least one key and
+// returns it compacted, so that unchanged key sets compare equal
+func normalizeJWKS(jwks []byte) (string, error) {
+	var keySet struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &keySet); err != nil {
+		return "", err
+	}
+	if len(keySet.Keys) == 0 {
+		return "", fmt.Errorf("no keys")
+	}
+	for _, key := range keySet.Keys {
+		if _, ok := key["kty"].(string); !ok {
+			return "", fmt.Errorf("key without kty")
+		}
+	}
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, jwks); err != nil {
+		return "", err
+	}
+	return compacted.String(), nil
+}
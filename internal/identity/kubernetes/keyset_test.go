@@ -0,0 +1,83 @@
+package kubernetes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity/k8stoken"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLocalKeySet(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case discoveryPath:
+			_, _ = w.Write([]byte(`{"issuer":"https://kubernetes.default.svc.cluster.local"}`))
+		case apiServerJWKSPath:
+			_, _ = w.Write([]byte(`{"keys": [{"kty": "RSA", "kid": "key-1"}, {"kty": "EC", "kid": "key-2"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	if err := k8stoken.Setup(&rest.Config{Host: server.URL}, fake.NewClientBuilder().Build(), "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	keySet, err := LocalKeySet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := KeySet{Issuer: "https://kubernetes.default.svc.cluster.local", JWKS: `{"keys":[{"kty":"RSA","kid":"key-1"},{"kty":"EC","kid":"key-2"}]}`}
+	if keySet != want {
+		t.Errorf("LocalKeySet() = %+v, want %+v", keySet, want)
+	}
+	if keyIDs := keySet.KeyIDs(); !reflect.DeepEqual(keyIDs, []string{"key-1", "key-2"}) {
+		t.Errorf("KeyIDs() = %v", keyIDs)
+	}
+	// the hash of the compacted key set changes with the keys only
+	if hash := keySet.Hash(); len(hash) != 64 || hash != (KeySet{JWKS: want.JWKS}).Hash() || hash == (KeySet{JWKS: testJWKS}).Hash() {
+		t.Errorf("Hash() = %s, want the SHA-256 hash of the keys", hash)
+	}
+}
+
+func TestIdentityHelperKeySet(t *testing.T) {
+	ctx := context.Background()
+	identity := &aegisv1.Identity{}
+	identity.Name = "app"
+
+	// no key set is mounted until the provider published it
+	h := New("https://kubernetes.default.svc")
+	if volumes := h.GetAdditionalProxyVolumes(); len(volumes) != 0 {
+		t.Errorf("GetAdditionalProxyVolumes() = %+v before the key set is published", volumes)
+	}
+
+	h.jwksConfigMap = "aegis-jwks-kube-local"
+	args, err := h.GetProxyArgs(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--identity-provider kubernetes --kubernetes-issuer https://kubernetes.default.svc --kubernetes-jwks-file /var/run/aegis/jwks/jwks.json"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("GetProxyArgs() = %s, want %s", got, want)
+	}
+	volumes := h.GetAdditionalProxyVolumes()
+	if len(volumes) != 1 || volumes[0].MountPath != keySetMountPath || volumes[0].Volume.ConfigMap == nil || volumes[0].Volume.ConfigMap.Name != "aegis-jwks-kube-local" {
+		t.Errorf("GetAdditionalProxyVolumes() = %+v, want the key set ConfigMap", volumes)
+	}
+	if _, err := h.CreateIdentity(ctx, identity); err != nil {
+		t.Errorf("CreateIdentity() = %v on the local provider", err)
+	}
+
+	// the identities cannot use the provider of a remote cluster
+	if _, err := NewRemote("https://cluster-b.example.com").CreateIdentity(ctx, identity); err == nil {
+		t.Errorf("CreateIdentity() succeeded on the provider of a remote cluster")
+	}
+}
@@ -0,0 +1,43 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	identity.Register(identity.Provider{
+		Kind:             "KubernetesProvider",
+		ClusterKind:      "ClusterKubernetesProvider",
+		Name:             ProviderName,
+		Precedence:       30,
+		NewObject:        func() client.Object { return &aegisv1.KubernetesProvider{} },
+		NewClusterObject: func() client.Object { return &aegisv1.ClusterKubernetesProvider{} },
+		New: func(ctx context.Context, c client.Client, obj client.Object) (identity.IdentityHelper, error) {
+			var spec aegisv1.KubernetesProviderSpec
+			var status aegisv1.KubernetesProviderStatus
+			switch provider := obj.(type) {
+			case *aegisv1.KubernetesProvider:
+				spec, status = provider.Spec, provider.Status
+			case *aegisv1.ClusterKubernetesProvider:
+				spec, status = provider.Spec.KubernetesProviderSpec, provider.Status
+			default:
+				return nil, fmt.Errorf("expected a KubernetesProvider, got %T", obj)
+			}
+			h := New(status.Issuer)
+			if spec.Remote != nil {
+				// the proxies cannot validate the tokens of a remote cluster without its key set
+				if status.JWKSConfigMap == "" {
+					return nil, fmt.Errorf("key set of the remote cluster of %s not fetched yet", obj.GetName())
+				}
+				h = NewRemote(status.Issuer)
+			}
+			h.jwksConfigMap = status.JWKSConfigMap
+			return h, nil
+		},
+	})
+}
@@ -0,0 +1,141 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// discoveryPath is the OpenID Connect discovery document of an issuer
+	discoveryPath = "/.well-known/openid-configuration"
+	// apiServerJWKSPath is the key set of the service account issuer served by the API server
+	apiServerJWKSPath = "/openid/v1/jwks"
+	// maxDocumentSize bounds the discovery documents and key sets read
+	maxDocumentSize = 1 << 20
+)
+
+// FetchRemoteKeySet returns the issuer and the key set of the remote cluster.
+// kubeconfig is the kubeconfig of the remote cluster, nil when not referenced:
+// the issuer and the key set are then read from its API server. Otherwise the
+// key set is inline, or fetched with httpClient from its URI or from the
+// discovery document of the issuer. The credentials of the kubeconfig are only
+// sent to its API server: the URLs of other origins are fetched with
+// httpClient.
+func FetchRemoteKeySet(ctx context.Context, remote *aegisv1.KubernetesRemoteCluster, kubeconfig []byte, httpClient *http.Client) (KeySet, error) {
+	keySet := KeySet{Issuer: remote.Issuer}
+	base, jwksURI := strings.TrimSuffix(remote.Issuer, "/"), remote.JWKSURI
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	clientFor := func(string) *http.Client { return httpClient }
+
+	if kubeconfig != nil {
+		config, err := restConfigFor(kubeconfig)
+		if err != nil {
+			return keySet, err
+		}
+		apiClient, err := rest.HTTPClientFor(config)
+		if err != nil {
+			return keySet, fmt.Errorf("invalid kubeconfig of the remote cluster: %w", err)
+		}
+		server, _, err := rest.DefaultServerUrlFor(config)
+		if err != nil {
+			return keySet, fmt.Errorf("invalid kubeconfig of the remote cluster: %w", err)
+		}
+		clientFor = func(uri string) *http.Client {
+			if u, err := url.Parse(uri); err == nil && u.Scheme == server.Scheme && u.Host == server.Host {
+				return apiClient
+			}
+			return httpClient
+		}
+		base = strings.TrimSuffix(config.Host, "/")
+		if jwksURI == "" {
+			jwksURI = base + apiServerJWKSPath
+		}
+	}
+
+	if keySet.Issuer == "" || (jwksURI == "" && remote.JWKS == "") {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := getJSON(ctx, clientFor(base), base+discoveryPath, &discovery); err != nil {
+			return keySet, err
+		}
+		if keySet.Issuer == "" {
+			keySet.Issuer = discovery.Issuer
+		}
+		if jwksURI == "" {
+			jwksURI = discovery.JWKSURI
+		}
+	}
+	if keySet.Issuer == "" {
+		return keySet, fmt.Errorf("issuer of the remote cluster not found")
+	}
+
+	jwks := []byte(remote.JWKS)
+	if remote.JWKS == "" {
+		if jwksURI == "" {
+			return keySet, fmt.Errorf("key set of issuer %s not found", keySet.Issuer)
+		}
+		var raw json.RawMessage
+		if err := getJSON(ctx, clientFor(jwksURI), jwksURI, &raw); err != nil {
+			return keySet, err
+		}
+		jwks = raw
+	}
+	normalized, err := normalizeJWKS(jwks)
+	if err != nil {
+		return keySet, fmt.Errorf("invalid key set of issuer %s: %w", keySet.Issuer, err)
+	}
+	keySet.JWKS = normalized
+	return keySet, nil
+}
+
+// restConfigFor returns the configuration of the client of the remote cluster.
+// Kubeconfigs running commands to get credentials are refused, since their
+// content is not trusted to run on the operator.
+func restConfigFor(kubeconfig []byte) (*rest.Config, error) {
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig of the remote cluster: %w", err)
+	}
+	if config.ExecProvider != nil || config.AuthProvider != nil {
+		return nil, fmt.Errorf("kubeconfig of the remote cluster uses an exec or auth provider plugin")
+	}
+	return config, nil
+}
+
+// getJSON gets url with httpClient and decodes its JSON body into v
+func getJSON(ctx context.Context, httpClient *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get %s: %s", url, resp.Status)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid document %s: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+const testJWKS = `{"keys":[{"kty":"RSA","kid":"key-1","n":"AQAB","e":"AQAB"}]}`
+
+// newRemoteCluster returns an API server serving the discovery document and
+// the key set of its issuer to the requests with token
+func newRemoteCluster(t *testing.T, issuer, token string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case discoveryPath:
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": server.URL + apiServerJWKSPath})
+		case apiServerJWKSPath:
+			_, _ = w.Write([]byte("{\n  \"keys\": [{\"kty\": \"RSA\", \"kid\": \"key-1\", \"n\": \"AQAB\", \"e\": \"AQAB\"}]\n}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// kubeconfig returns a kubeconfig of server authenticating with user
+func kubeconfig(server *httptest.Server, user string) []byte {
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: %s
+    insecure-skip-tls-verify: true
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+current-context: remote
+users:
+- name: remote
+  user:
+%s
+`, server.URL, user))
+}
+
+func TestFetchRemoteKeySet(t *testing.T) {
+	ctx := context.Background()
+	remote := newRemoteCluster(t, "https://cluster-b.example.com", "")
+
+	tests := []struct {
+		name    string
+		remote  aegisv1.KubernetesRemoteCluster
+		want    KeySet
+		wantErr string
+	}{
+		{
+			name:   "discovery",
+			remote: aegisv1.KubernetesRemoteCluster{Issuer: remote.URL},
+			want:   KeySet{Issuer: remote.URL, JWKS: testJWKS},
+		},
+		{
+			name:   "JWKS URI",
+			remote: aegisv1.KubernetesRemoteCluster{Issuer: "https://cluster-b.example.com", JWKSURI: remote.URL + apiServerJWKSPath},
+			want:   KeySet{Issuer: "https://cluster-b.example.com", JWKS: testJWKS},
+		},
+		{
+			name:   "inline JWKS",
+			remote: aegisv1.KubernetesRemoteCluster{Issuer: "https://cluster-c.example.com", JWKS: testJWKS},
+			want:   KeySet{Issuer: "https://cluster-c.example.com", JWKS: testJWKS},
+		},
+		{
+			name:    "invalid JWKS",
+			remote:  aegisv1.KubernetesRemoteCluster{Issuer: "https://cluster-c.example.com", JWKS: `{"keys":[]}`},
+			wantErr: "no keys",
+		},
+		{
+			name:    "missing discovery document",
+			remote:  aegisv1.KubernetesRemoteCluster{Issuer: remote.URL + "/missing"},
+			wantErr: "404",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FetchRemoteKeySet(ctx, &tt.remote, nil, remote.Client())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("FetchRemoteKeySet() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("FetchRemoteKeySet() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchRemoteKeySetKubeconfig(t *testing.T) {
+	ctx := context.Background()
+	remote := newRemoteCluster(t, "https://cluster-b.example.com", "remote-token")
+
+	// the issuer and the key set are read from the API server with the kubeconfig credentials
+	got, err := FetchRemoteKeySet(ctx, &aegisv1.KubernetesRemoteCluster{}, kubeconfig(remote, "    token: remote-token"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (KeySet{Issuer: "https://cluster-b.example.com", JWKS: testJWKS}); got != want {
+		t.Errorf("FetchRemoteKeySet() = %+v, want %+v", got, want)
+	}
+
+	// the issuer of the spec wins over the discovered one
+	got, err = FetchRemoteKeySet(ctx, &aegisv1.KubernetesRemoteCluster{Issuer: "https://alias.example.com"}, kubeconfig(remote, "    token: remote-token"), nil)
+	if err != nil || got.Issuer != "https://alias.example.com" {
+		t.Errorf("FetchRemoteKeySet() = %+v, %v, want the issuer of the spec", got, err)
+	}
+
+	if _, err := FetchRemoteKeySet(ctx, &aegisv1.KubernetesRemoteCluster{}, kubeconfig(remote, "    token: other"), nil); err == nil {
+		t.Errorf("FetchRemoteKeySet() succeeded with a wrong token")
+	}
+
+	// the key sets of other origins are fetched without the kubeconfig credentials
+	var authorization string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(testJWKS))
+	}))
+	t.Cleanup(other.Close)
+	got, err = FetchRemoteKeySet(ctx, &aegisv1.KubernetesRemoteCluster{JWKSURI: other.URL + "/keys"}, kubeconfig(remote, "    token: remote-token"), nil)
+	if err != nil || got.JWKS != testJWKS {
+		t.Errorf("FetchRemoteKeySet() = %+v, %v, want the key set of %s", got, err, other.URL)
+	}
+	if authorization != "" {
+		t.Errorf("FetchRemoteKeySet() sent %q to %s", authorization, other.URL)
+	}
+
+	// the kubeconfigs running commands are refused
+	exec := "    exec:\n      apiVersion: client.authentication.k8s.io/v1\n      command: /bin/sh\n      args: [\"-c\", \"echo\"]"
+	if _, err := FetchRemoteKeySet(ctx, &aegisv1.KubernetesRemoteCluster{}, kubeconfig(remote, exec), nil); err == nil || !strings.Contains(err.Error(), "exec") {
+		t.Errorf("FetchRemoteKeySet() error = %v for an exec kubeconfig", err)
+	}
+}
@@ -0,0 +1,353 @@
+package oidc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	"github.com/vmarchese/aegis-operator/internal/identity/k8stoken"
+	"github.com/vmarchese/aegis-operator/internal/logging"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	ProviderName = "oidc"
+	K8STokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	// defaults of the provider configuration
+	Audience          = "aegis"
+	DefaultTrustAlias = "kubernetes"
+
+	AdminAPIKeycloak = "keycloak"
+
+	identityMetaID       = "aegis.identity.id"
+	identityMetaClientID = "aegis.identity.client.id"
+
+	attributeIdentity = "aegis.identity"
+)
+
+// Trust is the cluster issuer federated on the IdP
+type Trust struct {
+	Alias   string
+	Issuer  string
+	JWKSURL string
+}
+
+// Client is the client of an identity on the IdP
+type Client struct {
+	// ID is the id assigned by the IdP
+	ID          string
+	ClientID    string
+	Description string
+	Attributes  map[string]string
+}
+
+// AdminAPI manages the trust with the cluster issuer and the clients of the
+// identities on an IdP. Get methods return nil when the object is not found.
+type AdminAPI interface {
+	// Login authenticates the operator on the admin API and returns the
+	// expiry of its access token, the zero time when unknown
+	Login(ctx context.Context) (time.Time, error)
+	GetTrust(ctx context.Context, alias string) (*Trust, error)
+	// EnsureTrust creates or updates the trust so that the tokens of the
+	// cluster issuer can be exchanged (RFC 8693) for tokens of the IdP
+	EnsureTrust(ctx context.Context, trust Trust) error
+	GetClient(ctx context.Context, clientID string) (*Client, error)
+	// EnsureClient creates or updates client and returns its id
+	EnsureClient(ctx context.Context, client Client) (string, error)
+	// DeleteClient deletes the client, it is a no-op if the client does not exist
+	DeleteClient(ctx context.Context, clientID string) error
+	// TokenEndpoint is the endpoint the proxy exchanges its token on
+	TokenEndpoint() string
+}
+
+// adminAPIs are the constructors of the supported admin API types
+var adminAPIs = map[string]func(config Config) (AdminAPI, error){
+	AdminAPIKeycloak: newKeycloak,
+}
+
+// Config is the configuration of an OIDC provider. Empty fields get the defaults.
+type Config struct {
+	IssuerURL    string
+	AdminAPI     string
+	AdminURL     string
+	ClientID     string
+	ClientSecret string
+	// CABundle is the PEM encoded CA bundle verifying the IdP certificate
+	CABundle       []byte
+	TrustAlias     string
+	ClusterJWKSURL string
+	Audience       string
+	// Issuer returns the issuer of the cluster, discovered from the API server when nil
+	Issuer     func(ctx context.Context) (string, error)
+	HTTPClient *http.Client
+}
+
+type IdentityHelper struct {
+	config Config
+	admin  AdminAPI
+	// clientKey identifies the cached clients of the provider
+	clientKey idp.ClientKey
+}
+
+func New(config Config) *IdentityHelper {
+	if config.AdminAPI == "" {
+		config.AdminAPI = AdminAPIKeycloak
+	}
+	if config.TrustAlias == "" {
+		config.TrustAlias = DefaultTrustAlias
+	}
+	if config.Audience == "" {
+		config.Audience = Audience
+	}
+	if config.Issuer == nil {
+		config.Issuer = k8stoken.Issuer
+	}
+	config.IssuerURL = strings.TrimSuffix(config.IssuerURL, "/")
+	return &IdentityHelper{config: config}
+}
+
+func (h *IdentityHelper) GetName() string {
+	return ProviderName
+}
+
+func (h *IdentityHelper) GetAudience() string {
+	return h.config.Audience
+}
+
+func (h *IdentityHelper) GetTokenBounds() idp.TokenBounds {
+	return idp.TokenBounds{
+		MinTTL: idp.MinTokenTTL,
+	}
+}
+
+func (h *IdentityHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	admin, err := h.getAdmin()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		"--oidc-issuer", h.config.IssuerURL,
+		"--oidc-token-endpoint", admin.TokenEndpoint(),
+		"--oidc-subject-issuer", h.config.TrustAlias,
+	}
+	if identity != nil {
+		clientID := identity.Status.Metadata[identityMetaClientID]
+		if clientID == "" {
+			return nil, fmt.Errorf("client id is not set for identity %s", identity.Name)
+		}
+		args = append(args, "--oidc-client-id", clientID)
+	}
+	return args, nil
+}
+
+// CreateIdentity federates the cluster issuer on the IdP and registers the
+// client the proxy of the identity exchanges its token with.
+func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (_ map[string]string, err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	admin, err := h.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trust, err := h.trust(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get issuer")
+		return nil, err
+	}
+	if err := admin.EnsureTrust(ctx, trust); err != nil {
+		return nil, fmt.Errorf("failed to federate issuer %s: %w", trust.Issuer, err)
+	}
+
+	client := h.client(identity)
+	id, err := admin.EnsureClient(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register client %s: %w", client.ClientID, err)
+	}
+	log.Info("Client registered", "clientId", client.ClientID, "id", id)
+
+	return map[string]string{
+		identityMetaID:       id,
+		identityMetaClientID: client.ClientID,
+	}, nil
+}
+
+// GetIdentity checks that the IdP trusts the cluster issuer and that the
+// client of the identity exists and matches the identity.
+func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (_ bool, err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	if identity.Status.Metadata[identityMetaID] == "" {
+		return false, nil
+	}
+
+	admin, err := h.login(ctx)
+	if err != nil {
+		return false, err
+	}
+	desiredTrust, err := h.trust(ctx)
+	if err != nil {
+		log.Error(err, "Failed to get issuer")
+		return false, err
+	}
+	trust, err := admin.GetTrust(ctx, desiredTrust.Alias)
+	if err != nil {
+		return false, fmt.Errorf("failed to get trust %s: %w", desiredTrust.Alias, err)
+	}
+	if trust == nil || *trust != desiredTrust {
+		log.Info("Cluster issuer is not trusted", "alias", desiredTrust.Alias, "issuer", desiredTrust.Issuer)
+		return false, nil
+	}
+
+	desired := h.client(identity)
+	client, err := admin.GetClient(ctx, desired.ClientID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get client %s: %w", desired.ClientID, err)
+	}
+	if client == nil || client.ID != identity.Status.Metadata[identityMetaID] {
+		log.Info("Client not found", "clientId", desired.ClientID)
+		return false, nil
+	}
+	for k, v := range desired.Attributes {
+		if client.Attributes[k] != v {
+			log.Info("Client drifted", "clientId", desired.ClientID, "attribute", k)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) (err error) {
+	defer h.invalidateOnAuthFailure(&err)
+	log := log.FromContext(ctx)
+
+	admin, err := h.login(ctx)
+	if err != nil {
+		return err
+	}
+	clientID := h.client(identity).ClientID
+	if err := admin.DeleteClient(ctx, clientID); err != nil {
+		return fmt.Errorf("failed to delete client %s: %w", clientID, err)
+	}
+	log.Info("Client deleted", "clientId", clientID)
+	return nil
+}
+
+// CheckHealth logs in to the admin API of the IdP. The cached login is not
+// reused, a fresh one verifies the current credentials of the operator.
+func (h *IdentityHelper) CheckHealth(ctx context.Context) idp.Health {
+	if _, _, err := h.newLogin(ctx); err != nil {
+		// the IdP answered but refused the credentials
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			return idp.Health{Reachable: true, Err: err}
+		}
+		return idp.Health{Err: err}
+	}
+	return idp.Health{Reachable: true, Authenticated: true}
+}
+
+// client is the desired client of identity. Its id is the subject of the
+// service account tokens of the identity.
+func (h *IdentityHelper) client(identity *aegisv1.Identity) Client {
+	return Client{
+		ClientID:    fmt.Sprintf("system:serviceaccount:%s:%s", identity.Namespace, identity.Name),
+		Description: fmt.Sprintf("aegis identity %s/%s", identity.Namespace, identity.Name),
+		Attributes: map[string]string{
+			attributeIdentity: identity.Namespace + "/" + identity.Name,
+		},
+	}
+}
+
+// trust is the desired trust of the cluster issuer
+func (h *IdentityHelper) trust(ctx context.Context) (Trust, error) {
+	issuer, err := h.GetIssuer(ctx)
+	if err != nil {
+		return Trust{}, err
+	}
+	jwksURL := h.config.ClusterJWKSURL
+	if jwksURL == "" {
+		jwksURL = strings.TrimSuffix(issuer, "/") + "/openid/v1/jwks"
+	}
+	return Trust{Alias: h.config.TrustAlias, Issuer: issuer, JWKSURL: jwksURL}, nil
+}
+
+// getAdmin returns the admin API of the configured type
+func (h *IdentityHelper) getAdmin() (AdminAPI, error) {
+	if h.admin != nil {
+		return h.admin, nil
+	}
+	newAdmin, ok := adminAPIs[h.config.AdminAPI]
+	if !ok {
+		return nil, fmt.Errorf("unsupported admin API %s", h.config.AdminAPI)
+	}
+	if h.config.HTTPClient == nil {
+		httpClient, err := newHTTPClient(h.config.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		h.config.HTTPClient = logging.HTTPClient(httpClient)
+	}
+	admin, err := newAdmin(h.config)
+	if err != nil {
+		return nil, err
+	}
+	h.admin = admin
+	return admin, nil
+}
+
+// login returns the admin API authenticated as the operator, shared by the
+// identities of the provider until its access token is close to expiry
+func (h *IdentityHelper) login(ctx context.Context) (AdminAPI, error) {
+	return idp.CachedClient(ctx, h.clientKey, "oidc", h.newLogin)
+}
+
+// newLogin authenticates the admin API as the operator and returns it
+// together with the expiry of its access token
+func (h *IdentityHelper) newLogin(ctx context.Context) (AdminAPI, time.Time, error) {
+	admin, err := h.getAdmin()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	expires, err := admin.Login(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return admin, expires, nil
+}
+
+// invalidateOnAuthFailure drops the cached login of the provider when the IdP
+// rejected its access token, so that the next call logs in again
+func (h *IdentityHelper) invalidateOnAuthFailure(err *error) {
+	if isAuthFailure(*err) {
+		idp.Clients.Invalidate(h.clientKey.UID)
+	}
+}
+
+// newHTTPClient returns an HTTP client trusting caBundle, or the default client
+func newHTTPClient(caBundle []byte) (*http.Client, error) {
+	if len(caBundle) == 0 {
+		return http.DefaultClient, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, fmt.Errorf("invalid CA bundle")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &http.Client{Transport: transport}, nil
+}
+
+// GetIssuer returns the issuer of the service account tokens of the cluster
+func (h *IdentityHelper) GetIssuer(ctx context.Context) (string, error) {
+	return h.config.Issuer(ctx)
+}
@@ -0,0 +1,302 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiError is an error answer of the IdP
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("idp error %d: %s", e.StatusCode, e.Message)
+}
+
+// keycloak implements AdminAPI with the Keycloak admin REST API. The operator
+// authenticates with the client credentials grant on the realm of the issuer;
+// its service account needs the manage-clients and manage-identity-providers
+// roles of realm-management.
+type keycloak struct {
+	http         *http.Client
+	baseURL      string
+	realm        string
+	clientID     string
+	clientSecret string
+	accessToken  string
+}
+
+// keycloakClient is the ClientRepresentation of the admin API
+type keycloakClient struct {
+	ID                        string            `json:"id,omitempty"`
+	ClientID                  string            `json:"clientId"`
+	Description               string            `json:"description,omitempty"`
+	Enabled                   bool              `json:"enabled"`
+	Protocol                  string            `json:"protocol,omitempty"`
+	PublicClient              bool              `json:"publicClient"`
+	StandardFlowEnabled       bool              `json:"standardFlowEnabled"`
+	DirectAccessGrantsEnabled bool              `json:"directAccessGrantsEnabled"`
+	ServiceAccountsEnabled    bool              `json:"serviceAccountsEnabled"`
+	Attributes                map[string]string `json:"attributes,omitempty"`
+}
+
+// keycloakIdentityProvider is the IdentityProviderRepresentation of the admin API
+type keycloakIdentityProvider struct {
+	Alias      string            `json:"alias"`
+	ProviderID string            `json:"providerId"`
+	Enabled    bool              `json:"enabled"`
+	Config     map[string]string `json:"config"`
+}
+
+// newKeycloak derives the base URL and the realm from the issuer
+// (https://<host>/realms/<realm>)
+func newKeycloak(config Config) (AdminAPI, error) {
+	i := strings.LastIndex(config.IssuerURL, "/realms/")
+	if i < 0 {
+		return nil, fmt.Errorf("issuer %s is not a keycloak realm", config.IssuerURL)
+	}
+	baseURL := config.AdminURL
+	if baseURL == "" {
+		baseURL = config.IssuerURL[:i]
+	}
+	return &keycloak{
+		http:         config.HTTPClient,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		realm:        config.IssuerURL[i+len("/realms/"):],
+		clientID:     config.ClientID,
+		clientSecret: config.ClientSecret,
+	}, nil
+}
+
+func (k *keycloak) TokenEndpoint() string {
+	return fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", k.baseURL, k.realm)
+}
+
+func (k *keycloak) Login(ctx context.Context) (time.Time, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {k.clientID},
+		"client_secret": {k.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.TokenEndpoint(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := k.send(req, &token); err != nil {
+		return time.Time{}, fmt.Errorf("failed to log in to keycloak: %w", err)
+	}
+	k.accessToken = token.AccessToken
+	var expires time.Time
+	if token.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return expires, nil
+}
+
+func (k *keycloak) GetTrust(ctx context.Context, alias string) (*Trust, error) {
+	provider := &keycloakIdentityProvider{}
+	if err := k.do(ctx, http.MethodGet, k.identityProviderURL(alias), nil, provider); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !provider.Enabled || provider.Config["validateSignature"] != "true" {
+		// a trust accepting any token is not the one we configured
+		return &Trust{Alias: alias}, nil
+	}
+	return &Trust{
+		Alias:   provider.Alias,
+		Issuer:  provider.Config["issuer"],
+		JWKSURL: provider.Config["jwksUrl"],
+	}, nil
+}
+
+// EnsureTrust registers the cluster issuer as an OIDC identity provider
+// validating the token signatures with the issuer keys
+func (k *keycloak) EnsureTrust(ctx context.Context, trust Trust) error {
+	desired := &keycloakIdentityProvider{
+		Alias:      trust.Alias,
+		ProviderID: "oidc",
+		Enabled:    true,
+		Config: map[string]string{
+			"issuer":            trust.Issuer,
+			"jwksUrl":           trust.JWKSURL,
+			"useJwksUrl":        "true",
+			"validateSignature": "true",
+			"disableUserInfo":   "true",
+			"clientId":          "aegis",
+			"syncMode":          "LEGACY",
+		},
+	}
+
+	current, err := k.GetTrust(ctx, trust.Alias)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return k.do(ctx, http.MethodPost, k.adminURL("/identity-provider/instances"), desired, nil)
+	}
+	if *current == trust {
+		return nil
+	}
+	return k.do(ctx, http.MethodPut, k.identityProviderURL(trust.Alias), desired, nil)
+}
+
+func (k *keycloak) GetClient(ctx context.Context, clientID string) (*Client, error) {
+	client, err := k.getClient(ctx, clientID)
+	if err != nil || client == nil {
+		return nil, err
+	}
+	return &Client{
+		ID:          client.ID,
+		ClientID:    client.ClientID,
+		Description: client.Description,
+		Attributes:  client.Attributes,
+	}, nil
+}
+
+// EnsureClient registers a public client allowed to exchange the tokens of
+// the trusted issuer
+func (k *keycloak) EnsureClient(ctx context.Context, client Client) (string, error) {
+	desired := &keycloakClient{
+		ClientID:     client.ClientID,
+		Description:  client.Description,
+		Enabled:      true,
+		Protocol:     "openid-connect",
+		PublicClient: true,
+		Attributes:   map[string]string{"standard.token.exchange.enabled": "true"},
+	}
+	for key, value := range client.Attributes {
+		desired.Attributes[key] = value
+	}
+
+	current, err := k.getClient(ctx, client.ClientID)
+	if err != nil {
+		return "", err
+	}
+	if current == nil {
+		if err := k.do(ctx, http.MethodPost, k.adminURL("/clients"), desired, nil); err != nil {
+			return "", err
+		}
+		current, err = k.getClient(ctx, client.ClientID)
+		if err != nil {
+			return "", err
+		}
+		if current == nil {
+			return "", fmt.Errorf("client %s not found after creation", client.ClientID)
+		}
+		return current.ID, nil
+	}
+
+	desired.ID = current.ID
+	if err := k.do(ctx, http.MethodPut, k.adminURL("/clients/"+current.ID), desired, nil); err != nil {
+		return "", err
+	}
+	return current.ID, nil
+}
+
+func (k *keycloak) DeleteClient(ctx context.Context, clientID string) error {
+	client, err := k.getClient(ctx, clientID)
+	if err != nil || client == nil {
+		return err
+	}
+	err = k.do(ctx, http.MethodDelete, k.adminURL("/clients/"+client.ID), nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// getClient looks up a client by client id, clientID is the public id of the
+// client while the admin API addresses clients by their internal id
+func (k *keycloak) getClient(ctx context.Context, clientID string) (*keycloakClient, error) {
+	clients := []keycloakClient{}
+	if err := k.do(ctx, http.MethodGet, k.adminURL("/clients?clientId="+url.QueryEscape(clientID)), nil, &clients); err != nil {
+		return nil, err
+	}
+	for i := range clients {
+		if clients[i].ClientID == clientID {
+			return &clients[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (k *keycloak) adminURL(path string) string {
+	return fmt.Sprintf("%s/admin/realms/%s%s", k.baseURL, k.realm, path)
+}
+
+func (k *keycloak) identityProviderURL(alias string) string {
+	return k.adminURL("/identity-provider/instances/" + url.PathEscape(alias))
+}
+
+// do sends in as the JSON body of an admin API request and decodes the answer
+// into out. in and out can be nil.
+func (k *keycloak) do(ctx context.Context, method, url string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+k.accessToken)
+	return k.send(req, out)
+}
+
+func (k *keycloak) send(req *http.Request, out interface{}) error {
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &apiError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// isNotFound reports whether err is a 404 answer of the IdP
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// isAuthFailure reports whether the IdP rejected the access token of the operator
+func isAuthFailure(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
@@ -0,0 +1,241 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+const testIssuer = "https://oidc.example.com/cluster"
+
+// fakeKeycloak is an in memory stand-in for the Keycloak admin REST API
+type fakeKeycloak struct {
+	mu        sync.Mutex
+	providers map[string]*keycloakIdentityProvider
+	clients   map[string]*keycloakClient
+	nextID    int
+	// logins counts the logins of the operator
+	logins int
+	// revoked rejects the access tokens issued
+	revoked bool
+}
+
+func (f *fakeKeycloak) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const admin = "/admin/realms/aegis"
+	path := r.URL.Path
+	if path == "/realms/aegis/protocol/openid-connect/token" {
+		_ = r.ParseForm()
+		if r.PostForm.Get("client_id") != "aegis-operator" || r.PostForm.Get("client_secret") != "secret" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized_client"})
+			return
+		}
+		f.logins++
+		writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": "admin-token", "expires_in": 300})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer admin-token" || f.revoked {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "HTTP 401 Unauthorized"})
+		return
+	}
+
+	switch {
+	case path == admin+"/identity-provider/instances" && r.Method == http.MethodPost:
+		provider := &keycloakIdentityProvider{}
+		_ = json.NewDecoder(r.Body).Decode(provider)
+		f.providers[provider.Alias] = provider
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, admin+"/identity-provider/instances/"):
+		alias := strings.TrimPrefix(path, admin+"/identity-provider/instances/")
+		if f.providers[alias] == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Could not find identity provider"})
+			return
+		}
+		if r.Method == http.MethodPut {
+			provider := &keycloakIdentityProvider{}
+			_ = json.NewDecoder(r.Body).Decode(provider)
+			f.providers[alias] = provider
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, f.providers[alias])
+	case path == admin+"/clients" && r.Method == http.MethodGet:
+		clients := []*keycloakClient{}
+		for _, client := range f.clients {
+			if client.ClientID == r.URL.Query().Get("clientId") {
+				clients = append(clients, client)
+			}
+		}
+		writeJSON(w, http.StatusOK, clients)
+	case path == admin+"/clients" && r.Method == http.MethodPost:
+		client := &keycloakClient{}
+		_ = json.NewDecoder(r.Body).Decode(client)
+		f.nextID++
+		client.ID = strings.Repeat("0", f.nextID)
+		f.clients[client.ID] = client
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, admin+"/clients/"):
+		id := strings.TrimPrefix(path, admin+"/clients/")
+		if f.clients[id] == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Could not find client"})
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			client := &keycloakClient{}
+			_ = json.NewDecoder(r.Body).Decode(client)
+			f.clients[id] = client
+		case http.MethodDelete:
+			delete(f.clients, id)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unexpected " + r.Method + " " + path})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func newTestHelper(t *testing.T, secret string) (*IdentityHelper, *fakeKeycloak) {
+	t.Helper()
+	fake := &fakeKeycloak{providers: map[string]*keycloakIdentityProvider{}, clients: map[string]*keycloakClient{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return New(Config{
+		IssuerURL:    server.URL + "/realms/aegis",
+		ClientID:     "aegis-operator",
+		ClientSecret: secret,
+		Issuer:       func(ctx context.Context) (string, error) { return testIssuer, nil },
+		HTTPClient:   server.Client(),
+	}), fake
+}
+
+func TestKeycloakIdentityLifecycle(t *testing.T) {
+	ctx := context.Background()
+	h, fake := newTestHelper(t, "secret")
+	identity := &aegisv1.Identity{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"}}
+
+	meta, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatalf("CreateIdentity() error = %v", err)
+	}
+	if meta[identityMetaClientID] != "system:serviceaccount:shop:frontend" || meta[identityMetaID] == "" {
+		t.Fatalf("unexpected metadata %v", meta)
+	}
+	identity.Status.Metadata = meta
+
+	trust := fake.providers[DefaultTrustAlias]
+	if trust == nil || trust.Config["issuer"] != testIssuer || trust.Config["jwksUrl"] != testIssuer+"/openid/v1/jwks" {
+		t.Fatalf("cluster issuer not trusted: %+v", trust)
+	}
+	if client := fake.clients[meta[identityMetaID]]; !client.PublicClient || client.Attributes[attributeIdentity] != "shop/frontend" {
+		t.Errorf("unexpected client %+v", client)
+	}
+
+	if found, err := h.GetIdentity(ctx, identity); err != nil || !found {
+		t.Fatalf("GetIdentity() = %v, %v, want true", found, err)
+	}
+
+	// a drifted trust is detected and repaired in place
+	trust.Config["validateSignature"] = "false"
+	if found, err := h.GetIdentity(ctx, identity); err != nil || found {
+		t.Fatalf("GetIdentity() with drifted trust = %v, %v, want false", found, err)
+	}
+	again, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatalf("CreateIdentity() repair error = %v", err)
+	}
+	if again[identityMetaID] != meta[identityMetaID] || len(fake.clients) != 1 {
+		t.Errorf("client recreated: %v, %d clients", again, len(fake.clients))
+	}
+	if found, err := h.GetIdentity(ctx, identity); err != nil || !found {
+		t.Fatalf("GetIdentity() after repair = %v, %v, want true", found, err)
+	}
+
+	args, err := h.GetProxyArgs(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); !strings.Contains(got, "/realms/aegis/protocol/openid-connect/token --oidc-subject-issuer kubernetes --oidc-client-id system:serviceaccount:shop:frontend") {
+		t.Errorf("unexpected proxy args %q", got)
+	}
+
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatalf("DeleteIdentity() error = %v", err)
+	}
+	if found, err := h.GetIdentity(ctx, identity); err != nil || found {
+		t.Fatalf("GetIdentity() after delete = %v, %v, want false", found, err)
+	}
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatalf("DeleteIdentity() again error = %v", err)
+	}
+}
+
+func TestKeycloakLoginCache(t *testing.T) {
+	ctx := context.Background()
+	h, fake := newTestHelper(t, "secret")
+	h.clientKey = idp.ClientKey{UID: types.UID("oidc-provider")}
+	t.Cleanup(func() { idp.Clients.Invalidate(h.clientKey.UID) })
+	identity := &aegisv1.Identity{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"}}
+	identity.Status.Metadata = map[string]string{identityMetaID: "0"}
+
+	// the operator logs in once for the identities of the provider
+	for i := 0; i < 2; i++ {
+		if _, err := h.GetIdentity(ctx, identity); err != nil {
+			t.Fatalf("GetIdentity() error = %v", err)
+		}
+	}
+	if fake.logins != 1 {
+		t.Fatalf("%d logins, want 1", fake.logins)
+	}
+
+	// a rejected access token drops the cached login
+	fake.revoked = true
+	if _, err := h.GetIdentity(ctx, identity); err == nil {
+		t.Fatal("GetIdentity() succeeded with a revoked access token")
+	}
+	fake.revoked = false
+	if _, err := h.GetIdentity(ctx, identity); err != nil {
+		t.Fatalf("GetIdentity() error = %v", err)
+	}
+	if fake.logins != 2 {
+		t.Errorf("%d logins, want 2 after the access token was rejected", fake.logins)
+	}
+}
+
+func TestKeycloakCheckHealth(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHelper(t, "secret")
+	if health := h.CheckHealth(ctx); !health.Reachable || !health.Authenticated {
+		t.Errorf("CheckHealth() = %+v, want reachable and authenticated", health)
+	}
+
+	h, _ = newTestHelper(t, "wrong")
+	if health := h.CheckHealth(ctx); !health.Reachable || health.Authenticated {
+		t.Errorf("CheckHealth() with a wrong secret = %+v, want reachable and not authenticated", health)
+	}
+}
+
+func TestUnsupportedAdminAPI(t *testing.T) {
+	h := New(Config{IssuerURL: "https://okta.example.com", AdminAPI: "okta"})
+	if _, err := h.GetProxyArgs(context.Background(), nil); err == nil {
+		t.Errorf("GetProxyArgs() with an unsupported admin API should fail")
+	}
+}
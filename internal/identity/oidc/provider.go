@@ -0,0 +1,61 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	identity.Register(identity.Provider{
+		Kind:             "OIDCProvider",
+		ClusterKind:      "ClusterOIDCProvider",
+		Name:             ProviderName,
+		Precedence:       60,
+		NewObject:        func() client.Object { return &aegisv1.OIDCProvider{} },
+		NewClusterObject: func() client.Object { return &aegisv1.ClusterOIDCProvider{} },
+		New: func(ctx context.Context, c client.Client, obj client.Object) (identity.IdentityHelper, error) {
+			var spec aegisv1.OIDCProviderSpec
+			switch provider := obj.(type) {
+			case *aegisv1.OIDCProvider:
+				spec = provider.Spec
+			case *aegisv1.ClusterOIDCProvider:
+				spec = provider.Spec.OIDCProviderSpec
+			default:
+				return nil, fmt.Errorf("expected an OIDCProvider, got %T", obj)
+			}
+
+			clientSecret, err := identity.ReadSecretKey(ctx, c, &spec.ClientSecretRef, obj.GetNamespace())
+			if err != nil {
+				return nil, err
+			}
+			config := Config{
+				IssuerURL:      spec.IssuerURL,
+				AdminAPI:       spec.AdminAPI,
+				AdminURL:       spec.AdminURL,
+				ClientID:       spec.ClientID,
+				ClientSecret:   string(clientSecret),
+				TrustAlias:     spec.TrustAlias,
+				ClusterJWKSURL: spec.ClusterJWKSURL,
+				Audience:       spec.Audience,
+			}
+			if spec.CABundleRef != nil {
+				caBundle, err := identity.ReadSecretKey(ctx, c, spec.CABundleRef, obj.GetNamespace())
+				if err != nil {
+					return nil, err
+				}
+				config.CABundle = caBundle
+			}
+			h := New(config)
+			// a rotation of the client secret or of the CA bundle invalidates the cached login
+			h.clientKey = identity.ClientKeyFor(obj, &identity.Credentials{Secret: map[string][]byte{
+				identity.CredentialClientSecret: clientSecret,
+				"caBundle":                      config.CABundle,
+			}})
+			return h, nil
+		},
+	})
+}
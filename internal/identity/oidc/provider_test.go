@@ -0,0 +1,68 @@
+package oidc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+)
+
+func TestNewClientSecretNamespace(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "keycloak", Namespace: "tenant-a"}, Data: map[string][]byte{"clientSecret": []byte("a")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "keycloak", Namespace: "tenant-b"}, Data: map[string][]byte{"clientSecret": []byte("b")}},
+	).Build()
+	provider, ok := identity.Lookup("OIDCProvider")
+	if !ok {
+		t.Fatal("OIDCProvider not registered")
+	}
+	spec := func(namespace string) aegisv1.OIDCProviderSpec {
+		return aegisv1.OIDCProviderSpec{
+			IssuerURL:       "https://keycloak.example.com/realms/aegis",
+			ClientID:        "aegis-operator",
+			ClientSecretRef: aegisv1.SecretKeyRef{Name: "keycloak", Namespace: namespace, Key: "clientSecret"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		obj     client.Object
+		wantErr string
+	}{
+		{
+			name: "same namespace",
+			obj:  &aegisv1.OIDCProvider{ObjectMeta: metav1.ObjectMeta{Name: "keycloak", Namespace: "tenant-a"}, Spec: spec("tenant-a")},
+		},
+		{
+			name:    "cross namespace",
+			obj:     &aegisv1.OIDCProvider{ObjectMeta: metav1.ObjectMeta{Name: "keycloak", Namespace: "tenant-a"}, Spec: spec("tenant-b")},
+			wantErr: "not in the namespace tenant-a",
+		},
+		{
+			name: "cluster provider",
+			obj:  &aegisv1.ClusterOIDCProvider{ObjectMeta: metav1.ObjectMeta{Name: "keycloak"}, Spec: aegisv1.ClusterOIDCProviderSpec{OIDCProviderSpec: spec("tenant-b")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.New(ctx, c, tt.obj)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+var (
+	secretReaderMu sync.RWMutex
+	secretReader   client.Reader
+)
+
+// SetSecretReader sets the reader of the secrets referenced by the providers,
+// meant to be the uncached API reader of the manager so that the operator
+// neither watches nor keeps in memory every secret of the cluster. It is
+// meant to be called once from main; until then secrets are read with the
+// client passed to the readers.
+func SetSecretReader(r client.Reader) {
+	secretReaderMu.Lock()
+	defer secretReaderMu.Unlock()
+	secretReader = r
+}
+
+// secretReaderFor returns the reader of the secrets, c when none is set
+func secretReaderFor(c client.Reader) client.Reader {
+	secretReaderMu.RLock()
+	defer secretReaderMu.RUnlock()
+	if secretReader != nil {
+		return secretReader
+	}
+	return c
+}
+
+// referencedNamespace returns the namespace of the object kind/name referenced
+// with refNamespace by a provider of namespace, empty for the cluster scoped
+// ones. The operator reads the referenced objects with its own permissions, so
+// namespaced providers can only reference the objects of their namespace.
+func referencedNamespace(kind, name, refNamespace, namespace string) (string, error) {
+	switch {
+	case namespace == "" && refNamespace == "":
+		return "", fmt.Errorf("namespace of %s %s is not set", kind, name)
+	case namespace == "":
+		return refNamespace, nil
+	case refNamespace != "" && refNamespace != namespace:
+		return "", fmt.Errorf("%s %s/%s is not in the namespace %s of the provider", kind, refNamespace, name, namespace)
+	}
+	return namespace, nil
+}
+
+// ReadSecretKey returns the value of the secret key referenced by ref.
+// namespace is the namespace of the provider, empty for the cluster scoped
+// ones; the secrets of other namespaces can only be referenced by the latter.
+func ReadSecretKey(ctx context.Context, c client.Reader, ref *aegisv1.SecretKeyRef, namespace string) ([]byte, error) {
+	namespace, err := referencedNamespace("secret", ref.Name, ref.Namespace, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{}
+	if err := secretReaderFor(c).Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, ref.Name, err)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in secret %s/%s", ref.Key, namespace, ref.Name)
+	}
+	return value, nil
+}
+
+// ReadConfigMapKey returns the value of the config map key referenced by ref.
+// namespace is the namespace of the referencing object, empty for the cluster
+// scoped providers; the config maps of other namespaces can only be
+// referenced by the latter.
+func ReadConfigMapKey(ctx context.Context, c client.Reader, ref *aegisv1.ConfigMapKeyRef, namespace string) (string, error) {
+	namespace, err := referencedNamespace("config map", ref.Name, ref.Namespace, namespace)
+	if err != nil {
+		return "", err
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, configMap); err != nil {
+		return "", fmt.Errorf("failed to get config map %s/%s: %w", namespace, ref.Name, err)
+	}
+	value, ok := configMap.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in config map %s/%s", ref.Key, namespace, ref.Name)
+	}
+	return value, nil
+}
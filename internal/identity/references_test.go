@@ -0,0 +1,64 @@
+package identity
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+func TestReadSecretKey(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "tenant-a"}, Data: map[string][]byte{"ca.crt": []byte("tenant-a")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "tenant-b"}, Data: map[string][]byte{"ca.crt": []byte("tenant-b")}},
+	).Build()
+
+	tests := []struct {
+		name      string
+		ref       aegisv1.SecretKeyRef
+		namespace string
+		want      string
+		wantErr   bool
+	}{
+		{name: "namespace of the provider", ref: aegisv1.SecretKeyRef{Name: "ca", Key: "ca.crt"}, namespace: "tenant-a", want: "tenant-a"},
+		{name: "same namespace", ref: aegisv1.SecretKeyRef{Name: "ca", Namespace: "tenant-a", Key: "ca.crt"}, namespace: "tenant-a", want: "tenant-a"},
+		{name: "other namespace", ref: aegisv1.SecretKeyRef{Name: "ca", Namespace: "tenant-b", Key: "ca.crt"}, namespace: "tenant-a", wantErr: true},
+		{name: "cluster provider", ref: aegisv1.SecretKeyRef{Name: "ca", Namespace: "tenant-b", Key: "ca.crt"}, want: "tenant-b"},
+		{name: "cluster provider without namespace", ref: aegisv1.SecretKeyRef{Name: "ca", Key: "ca.crt"}, wantErr: true},
+		{name: "missing key", ref: aegisv1.SecretKeyRef{Name: "ca", Key: "tls.crt"}, namespace: "tenant-a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadSecretKey(ctx, c, &tt.ref, tt.namespace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadSecretKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadSecretKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigMapKey(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "tenant-a"}, Data: map[string]string{"template": "tenant-a"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "tenant-b"}, Data: map[string]string{"template": "tenant-b"}},
+	).Build()
+
+	if got, err := ReadConfigMapKey(ctx, c, &aegisv1.ConfigMapKeyRef{Name: "template", Key: "template"}, "tenant-a"); err != nil || got != "tenant-a" {
+		t.Errorf("ReadConfigMapKey() = %q, %v, want the config map of the namespace", got, err)
+	}
+	if _, err := ReadConfigMapKey(ctx, c, &aegisv1.ConfigMapKeyRef{Name: "template", Namespace: "tenant-b", Key: "template"}, "tenant-a"); err == nil {
+		t.Errorf("ReadConfigMapKey() succeeded for a config map of another namespace")
+	}
+	if got, err := ReadConfigMapKey(ctx, c, &aegisv1.ConfigMapKeyRef{Name: "template", Namespace: "tenant-b", Key: "template"}, ""); err != nil || got != "tenant-b" {
+		t.Errorf("ReadConfigMapKey() = %q, %v, want the config map of the cluster provider", got, err)
+	}
+}
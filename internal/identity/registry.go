@@ -0,0 +1,139 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// IdentityHelper is implemented by every identity backend. It manages the
+// identity on the external IdP and describes how the aegis-proxy sidecar
+// must be configured to use it.
+type IdentityHelper interface {
+	CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (map[string]string, error)
+	GetIdentity(ctx context.Context, identity *aegisv1.Identity) (bool, error)
+	DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) error
+	GetName() string
+
+	// GetAudience returns the default audience of the projected service
+	// account token mounted into the aegis-proxy container.
+	GetAudience() string
+	// GetTokenBounds returns the bounds of the token lifetime and audiences
+	// that identities can set.
+	GetTokenBounds() TokenBounds
+	// GetProxyArgs returns the provider specific aegis-proxy arguments.
+	// identity is nil for ingress only proxies.
+	GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error)
+}
+
+// Provider describes an identity backend and the CRDs configuring it.
+type Provider struct {
+	// Kind is the kind of the namespaced provider CRD (e.g. AzureProvider)
+	Kind string
+	// ClusterKind is the kind of the cluster scoped provider CRD (e.g. ClusterAzureProvider)
+	ClusterKind string
+	// Name is the provider type name (e.g. azure) as returned by IdentityHelper.GetName
+	Name string
+	// Precedence orders the provider in Providers, lowest first. It decides
+	// which kind the deprecated provider name of an identity resolves to when
+	// providers of several kinds have that name. Precedences are unique.
+	Precedence int
+	// NewObject returns an empty namespaced provider CRD object
+	NewObject func() client.Object
+	// NewClusterObject returns an empty cluster scoped provider CRD object
+	NewClusterObject func() client.Object
+	// New builds the IdentityHelper from a namespaced or cluster scoped provider CRD object.
+	// c is used to read the objects referenced by the provider (e.g. secrets)
+	// and to issue the tokens of the service accounts of its credentials.
+	New func(ctx context.Context, c client.Client, obj client.Object) (IdentityHelper, error)
+}
+
+// IsClusterKind reports whether kind is the cluster scoped kind of the provider
+func (p Provider) IsClusterKind(kind string) bool {
+	return p.ClusterKind != "" && p.ClusterKind == kind
+}
+
+// NewObjectForKind returns an empty CRD object of the given provider kind
+func (p Provider) NewObjectForKind(kind string) client.Object {
+	if p.IsClusterKind(kind) {
+		return p.NewClusterObject()
+	}
+	return p.NewObject()
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{}
+)
+
+// Register adds a provider to the registry. It is meant to be called from
+// the init function of the backend package and panics on duplicates.
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if p.Kind == "" || p.Name == "" || p.NewObject == nil || p.New == nil {
+		panic(fmt.Sprintf("identity: incomplete provider registration for kind %q", p.Kind))
+	}
+	if (p.ClusterKind == "") != (p.NewClusterObject == nil) {
+		panic(fmt.Sprintf("identity: incomplete cluster provider registration for kind %q", p.Kind))
+	}
+	for _, other := range providers {
+		if other.Kind == p.Kind || other.Kind == p.ClusterKind || other.IsClusterKind(p.Kind) || other.IsClusterKind(p.ClusterKind) {
+			panic(fmt.Sprintf("identity: provider kind %q registered twice", p.Kind))
+		}
+		if other.Name == p.Name {
+			panic(fmt.Sprintf("identity: provider name %q registered twice", p.Name))
+		}
+		if other.Precedence == p.Precedence {
+			panic(fmt.Sprintf("identity: providers %q and %q have the same precedence", other.Kind, p.Kind))
+		}
+	}
+	providers[p.Kind] = p
+}
+
+// Lookup returns the provider registered for a namespaced or cluster scoped CRD kind.
+func Lookup(kind string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if p, ok := providers[kind]; ok {
+		return p, true
+	}
+	for _, p := range providers {
+		if p.IsClusterKind(kind) {
+			return p, true
+		}
+	}
+	return Provider{}, false
+}
+
+// LookupByName returns the provider registered with the given type name.
+func LookupByName(name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, p := range providers {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Provider{}, false
+}
+
+// Providers returns all registered providers sorted by precedence.
+func Providers() []Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Precedence < list[j].Precedence })
+	return list
+}
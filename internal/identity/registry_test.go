@@ -0,0 +1,37 @@
+package identity_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/aws"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/azure"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/gcp"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/hashicorpvault"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/kubernetes"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/oidc"
+	_ "github.com/vmarchese/aegis-operator/internal/identity/spire"
+)
+
+// TestProvidersOrder pins the order the deprecated provider names of the
+// identities are resolved in: the historical Vault, Azure, Kubernetes, AWS
+// lookup order, followed by the backends added later.
+func TestProvidersOrder(t *testing.T) {
+	kinds := []string{}
+	for _, p := range identity.Providers() {
+		kinds = append(kinds, p.Kind)
+	}
+	want := []string{
+		"HashicorpVaultProvider",
+		"AzureProvider",
+		"KubernetesProvider",
+		"AWSProvider",
+		"GCPProvider",
+		"OIDCProvider",
+		"SPIREProvider",
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("Providers() kinds = %v, want %v", kinds, want)
+	}
+}
@@ -0,0 +1,402 @@
+package spire
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/vmarchese/aegis-operator/internal/logging"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The SPIRE server admin API is gRPC only. The few unary calls of the Entry
+// service used by the operator are encoded by hand to avoid pulling the
+// SPIRE SDK and the gRPC stack in.
+const entryService = "/spire.api.server.entry.v1.Entry/"
+
+// gRPC status codes returned by the SPIRE server
+const (
+	codeOK       = 0
+	codeNotFound = 5
+)
+
+// grpcError is a non OK gRPC status
+type grpcError struct {
+	Code    int
+	Message string
+}
+
+func (e *grpcError) Error() string {
+	return fmt.Sprintf("spire server error %d: %s", e.Code, e.Message)
+}
+
+type selector struct {
+	Type  string
+	Value string
+}
+
+// entry is a SPIRE registration entry (spire.api.types.Entry)
+type entry struct {
+	ID        string
+	SPIFFEID  string
+	ParentID  string
+	Selectors []selector
+	// JWTSVIDTTL is the lifetime of the JWT-SVIDs in seconds, the server default when zero
+	JWTSVIDTTL int32
+}
+
+// entryClient calls the Entry service of the SPIRE server on its admin socket
+type entryClient struct {
+	http *http.Client
+	// baseURL is a placeholder: every connection is dialed on the socket
+	baseURL string
+}
+
+func newEntryClient(socketPath string) *entryClient {
+	transport := &http2.Transport{
+		// the admin socket speaks cleartext HTTP/2
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &entryClient{http: &http.Client{Transport: logging.Transport(transport)}, baseURL: "http://spire-server"}
+}
+
+// listEntries returns the entries of spiffeID, all the entries if it is empty
+func (c *entryClient) listEntries(ctx context.Context, spiffeID string) ([]entry, error) {
+	var filter []byte
+	if spiffeID != "" {
+		id, err := encodeSPIFFEID(spiffeID)
+		if err != nil {
+			return nil, err
+		}
+		filter = protowire.AppendTag(filter, 1, protowire.BytesType) // by_spiffe_id
+		filter = protowire.AppendBytes(filter, id)
+	}
+
+	entries := []entry{}
+	pageToken := ""
+	for {
+		var req []byte
+		if filter != nil {
+			req = protowire.AppendTag(req, 1, protowire.BytesType) // filter
+			req = protowire.AppendBytes(req, filter)
+		}
+		if pageToken != "" {
+			req = protowire.AppendTag(req, 4, protowire.BytesType) // page_token
+			req = protowire.AppendString(req, pageToken)
+		}
+
+		resp, err := c.call(ctx, "ListEntries", req)
+		if err != nil {
+			return nil, err
+		}
+		pageToken = ""
+		err = walkFields(resp, func(num protowire.Number, value []byte, _ uint64) error {
+			switch num {
+			case 1: // entries
+				e, err := decodeEntry(value)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, e)
+			case 2: // next_page_token
+				pageToken = string(value)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if pageToken == "" {
+			return entries, nil
+		}
+	}
+}
+
+// ping lists a single entry to check that the server answers and authorizes the operator
+func (c *entryClient) ping(ctx context.Context) error {
+	req := protowire.AppendTag(nil, 3, protowire.VarintType) // page_size
+	req = protowire.AppendVarint(req, 1)
+	_, err := c.call(ctx, "ListEntries", req)
+	return err
+}
+
+// createEntry creates e and returns it with its id
+func (c *entryClient) createEntry(ctx context.Context, e entry) (entry, error) {
+	encoded, err := encodeEntry(e)
+	if err != nil {
+		return entry{}, err
+	}
+	req := protowire.AppendTag(nil, 1, protowire.BytesType) // entries
+	req = protowire.AppendBytes(req, encoded)
+	return c.batchResult(ctx, "BatchCreateEntry", req)
+}
+
+// updateEntry replaces all the fields of the entry with the id of e
+func (c *entryClient) updateEntry(ctx context.Context, e entry) (entry, error) {
+	encoded, err := encodeEntry(e)
+	if err != nil {
+		return entry{}, err
+	}
+	req := protowire.AppendTag(nil, 1, protowire.BytesType) // entries
+	req = protowire.AppendBytes(req, encoded)
+	return c.batchResult(ctx, "BatchUpdateEntry", req)
+}
+
+// deleteEntry deletes the entry id
+func (c *entryClient) deleteEntry(ctx context.Context, id string) error {
+	req := protowire.AppendTag(nil, 1, protowire.BytesType) // ids
+	req = protowire.AppendString(req, id)
+	_, err := c.batchResult(ctx, "BatchDeleteEntry", req)
+	return err
+}
+
+// batchResult calls a batch method with a single item and returns the status
+// and the entry of its result
+func (c *entryClient) batchResult(ctx context.Context, method string, req []byte) (entry, error) {
+	resp, err := c.call(ctx, method, req)
+	if err != nil {
+		return entry{}, err
+	}
+	var result []byte
+	if err := walkFields(resp, func(num protowire.Number, value []byte, _ uint64) error {
+		if num == 1 { // results
+			result = value
+		}
+		return nil
+	}); err != nil {
+		return entry{}, err
+	}
+	if result == nil {
+		return entry{}, fmt.Errorf("%s returned no result", method)
+	}
+
+	status := &grpcError{}
+	var e entry
+	err = walkFields(result, func(num protowire.Number, value []byte, _ uint64) error {
+		switch num {
+		case 1: // status
+			return walkFields(value, func(num protowire.Number, value []byte, v uint64) error {
+				switch num {
+				case 1:
+					status.Code = int(int32(v))
+				case 2:
+					status.Message = string(value)
+				}
+				return nil
+			})
+		case 2: // entry, the id for deletions
+			if method == "BatchDeleteEntry" {
+				e.ID = string(value)
+				return nil
+			}
+			var err error
+			e, err = decodeEntry(value)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return entry{}, err
+	}
+	if status.Code != codeOK {
+		return e, status
+	}
+	return e, nil
+}
+
+// call sends a unary gRPC request and returns the response message
+func (c *entryClient) call(ctx context.Context, method string, msg []byte) ([]byte, error) {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+entryService+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &grpcError{Code: -1, Message: resp.Status}
+	}
+	// the status is in the trailers, or in the headers of trailers only responses
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc status %q", status)
+	}
+	if code != codeOK {
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+		return nil, &grpcError{Code: code, Message: message}
+	}
+
+	if len(data) < 5 {
+		return nil, fmt.Errorf("short grpc response")
+	}
+	size := binary.BigEndian.Uint32(data[1:5])
+	if data[0] != 0 || int(size) != len(data)-5 {
+		return nil, fmt.Errorf("unsupported grpc response frame")
+	}
+	return data[5:], nil
+}
+
+// walkFields calls fn for each field of the protobuf message b. value is the
+// payload of length delimited fields, v the value of varint fields.
+func walkFields(b []byte, fn func(num protowire.Number, value []byte, v uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, value, 0); err != nil {
+				return err
+			}
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, nil, v); err != nil {
+				return err
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+// encodeSPIFFEID encodes id as a spire.api.types.SPIFFEID
+func encodeSPIFFEID(id string) ([]byte, error) {
+	u, err := url.Parse(id)
+	if err != nil || u.Scheme != "spiffe" || u.Host == "" {
+		return nil, fmt.Errorf("invalid SPIFFE ID %q", id)
+	}
+	b := protowire.AppendTag(nil, 1, protowire.BytesType) // trust_domain
+	b = protowire.AppendString(b, u.Host)
+	b = protowire.AppendTag(b, 2, protowire.BytesType) // path
+	b = protowire.AppendString(b, u.Path)
+	return b, nil
+}
+
+func decodeSPIFFEID(b []byte) (string, error) {
+	var trustDomain, path string
+	err := walkFields(b, func(num protowire.Number, value []byte, _ uint64) error {
+		switch num {
+		case 1:
+			trustDomain = string(value)
+		case 2:
+			path = string(value)
+		}
+		return nil
+	})
+	return "spiffe://" + trustDomain + path, err
+}
+
+func encodeEntry(e entry) ([]byte, error) {
+	var b []byte
+	if e.ID != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, e.ID)
+	}
+	spiffeID, err := encodeSPIFFEID(e.SPIFFEID)
+	if err != nil {
+		return nil, err
+	}
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, spiffeID)
+	parentID, err := encodeSPIFFEID(e.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, parentID)
+	for _, s := range e.Selectors {
+		var sel []byte
+		sel = protowire.AppendTag(sel, 1, protowire.BytesType)
+		sel = protowire.AppendString(sel, s.Type)
+		sel = protowire.AppendTag(sel, 2, protowire.BytesType)
+		sel = protowire.AppendString(sel, s.Value)
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, sel)
+	}
+	if e.JWTSVIDTTL != 0 {
+		b = protowire.AppendTag(b, 13, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(e.JWTSVIDTTL))
+	}
+	return b, nil
+}
+
+func decodeEntry(b []byte) (entry, error) {
+	e := entry{}
+	err := walkFields(b, func(num protowire.Number, value []byte, v uint64) error {
+		var err error
+		switch num {
+		case 1:
+			e.ID = string(value)
+		case 2:
+			e.SPIFFEID, err = decodeSPIFFEID(value)
+		case 3:
+			e.ParentID, err = decodeSPIFFEID(value)
+		case 4:
+			s := selector{}
+			err = walkFields(value, func(num protowire.Number, value []byte, _ uint64) error {
+				switch num {
+				case 1:
+					s.Type = string(value)
+				case 2:
+					s.Value = string(value)
+				}
+				return nil
+			})
+			e.Selectors = append(e.Selectors, s)
+		case 13:
+			e.JWTSVIDTTL = int32(v)
+		}
+		return err
+	})
+	return e, err
+}
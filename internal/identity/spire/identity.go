@@ -0,0 +1,269 @@
+package spire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	idp "github.com/vmarchese/aegis-operator/internal/identity"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	ProviderName = "spire"
+
+	// defaults of the provider configuration
+	Audience                = "aegis"
+	DefaultServerSocketPath = "/tmp/spire-server/private/api.sock"
+	DefaultAgentSocketPath  = "/run/spire/agent-sockets/spire-agent.sock"
+
+	// workloadAPIMountPath is where the Workload API socket is mounted in the proxy
+	workloadAPIMountPath  = "/spiffe-workload-api"
+	workloadAPIVolumeName = "spiffe-workload-api"
+
+	identityMetaID       = "aegis.identity.id"
+	identityMetaSPIFFEID = "aegis.identity.spiffe.id"
+)
+
+// Config is the configuration of a SPIRE provider. Empty fields get the defaults.
+type Config struct {
+	TrustDomain      string
+	ParentID         string
+	ServerSocketPath string
+	AgentSocketPath  string
+	CSIDriver        string
+	Audience         string
+}
+
+type IdentityHelper struct {
+	config Config
+	client *entryClient
+}
+
+func New(config Config) *IdentityHelper {
+	if config.ServerSocketPath == "" {
+		config.ServerSocketPath = DefaultServerSocketPath
+	}
+	if config.AgentSocketPath == "" {
+		config.AgentSocketPath = DefaultAgentSocketPath
+	}
+	if config.Audience == "" {
+		config.Audience = Audience
+	}
+	return &IdentityHelper{config: config, client: newEntryClient(config.ServerSocketPath)}
+}
+
+func (h *IdentityHelper) GetName() string {
+	return ProviderName
+}
+
+// GetAudience returns the default audience of the JWT-SVIDs
+func (h *IdentityHelper) GetAudience() string {
+	return h.config.Audience
+}
+
+func (h *IdentityHelper) GetTokenBounds() idp.TokenBounds {
+	return idp.TokenBounds{
+		MinTTL: idp.MinTokenTTL,
+	}
+}
+
+// GetProxyArgs points the proxy to the Workload API socket and sets the
+// audiences of the JWT-SVIDs it fetches
+func (h *IdentityHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	options, err := idp.GetTokenOptions(h, identity)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		"--spiffe-endpoint-socket", "unix://" + workloadAPIMountPath + "/" + filepath.Base(h.config.AgentSocketPath),
+		"--spiffe-trust-domain", h.config.TrustDomain,
+	}
+	for _, audience := range options.Audiences {
+		args = append(args, "--jwt-svid-audience", audience)
+	}
+	if identity != nil {
+		spiffeID := identity.Status.Metadata[identityMetaSPIFFEID]
+		if spiffeID == "" {
+			return nil, fmt.Errorf("SPIFFE ID is not set for identity %s", identity.Name)
+		}
+		args = append(args, "--spiffe-id", spiffeID)
+	}
+	return args, nil
+}
+
+// GetProxyVolume returns the Workload API socket of the SPIRE agent, which
+// replaces the projected service account token of the proxy
+func (h *IdentityHelper) GetProxyVolume() idp.ProxyVolume {
+	volume := corev1.Volume{Name: workloadAPIVolumeName}
+	if h.config.CSIDriver != "" {
+		readOnly := true
+		volume.VolumeSource = corev1.VolumeSource{
+			CSI: &corev1.CSIVolumeSource{Driver: h.config.CSIDriver, ReadOnly: &readOnly},
+		}
+	} else {
+		hostPathType := corev1.HostPathDirectory
+		volume.VolumeSource = corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: filepath.Dir(h.config.AgentSocketPath), Type: &hostPathType},
+		}
+	}
+	return idp.ProxyVolume{Volume: volume, MountPath: workloadAPIMountPath}
+}
+
+// CreateIdentity registers the SPIFFE ID of the identity for the pods running
+// with its service account, or updates its registration entry if it drifted
+func (h *IdentityHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (map[string]string, error) {
+	log := log.FromContext(ctx)
+
+	desired, err := h.entry(identity)
+	if err != nil {
+		return nil, err
+	}
+	current, err := h.findEntry(ctx, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case current == nil:
+		log.Info("Creating registration entry", "spiffeId", desired.SPIFFEID)
+		created, err := h.client.createEntry(ctx, desired)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create registration entry for %s: %w", desired.SPIFFEID, err)
+		}
+		current = &created
+	case !entryMatches(current, &desired):
+		log.Info("Updating registration entry", "spiffeId", desired.SPIFFEID, "id", current.ID)
+		desired.ID = current.ID
+		if _, err := h.client.updateEntry(ctx, desired); err != nil {
+			return nil, fmt.Errorf("failed to update registration entry %s: %w", current.ID, err)
+		}
+	}
+
+	return map[string]string{
+		identityMetaID:       current.ID,
+		identityMetaSPIFFEID: desired.SPIFFEID,
+	}, nil
+}
+
+// GetIdentity checks that the registration entry of the identity exists and
+// matches the identity
+func (h *IdentityHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (bool, error) {
+	log := log.FromContext(ctx)
+
+	id := identity.Status.Metadata[identityMetaID]
+	if id == "" {
+		return false, nil
+	}
+	desired, err := h.entry(identity)
+	if err != nil {
+		return false, err
+	}
+	current, err := h.findEntry(ctx, desired)
+	if err != nil {
+		return false, err
+	}
+	if current == nil || current.ID != id {
+		log.Info("Registration entry not found", "spiffeId", desired.SPIFFEID, "id", id)
+		return false, nil
+	}
+	if !entryMatches(current, &desired) {
+		log.Info("Registration entry drifted", "spiffeId", desired.SPIFFEID, "id", id)
+		return false, nil
+	}
+	return true, nil
+}
+
+// DeleteIdentity deletes the registration entry of the identity
+func (h *IdentityHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) error {
+	log := log.FromContext(ctx)
+
+	desired, err := h.entry(identity)
+	if err != nil {
+		return err
+	}
+	current, err := h.findEntry(ctx, desired)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		log.Info("Registration entry already deleted", "spiffeId", desired.SPIFFEID)
+		return nil
+	}
+	if err := h.client.deleteEntry(ctx, current.ID); err != nil {
+		var grpcErr *grpcError
+		if errors.As(err, &grpcErr) && grpcErr.Code == codeNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to delete registration entry %s: %w", current.ID, err)
+	}
+	log.Info("Registration entry deleted", "spiffeId", desired.SPIFFEID, "id", current.ID)
+	return nil
+}
+
+// CheckHealth lists the entries on the admin socket of the SPIRE server
+func (h *IdentityHelper) CheckHealth(ctx context.Context) idp.Health {
+	if err := h.client.ping(ctx); err != nil {
+		// the server answered but refused the call
+		var grpcErr *grpcError
+		if errors.As(err, &grpcErr) {
+			return idp.Health{Reachable: true, Err: err}
+		}
+		return idp.Health{Err: err}
+	}
+	return idp.Health{Reachable: true, Authenticated: true}
+}
+
+// entry is the desired registration entry of identity
+func (h *IdentityHelper) entry(identity *aegisv1.Identity) (entry, error) {
+	options, err := idp.GetTokenOptions(h, identity)
+	if err != nil {
+		return entry{}, err
+	}
+	return entry{
+		SPIFFEID: fmt.Sprintf("spiffe://%s/ns/%s/sa/%s", h.config.TrustDomain, identity.Namespace, identity.Name),
+		ParentID: h.config.ParentID,
+		Selectors: []selector{
+			{Type: "k8s", Value: "ns:" + identity.Namespace},
+			{Type: "k8s", Value: "sa:" + identity.Name},
+		},
+		JWTSVIDTTL: int32(options.TTL.Seconds()),
+	}, nil
+}
+
+// findEntry returns the entry with the SPIFFE ID and the parent of desired, nil if not found
+func (h *IdentityHelper) findEntry(ctx context.Context, desired entry) (*entry, error) {
+	entries, err := h.client.listEntries(ctx, desired.SPIFFEID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list registration entries of %s: %w", desired.SPIFFEID, err)
+	}
+	for i := range entries {
+		if entries[i].ParentID == desired.ParentID {
+			return &entries[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// entryMatches reports whether the selectors and the JWT-SVID lifetime of current match desired
+func entryMatches(current, desired *entry) bool {
+	if current.JWTSVIDTTL != desired.JWTSVIDTTL || len(current.Selectors) != len(desired.Selectors) {
+		return false
+	}
+	for _, s := range desired.Selectors {
+		found := false
+		for _, c := range current.Selectors {
+			if c == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,229 @@
+package spire
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+// fakeServer is an in memory stand-in for the Entry service of the SPIRE server
+type fakeServer struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	nextID  int
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	msg := body[5:]
+	var resp []byte
+	switch strings.TrimPrefix(r.URL.Path, entryService) {
+	case "ListEntries":
+		var spiffeID string
+		_ = walkFields(msg, func(num protowire.Number, value []byte, _ uint64) error {
+			if num == 1 { // filter
+				return walkFields(value, func(num protowire.Number, value []byte, _ uint64) error {
+					var err error
+					if num == 1 {
+						spiffeID, err = decodeSPIFFEID(value)
+					}
+					return err
+				})
+			}
+			return nil
+		})
+		for _, e := range f.entries {
+			if spiffeID == "" || e.SPIFFEID == spiffeID {
+				encoded, _ := encodeEntry(e)
+				resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+				resp = protowire.AppendBytes(resp, encoded)
+			}
+		}
+	case "BatchCreateEntry", "BatchUpdateEntry":
+		_ = walkFields(msg, func(num protowire.Number, value []byte, _ uint64) error {
+			if num != 1 {
+				return nil
+			}
+			e, err := decodeEntry(value)
+			if err != nil {
+				return err
+			}
+			if e.ID == "" {
+				f.nextID++
+				e.ID = fmt.Sprintf("entry-%d", f.nextID)
+			}
+			f.entries[e.ID] = e
+			encoded, _ := encodeEntry(e)
+			result := protowire.AppendTag(nil, 2, protowire.BytesType)
+			result = protowire.AppendBytes(result, encoded)
+			resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+			resp = protowire.AppendBytes(resp, result)
+			return nil
+		})
+	case "BatchDeleteEntry":
+		_ = walkFields(msg, func(num protowire.Number, value []byte, _ uint64) error {
+			id := string(value)
+			var result []byte
+			if _, ok := f.entries[id]; ok {
+				delete(f.entries, id)
+			} else {
+				status := protowire.AppendTag(nil, 1, protowire.VarintType)
+				status = protowire.AppendVarint(status, codeNotFound)
+				result = protowire.AppendTag(result, 1, protowire.BytesType)
+				result = protowire.AppendBytes(result, status)
+			}
+			result = protowire.AppendTag(result, 2, protowire.BytesType)
+			result = protowire.AppendString(result, id)
+			resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+			resp = protowire.AppendBytes(resp, result)
+			return nil
+		})
+	default:
+		w.Header().Set("Grpc-Status", "12")
+		w.Header().Set("Grpc-Message", "unimplemented")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status")
+	frame := make([]byte, 5, 5+len(resp))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+	_, _ = w.Write(append(frame, resp...))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func newTestHelper(t *testing.T) (*IdentityHelper, *fakeServer) {
+	t.Helper()
+	// unix socket paths are limited to ~100 characters
+	dir, err := os.MkdirTemp("", "spire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "api.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeServer{entries: map[string]entry{}}
+	server := &http.Server{Handler: h2c.NewHandler(fake, &http2.Server{}), ReadHeaderTimeout: time.Second}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { server.Close() })
+
+	return New(Config{
+		TrustDomain:      "example.org",
+		ParentID:         "spiffe://example.org/spire/agent/k8s_psat/cluster",
+		ServerSocketPath: socketPath,
+	}), fake
+}
+
+func TestRegistrationEntryLifecycle(t *testing.T) {
+	ctx := context.Background()
+	h, fake := newTestHelper(t)
+	identity := &aegisv1.Identity{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"},
+		Spec:       aegisv1.IdentitySpec{TokenTTL: &metav1.Duration{Duration: time.Hour}},
+	}
+
+	meta, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatalf("CreateIdentity() error = %v", err)
+	}
+	if meta[identityMetaSPIFFEID] != "spiffe://example.org/ns/shop/sa/frontend" {
+		t.Fatalf("unexpected SPIFFE ID %q", meta[identityMetaSPIFFEID])
+	}
+	identity.Status.Metadata = meta
+	e := fake.entries[meta[identityMetaID]]
+	if e.ParentID != h.config.ParentID || e.JWTSVIDTTL != 3600 || len(e.Selectors) != 2 {
+		t.Fatalf("unexpected registration entry %+v", e)
+	}
+
+	if found, err := h.GetIdentity(ctx, identity); err != nil || !found {
+		t.Fatalf("GetIdentity() = %v, %v, want true", found, err)
+	}
+
+	// a drifted entry is detected and updated in place
+	e.Selectors = e.Selectors[:1]
+	fake.entries[e.ID] = e
+	if found, err := h.GetIdentity(ctx, identity); err != nil || found {
+		t.Fatalf("GetIdentity() with drifted entry = %v, %v, want false", found, err)
+	}
+	again, err := h.CreateIdentity(ctx, identity)
+	if err != nil {
+		t.Fatalf("CreateIdentity() repair error = %v", err)
+	}
+	if again[identityMetaID] != meta[identityMetaID] || len(fake.entries) != 1 {
+		t.Errorf("entry recreated: %v, %d entries", again, len(fake.entries))
+	}
+	if found, err := h.GetIdentity(ctx, identity); err != nil || !found {
+		t.Fatalf("GetIdentity() after repair = %v, %v, want true", found, err)
+	}
+
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatalf("DeleteIdentity() error = %v", err)
+	}
+	if len(fake.entries) != 0 {
+		t.Errorf("entry not deleted: %+v", fake.entries)
+	}
+	if err := h.DeleteIdentity(ctx, identity); err != nil {
+		t.Fatalf("DeleteIdentity() again error = %v", err)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHelper(t)
+	if health := h.CheckHealth(ctx); !health.Reachable || !health.Authenticated {
+		t.Errorf("CheckHealth() = %+v, want reachable and authenticated", health)
+	}
+
+	unreachable := New(Config{ServerSocketPath: filepath.Join(os.TempDir(), "missing-spire.sock")})
+	if health := unreachable.CheckHealth(ctx); health.Reachable {
+		t.Errorf("CheckHealth() without server = %+v, want unreachable", health)
+	}
+}
+
+func TestProxyVolumeAndArgs(t *testing.T) {
+	h := New(Config{TrustDomain: "example.org", CSIDriver: "csi.spiffe.io"})
+	volume := h.GetProxyVolume()
+	if volume.Volume.CSI == nil || volume.Volume.CSI.Driver != "csi.spiffe.io" || volume.MountPath != workloadAPIMountPath {
+		t.Errorf("unexpected proxy volume %+v", volume)
+	}
+	if hostPath := New(Config{}).GetProxyVolume().Volume.HostPath; hostPath == nil || hostPath.Path != "/run/spire/agent-sockets" {
+		t.Errorf("unexpected host path volume %+v", hostPath)
+	}
+
+	identity := &aegisv1.Identity{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "shop"},
+		Spec:       aegisv1.IdentitySpec{Audiences: []string{"orders"}},
+		Status:     aegisv1.IdentityStatus{Metadata: map[string]string{identityMetaSPIFFEID: "spiffe://example.org/ns/shop/sa/frontend"}},
+	}
+	args, err := h.GetProxyArgs(context.Background(), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--spiffe-endpoint-socket unix:///spiffe-workload-api/spire-agent.sock --spiffe-trust-domain example.org --jwt-svid-audience orders --spiffe-id spiffe://example.org/ns/shop/sa/frontend"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("GetProxyArgs() = %q, want %q", got, want)
+	}
+}
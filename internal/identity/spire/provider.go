@@ -0,0 +1,40 @@
+package spire
+
+import (
+	"context"
+	"fmt"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+	"github.com/vmarchese/aegis-operator/internal/identity"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	identity.Register(identity.Provider{
+		Kind:             "SPIREProvider",
+		ClusterKind:      "ClusterSPIREProvider",
+		Name:             ProviderName,
+		Precedence:       70,
+		NewObject:        func() client.Object { return &aegisv1.SPIREProvider{} },
+		NewClusterObject: func() client.Object { return &aegisv1.ClusterSPIREProvider{} },
+		New: func(ctx context.Context, c client.Client, obj client.Object) (identity.IdentityHelper, error) {
+			var spec aegisv1.SPIREProviderSpec
+			switch provider := obj.(type) {
+			case *aegisv1.SPIREProvider:
+				spec = provider.Spec
+			case *aegisv1.ClusterSPIREProvider:
+				spec = provider.Spec.SPIREProviderSpec
+			default:
+				return nil, fmt.Errorf("expected a SPIREProvider, got %T", obj)
+			}
+			return New(Config{
+				TrustDomain:      spec.TrustDomain,
+				ParentID:         spec.ParentID,
+				ServerSocketPath: spec.ServerSocketPath,
+				AgentSocketPath:  spec.AgentSocketPath,
+				CSIDriver:        spec.CSIDriver,
+				Audience:         spec.Audience,
+			}), nil
+		},
+	})
+}
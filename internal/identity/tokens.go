@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"fmt"
+	"time"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+// MinTokenTTL is the minimum lifetime of the service account tokens accepted by the TokenRequest API
+const MinTokenTTL = 10 * time.Minute
+
+// TokenBounds are the provider specific bounds of the token options of an identity
+type TokenBounds struct {
+	MinTTL time.Duration
+	// MaxTTL is the maximum token lifetime, unbounded when zero
+	MaxTTL time.Duration
+	// MaxAudiences is the maximum number of audiences, unbounded when zero
+	MaxAudiences int
+}
+
+// TokenOptions are the lifetime and the audiences of the tokens of an identity
+type TokenOptions struct {
+	// TTL is the token lifetime set on the identity, zero when the provider default applies
+	TTL time.Duration
+	// Audiences are the token audiences. The first one is the audience of the
+	// service account token projected into the proxy.
+	Audiences []string
+}
+
+// TTLOrDefault returns the token lifetime, or def if the identity does not set one
+func (o TokenOptions) TTLOrDefault(def time.Duration) time.Duration {
+	if o.TTL == 0 {
+		return def
+	}
+	return o.TTL
+}
+
+// GetTokenOptions returns the token options of identity, defaulted from the
+// provider and validated against its bounds. identity is nil for ingress only
+// proxies, which get the provider defaults.
+func GetTokenOptions(h IdentityHelper, identity *aegisv1.Identity) (TokenOptions, error) {
+	options := TokenOptions{Audiences: []string{h.GetAudience()}}
+	if identity == nil {
+		return options, nil
+	}
+	bounds := h.GetTokenBounds()
+
+	if identity.Spec.TokenTTL != nil {
+		ttl := identity.Spec.TokenTTL.Duration
+		if ttl < bounds.MinTTL {
+			return options, fmt.Errorf("tokenTTL %s of identity %s is shorter than %s, the minimum of provider %s", ttl, identity.Name, bounds.MinTTL, h.GetName())
+		}
+		if bounds.MaxTTL > 0 && ttl > bounds.MaxTTL {
+			return options, fmt.Errorf("tokenTTL %s of identity %s is longer than %s, the maximum of provider %s", ttl, identity.Name, bounds.MaxTTL, h.GetName())
+		}
+		options.TTL = ttl
+	}
+
+	if len(identity.Spec.Audiences) > 0 {
+		if bounds.MaxAudiences > 0 && len(identity.Spec.Audiences) > bounds.MaxAudiences {
+			return options, fmt.Errorf("identity %s has %d audiences, provider %s accepts at most %d", identity.Name, len(identity.Spec.Audiences), h.GetName(), bounds.MaxAudiences)
+		}
+		options.Audiences = identity.Spec.Audiences
+	}
+	return options, nil
+}
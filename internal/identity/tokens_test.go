@@ -0,0 +1,72 @@
+package identity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	aegisv1 "github.com/vmarchese/aegis-operator/api/v1"
+)
+
+type fakeHelper struct {
+	bounds TokenBounds
+}
+
+func (h *fakeHelper) CreateIdentity(ctx context.Context, identity *aegisv1.Identity) (map[string]string, error) {
+	return nil, nil
+}
+func (h *fakeHelper) GetIdentity(ctx context.Context, identity *aegisv1.Identity) (bool, error) {
+	return true, nil
+}
+func (h *fakeHelper) DeleteIdentity(ctx context.Context, identity *aegisv1.Identity) error {
+	return nil
+}
+func (h *fakeHelper) GetName() string             { return "fake" }
+func (h *fakeHelper) GetAudience() string         { return "fake-audience" }
+func (h *fakeHelper) GetTokenBounds() TokenBounds { return h.bounds }
+func (h *fakeHelper) GetProxyArgs(ctx context.Context, identity *aegisv1.Identity) ([]string, error) {
+	return nil, nil
+}
+
+func TestGetTokenOptions(t *testing.T) {
+	helper := &fakeHelper{bounds: TokenBounds{MinTTL: MinTokenTTL, MaxTTL: 24 * time.Hour, MaxAudiences: 1}}
+
+	tests := []struct {
+		name          string
+		identity      *aegisv1.Identity
+		wantTTL       time.Duration
+		wantAudiences []string
+		wantErr       bool
+	}{
+		{name: "ingress proxy", wantAudiences: []string{"fake-audience"}},
+		{name: "provider defaults", identity: &aegisv1.Identity{}, wantAudiences: []string{"fake-audience"}},
+		{
+			name:          "identity options",
+			identity:      &aegisv1.Identity{Spec: aegisv1.IdentitySpec{TokenTTL: &metav1.Duration{Duration: time.Hour}, Audiences: []string{"api"}}},
+			wantTTL:       time.Hour,
+			wantAudiences: []string{"api"},
+		},
+		{name: "ttl too short", identity: &aegisv1.Identity{Spec: aegisv1.IdentitySpec{TokenTTL: &metav1.Duration{Duration: time.Minute}}}, wantErr: true},
+		{name: "ttl too long", identity: &aegisv1.Identity{Spec: aegisv1.IdentitySpec{TokenTTL: &metav1.Duration{Duration: 48 * time.Hour}}}, wantErr: true},
+		{name: "too many audiences", identity: &aegisv1.Identity{Spec: aegisv1.IdentitySpec{Audiences: []string{"a", "b"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := GetTokenOptions(helper, tt.identity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetTokenOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if options.TTL != tt.wantTTL {
+				t.Errorf("TTL = %s, want %s", options.TTL, tt.wantTTL)
+			}
+			if len(options.Audiences) != len(tt.wantAudiences) || options.Audiences[0] != tt.wantAudiences[0] {
+				t.Errorf("Audiences = %v, want %v", options.Audiences, tt.wantAudiences)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package identity
+
+import corev1 "k8s.io/api/core/v1"
+
+// ProxyVolume is a volume mounted into the aegis-proxy container
+type ProxyVolume struct {
+	Volume    corev1.Volume
+	MountPath string
+}
+
+// ProxyVolumeProvider is implemented by the backends whose proxy does not
+// authenticate with a projected service account token (e.g. SPIRE, whose proxy
+// fetches JWT-SVIDs from the Workload API socket). It is optional: the
+// projected token is mounted for the backends not implementing it.
+type ProxyVolumeProvider interface {
+	GetProxyVolume() ProxyVolume
+}
+
+// AdditionalProxyVolumeProvider is implemented by the backends mounting
+// volumes into the aegis-proxy container besides its token volume (e.g. the
+// key set the Kubernetes proxies validate the tokens with offline). The
+// volumes are mounted read only.
+type AdditionalProxyVolumeProvider interface {
+	GetAdditionalProxyVolumes() []ProxyVolume
+}
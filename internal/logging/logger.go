@@ -0,0 +1,58 @@
+package logging
+
+import "github.com/go-logr/logr"
+
+// NewRedactingLogger returns a logger redacting the secrets of the messages,
+// the errors and the values logged with logger. It is meant to wrap the
+// logger of the manager, so that the loggers of the controllers and of the
+// identity backends, derived from it, are redacted too.
+func NewRedactingLogger(logger logr.Logger) logr.Logger {
+	sink := logger.GetSink()
+	if sink == nil {
+		return logger
+	}
+	// skip the frame of the redacting sink when reporting the caller
+	if withCallDepth, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = withCallDepth.WithCallDepth(1)
+	}
+	return logr.New(&redactingSink{sink: sink})
+}
+
+// redactingSink redacts the log lines before passing them to the wrapped sink
+type redactingSink struct {
+	sink logr.LogSink
+}
+
+// Init does not initialize the wrapped sink again: it was initialized by its
+// logger and the frame of the redacting sink is skipped with WithCallDepth.
+func (s *redactingSink) Init(info logr.RuntimeInfo) {}
+
+func (s *redactingSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *redactingSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.sink.Info(level, RedactString(msg), RedactKeysAndValues(keysAndValues)...)
+}
+
+func (s *redactingSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if err != nil {
+		err = redactedError{err: err}
+	}
+	s.sink.Error(err, RedactString(msg), RedactKeysAndValues(keysAndValues)...)
+}
+
+func (s *redactingSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &redactingSink{sink: s.sink.WithValues(RedactKeysAndValues(keysAndValues)...)}
+}
+
+func (s *redactingSink) WithName(name string) logr.LogSink {
+	return &redactingSink{sink: s.sink.WithName(name)}
+}
+
+func (s *redactingSink) WithCallDepth(depth int) logr.LogSink {
+	if withCallDepth, ok := s.sink.(logr.CallDepthLogSink); ok {
+		return &redactingSink{sink: withCallDepth.WithCallDepth(depth)}
+	}
+	return s
+}
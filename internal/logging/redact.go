@@ -0,0 +1,195 @@
+// Package logging redacts the secrets (tokens, client secrets, JWTs) out of
+// the logs of the operator and logs the calls to the provider APIs.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Redacted replaces the redacted values
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are the keys, normalized by normalizeKey, whose values are always redacted
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"apikey":        true,
+	"privatekey":    true,
+	"secretid":      true,
+	"credentials":   true,
+}
+
+// sensitiveSuffixes are the suffixes of the normalized keys whose values are redacted
+var sensitiveSuffixes = []string{"token", "secret", "password", "jwt", "assertion", "secretaccesskey"}
+
+// sensitivePatterns match the secrets embedded in free text. The groups, when
+// present, surround the secret and are kept.
+var sensitivePatterns = []*regexp.Regexp{
+	// JWTs (header.payload.signature)
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	// Vault service, batch and recovery tokens
+	regexp.MustCompile(`\bhv[sbr]\.[A-Za-z0-9_-]{20,}`),
+	// bearer and basic authorization headers
+	regexp.MustCompile(`(?i)(\b(?:bearer|basic)\s+)[A-Za-z0-9._~+/-]+=*`),
+	// secrets in query strings and form bodies
+	regexp.MustCompile(`(?i)(\b(?:[a-z_]*token|[a-z_]*secret|secret_id|password|client_assertion|jwt)=)[^&\s"]+`),
+	// secrets in JSON documents
+	regexp.MustCompile(`(?i)("(?:[a-z_]*token|[a-z_]*secret|[a-z_]*password|secret_?id|jwt|client_?assertion)"\s*:\s*")[^"]*(")`),
+}
+
+// normalizeKey lower cases key and drops its separators, so that clientSecret,
+// client_secret and client-secret are the same key
+func normalizeKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "", ".", "", " ", "").Replace(strings.ToLower(key))
+}
+
+// IsSensitiveKey reports whether the values of key are redacted
+func IsSensitiveKey(key string) bool {
+	key = normalizeKey(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactString redacts the secrets matched by the sensitive patterns in s
+func RedactString(s string) string {
+	for _, pattern := range sensitivePatterns {
+		switch pattern.NumSubexp() {
+		case 0:
+			s = pattern.ReplaceAllString(s, Redacted)
+		case 1:
+			s = pattern.ReplaceAllString(s, "${1}"+Redacted)
+		default:
+			s = pattern.ReplaceAllString(s, "${1}"+Redacted+"${2}")
+		}
+	}
+	return s
+}
+
+// RedactValue returns value with the secrets redacted. Maps and structs are
+// redacted by key, strings, errors and other types by pattern.
+func RedactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, time.Duration, time.Time:
+		return v
+	case string:
+		return RedactString(v)
+	case []byte:
+		return RedactString(string(v))
+	case error:
+		return redactedError{err: v}
+	case logr.Marshaler:
+		return RedactValue(v.MarshalLog())
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for key, value := range v {
+			if IsSensitiveKey(key) {
+				redacted[key] = Redacted
+			} else {
+				redacted[key] = RedactString(value)
+			}
+		}
+		return redacted
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if IsSensitiveKey(key) {
+				redacted[key] = Redacted
+			} else {
+				redacted[key] = RedactValue(value)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = RedactValue(value)
+		}
+		return redacted
+	case []string:
+		redacted := make([]string, len(v))
+		for i, value := range v {
+			redacted[i] = RedactString(value)
+		}
+		return redacted
+	case fmt.Stringer:
+		return RedactString(v.String())
+	}
+
+	// the other values are redacted by key through their JSON form
+	kind := reflect.Indirect(reflect.ValueOf(value)).Kind()
+	if kind == reflect.Struct || kind == reflect.Map || kind == reflect.Slice || kind == reflect.Array {
+		if data, err := json.Marshal(value); err == nil {
+			var generic interface{}
+			if err := json.Unmarshal(data, &generic); err == nil {
+				return RedactValue(generic)
+			}
+		}
+	}
+	return RedactString(fmt.Sprintf("%v", value))
+}
+
+// RedactKeysAndValues redacts the key value pairs of a log line
+func RedactKeysAndValues(keysAndValues []interface{}) []interface{} {
+	if len(keysAndValues) == 0 {
+		return keysAndValues
+	}
+	redacted := make([]interface{}, len(keysAndValues))
+	for i := 0; i < len(keysAndValues); i += 2 {
+		redacted[i] = keysAndValues[i]
+		if i+1 == len(keysAndValues) {
+			break
+		}
+		if key, ok := keysAndValues[i].(string); ok && IsSensitiveKey(key) {
+			redacted[i+1] = Redacted
+		} else {
+			redacted[i+1] = RedactValue(keysAndValues[i+1])
+		}
+	}
+	return redacted
+}
+
+// RedactURL redacts the sensitive query parameters and the user info of rawURL
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return RedactString(rawURL)
+	}
+	if u.User != nil {
+		u.User = url.User(Redacted)
+	}
+	query := u.Query()
+	for key := range query {
+		if IsSensitiveKey(key) {
+			query.Set(key, Redacted)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return RedactString(u.String())
+}
+
+// redactedError redacts the message of the wrapped error
+type redactedError struct {
+	err error
+}
+
+func (e redactedError) Error() string {
+	return RedactString(e.err.Error())
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
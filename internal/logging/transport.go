@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// maxLoggedBody is the maximum length of the logged request and response bodies
+const maxLoggedBody = 4096
+
+var providerCalls atomic.Bool
+
+// SetProviderCallLogging enables the logging of the requests to the provider
+// APIs and of their responses, with the secrets redacted
+func SetProviderCallLogging(enabled bool) {
+	providerCalls.Store(enabled)
+}
+
+// ProviderCallLogging reports whether the calls to the provider APIs are logged
+func ProviderCallLogging() bool {
+	return providerCalls.Load()
+}
+
+// Doer is the HTTP client interface of the Azure and AWS SDKs
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Transport wraps base, http.DefaultTransport when nil, to log the provider
+// API calls when enabled
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &loggingTransport{next: base.RoundTrip}
+}
+
+// HTTPClient returns a copy of client, http.DefaultClient when nil, logging
+// the provider API calls when enabled
+func HTTPClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	wrapped := *client
+	wrapped.Transport = Transport(client.Transport)
+	return &wrapped
+}
+
+// WrapDoer wraps the HTTP client of an SDK to log the provider API calls when enabled
+func WrapDoer(doer Doer) Doer {
+	return &loggingTransport{next: doer.Do}
+}
+
+type loggingTransport struct {
+	next func(req *http.Request) (*http.Response, error)
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.do(req)
+}
+
+func (t *loggingTransport) Do(req *http.Request) (*http.Response, error) {
+	return t.do(req)
+}
+
+func (t *loggingTransport) do(req *http.Request) (*http.Response, error) {
+	if !ProviderCallLogging() {
+		return t.next(req)
+	}
+	log := log.FromContext(req.Context()).WithName("provider-api")
+
+	keysAndValues := []interface{}{"method", req.Method, "url", RedactURL(req.URL.String())}
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(body, maxLoggedBody+1))
+			body.Close()
+			keysAndValues = append(keysAndValues, "request", redactBody(req.Header.Get("Content-Type"), data))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next(req)
+	keysAndValues = append(keysAndValues, "duration", time.Since(start))
+	if err != nil {
+		log.Info("Provider API call failed", append(keysAndValues, "error", err.Error())...)
+		return resp, err
+	}
+
+	data, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if readErr != nil {
+		return resp, readErr
+	}
+	keysAndValues = append(keysAndValues, "status", resp.StatusCode, "response", redactBody(resp.Header.Get("Content-Type"), data))
+	log.Info("Provider API call", keysAndValues...)
+	return resp, nil
+}
+
+// redactBody returns the redacted text of a JSON, form or text body, or its
+// size for the other content types
+func redactBody(contentType string, data []byte) interface{} {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	truncated := len(data) > maxLoggedBody
+	if truncated {
+		data = data[:maxLoggedBody]
+	}
+
+	var text string
+	switch {
+	case mediaType == "application/json" || (len(mediaType) > 5 && mediaType[len(mediaType)-5:] == "+json"):
+		var generic interface{}
+		if !truncated && json.Unmarshal(data, &generic) == nil {
+			redacted, _ := json.Marshal(RedactValue(generic))
+			return string(redacted)
+		}
+		text = RedactString(string(data))
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			text = RedactString(string(data))
+			break
+		}
+		for key := range values {
+			if IsSensitiveKey(key) {
+				values.Set(key, Redacted)
+			}
+		}
+		text = RedactString(values.Encode())
+	case mediaType == "" && len(data) == 0:
+		return ""
+	case len(mediaType) > 5 && mediaType[:5] == "text/":
+		text = RedactString(string(data))
+	default:
+		return map[string]interface{}{"contentType": contentType, "size": len(data)}
+	}
+	if truncated {
+		text += "..."
+	}
+	return text
+}